@@ -34,6 +34,7 @@ func newCliApp() *cliv3.Command {
 			backupCreateCmd(),
 			backupRestoreCmd(),
 			restoreCommandCmd(),
+			repoCmd(),
 			validateCmd(),
 		},
 	}
@@ -100,6 +101,7 @@ func daemonCmd() *cliv3.Command {
 					ListenPort:       cfg.Main.ListenPort,
 					Slot:             cfg.Receiver.Slot,
 					NoLoop:           cfg.Receiver.NoLoop,
+					WALLayout:        cfg.Storage.WALLayout,
 				})
 				if err != nil {
 					return err
@@ -108,8 +110,10 @@ func daemonCmd() *cliv3.Command {
 
 			if mode == config.ModeServe {
 				err := cmd.RunServeMode(&cmd.ServeModeOpts{
-					Directory:  filepath.ToSlash(cfg.Main.Directory),
-					ListenPort: cfg.Main.ListenPort,
+					Directory:     filepath.ToSlash(cfg.Main.Directory),
+					ListenPort:    cfg.Main.ListenPort,
+					WALLayout:     cfg.Storage.WALLayout,
+					AllowUnsigned: cfg.Signing.AllowUnsigned,
 				})
 				if err != nil {
 					return err
@@ -127,8 +131,28 @@ func backupCreateCmd() *cliv3.Command {
 		Usage: "Create basebackup using streaming replication protocol",
 		Flags: []cliv3.Flag{
 			configFlag,
+			&cliv3.BoolFlag{
+				Name:  "incremental",
+				Usage: "Take an incremental backup against the latest backup (PostgreSQL 17+)",
+			},
+			&cliv3.BoolFlag{
+				Name:  "include-wal",
+				Usage: "Add the WAL needed to restore the backup to the backup itself",
+			},
+			&cliv3.StringFlag{
+				Name:  "label",
+				Usage: "Label of the backup, pgrwl_<id> by default",
+			},
+			&cliv3.StringSliceFlag{
+				Name:  "annotation",
+				Usage: "Annotation stored with the backup, as key=value (repeatable)",
+			},
+			&cliv3.BoolFlag{
+				Name:  "pin",
+				Usage: "Keep the backup and the WAL it needs regardless of retention",
+			},
 		},
-		Action: func(_ context.Context, c *cliv3.Command) error {
+		Action: func(ctx context.Context, c *cliv3.Command) error {
 			var err error
 
 			err = cmd.CheckPgEnvsAreSet()
@@ -141,9 +165,89 @@ func backupCreateCmd() *cliv3.Command {
 				return err
 			}
 
-			_, err = backup.CreateBaseBackup(&backup.CreateBaseBackupOpts{Directory: cfg.Main.Directory})
+			annotations, err := backup.ParseAnnotations(c.StringSlice("annotation"))
+			if err != nil {
+				return err
+			}
+
+			_, err = backup.CreateBaseBackup(ctx, &backup.CreateBaseBackupOpts{
+				Directory:   cfg.Main.Directory,
+				Incremental: c.Bool("incremental"),
+				IncludeWAL:  c.Bool("include-wal"),
+				Label:       c.String("label"),
+				Annotations: annotations,
+				Pinned:      c.Bool("pin"),
+			})
 			return err
 		},
+		Commands: []*cliv3.Command{
+			backupVerifyCmd(),
+			backupCancelCmd(),
+		},
+	}
+}
+
+func backupVerifyCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "verify",
+		Usage: "Verify a basebackup against its manifest and the WAL archive",
+
+		Description: strx.HeredocTrim(`
+				Streams every archive of the backup from the storage, without
+				extracting it, and checks the size and checksum of each file against
+				the PostgreSQL backup manifest, the checksum of the manifest itself,
+				the signature of the backup marker when signing is configured, and
+				that the WAL needed to recover the backup is archived.
+				Prints a JSON report and exits with an error when any check failed.
+				`),
+
+		Flags: []cliv3.Flag{
+			configFlag,
+			&cliv3.StringFlag{
+				Name:  "id",
+				Usage: "Backup id to verify (20060102150405), the 'latest' will be used if not set",
+			},
+			&cliv3.Uint64Flag{
+				Name:  "wal-segsize",
+				Usage: "WAL segment size of the cluster in megabytes",
+				Value: 16,
+			},
+		},
+		Action: func(_ context.Context, c *cliv3.Command) error {
+			cfg, err := cmd.LoadConfig(c.String(configKey), config.ModeRestoreCMD)
+			if err != nil {
+				return err
+			}
+			return cmd.RunBackupVerify(os.Stdout, cfg, &cmd.BackupVerifyOpts{
+				ID:         c.String("id"),
+				WalSegSzMB: c.Uint64("wal-segsize"),
+			})
+		},
+	}
+}
+
+func backupCancelCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "cancel",
+		Usage: "Cancel the basebackup running in a receiver",
+
+		Description: strx.HeredocTrim(`
+				Aborts the running basebackup, scheduled or manual, and deletes its
+				partially uploaded files. WAL streaming is not interrupted.
+				`),
+
+		Flags: []cliv3.Flag{
+			&cliv3.StringFlag{
+				Name:     "addr",
+				Required: true,
+				Usage:    "The address of pgrwl running in a receive mode",
+			},
+		},
+		Action: func(ctx context.Context, c *cliv3.Command) error {
+			return cmd.ExecBackupCancel(ctx, os.Stdout, &cmd.BackupCancelOpts{
+				Addr: c.String("addr"),
+			})
+		},
 	}
 }
 
@@ -215,6 +319,217 @@ func restoreCommandCmd() *cliv3.Command {
 	}
 }
 
+func repoCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "repo",
+		Usage: "Maintain the repository",
+		Commands: []*cliv3.Command{
+			repoMigrateLayoutCmd(),
+			repoCopyCmd(),
+			repoRekeyCmd(),
+			repoRebuildCatalogCmd(),
+			repoKeygenCmd(),
+			repoSignKeygenCmd(),
+		},
+	}
+}
+
+func repoMigrateLayoutCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "migrate-layout",
+		Usage: "Move WAL files into the layout set in storage.wal_layout",
+
+		Description: strx.HeredocTrim(`
+				Moves WAL files stored in the other layout (flat or sharded) into the
+				configured one. Both layouts are readable at any time, so the migration
+				may run while the receiver is uploading and restore is reading.
+				An interrupted migration is resumed by running the command again.
+				`),
+
+		Flags: []cliv3.Flag{
+			configFlag,
+			&cliv3.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only log the files that would be moved",
+			},
+		},
+		Action: func(_ context.Context, c *cliv3.Command) error {
+			cfg, err := cmd.LoadConfig(c.String(configKey), config.ModeRepoCMD)
+			if err != nil {
+				return err
+			}
+			return cmd.RunRepoMigrateLayout(&cmd.RepoMigrateLayoutOpts{
+				Directory: filepath.ToSlash(cfg.Main.Directory),
+				WALLayout: cfg.Storage.WALLayout,
+				DryRun:    c.Bool("dry-run"),
+			})
+		},
+	}
+}
+
+func repoCopyCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "copy",
+		Usage: "Copy WAL files and basebackups into another repository",
+
+		Description: strx.HeredocTrim(`
+				Copies the WAL archive and the basebackups of the repository configured in
+				--from into the repository configured in --to. Files are decoded with the
+				source compression/encryption and encoded with the target ones while
+				streaming, and each copy is verified by its checksum.
+				Files already in the target with the same content are skipped, so an
+				interrupted copy is resumed by running the command again.
+				Stop the receivers of both repositories before copying.
+				`),
+
+		Flags: []cliv3.Flag{
+			&cliv3.StringFlag{
+				Name:     "from",
+				Usage:    "Config file of the source repository",
+				Required: true,
+			},
+			&cliv3.StringFlag{
+				Name:     "to",
+				Usage:    "Config file of the target repository",
+				Required: true,
+			},
+			&cliv3.IntFlag{
+				Name:  "parallel",
+				Usage: "Number of files copied at once",
+				Value: 4,
+			},
+			&cliv3.BoolFlag{
+				Name:  "delete-source",
+				Usage: "Delete the source files after everything was copied and verified",
+			},
+			&cliv3.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only log the files that would be copied",
+			},
+		},
+		Action: func(_ context.Context, c *cliv3.Command) error {
+			from, err := cmd.LoadConfig(c.String("from"), config.ModeRepoCMD)
+			if err != nil {
+				return err
+			}
+			to, err := config.Load(c.String("to"), config.ModeRepoCMD)
+			if err != nil {
+				return fmt.Errorf("load target config: %w", err)
+			}
+			return cmd.RunRepoCopy(&cmd.RepoCopyOpts{
+				From:         from,
+				To:           to,
+				Parallel:     c.Int("parallel"),
+				DeleteSource: c.Bool("delete-source"),
+				DryRun:       c.Bool("dry-run"),
+			})
+		},
+	}
+}
+
+func repoRebuildCatalogCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "rebuild-catalog",
+		Usage: "Rebuild the backup catalog from the backup markers",
+
+		Description: strx.HeredocTrim(`
+				Adds every completed basebackup missing from the backup catalog, read from
+				the marker the backup leaves when it completes. A catalog that cannot be
+				read is replaced, and loses the failed runs it recorded.
+				The receiver may keep running, but a backup finishing during the rebuild
+				may be missing from the catalog until the command is run again.
+				`),
+
+		Flags: []cliv3.Flag{
+			configFlag,
+		},
+		Action: func(_ context.Context, c *cliv3.Command) error {
+			cfg, err := cmd.LoadConfig(c.String(configKey), config.ModeRepoCMD)
+			if err != nil {
+				return err
+			}
+			return cmd.RunRepoRebuildCatalog(&cmd.RepoRebuildCatalogOpts{
+				Directory: filepath.ToSlash(cfg.Main.Directory),
+			})
+		},
+	}
+}
+
+func repoRekeyCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "rekey",
+		Usage: "Re-encrypt WAL files and basebackups with the active encryption key",
+
+		Description: strx.HeredocTrim(`
+				Re-encrypts every object that was written with another key of
+				storage.encryption.keys, or with the legacy storage.encryption.pass,
+				using storage.encryption.active_key. Compressed content is kept as is.
+				Each object is written next to the old one, verified and then renamed
+				over it, so the command may run while the receiver is uploading.
+				An interrupted run is resumed by running the command again. Once it
+				completes, retired keys may be removed from the config.
+				`),
+
+		Flags: []cliv3.Flag{
+			configFlag,
+			&cliv3.IntFlag{
+				Name:  "parallel",
+				Usage: "Number of files re-encrypted at once",
+				Value: 4,
+			},
+			&cliv3.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only log the files that would be re-encrypted",
+			},
+		},
+		Action: func(_ context.Context, c *cliv3.Command) error {
+			cfg, err := cmd.LoadConfig(c.String(configKey), config.ModeRepoCMD)
+			if err != nil {
+				return err
+			}
+			return cmd.RunRepoRekey(&cmd.RepoRekeyOpts{
+				Directory: filepath.ToSlash(cfg.Main.Directory),
+				Parallel:  c.Int("parallel"),
+				DryRun:    c.Bool("dry-run"),
+			})
+		},
+	}
+}
+
+func repoKeygenCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "keygen",
+		Usage: "Generate an x25519 key pair for write-only encryption",
+
+		Description: strx.HeredocTrim(`
+				Prints a new key pair for storage.encryption.algo: x25519. Give the
+				receiver only the public key, so that it can write the archive but not
+				read it, and keep the private key for restore and serve.
+				`),
+
+		Action: func(_ context.Context, _ *cliv3.Command) error {
+			return cmd.RunRepoKeygen(os.Stdout)
+		},
+	}
+}
+
+func repoSignKeygenCmd() *cliv3.Command {
+	return &cliv3.Command{
+		Name:  "sign-keygen",
+		Usage: "Generate an ed25519 key pair for signed backups and WAL manifests",
+
+		Description: strx.HeredocTrim(`
+				Prints a new key pair for the signing section. The receiver signs
+				backup markers and WAL manifests with the private key, restore and
+				serve need only the public key to verify them.
+				`),
+
+		Action: func(_ context.Context, _ *cliv3.Command) error {
+			return cmd.RunRepoSignKeygen(os.Stdout)
+		},
+	}
+}
+
 func validateCmd() *cliv3.Command {
 	return &cliv3.Command{
 		Name:  "validate",
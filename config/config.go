@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +35,9 @@ const (
 	// ModeRestoreCMD used in pgrwl restore CLI command.
 	ModeRestoreCMD = "restore"
 
+	// ModeRepoCMD used in pgrwl repo CLI commands.
+	ModeRepoCMD = "repo"
+
 	// StorageNameS3 is the identifier for the S3 storage backend.
 	StorageNameS3 = "s3"
 
@@ -45,16 +53,52 @@ const (
 	// BaseBackupSubpath when storage name is 'local', put basebackups to this directory.
 	BaseBackupSubpath = "backups"
 
+	// LockSubpath holds the repository lease object.
+	LockSubpath = "locks"
+
+	// WALManifestSubpath holds the signed manifests of the WAL archive.
+	WALManifestSubpath = "wal-manifests"
+
+	// CatalogSubpath holds the catalog of backup runs.
+	CatalogSubpath = "catalog"
+
 	// RepoEncryptorAes256Gcm is the AES-256-GCM encryption algorithm identifier.
 	RepoEncryptorAes256Gcm = "aes-256-gcm"
 
+	// RepoEncryptorChaCha20Poly1305 is the ChaCha20-Poly1305 encryption algorithm identifier.
+	RepoEncryptorChaCha20Poly1305 = "chacha20-poly1305"
+
+	// RepoEncryptorX25519 is the X25519 public-key encryption algorithm identifier.
+	RepoEncryptorX25519 = "x25519"
+
+	// RepoEncryptorEnvelope is envelope encryption with a key-encryption key provider.
+	RepoEncryptorEnvelope = "envelope"
+
+	// KEKProviderFile reads the key-encryption key from a file.
+	KEKProviderFile = "file"
+
+	// KEKProviderExec wraps and unwraps data keys with external commands.
+	KEKProviderExec = "exec"
+
 	// RepoCompressorGzip is the Gzip compression algorithm identifier.
 	RepoCompressorGzip = "gzip"
 
 	// RepoCompressorZstd is the Zstandard compression algorithm identifier.
 	RepoCompressorZstd = "zstd"
 
+	// RepoCompressorLz4 is the LZ4 compression algorithm identifier.
+	RepoCompressorLz4 = "lz4"
+
+	// RepoCompressorXz is the XZ compression algorithm identifier.
+	RepoCompressorXz = "xz"
+
 	RetentionTypeRecoveryWindow = "recovery_window"
+
+	// WALLayoutFlat keeps all WAL files in the root of the WAL archive.
+	WALLayoutFlat = "flat"
+
+	// WALLayoutSharded places WAL files under wal/<timeline>/<logid>/.
+	WALLayoutSharded = "sharded"
 )
 
 var (
@@ -73,6 +117,7 @@ var (
 		// CMD
 		ModeBackupCMD,
 		ModeRestoreCMD,
+		ModeRepoCMD,
 		// daemons
 		ModeReceive,
 		ModeServe,
@@ -90,6 +135,9 @@ type Config struct {
 	DevConfig DevConfig       `json:"devconfig,omitzero"` // Various dev options.
 	Backup    BackupConfig    `json:"backup,omitzero"`    // Streaming basebackup options.
 	Retention RetentionConfig `json:"retention,omitzero"` // Retention worker (recovery-window)
+	Lock      LockConfig      `json:"lock,omitzero"`      // Repository lease.
+	Signing   SigningConfig   `json:"signing,omitzero"`   // Signatures of backup markers and WAL manifests.
+	Hooks     HooksConfig     `json:"hooks,omitzero"`     // Commands and webhooks run around backups and restores.
 }
 
 // MainConfig holds top-level application settings.
@@ -113,7 +161,207 @@ type DevConfigPprof struct {
 
 // BackupConfig configures streaming basebackup properties.
 type BackupConfig struct {
-	Cron string `json:"cron" env:"PGRWL_BACKUP_CRON"`
+	// Cron is the schedule of the backups, unless Schedules are given.
+	Cron string `json:"cron,omitzero" env:"PGRWL_BACKUP_CRON"`
+
+	// Schedules are named schedules with their own policies, they replace Cron.
+	Schedules []BackupSchedule `json:"schedules,omitzero"`
+
+	// Timezone is the IANA time zone of the schedules and blackout windows,
+	// the zone of the process when empty.
+	Timezone string `json:"timezone,omitzero" env:"PGRWL_BACKUP_TIMEZONE"`
+	location *time.Location
+
+	// Blackouts are time windows in which scheduled backups are skipped.
+	Blackouts []BlackoutWindow `json:"blackouts,omitzero"`
+
+	// Verify checks every new backup against its manifest and the WAL
+	// archive, as 'pgrwl backup verify' does. It needs the private key
+	// with x25519 encryption.
+	Verify bool `json:"verify,omitzero" env:"PGRWL_BACKUP_VERIFY"`
+
+	// IncludeWAL adds the WAL needed to restore a backup to the backup
+	// itself, so it restores without the WAL archive.
+	IncludeWAL bool `json:"include_wal,omitzero" env:"PGRWL_BACKUP_INCLUDE_WAL"`
+
+	// Incremental takes incremental backups against the previous backup
+	// (PostgreSQL 17+ with summarize_wal enabled).
+	Incremental IncrementalConfig `json:"incremental,omitzero"`
+
+	// ServerCompression makes the server compress the archives (PostgreSQL
+	// 15+). They are stored as received, without recompression.
+	ServerCompression CompressionOverride `json:"server_compression,omitzero" env:", prefix=PGRWL_BACKUP_SERVER_COMPRESSION_"`
+
+	// Source is the server backups are taken from, e.g. a standby.
+	Source BackupSourceConfig `json:"source,omitzero"`
+
+	// Split stores each archive as numbered parts of a bounded size.
+	Split SplitConfig `json:"split,omitzero"`
+
+	// Cleanup removes what failed backups left in the repository.
+	Cleanup BackupCleanupConfig `json:"cleanup,omitzero"`
+}
+
+// Backup types of a schedule.
+const (
+	BackupTypeFull        = "full"
+	BackupTypeIncremental = "incremental"
+)
+
+// DefaultScheduleName is the name of the schedule given by backup.cron.
+const DefaultScheduleName = "default"
+
+// BackupSchedule is a named backup schedule.
+type BackupSchedule struct {
+	Name string `json:"name"`
+	// Cron is the schedule, POSIX format.
+	Cron string `json:"cron"`
+
+	// Type is "full" or "incremental", as backup.incremental.enable decides
+	// when empty. An incremental backup without a parent is a full one.
+	Type string `json:"type,omitzero"`
+
+	// Timeout cancels a run that takes longer (e.g., "6h"), no limit when empty.
+	Timeout       string        `json:"timeout,omitzero"`
+	TimeoutParsed time.Duration `json:"-"`
+
+	// ServerCompression replaces backup.server_compression for the schedule.
+	ServerCompression CompressionOverride `json:"server_compression,omitzero"`
+
+	// RetentionClass names the retention.classes entry of the backups.
+	RetentionClass string `json:"retention_class,omitzero"`
+}
+
+// Location returns the time zone of the schedules and blackout windows.
+func (c *BackupConfig) Location() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
+
+// AllSchedules returns the schedules, backup.cron as the "default" one when
+// no schedules are given.
+func (c *BackupConfig) AllSchedules() []BackupSchedule {
+	if len(c.Schedules) > 0 {
+		return c.Schedules
+	}
+	if strings.TrimSpace(c.Cron) == "" {
+		return nil
+	}
+	return []BackupSchedule{{Name: DefaultScheduleName, Cron: c.Cron}}
+}
+
+// BlackoutWindow is a daily time window, e.g. business hours. End may be
+// before Start for a window that spans midnight.
+type BlackoutWindow struct {
+	// Days limits the window to the days it starts on ("mon" ... "sun"),
+	// every day when empty.
+	Days []string `json:"days,omitzero"`
+	// Start and End are times of day, "HH:MM".
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	daysParsed  map[time.Weekday]bool
+	startParsed time.Duration
+	endParsed   time.Duration
+}
+
+// Contains reports whether t is in the window, t is in the zone of the schedules.
+func (w *BlackoutWindow) Contains(t time.Time) bool {
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	day := t.Weekday()
+	switch {
+	case w.startParsed <= w.endParsed:
+		if tod < w.startParsed || tod >= w.endParsed {
+			return false
+		}
+	case tod >= w.startParsed:
+		// in the evening part of a window that spans midnight
+	case tod < w.endParsed:
+		// in the morning part, the window started the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return len(w.daysParsed) == 0 || w.daysParsed[day]
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// DefaultWALWaitTimeout is how long a backup taken from a standby waits for
+// its WAL to be archived, when wal_wait_timeout is not set.
+const DefaultWALWaitTimeout = 10 * time.Minute
+
+// BackupSourceConfig configures the server backups are taken from.
+type BackupSourceConfig struct {
+	// Conninfo is a libpq connection string (keyword/value or URL). The PG*
+	// environment variables fill in what it leaves out, the WAL receiver
+	// keeps connecting with them alone.
+	Conninfo string `json:"conninfo,omitzero" env:"PGRWL_BACKUP_SOURCE_CONNINFO"`
+
+	// WALWaitTimeout limits the wait for the receiver to archive the WAL of
+	// a backup taken from a standby (e.g., "10m").
+	WALWaitTimeout       string        `json:"wal_wait_timeout,omitzero" env:"PGRWL_BACKUP_SOURCE_WAL_WAIT_TIMEOUT"`
+	WALWaitTimeoutParsed time.Duration `json:"-"`
+}
+
+// DefaultSplitRetries is how many times the upload of a part is retried
+// when split.retries is not set.
+const DefaultSplitRetries = 3
+
+// MinSplitSize is the smallest part size.
+const MinSplitSize = 1 << 20
+
+// SplitConfig configures the split of backup archives into parts, e.g. for
+// storage that limits the object size.
+type SplitConfig struct {
+	// Size is the maximum size of a part (e.g., "4GiB"), archives are not
+	// split when empty.
+	Size       string `json:"size,omitzero" env:"PGRWL_BACKUP_SPLIT_SIZE"`
+	SizeParsed int64  `json:"-"`
+
+	// Retries is how many times a failed part upload is retried, zero keeps
+	// the default.
+	Retries int `json:"retries,omitzero" env:"PGRWL_BACKUP_SPLIT_RETRIES"`
+}
+
+// DefaultCleanupGracePeriod is how long a backup without a marker is left
+// alone, when cleanup.grace_period is not set.
+const DefaultCleanupGracePeriod = 24 * time.Hour
+
+// BackupCleanupConfig configures the cleanup of failed backups.
+type BackupCleanupConfig struct {
+	// Enable deletes orphaned backups, directories without a backup marker,
+	// and aborts unfinished multipart uploads before each backup.
+	Enable bool `json:"enable,omitzero" env:"PGRWL_BACKUP_CLEANUP_ENABLE"`
+
+	// GracePeriod is how long after its last write an orphaned backup is
+	// kept (e.g., "24h"). It must exceed the duration of the longest backup,
+	// as a backup taken by another process looks orphaned until it is done.
+	GracePeriod       string        `json:"grace_period,omitzero" env:"PGRWL_BACKUP_CLEANUP_GRACE_PERIOD"`
+	GracePeriodParsed time.Duration `json:"-"`
+}
+
+// DefaultIncrementalMaxChain is the number of incremental backups taken on
+// top of a full backup before the next full one, when max_chain is not set.
+const DefaultIncrementalMaxChain = 6
+
+// IncrementalConfig configures incremental basebackups.
+type IncrementalConfig struct {
+	Enable bool `json:"enable,omitzero" env:"PGRWL_BACKUP_INCREMENTAL_ENABLE"`
+
+	// MaxChain limits the number of incremental backups on top of a full
+	// backup, the next backup is a full one. Zero keeps the default.
+	MaxChain int `json:"max_chain,omitzero" env:"PGRWL_BACKUP_INCREMENTAL_MAX_CHAIN"`
 }
 
 // RetentionConfig configures retention for basebackups.
@@ -127,6 +375,93 @@ type RetentionConfig struct {
 	KeepDurationParsed time.Duration `json:"-"`
 
 	KeepLast *int `json:"keep_last,omitzero" env:"PGRWL_BACKUP_RETENTION_KEEP_LAST"`
+
+	// Classes keep the backups of the schedules that name them for longer
+	// than the recovery window.
+	Classes map[string]RetentionClass `json:"classes,omitzero"`
+}
+
+// RetentionClass keeps backups, and the WAL to restore them to their end,
+// for a duration after they were taken.
+type RetentionClass struct {
+	Keep       string        `json:"keep"`
+	KeepParsed time.Duration `json:"-"`
+}
+
+// LockConfig configures the repository lease, which keeps a single receiver
+// writing to the repository.
+type LockConfig struct {
+	// Enable makes receive mode acquire the lease before uploads, backups and retention.
+	Enable bool `json:"enable,omitzero" env:"PGRWL_LOCK_ENABLE"`
+
+	// TTL is how long the lease stays valid without a heartbeat (e.g., "60s").
+	TTL       string        `json:"ttl,omitzero" env:"PGRWL_LOCK_TTL"`
+	TTLParsed time.Duration `json:"-"`
+}
+
+// Hook failure policies.
+const (
+	HookOnFailureAbort = "abort"
+	HookOnFailureWarn  = "warn"
+)
+
+// DefaultHookTimeout is how long a hook may run when no timeout is set.
+const DefaultHookTimeout = time.Minute
+
+// HooksConfig configures the hooks run around backups and restores, in the
+// order they are listed.
+type HooksConfig struct {
+	PreBackup   []Hook `json:"pre_backup,omitzero"`
+	PostBackup  []Hook `json:"post_backup,omitzero"`
+	PreRestore  []Hook `json:"pre_restore,omitzero"`
+	PostRestore []Hook `json:"post_restore,omitzero"`
+}
+
+// Hook is a command or a webhook, exactly one of Command and URL is set.
+type Hook struct {
+	// Name identifies the hook in logs and errors.
+	Name string `json:"name,omitzero"`
+
+	// Command is run with "sh -c", the backup is described by PGRWL_*
+	// environment variables.
+	Command string `json:"command,omitzero"`
+
+	// URL receives a POST with the backup described in a JSON body.
+	URL     string            `json:"url,omitzero"`
+	Headers map[string]string `json:"headers,omitzero"`
+
+	// Timeout limits the hook (e.g., "30s"), DefaultHookTimeout when empty.
+	Timeout       string        `json:"timeout,omitzero"`
+	TimeoutParsed time.Duration `json:"-"`
+
+	// OnFailure is "abort" (the default), which fails the backup or restore,
+	// or "warn", which logs the failure and goes on.
+	OnFailure string `json:"on_failure,omitzero"`
+}
+
+// Abort reports whether a failure of the hook fails the backup or restore.
+func (h *Hook) Abort() bool {
+	return h.OnFailure != HookOnFailureWarn
+}
+
+// SigningConfig configures ed25519 signatures of backup markers and WAL
+// manifests. The keys are independent of the encryption keys.
+type SigningConfig struct {
+	// PrivateKey signs new backup markers and WAL manifests (see 'pgrwl repo sign-keygen').
+	PrivateKey string `json:"private_key,omitzero" env:"PGRWL_SIGNING_PRIVATE_KEY"`
+
+	// PublicKeys verify signatures on restore and serve. The public key of
+	// PrivateKey is always accepted.
+	PublicKeys []string `json:"public_keys,omitzero" env:"PGRWL_SIGNING_PUBLIC_KEYS"`
+
+	// AllowUnsigned accepts objects without a signature, e.g. written before
+	// signing was enabled. Objects with a wrong signature are always rejected.
+	AllowUnsigned bool `json:"allow_unsigned,omitzero" env:"PGRWL_SIGNING_ALLOW_UNSIGNED"`
+}
+
+// Enabled reports whether signatures are written or verified.
+func (c *SigningConfig) Enabled() bool {
+	return c.PrivateKey != "" || len(c.PublicKeys) > 0
 }
 
 // ReceiveConfig configures the WAL receiving logic.
@@ -175,6 +510,10 @@ type StorageConfig struct {
 	// Name specifies the storage backend to use ("s3", "sftp", etc.).
 	Name string `json:"name,omitzero" env:"PGRWL_STORAGE_NAME"`
 
+	// WALLayout defines where new WAL files are placed ("flat" or "sharded").
+	// Both layouts are always readable.
+	WALLayout string `json:"wal_layout,omitzero" env:"PGRWL_STORAGE_WAL_LAYOUT"`
+
 	// Compression defines compression settings for stored WAL files.
 	Compression CompressionConfig `json:"compression,omitzero"`
 
@@ -190,17 +529,108 @@ type StorageConfig struct {
 
 // CompressionConfig defines the compression algorithm to use.
 type CompressionConfig struct {
-	// Algo is the compression algorithm ("gzip", "zstd", etc.).
+	// Algo is the compression algorithm ("gzip", "zstd", "lz4", "xz").
 	Algo string `json:"algo,omitzero" env:"PGRWL_STORAGE_COMPRESSION_ALGO"`
+
+	// Level is the compression level of Algo, the codec default when zero.
+	Level int `json:"level,omitzero" env:"PGRWL_STORAGE_COMPRESSION_LEVEL"`
+
+	// Concurrency is the number of zstd encoder goroutines, GOMAXPROCS when zero.
+	Concurrency int `json:"concurrency,omitzero" env:"PGRWL_STORAGE_COMPRESSION_CONCURRENCY"`
+
+	// WAL and Backups override Algo and Level for the WAL archive and for basebackups.
+	WAL     CompressionOverride `json:"wal,omitzero" env:", prefix=PGRWL_STORAGE_COMPRESSION_WAL_"`
+	Backups CompressionOverride `json:"backups,omitzero" env:", prefix=PGRWL_STORAGE_COMPRESSION_BACKUPS_"`
+}
+
+// CompressionOverride sets the compression of one kind of data.
+type CompressionOverride struct {
+	Algo  string `json:"algo,omitzero" env:"ALGO"`
+	Level int    `json:"level,omitzero" env:"LEVEL"`
+}
+
+// ForWAL returns the algorithm and level for the WAL archive.
+func (c *CompressionConfig) ForWAL() (algo string, level int) {
+	return c.resolve(c.WAL)
+}
+
+// ForBackups returns the algorithm and level for basebackups.
+func (c *CompressionConfig) ForBackups() (algo string, level int) {
+	return c.resolve(c.Backups)
+}
+
+// resolve applies an override. A level set for the default algorithm is
+// not carried over to another algorithm, levels differ between codecs.
+func (c *CompressionConfig) resolve(o CompressionOverride) (algo string, level int) {
+	if o.Algo != "" && o.Algo != c.Algo {
+		return o.Algo, o.Level
+	}
+	if o.Level != 0 {
+		return c.Algo, o.Level
+	}
+	return c.Algo, c.Level
 }
 
 // EncryptionConfig defines the encryption algorithm and credentials.
 type EncryptionConfig struct {
-	// Algo is the encryption algorithm identifier ("aes-256-gcm", etc.).
+	// Algo is the encryption algorithm identifier ("aes-256-gcm", "chacha20-poly1305", "x25519", "envelope").
 	Algo string `json:"algo,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_ALGO"`
 
-	// Pass is the encryption passphrase.
+	// Pass is the encryption passphrase. With a keyring, it only decrypts
+	// objects written before key IDs were introduced.
 	Pass string `json:"pass,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_PASS"`
+
+	// Keys is a keyring of named passphrases. New objects are encrypted with
+	// ActiveKey and record its ID, old objects are decrypted with the key they name.
+	Keys []EncryptionKey `json:"keys,omitzero"`
+
+	// ActiveKey is the ID of the key for new objects, the last key when empty.
+	ActiveKey string `json:"active_key,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_ACTIVE_KEY"`
+
+	// PublicKey is the x25519 recipient key, enough to write the archive.
+	PublicKey string `json:"public_key,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_PUBLIC_KEY"`
+
+	// PrivateKey is the x25519 identity key, required to read the archive.
+	PrivateKey string `json:"private_key,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_PRIVATE_KEY"`
+
+	// KEK configures the key-encryption key of envelope encryption.
+	KEK KEKConfig `json:"kek,omitzero"`
+
+	// KDF tunes the Argon2id key derivation of aes-256-gcm and chacha20-poly1305.
+	KDF KDFConfig `json:"kdf,omitzero"`
+}
+
+// KDFConfig defines the Argon2id parameters for new objects. They are stored
+// in every object, so changing them keeps existing objects readable. Zero
+// values keep the defaults: time 1, 64 MiB of memory and 4 threads.
+type KDFConfig struct {
+	Time      uint32 `json:"time,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KDF_TIME"`
+	MemoryMiB uint32 `json:"memory_mib,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KDF_MEMORY_MIB"`
+	Threads   uint8  `json:"threads,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KDF_THREADS"`
+}
+
+// KEKConfig defines where the key-encryption key of envelope encryption lives.
+type KEKConfig struct {
+	// Provider is "file" or "exec".
+	Provider string `json:"provider,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KEK_PROVIDER"`
+
+	// File holds a 32-byte key, raw, hex or base64 encoded (file provider).
+	File string `json:"file,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KEK_FILE"`
+
+	// WrapCmd and UnwrapCmd are shell commands that read base64 on stdin and
+	// write base64 to stdout (exec provider).
+	WrapCmd   string `json:"wrap_cmd,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KEK_WRAP_CMD"`
+	UnwrapCmd string `json:"unwrap_cmd,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KEK_UNWRAP_CMD"`
+
+	// Timeout limits one command run (exec provider, e.g. "30s").
+	Timeout       string        `json:"timeout,omitzero" env:"PGRWL_STORAGE_ENCRYPTION_KEK_TIMEOUT"`
+	TimeoutParsed time.Duration `json:"-"`
+}
+
+// EncryptionKey is a named passphrase of the encryption keyring.
+type EncryptionKey struct {
+	ID   string `json:"id"`
+	Pass string `json:"pass"`
 }
 
 // SFTPConfig defines parameters for connecting to an SFTP server.
@@ -225,6 +655,16 @@ type SFTPConfig struct {
 
 	// Base directory with sufficient user permissions
 	BaseDir string `json:"base_dir,omitzero" env:"PGRWL_STORAGE_SFTP_BASE_DIR"`
+
+	// KnownHosts is the path to an OpenSSH known_hosts file used to verify the server host key.
+	KnownHosts string `json:"known_hosts,omitzero" env:"PGRWL_STORAGE_SFTP_KNOWN_HOSTS"`
+
+	// HostKeyFingerprint pins the server host key (SHA256:..., as printed by 'ssh-keygen -lf').
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitzero" env:"PGRWL_STORAGE_SFTP_HOST_KEY_FINGERPRINT"`
+
+	// KeepaliveInterval is the interval between SSH keepalive requests (e.g., "30s").
+	KeepaliveInterval       string        `json:"keepalive_interval,omitzero" env:"PGRWL_STORAGE_SFTP_KEEPALIVE_INTERVAL"`
+	KeepaliveIntervalParsed time.Duration `json:"-"`
 }
 
 // S3Config defines configuration for S3-compatible object storage.
@@ -276,6 +716,19 @@ func RedactedCopy() Config {
 	if cp.Storage.Encryption.Pass != "" {
 		cp.Storage.Encryption.Pass = redacted
 	}
+	if len(cp.Storage.Encryption.Keys) > 0 {
+		keys := make([]EncryptionKey, len(cp.Storage.Encryption.Keys))
+		for i, k := range cp.Storage.Encryption.Keys {
+			keys[i] = EncryptionKey{ID: k.ID, Pass: redacted}
+		}
+		cp.Storage.Encryption.Keys = keys
+	}
+	if cp.Storage.Encryption.PrivateKey != "" {
+		cp.Storage.Encryption.PrivateKey = redacted
+	}
+	if cp.Signing.PrivateKey != "" {
+		cp.Signing.PrivateKey = redacted
+	}
 	if cp.Storage.SFTP.Pass != "" {
 		cp.Storage.SFTP.Pass = redacted
 	}
@@ -334,6 +787,19 @@ func FromFile(path, mode string) (*Config, error) {
 	return config, nil
 }
 
+// Load reads and validates a config file without making it the config of
+// the process. It is used by commands that work with two repositories.
+func Load(path, mode string) (*Config, error) {
+	cfg, err := mustLoadCfg(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(cfg, mode); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 func FromEnvs(mode string) (*Config, error) {
 	once.Do(func() {
 		config = new(Config)
@@ -396,8 +862,11 @@ func validate(c *Config, mode string) error {
 	errs = checkRetentionConfig(c, errs)
 	errs = checkLogConfig(c, errs)
 	errs = checkStorageConfig(c, errs)
-	errs = checkStorageModifiersConfig(c, errs)
+	errs = checkStorageModifiersConfig(c, mode, errs)
 	errs = checkBackupConfig(c, errs)
+	errs = checkLockConfig(c, errs)
+	errs = checkSigningConfig(c, errs)
+	errs = checkHooksConfig(c, errs)
 
 	if len(errs) > 0 {
 		return errors.New("invalid config:\n  - " + strings.Join(errs, "\n  - "))
@@ -441,7 +910,8 @@ func checkReceiverConfig(c *Config, mode string, errs []string) []string {
 		// uploader conf is required:
 		// * when external storage is used
 		// * when local storage used with compression || encryption configured
-		if c.IsExternalStor() || c.Storage.Compression.Algo != "" || c.Storage.Encryption.Algo != "" {
+		walCompression, _ := c.Storage.Compression.ForWAL()
+		if c.IsExternalStor() || walCompression != "" || c.Storage.Encryption.Algo != "" {
 			// uploader
 			syncIntervalUploader := c.Receiver.Uploader.SyncInterval
 			if duration, err := time.ParseDuration(syncIntervalUploader); err != nil {
@@ -457,29 +927,443 @@ func checkReceiverConfig(c *Config, mode string, errs []string) []string {
 	return errs
 }
 
-func checkStorageModifiersConfig(c *Config, errs []string) []string {
+func checkStorageModifiersConfig(c *Config, mode string, errs []string) []string {
 	// Validate optional compression
-	if c.Storage.Compression.Algo != "" {
-		if c.Storage.Compression.Algo != RepoCompressorGzip && c.Storage.Compression.Algo != RepoCompressorZstd {
-			errs = append(errs, fmt.Sprintf("unsupported compression algo: %s", c.Storage.Compression.Algo))
-		}
+	comp := &c.Storage.Compression
+	errs = checkCompression(comp.Algo, comp.Level, "storage.compression", errs)
+	if comp.WAL.Algo != "" || comp.WAL.Level != 0 {
+		algo, level := comp.ForWAL()
+		errs = checkCompression(algo, level, "storage.compression.wal", errs)
+	}
+	if comp.Backups.Algo != "" || comp.Backups.Level != 0 {
+		algo, level := comp.ForBackups()
+		errs = checkCompression(algo, level, "storage.compression.backups", errs)
+	}
+	if comp.Concurrency < 0 {
+		errs = append(errs, "storage.compression.concurrency must be >= 0")
 	}
 
 	// Validate optional encryption
-	if c.Storage.Encryption.Algo != "" {
-		if c.Storage.Encryption.Algo != RepoEncryptorAes256Gcm {
-			errs = append(errs, fmt.Sprintf("unsupported encryption algo: %s", c.Storage.Encryption.Algo))
-		}
+	switch c.Storage.Encryption.Algo {
+	case "":
+	case RepoEncryptorAes256Gcm:
+		errs = checkEncryptionKeys(c, errs)
+		errs = checkKDFConfig(c, errs)
+	case RepoEncryptorChaCha20Poly1305:
+		errs = checkKDFConfig(c, errs)
 		if c.Storage.Encryption.Pass == "" {
-			errs = append(errs, "storage.encryption.pass is required if encryption is enabled")
+			errs = append(errs, "storage.encryption.pass is required for chacha20-poly1305")
 		}
+		if len(c.Storage.Encryption.Keys) > 0 {
+			errs = append(errs, "storage.encryption.keys is supported by aes-256-gcm only")
+		}
+	case RepoEncryptorX25519:
+		errs = checkX25519Keys(c, mode, errs)
+	case RepoEncryptorEnvelope:
+		errs = checkKEKConfig(c, errs)
+	default:
+		errs = append(errs, fmt.Sprintf("unsupported encryption algo: %s", c.Storage.Encryption.Algo))
 	}
 	return errs
 }
 
+// Limits of the Argon2id parameters, readers enforce the same on object headers.
+const (
+	maxKDFTime      = 64
+	maxKDFMemoryMiB = 4096
+
+	// defaults of unset parameters, see KDFConfig
+	defaultKDFMemoryMiB = 64
+	defaultKDFThreads   = 4
+)
+
+func checkKDFConfig(c *Config, errs []string) []string {
+	k := c.Storage.Encryption.KDF
+	if k.Time > maxKDFTime {
+		errs = append(errs, fmt.Sprintf("storage.encryption.kdf.time must be in 1..%d (got: %d)", maxKDFTime, k.Time))
+	}
+	if k.MemoryMiB > maxKDFMemoryMiB {
+		errs = append(errs, fmt.Sprintf("storage.encryption.kdf.memory_mib must be in 1..%d (got: %d)", maxKDFMemoryMiB, k.MemoryMiB))
+		return errs
+	}
+
+	// Argon2 needs 8 KiB of memory per thread, checked here rather than on
+	// the first write; a zero threads keeps the default, so it is at least 1
+	memoryMiB, threads := k.MemoryMiB, uint32(k.Threads)
+	if memoryMiB == 0 {
+		memoryMiB = defaultKDFMemoryMiB
+	}
+	if threads == 0 {
+		threads = defaultKDFThreads
+	}
+	if memoryMiB*1024 < 8*threads {
+		errs = append(errs, fmt.Sprintf("storage.encryption.kdf.memory_mib must be at least 8 KiB per thread, %d threads need %d KiB (got: %d MiB)",
+			threads, 8*threads, memoryMiB))
+	}
+	return errs
+}
+
+func checkKEKConfig(c *Config, errs []string) []string {
+	kek := &c.Storage.Encryption.KEK
+	switch kek.Provider {
+	case KEKProviderFile:
+		if kek.File == "" {
+			errs = append(errs, "storage.encryption.kek.file is required for the file provider")
+		}
+	case KEKProviderExec:
+		if kek.WrapCmd == "" || kek.UnwrapCmd == "" {
+			errs = append(errs, "storage.encryption.kek.wrap_cmd and unwrap_cmd are required for the exec provider")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("unknown storage.encryption.kek.provider: %q (must be %q or %q)",
+			kek.Provider, KEKProviderFile, KEKProviderExec))
+	}
+	if kek.Timeout != "" {
+		duration, err := time.ParseDuration(kek.Timeout)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Sprintf("storage.encryption.kek.timeout cannot parse: %s, %v", kek.Timeout, err))
+		} else {
+			kek.TimeoutParsed = duration
+		}
+	}
+	return errs
+}
+
+func checkX25519Keys(c *Config, mode string, errs []string) []string {
+	enc := c.Storage.Encryption
+	if enc.PublicKey == "" && enc.PrivateKey == "" {
+		errs = append(errs, "storage.encryption.public_key or storage.encryption.private_key is required for x25519")
+	}
+	// reading the archive needs the private key
+	if (mode == ModeServe || mode == ModeRestoreCMD) && enc.PrivateKey == "" {
+		errs = append(errs, fmt.Sprintf("storage.encryption.private_key is required for x25519 in %s mode", mode))
+	}
+	// verifying a new backup reads its archives back
+	if mode == ModeReceive && c.Backup.Verify && enc.PrivateKey == "" {
+		errs = append(errs, "backup.verify requires storage.encryption.private_key with x25519, the receiver cannot read the archives otherwise")
+	}
+	return errs
+}
+
+// compressionLevels are the valid levels per algorithm, 0 is always the default.
+var compressionLevels = map[string][2]int{
+	RepoCompressorGzip: {1, 9},
+	RepoCompressorZstd: {1, 22},
+	RepoCompressorLz4:  {1, 9},
+	RepoCompressorXz:   {1, 9},
+}
+
+func checkCompression(algo string, level int, key string, errs []string) []string {
+	if algo == "" {
+		if level != 0 {
+			errs = append(errs, fmt.Sprintf("%s.level requires a compression algo", key))
+		}
+		return errs
+	}
+	bounds, ok := compressionLevels[algo]
+	if !ok {
+		return append(errs, fmt.Sprintf("unsupported compression algo: %s", algo))
+	}
+	if level != 0 && (level < bounds[0] || level > bounds[1]) {
+		errs = append(errs, fmt.Sprintf("%s.level must be in %d..%d for %s (got: %d)", key, bounds[0], bounds[1], algo, level))
+	}
+	return errs
+}
+
+func checkEncryptionKeys(c *Config, errs []string) []string {
+	enc := &c.Storage.Encryption
+	if len(enc.Keys) == 0 {
+		if enc.Pass == "" {
+			errs = append(errs, "storage.encryption.pass or storage.encryption.keys is required if encryption is enabled")
+		}
+		if enc.ActiveKey != "" {
+			errs = append(errs, "storage.encryption.active_key requires storage.encryption.keys")
+		}
+		return errs
+	}
+
+	seen := make(map[string]bool, len(enc.Keys))
+	for i, k := range enc.Keys {
+		switch {
+		case !validKeyID(k.ID):
+			errs = append(errs, fmt.Sprintf("storage.encryption.keys[%d].id must be 1-255 characters of [A-Za-z0-9._-] (got: %q)", i, k.ID))
+		case seen[k.ID]:
+			errs = append(errs, fmt.Sprintf("storage.encryption.keys[%d].id is duplicated: %q", i, k.ID))
+		}
+		seen[k.ID] = true
+		if k.Pass == "" {
+			errs = append(errs, fmt.Sprintf("storage.encryption.keys[%d].pass is required", i))
+		}
+	}
+
+	if enc.ActiveKey == "" {
+		enc.ActiveKey = enc.Keys[len(enc.Keys)-1].ID
+	} else if !seen[enc.ActiveKey] {
+		errs = append(errs, fmt.Sprintf("storage.encryption.active_key %q is not in storage.encryption.keys", enc.ActiveKey))
+	}
+	return errs
+}
+
+func validKeyID(id string) bool {
+	if id == "" || len(id) > 255 {
+		return false
+	}
+	for _, r := range id {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func checkBackupConfig(c *Config, errs []string) []string {
-	if strings.TrimSpace(c.Backup.Cron) == "" {
-		errs = append(errs, "backup.cron is required")
+	switch {
+	case len(c.Backup.Schedules) > 0 && strings.TrimSpace(c.Backup.Cron) != "":
+		errs = append(errs, "backup.cron and backup.schedules are mutually exclusive")
+	case len(c.Backup.Schedules) == 0 && strings.TrimSpace(c.Backup.Cron) == "":
+		errs = append(errs, "backup.cron or backup.schedules is required")
+	}
+	errs = checkBackupSchedules(c, errs)
+	if c.Backup.Timezone != "" {
+		loc, err := time.LoadLocation(c.Backup.Timezone)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("backup.timezone is not a known time zone (got: %s)", c.Backup.Timezone))
+		} else {
+			c.Backup.location = loc
+		}
+	}
+	for i := range c.Backup.Blackouts {
+		errs = checkBlackoutWindow(&c.Backup.Blackouts[i], fmt.Sprintf("backup.blackouts[%d]", i), errs)
+	}
+	if sc := c.Backup.ServerCompression; sc.Algo == RepoCompressorXz {
+		errs = append(errs, "backup.server_compression.algo must be one of: gzip, lz4, zstd")
+	} else {
+		errs = checkCompression(sc.Algo, sc.Level, "backup.server_compression", errs)
+	}
+	if c.Backup.Incremental.MaxChain < 0 {
+		errs = append(errs, fmt.Sprintf("backup.incremental.max_chain must not be negative (got: %d)", c.Backup.Incremental.MaxChain))
+	}
+	if src := &c.Backup.Source; src.WALWaitTimeout != "" {
+		duration, err := time.ParseDuration(src.WALWaitTimeout)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Sprintf("backup.source.wal_wait_timeout must be a positive duration (got: %s)", src.WALWaitTimeout))
+		} else {
+			src.WALWaitTimeoutParsed = duration
+		}
+	}
+	if cl := &c.Backup.Cleanup; cl.GracePeriod != "" {
+		duration, err := time.ParseDuration(cl.GracePeriod)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Sprintf("backup.cleanup.grace_period must be a positive duration (got: %s)", cl.GracePeriod))
+		} else {
+			cl.GracePeriodParsed = duration
+		}
+	}
+	return checkSplitConfig(c, errs)
+}
+
+func checkSplitConfig(c *Config, errs []string) []string {
+	split := &c.Backup.Split
+	if split.Retries < 0 {
+		errs = append(errs, fmt.Sprintf("backup.split.retries must not be negative (got: %d)", split.Retries))
+	}
+	if split.Size == "" {
+		return errs
+	}
+	size, err := parseByteSize(split.Size)
+	if err != nil || size < MinSplitSize {
+		return append(errs, fmt.Sprintf("backup.split.size must be a size of at least 1MiB, e.g. 4GiB (got: %s)", split.Size))
+	}
+	split.SizeParsed = size
+
+	// a part of a compressed stream cannot be decompressed on its own
+	if c.Backup.ServerCompression.Algo != "" {
+		errs = append(errs, "backup.split and backup.server_compression are mutually exclusive")
+	}
+	for i, sch := range c.Backup.Schedules {
+		if sch.ServerCompression.Algo != "" {
+			errs = append(errs, fmt.Sprintf("backup.split and backup.schedules[%d].server_compression are mutually exclusive", i))
+		}
+	}
+	return errs
+}
+
+// byteUnits are the size suffixes of parseByteSize, longest first.
+var byteUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+	{"B", 1},
+}
+
+// parseByteSize parses a size like "512MiB", "5GB" or "1048576".
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	factor := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > math.MaxInt64/factor {
+		return 0, fmt.Errorf("size out of range: %s", s)
+	}
+	return n * factor, nil
+}
+
+func checkBackupSchedules(c *Config, errs []string) []string {
+	names := make(map[string]bool, len(c.Backup.Schedules))
+	for i := range c.Backup.Schedules {
+		sch := &c.Backup.Schedules[i]
+		key := fmt.Sprintf("backup.schedules[%d]", i)
+
+		if strings.TrimSpace(sch.Name) == "" {
+			errs = append(errs, key+".name is required")
+		} else if names[sch.Name] {
+			errs = append(errs, fmt.Sprintf("%s.name must be unique (got: %s)", key, sch.Name))
+		}
+		names[sch.Name] = true
+
+		if strings.TrimSpace(sch.Cron) == "" {
+			errs = append(errs, key+".cron is required")
+		}
+		switch sch.Type {
+		case "", BackupTypeFull, BackupTypeIncremental:
+		default:
+			errs = append(errs, fmt.Sprintf("%s.type must be one of: full, incremental (got: %s)", key, sch.Type))
+		}
+		if sch.Timeout != "" {
+			duration, err := time.ParseDuration(sch.Timeout)
+			if err != nil || duration <= 0 {
+				errs = append(errs, fmt.Sprintf("%s.timeout must be a positive duration (got: %s)", key, sch.Timeout))
+			} else {
+				sch.TimeoutParsed = duration
+			}
+		}
+		if sc := sch.ServerCompression; sc.Algo == RepoCompressorXz {
+			errs = append(errs, key+".server_compression.algo must be one of: gzip, lz4, zstd")
+		} else {
+			errs = checkCompression(sc.Algo, sc.Level, key+".server_compression", errs)
+		}
+		if sch.RetentionClass != "" {
+			if _, ok := c.Retention.Classes[sch.RetentionClass]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.retention_class is not defined in retention.classes (got: %s)", key, sch.RetentionClass))
+			}
+		}
+	}
+	return errs
+}
+
+func checkBlackoutWindow(w *BlackoutWindow, key string, errs []string) []string {
+	var err error
+	if w.startParsed, err = parseTimeOfDay(w.Start); err != nil {
+		errs = append(errs, fmt.Sprintf("%s.start must be a time of day, HH:MM (got: %s)", key, w.Start))
+	}
+	if w.endParsed, err = parseTimeOfDay(w.End); err != nil {
+		errs = append(errs, fmt.Sprintf("%s.end must be a time of day, HH:MM (got: %s)", key, w.End))
+	}
+	w.daysParsed = make(map[time.Weekday]bool, len(w.Days))
+	for _, d := range w.Days {
+		day, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s.days must be one of: mon, tue, wed, thu, fri, sat, sun (got: %s)", key, d))
+			continue
+		}
+		w.daysParsed[day] = true
+	}
+	return errs
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func checkHooksConfig(c *Config, errs []string) []string {
+	phases := []struct {
+		key   string
+		hooks []Hook
+	}{
+		{"hooks.pre_backup", c.Hooks.PreBackup},
+		{"hooks.post_backup", c.Hooks.PostBackup},
+		{"hooks.pre_restore", c.Hooks.PreRestore},
+		{"hooks.post_restore", c.Hooks.PostRestore},
+	}
+	for _, phase := range phases {
+		for i := range phase.hooks {
+			errs = checkHook(&phase.hooks[i], fmt.Sprintf("%s[%d]", phase.key, i), errs)
+		}
+	}
+	return errs
+}
+
+func checkHook(h *Hook, key string, errs []string) []string {
+	switch {
+	case h.Command == "" && h.URL == "":
+		errs = append(errs, key+".command or "+key+".url is required")
+	case h.Command != "" && h.URL != "":
+		errs = append(errs, key+".command and "+key+".url are mutually exclusive")
+	case h.URL != "":
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s.url must be an http or https URL (got: %s)", key, h.URL))
+		}
+	}
+	if len(h.Headers) > 0 && h.URL == "" {
+		errs = append(errs, key+".headers are only used with url")
+	}
+
+	h.TimeoutParsed = DefaultHookTimeout
+	if h.Timeout != "" {
+		duration, err := time.ParseDuration(h.Timeout)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Sprintf("%s.timeout must be a positive duration (got: %s)", key, h.Timeout))
+		} else {
+			h.TimeoutParsed = duration
+		}
+	}
+
+	switch h.OnFailure {
+	case "", HookOnFailureAbort, HookOnFailureWarn:
+	default:
+		errs = append(errs, fmt.Sprintf("%s.on_failure must be one of: abort, warn (got: %s)", key, h.OnFailure))
+	}
+	return errs
+}
+
+func checkSigningConfig(c *Config, errs []string) []string {
+	if c.Signing.PrivateKey != "" && !strings.HasPrefix(c.Signing.PrivateKey, "pgrwl-sign-priv-") {
+		errs = append(errs, "signing.private_key must start with pgrwl-sign-priv-")
+	}
+	for i, k := range c.Signing.PublicKeys {
+		if !strings.HasPrefix(k, "pgrwl-sign-pub-") {
+			errs = append(errs, fmt.Sprintf("signing.public_keys[%d] must start with pgrwl-sign-pub-", i))
+		}
+	}
+	return errs
+}
+
+func checkLockConfig(c *Config, errs []string) []string {
+	if !c.Lock.Enable || c.Lock.TTL == "" {
+		return errs
+	}
+	duration, err := time.ParseDuration(c.Lock.TTL)
+	if err != nil || duration < time.Second {
+		errs = append(errs, fmt.Sprintf("lock.ttl must be a duration of at least 1s (got: %s)", c.Lock.TTL))
+	} else {
+		c.Lock.TTLParsed = duration
 	}
 	return errs
 }
@@ -523,9 +1407,26 @@ func checkStorageConfig(c *Config, errs []string) []string {
 		if sftp.BaseDir == "" {
 			errs = append(errs, "storage.sftp.base_dir is required for sftp storage")
 		}
+		if sftp.HostKeyFingerprint != "" && !strings.HasPrefix(strings.TrimSpace(sftp.HostKeyFingerprint), "SHA256:") {
+			errs = append(errs, "storage.sftp.host_key_fingerprint must be in SHA256:<base64> format")
+		}
+		if sftp.KeepaliveInterval != "" {
+			duration, err := time.ParseDuration(sftp.KeepaliveInterval)
+			if err != nil || duration <= 0 {
+				errs = append(errs, fmt.Sprintf("storage.sftp.keepalive_interval cannot parse: %s, %v", sftp.KeepaliveInterval, err))
+			} else {
+				c.Storage.SFTP.KeepaliveIntervalParsed = duration
+			}
+		}
 	default:
 		errs = append(errs, fmt.Sprintf("unknown storage.name: %q (must be %q or %q)", c.Storage.Name, StorageNameS3, StorageNameSFTP))
 	}
+
+	switch c.Storage.WALLayout {
+	case "", WALLayoutFlat, WALLayoutSharded:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown storage.wal_layout: %q (must be %q or %q)", c.Storage.WALLayout, WALLayoutFlat, WALLayoutSharded))
+	}
 	return errs
 }
 
@@ -562,6 +1463,17 @@ func checkRetentionConfig(c *Config, errs []string) []string {
 		errs = append(errs, "backup.retention.keep_last must be greater than zero")
 	}
 
+	for _, name := range slices.Sorted(maps.Keys(c.Retention.Classes)) {
+		class := c.Retention.Classes[name]
+		keep, err := time.ParseDuration(class.Keep)
+		if err != nil || keep <= 0 {
+			errs = append(errs, fmt.Sprintf("retention.classes.%s.keep must be a positive duration (got: %s)", name, class.Keep))
+			continue
+		}
+		class.KeepParsed = keep
+		c.Retention.Classes[name] = class
+	}
+
 	return errs
 }
 
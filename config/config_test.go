@@ -165,6 +165,40 @@ storage:
 	assert.True(t, Verbose)
 }
 
+func TestLoadDoesNotReplaceProcessConfig(t *testing.T) {
+	resetConfigForTest(t)
+
+	first := writeConfigForTest(t, `main:
+  listen_port: 9090
+  directory: /data/first
+backup:
+  cron: "* * * * *"
+`)
+	second := writeConfigForTest(t, `main:
+  listen_port: 9090
+  directory: /data/second
+backup:
+  cron: "* * * * *"
+storage:
+  compression:
+    algo: zstd
+`)
+
+	_, err := FromFile(first, ModeRepoCMD)
+	assert.NoError(t, err)
+
+	cfg, err := Load(second, ModeRepoCMD)
+	assert.NoError(t, err)
+	assert.Equal(t, "/data/second", cfg.Main.Directory)
+
+	cur, err := Cfg()
+	assert.NoError(t, err)
+	assert.Equal(t, "/data/first", cur.Main.Directory)
+
+	_, err = Load(writeConfigForTest(t, "main: {}\n"), ModeRepoCMD)
+	assert.Error(t, err)
+}
+
 func TestFromEnvsAppliesOverridesAndParsesValues(t *testing.T) {
 	resetConfigForTest(t)
 	setValidReceiveEnvForTest(t)
@@ -183,6 +217,43 @@ func TestFromEnvsAppliesOverridesAndParsesValues(t *testing.T) {
 	assert.True(t, Verbose)
 }
 
+func TestFromEnvsReadsCompressionOverrides(t *testing.T) {
+	resetConfigForTest(t)
+	setValidReceiveEnvForTest(t)
+	t.Setenv("PGRWL_STORAGE_COMPRESSION_ALGO", "zstd")
+	t.Setenv("PGRWL_STORAGE_COMPRESSION_WAL_LEVEL", "1")
+	t.Setenv("PGRWL_STORAGE_COMPRESSION_BACKUPS_ALGO", "xz")
+
+	cfg, err := FromEnvs(ModeReceive)
+	assert.NoError(t, err)
+	algo, level := cfg.Storage.Compression.ForWAL()
+	assert.Equal(t, RepoCompressorZstd, algo)
+	assert.Equal(t, 1, level)
+	algo, level = cfg.Storage.Compression.ForBackups()
+	assert.Equal(t, RepoCompressorXz, algo)
+	assert.Equal(t, 0, level)
+}
+
+func TestCompressionConfig_Resolve(t *testing.T) {
+	c := CompressionConfig{
+		Algo:    RepoCompressorZstd,
+		Level:   3,
+		Backups: CompressionOverride{Level: 19},
+	}
+	algo, level := c.ForWAL()
+	assert.Equal(t, RepoCompressorZstd, algo)
+	assert.Equal(t, 3, level)
+	algo, level = c.ForBackups()
+	assert.Equal(t, RepoCompressorZstd, algo)
+	assert.Equal(t, 19, level)
+
+	// the zstd level does not leak into another codec
+	c.WAL = CompressionOverride{Algo: RepoCompressorLz4}
+	algo, level = c.ForWAL()
+	assert.Equal(t, RepoCompressorLz4, algo)
+	assert.Equal(t, 0, level)
+}
+
 func TestFromEnvsInvalidValuesReturnErrors(t *testing.T) {
 	resetConfigForTest(t)
 	setValidReceiveEnvForTest(t)
@@ -306,6 +377,526 @@ func TestValidate_Config(t *testing.T) {
 				"either storage.sftp.pass or storage.sftp.pkey_path must be provided",
 			},
 		},
+		{
+			name: "invalid sftp host key fingerprint and keepalive",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+					Uploader: UploadConfig{
+						SyncInterval:   "10s",
+						MaxConcurrency: 1,
+					},
+				},
+				Storage: StorageConfig{
+					Name: StorageNameSFTP,
+					SFTP: SFTPConfig{
+						Host:               "host",
+						Port:               22,
+						User:               "user",
+						PKeyPath:           "/id_ed25519",
+						BaseDir:            "/wal",
+						HostKeyFingerprint: "MD5:aa:bb",
+						KeepaliveInterval:  "soon",
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"storage.sftp.host_key_fingerprint must be in SHA256:<base64> format",
+				"storage.sftp.keepalive_interval cannot parse",
+			},
+		},
+		{
+			name: "unknown wal layout",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					WALLayout: "nested",
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				`unknown storage.wal_layout: "nested"`,
+			},
+		},
+		{
+			name: "invalid lock ttl",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Lock: LockConfig{
+					Enable: true,
+					TTL:    "500ms",
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"lock.ttl must be a duration of at least 1s",
+			},
+		},
+		{
+			name: "x25519 restore without private key",
+			mode: ModeRestoreCMD,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo:      RepoEncryptorX25519,
+						PublicKey: "pgrwl-pub-AAAA",
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"storage.encryption.private_key is required for x25519 in restore mode",
+			},
+		},
+		{
+			name: "backup verify with write-only encryption",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo:      RepoEncryptorX25519,
+						PublicKey: "pgrwl-pub-AAAA",
+					},
+				},
+				Backup: BackupConfig{
+					Cron:   "0 2 * * *",
+					Verify: true,
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.verify requires storage.encryption.private_key with x25519, the receiver cannot read the archives otherwise",
+			},
+		},
+		{
+			name: "envelope encryption without kek provider",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo: RepoEncryptorEnvelope,
+						KEK: KEKConfig{
+							Provider: "vault",
+							Timeout:  "soon",
+						},
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				`unknown storage.encryption.kek.provider: "vault"`,
+				"storage.encryption.kek.timeout cannot parse",
+			},
+		},
+		{
+			name: "chacha20-poly1305 without pass",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo: RepoEncryptorChaCha20Poly1305,
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"storage.encryption.pass is required for chacha20-poly1305",
+			},
+		},
+		{
+			name: "invalid compression levels",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Compression: CompressionConfig{
+						Algo:        RepoCompressorZstd,
+						Level:       23,
+						Concurrency: -1,
+						WAL:         CompressionOverride{Algo: "brotli"},
+						Backups:     CompressionOverride{Algo: RepoCompressorXz, Level: 10},
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"storage.compression.level must be in 1..22 for zstd (got: 23)",
+				"unsupported compression algo: brotli",
+				"storage.compression.backups.level must be in 1..9 for xz (got: 10)",
+				"storage.compression.concurrency must be >= 0",
+			},
+		},
+		{
+			name: "kdf parameters out of range",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo: RepoEncryptorChaCha20Poly1305,
+						Pass: "pass",
+						KDF:  KDFConfig{Time: 65, MemoryMiB: 8192},
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"storage.encryption.kdf.time must be in 1..64 (got: 65)",
+				"storage.encryption.kdf.memory_mib must be in 1..4096 (got: 8192)",
+			},
+		},
+		{
+			name: "kdf memory below 8 KiB per thread",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo: RepoEncryptorAes256Gcm,
+						Pass: "pass",
+						KDF:  KDFConfig{MemoryMiB: 1, Threads: 200},
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"storage.encryption.kdf.memory_mib must be at least 8 KiB per thread, 200 threads need 1600 KiB (got: 1 MiB)",
+			},
+		},
+		{
+			name: "invalid signing keys",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Signing: SigningConfig{
+					PrivateKey: "pgrwl-sign-pub-AAAA",
+					PublicKeys: []string{"pgrwl-sign-pub-AAAA", "AAAA"},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"signing.private_key must start with pgrwl-sign-priv-",
+				"signing.public_keys[1] must start with pgrwl-sign-pub-",
+			},
+		},
+		{
+			name: "invalid server compression",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					ServerCompression: CompressionOverride{Algo: RepoCompressorXz},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.server_compression.algo must be one of: gzip, lz4, zstd",
+			},
+		},
+		{
+			name: "negative incremental max chain",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Incremental: IncrementalConfig{Enable: true, MaxChain: -1},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.incremental.max_chain must not be negative (got: -1)",
+			},
+		},
+		{
+			name: "invalid backup source wal wait timeout",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Source: BackupSourceConfig{Conninfo: "host=standby", WALWaitTimeout: "soon"},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.source.wal_wait_timeout must be a positive duration (got: soon)",
+			},
+		},
+		{
+			name: "invalid backup schedules",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Cron: "0 2 * * *",
+					Schedules: []BackupSchedule{
+						{Name: "weekly", Cron: "0 2 * * 0", Type: "differential", Timeout: "-1h"},
+						{Name: "weekly", Cron: "", RetentionClass: "monthly"},
+					},
+					Timezone:  "Mars/Olympus",
+					Blackouts: []BlackoutWindow{{Days: []string{"monday"}, Start: "25:00", End: "18:00"}},
+				},
+				Retention: RetentionConfig{
+					Enable:  true,
+					Value:   "72h",
+					Classes: map[string]RetentionClass{"weekly": {Keep: "forever"}},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.cron and backup.schedules are mutually exclusive",
+				"backup.schedules[0].type must be one of: full, incremental (got: differential)",
+				"backup.schedules[0].timeout must be a positive duration (got: -1h)",
+				"backup.schedules[1].name must be unique (got: weekly)",
+				"backup.schedules[1].cron is required",
+				"backup.schedules[1].retention_class is not defined in retention.classes (got: monthly)",
+				"backup.timezone is not a known time zone (got: Mars/Olympus)",
+				"backup.blackouts[0].start must be a time of day, HH:MM (got: 25:00)",
+				"backup.blackouts[0].days must be one of: mon, tue, wed, thu, fri, sat, sun (got: monday)",
+				"retention.classes.weekly.keep must be a positive duration (got: forever)",
+			},
+		},
+		{
+			name: "missing backup schedule",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.cron or backup.schedules is required",
+			},
+		},
+		{
+			name: "invalid backup split",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Cron:              "0 2 * * *",
+					ServerCompression: CompressionOverride{Algo: RepoCompressorZstd},
+					Split:             SplitConfig{Size: "5GiB", Retries: -1},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.split.retries must not be negative (got: -1)",
+				"backup.split and backup.server_compression are mutually exclusive",
+			},
+		},
+		{
+			name: "backup split size too small",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Cron:  "0 2 * * *",
+					Split: SplitConfig{Size: "64KiB"},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.split.size must be a size of at least 1MiB, e.g. 4GiB (got: 64KiB)",
+			},
+		},
+		{
+			name: "invalid backup cleanup grace period",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Cron:    "0 2 * * *",
+					Cleanup: BackupCleanupConfig{Enable: true, GracePeriod: "-1h"},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"backup.cleanup.grace_period must be a positive duration (got: -1h)",
+			},
+		},
+		{
+			name: "invalid hooks",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Backup: BackupConfig{
+					Cron: "0 2 * * *",
+				},
+				Hooks: HooksConfig{
+					PreBackup: []Hook{
+						{Name: "empty"},
+						{Command: "true", URL: "https://example.com"},
+					},
+					PostBackup: []Hook{
+						{URL: "ftp://example.com", Timeout: "soon", OnFailure: "ignore"},
+					},
+					PostRestore: []Hook{
+						{Command: "true", Headers: map[string]string{"X-Token": "t"}},
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				"hooks.pre_backup[0].command or hooks.pre_backup[0].url is required",
+				"hooks.pre_backup[1].command and hooks.pre_backup[1].url are mutually exclusive",
+				"hooks.post_backup[0].url must be an http or https URL (got: ftp://example.com)",
+				"hooks.post_backup[0].timeout must be a positive duration (got: soon)",
+				"hooks.post_backup[0].on_failure must be one of: abort, warn (got: ignore)",
+				"hooks.post_restore[0].headers are only used with url",
+			},
+		},
+		{
+			name: "invalid encryption keyring",
+			mode: ModeReceive,
+			cfg: &Config{
+				Main: MainConfig{
+					ListenPort: 1234,
+					Directory:  "/data",
+				},
+				Receiver: ReceiveConfig{
+					Slot: "slot",
+				},
+				Storage: StorageConfig{
+					Encryption: EncryptionConfig{
+						Algo: RepoEncryptorAes256Gcm,
+						Keys: []EncryptionKey{
+							{ID: "2025", Pass: "old"},
+							{ID: "2025", Pass: "new"},
+							{ID: "bad id", Pass: "x"},
+						},
+						ActiveKey: "2026",
+					},
+				},
+			},
+			expectError: true,
+			wantMsgs: []string{
+				`storage.encryption.keys[1].id is duplicated: "2025"`,
+				`storage.encryption.keys[2].id must be 1-255 characters`,
+				`storage.encryption.active_key "2026" is not in storage.encryption.keys`,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -381,3 +972,102 @@ func setValidReceiveEnvForTest(t *testing.T) {
 	t.Setenv("PGRWL_STORAGE_S3_BUCKET", "env-bucket")
 	t.Setenv("PGRWL_STORAGE_S3_REGION", "us-east-1")
 }
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1048576", want: 1 << 20},
+		{in: "512MiB", want: 512 << 20},
+		{in: "4GiB", want: 4 << 30},
+		{in: "5 GB", want: 5e9},
+		{in: "1TiB", want: 1 << 40},
+		{in: "10B", want: 10},
+		{in: "GiB", wantErr: true},
+		{in: "1.5GiB", wantErr: true},
+		{in: "-1MiB", wantErr: true},
+		{in: "9000000TiB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if tt.wantErr {
+			assert.Error(t, err, tt.in)
+			continue
+		}
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestHooksConfig(t *testing.T) {
+	cfg := &Config{
+		Main:     MainConfig{ListenPort: 1234, Directory: "/data"},
+		Receiver: ReceiveConfig{Slot: "slot"},
+		Backup:   BackupConfig{Cron: "0 2 * * *"},
+		Hooks: HooksConfig{
+			PreBackup:  []Hook{{Name: "pause", Command: "batchctl pause", Timeout: "30s"}},
+			PostBackup: []Hook{{Name: "notify", URL: "https://hooks.example.com/pgrwl", OnFailure: HookOnFailureWarn}},
+		},
+	}
+	assert.NoError(t, validate(cfg, ModeReceive))
+
+	pre, post := &cfg.Hooks.PreBackup[0], &cfg.Hooks.PostBackup[0]
+	assert.Equal(t, 30*time.Second, pre.TimeoutParsed)
+	assert.True(t, pre.Abort())
+	assert.Equal(t, DefaultHookTimeout, post.TimeoutParsed)
+	assert.False(t, post.Abort())
+}
+
+func TestBackupSchedulesAndBlackouts(t *testing.T) {
+	cfg := &Config{
+		Main:     MainConfig{ListenPort: 1234, Directory: "/data"},
+		Receiver: ReceiveConfig{Slot: "slot"},
+		Backup: BackupConfig{
+			Schedules: []BackupSchedule{
+				{Name: "weekly-full", Cron: "0 2 * * 0", Type: BackupTypeFull, Timeout: "6h", RetentionClass: "weekly"},
+				{Name: "daily", Cron: "0 2 * * 1-6", Type: BackupTypeIncremental},
+			},
+			Timezone: "Europe/Berlin",
+			Blackouts: []BlackoutWindow{
+				{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00"},
+				{Days: []string{"sat"}, Start: "22:00", End: "02:00"},
+			},
+		},
+		Retention: RetentionConfig{
+			Enable:  true,
+			Value:   "72h",
+			Classes: map[string]RetentionClass{"weekly": {Keep: "720h"}},
+		},
+	}
+	assert.NoError(t, validate(cfg, ModeReceive))
+
+	assert.Equal(t, 6*time.Hour, cfg.Backup.Schedules[0].TimeoutParsed)
+	assert.Equal(t, 720*time.Hour, cfg.Retention.Classes["weekly"].KeepParsed)
+	assert.Equal(t, "Europe/Berlin", cfg.Backup.Location().String())
+	assert.Len(t, cfg.Backup.AllSchedules(), 2)
+
+	loc := cfg.Backup.Location()
+	at := func(day, hour, minute int) time.Time {
+		// 2026-10-05 is a Monday
+		return time.Date(2026, 10, 4+day, hour, minute, 0, 0, loc)
+	}
+	business, overnight := &cfg.Backup.Blackouts[0], &cfg.Backup.Blackouts[1]
+
+	assert.True(t, business.Contains(at(1, 8, 0)))
+	assert.True(t, business.Contains(at(5, 17, 59)))
+	assert.False(t, business.Contains(at(1, 18, 0)))
+	assert.False(t, business.Contains(at(6, 12, 0)))
+
+	assert.True(t, overnight.Contains(at(6, 23, 0)))
+	assert.True(t, overnight.Contains(at(7, 1, 30)), "sunday morning belongs to the saturday window")
+	assert.False(t, overnight.Contains(at(7, 23, 0)))
+	assert.False(t, overnight.Contains(at(6, 1, 30)))
+}
+
+func TestBackupConfigAllSchedulesFromCron(t *testing.T) {
+	c := BackupConfig{Cron: "0 2 * * *"}
+	assert.Equal(t, []BackupSchedule{{Name: DefaultScheduleName, Cron: "0 2 * * *"}}, c.AllSchedules())
+	assert.Equal(t, time.Local, c.Location())
+}
@@ -37,6 +37,7 @@ type pgReceiveWal struct {
 	noLoop           bool
 	streamMu         sync.RWMutex
 	stream           *StreamCtl // current active stream (or nil)
+	systemID         string     // of the cluster streamed from, once identified
 }
 
 var _ PgReceiveWal = &pgReceiveWal{}
@@ -168,6 +169,9 @@ func (pgrw *pgReceiveWal) streamLog(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("cannot identify system: %w", err)
 	}
+	pgrw.streamMu.Lock()
+	pgrw.systemID = sysident.SystemID
+	pgrw.streamMu.Unlock()
 
 	// 4
 	streamStartLSN, streamStartTimeline, err := pgrw.findStreamingStart()
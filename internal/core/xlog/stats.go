@@ -4,6 +4,7 @@ import "time"
 
 type StreamStatus struct {
 	Slot         string `json:"slot,omitempty"`
+	SystemID     string `json:"system_id,omitempty"`
 	Timeline     uint32 `json:"timeline,omitempty"`
 	LastFlushLSN string `json:"last_flush_lsn,omitempty"`
 	Uptime       string `json:"uptime,omitempty"`
@@ -31,5 +32,7 @@ func (pgrw *pgReceiveWal) Status() *StreamStatus {
 			Running: false,
 		}
 	}
-	return pgrw.stream.Status()
+	status := pgrw.stream.Status()
+	status.SystemID = pgrw.systemID
+	return status
 }
@@ -3,12 +3,18 @@ package serveapi
 import (
 	"net/http"
 
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 )
 
 type Opts struct {
 	BaseDir string
 	Storage *st.VariadicStorage
+
+	// WALIndex, when set, verifies WAL files fetched from the storage
+	// against the signed WAL manifests.
+	WALIndex      *signing.WALIndex
+	AllowUnsigned bool
 }
 
 func Init(opts *Opts) http.Handler {
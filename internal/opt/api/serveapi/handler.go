@@ -31,7 +31,9 @@ func (c *Handler) WalFileDownloadHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	// TODO: send checksum in headers
+	if vf, ok := file.(*verifiedFile); ok {
+		w.Header().Set(ChecksumHeader, vf.sha256)
+	}
 
 	_, err = io.Copy(w, file)
 	if err != nil {
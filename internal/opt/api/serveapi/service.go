@@ -1,7 +1,11 @@
 package serveapi
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,6 +14,7 @@ import (
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/fsx"
 
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 
 	"github.com/pgrwl/pgrwl/internal/core/xlog"
@@ -20,18 +25,34 @@ type Service interface {
 }
 
 type svc struct {
-	l       *slog.Logger
-	baseDir string
-	storage *st.VariadicStorage
+	l             *slog.Logger
+	baseDir       string
+	storage       *st.VariadicStorage
+	walIndex      *signing.WALIndex
+	allowUnsigned bool
 }
 
+// ChecksumHeader carries the SHA-256 of a WAL file verified against a
+// signed manifest, restore-command compares it with what it received.
+const ChecksumHeader = "X-Pgrwl-Sha256"
+
+// verifiedFile is a WAL file whose content matched its signed manifest.
+type verifiedFile struct {
+	io.Reader
+	sha256 string
+}
+
+func (f *verifiedFile) Close() error { return nil }
+
 var _ Service = &svc{}
 
 func NewService(opts *Opts) Service {
 	return &svc{
-		l:       slog.With("component", "serve-service"),
-		baseDir: opts.BaseDir,
-		storage: opts.Storage,
+		l:             slog.With("component", "serve-service"),
+		baseDir:       opts.BaseDir,
+		storage:       opts.Storage,
+		walIndex:      opts.WALIndex,
+		allowUnsigned: opts.AllowUnsigned,
 	}
 }
 
@@ -71,8 +92,46 @@ func (s *svc) GetWalFile(ctx context.Context, filename string) (io.ReadCloser, e
 	// 3) trying remote
 	if s.storage != nil {
 		s.log().Debug("wal-restore, fetching remote file", slog.String("filename", filename))
+		if s.walIndex != nil {
+			return s.getVerified(ctx, filename)
+		}
 		return s.storage.Get(ctx, filename)
 	}
 
 	return nil, fmt.Errorf("cannot fetch file: %s", filename)
 }
+
+// getVerified reads a remote WAL file into memory and checks it against the
+// signed manifests before any byte is sent, PostgreSQL must never replay a
+// modified segment.
+func (s *svc) getVerified(ctx context.Context, filename string) (io.ReadCloser, error) {
+	want, err := s.walIndex.Lookup(ctx, filename)
+	if errors.Is(err, signing.ErrUnsigned) && s.allowUnsigned {
+		s.log().Warn("wal-restore, file is not signed", slog.String("filename", filename))
+		return s.storage.Get(ctx, filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := s.storage.Get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	if err := rc.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	if int64(len(data)) != want.Size || got != want.SHA256 {
+		s.log().Error("wal-restore, checksum mismatch", slog.String("filename", filename))
+		return nil, fmt.Errorf("checksum mismatch for %s: the file was modified", filename)
+	}
+	return &verifiedFile{Reader: bytes.NewReader(data), sha256: got}, nil
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"path/filepath"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
+
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// NewSigner returns nil when no signing key is configured.
+func NewSigner(cfg *config.Config) (*signing.Signer, error) {
+	if cfg.Signing.PrivateKey == "" {
+		return nil, nil
+	}
+	return signing.NewSigner(cfg.Signing.PrivateKey)
+}
+
+// NewVerifier returns nil when signing is not configured.
+func NewVerifier(cfg *config.Config) (*signing.Verifier, error) {
+	if !cfg.Signing.Enabled() {
+		return nil, nil
+	}
+	keys := cfg.Signing.PublicKeys
+	if cfg.Signing.PrivateKey != "" {
+		signer, err := signing.NewSigner(cfg.Signing.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append([]string{signer.PublicKey()}, keys...)
+	}
+	return signing.NewVerifier(keys...)
+}
+
+// SetupWALManifestStorage returns the storage of the signed WAL manifests.
+func SetupWALManifestStorage(cfg *config.Config) (*st.VariadicStorage, error) {
+	return SetupStorage(&SetupStorageOpts{
+		BaseDir: filepath.ToSlash(cfg.Main.Directory),
+		SubPath: config.WALManifestSubpath,
+		Cfg:     cfg,
+	})
+}
@@ -6,7 +6,12 @@ import (
 	"strings"
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/aesgcm"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/chacha"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/envelope"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/kdf"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/x25519"
 
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 
@@ -21,27 +26,84 @@ type SetupStorageOpts struct {
 	// such as base backups). For WAL uploads set this to the WAL segment
 	// size (16 MiB) so each segment is uploaded as a single part.
 	S3PartSizeBytes int64
+	// WALLayout places WAL files written through the storage, set it
+	// for the WAL archive only.
+	WALLayout string
+	// Cfg takes the storage settings from another config than the one
+	// of the process, e.g. the target of 'repo copy'.
+	Cfg *config.Config
 }
 
 func SetupStorage(opts *SetupStorageOpts) (*st.VariadicStorage, error) {
-	cfg, err := config.Cfg()
+	stor, err := setupStorage(opts)
 	if err != nil {
 		return nil, err
 	}
+	if opts.WALLayout != "" {
+		stor.SetWALLayout(st.WALLayout(opts.WALLayout))
+	}
+	return stor, nil
+}
+
+func setupStorage(opts *SetupStorageOpts) (*st.VariadicStorage, error) {
+	cfg := opts.Cfg
+	if cfg == nil {
+		var err error
+		cfg, err = config.Cfg()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aes, err := newAESCrypter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	x, err := newX25519Crypter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	env, err := newEnvelopeCrypter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// every codec stays readable, the level applies to the one used for writes
+	compression, level := compressionFor(cfg, opts.SubPath)
+	levelOf := func(algo string) int {
+		if algo == compression {
+			return level
+		}
+		return 0
+	}
 
 	// storage configs
 	alg := st.Algorithms{
 		Gzip: &st.CodecPair{
-			Compressor:   codec.GzipCompressor{},
+			Compressor:   codec.GzipCompressor{Level: levelOf(config.RepoCompressorGzip)},
 			Decompressor: codec.GzipDecompressor{},
 		},
 		Zstd: &st.CodecPair{
-			Compressor:   codec.ZstdCompressor{},
+			Compressor: codec.ZstdCompressor{
+				Level:       levelOf(config.RepoCompressorZstd),
+				Concurrency: cfg.Storage.Compression.Concurrency,
+			},
 			Decompressor: codec.ZstdDecompressor{},
 		},
-		AES: aesgcm.NewChunkedGCMCrypter(cfg.Storage.Encryption.Pass),
+		Lz4: &st.CodecPair{
+			Compressor:   codec.Lz4Compressor{Level: levelOf(config.RepoCompressorLz4)},
+			Decompressor: codec.Lz4Decompressor{},
+		},
+		Xz: &st.CodecPair{
+			Compressor:   codec.XzCompressor{Level: levelOf(config.RepoCompressorXz)},
+			Decompressor: codec.XzDecompressor{},
+		},
+		AES:      aes,
+		ChaCha:   &chacha.ChunkedChaChaCrypter{Password: cfg.Storage.Encryption.Pass, KDF: kdfParams(cfg)},
+		X25519:   x,
+		Envelope: env,
 	}
-	writeExt := getWriteExt(cfg)
+	writeExt := getWriteExt(cfg, compression)
 
 	baseDir := filepath.ToSlash(opts.BaseDir)
 	if strings.TrimSpace(opts.SubPath) != "" {
@@ -71,12 +133,16 @@ func SetupStorage(opts *SetupStorageOpts) (*st.VariadicStorage, error) {
 			User:       cfg.Storage.SFTP.User,
 			PkeyPath:   cfg.Storage.SFTP.PKeyPath,
 			Passphrase: cfg.Storage.SFTP.PKeyPass,
+
+			KnownHostsPath:     cfg.Storage.SFTP.KnownHosts,
+			HostKeyFingerprint: cfg.Storage.SFTP.HostKeyFingerprint,
+			KeepaliveInterval:  cfg.Storage.SFTP.KeepaliveIntervalParsed,
 		})
 		if err != nil {
 			return nil, err
 		}
 		remotePath := filepath.ToSlash(filepath.Join(cfg.Storage.SFTP.BaseDir, baseDir))
-		backend := st.NewSFTPStorage(client.SFTPClient(), remotePath)
+		backend := st.NewSFTPStorageWithClient(client, remotePath)
 		return st.NewVariadicStorage(backend, alg, writeExt)
 	}
 
@@ -103,21 +169,112 @@ func SetupStorage(opts *SetupStorageOpts) (*st.VariadicStorage, error) {
 	return nil, fmt.Errorf("unknown storage name: %s", cfg.Storage.Name)
 }
 
-func getWriteExt(cfg *config.Config) string {
+// newAESCrypter returns a keyring crypter when keys are configured, so that
+// objects written under any of them stay readable.
+func newAESCrypter(cfg *config.Config) (crypt.Crypter, error) {
+	enc := cfg.Storage.Encryption
+	if len(enc.Keys) == 0 {
+		return &aesgcm.ChunkedGCMCrypter{Password: enc.Pass, KDF: kdfParams(cfg)}, nil
+	}
+	keys := make(map[string]string, len(enc.Keys))
+	for _, k := range enc.Keys {
+		keys[k.ID] = k.Pass
+	}
+	c, err := aesgcm.NewKeyringGCMCrypter(enc.Pass, keys, enc.ActiveKey)
+	if err != nil {
+		return nil, err
+	}
+	c.(*aesgcm.ChunkedGCMCrypter).KDF = kdfParams(cfg)
+	return c, nil
+}
+
+// kdfParams returns the KDF parameters for new objects, unset ones keep
+// their defaults.
+func kdfParams(cfg *config.Config) kdf.Params {
+	k := cfg.Storage.Encryption.KDF
+	p := kdf.Default
+	if k.Time != 0 {
+		p.Time = k.Time
+	}
+	if k.MemoryMiB != 0 {
+		p.MemoryKiB = k.MemoryMiB * 1024
+	}
+	if k.Threads != 0 {
+		p.Threads = k.Threads
+	}
+	return p
+}
+
+// newX25519Crypter returns nil when no x25519 key is configured.
+func newX25519Crypter(cfg *config.Config) (crypt.Crypter, error) {
+	enc := cfg.Storage.Encryption
+	if enc.PublicKey == "" && enc.PrivateKey == "" {
+		return nil, nil
+	}
+	return x25519.NewCrypter(enc.PublicKey, enc.PrivateKey)
+}
+
+// newEnvelopeCrypter returns nil when no KEK provider is configured.
+func newEnvelopeCrypter(cfg *config.Config) (crypt.Crypter, error) {
+	kek := cfg.Storage.Encryption.KEK
+	var provider envelope.KeyProvider
+	var err error
+	switch kek.Provider {
+	case "":
+		return nil, nil
+	case config.KEKProviderFile:
+		provider, err = envelope.NewFileProvider(kek.File)
+	case config.KEKProviderExec:
+		provider, err = envelope.NewExecProvider(envelope.ExecProviderOpts{
+			WrapCmd:   kek.WrapCmd,
+			UnwrapCmd: kek.UnwrapCmd,
+			Timeout:   kek.TimeoutParsed,
+		})
+	default:
+		return nil, fmt.Errorf("unknown kek provider: %s", kek.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return envelope.NewCrypter(provider, envelope.CipherAES256GCM)
+}
+
+// compressionFor returns the compression of the data kept under subPath:
+// basebackups, or the WAL archive for everything else.
+func compressionFor(cfg *config.Config, subPath string) (algo string, level int) {
+	subPath = filepath.ToSlash(subPath)
+	if subPath == config.BaseBackupSubpath || strings.HasPrefix(subPath, config.BaseBackupSubpath+"/") {
+		return cfg.Storage.Compression.ForBackups()
+	}
+	return cfg.Storage.Compression.ForWAL()
+}
+
+func getWriteExt(cfg *config.Config, compression string) string {
 	enc := ""
 	if cfg.Storage.Encryption.Algo != "" {
 		if cfg.Storage.Encryption.Algo == config.RepoEncryptorAes256Gcm {
 			enc = ".aes"
 		}
-	}
-	com := ""
-	if cfg.Storage.Compression.Algo != "" {
-		if cfg.Storage.Compression.Algo == config.RepoCompressorZstd {
-			com = ".zst"
+		if cfg.Storage.Encryption.Algo == config.RepoEncryptorChaCha20Poly1305 {
+			enc = ".chacha"
 		}
-		if cfg.Storage.Compression.Algo == config.RepoCompressorGzip {
-			com = ".gz"
+		if cfg.Storage.Encryption.Algo == config.RepoEncryptorX25519 {
+			enc = ".x25519"
 		}
+		if cfg.Storage.Encryption.Algo == config.RepoEncryptorEnvelope {
+			enc = ".kek"
+		}
+	}
+	com := ""
+	switch compression {
+	case config.RepoCompressorZstd:
+		com = ".zst"
+	case config.RepoCompressorGzip:
+		com = ".gz"
+	case config.RepoCompressorLz4:
+		com = ".lz4"
+	case config.RepoCompressorXz:
+		com = ".xz"
 	}
 	writeExt := fmt.Sprintf("%s%s", com, enc)
 	return writeExt
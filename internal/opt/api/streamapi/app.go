@@ -50,12 +50,14 @@ func Init(o *Opts) http.Handler {
 
 	// mount routes
 	mux.Handle("POST /api/v1/basebackup", secureChain(http.HandlerFunc(backupHandler.Start)))
+	mux.Handle("DELETE /api/v1/basebackup", secureChain(http.HandlerFunc(backupHandler.Cancel)))
 	mux.Handle("GET /api/v1/basebackup/status", secureChain(http.HandlerFunc(backupHandler.Status)))
 	mux.Handle("GET /api/v1/status", secureChain(http.HandlerFunc(receiveHandler.StatusHandler)))
 	mux.Handle("GET /api/v1/brief-config", secureChain(http.HandlerFunc(receiveHandler.BriefConfig)))
 	mux.Handle("GET /api/v1/redacted-config", secureChain(http.HandlerFunc(receiveHandler.FullRedactedConfig)))
 	mux.Handle("GET /api/v1/wals", secureChain(http.HandlerFunc(receiveHandler.WalsHandler)))
 	mux.Handle("GET /api/v1/backups", secureChain(http.HandlerFunc(receiveHandler.BackupsHandler)))
+	mux.Handle("GET /api/v1/backups/history", secureChain(http.HandlerFunc(receiveHandler.BackupHistoryHandler)))
 
 	initOptionalHandlers(o.Cfg, mux, l)
 	return mux
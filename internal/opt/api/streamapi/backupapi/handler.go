@@ -3,9 +3,12 @@ package backupapi
 import (
 	"context"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backup"
 	"github.com/pgrwl/pgrwl/internal/opt/supervisors/backupsv"
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/httpx"
@@ -21,8 +24,54 @@ func NewHandler(s Service) *Handler {
 	}
 }
 
-func (c *Handler) Start(w http.ResponseWriter, _ *http.Request) {
-	status, err := c.Service.Start()
+// startRequest is the optional JSON body of Start.
+type startRequest struct {
+	Label       string            `json:"label"`
+	Annotations map[string]string `json:"annotations"`
+	Pinned      bool              `json:"pinned"`
+	IncludeWAL  bool              `json:"include_wal"`
+}
+
+// Start triggers a basebackup in the background.
+//
+// The body is optional:
+//
+//	{"label": "...", "annotations": {"key": "value"}, "pinned": true, "include_wal": true}
+//
+// Query parameters:
+//   - include_wal: add the WAL needed to restore the backup to the backup
+func (c *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	var req startRequest
+	if err := httpx.ReadJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"err": "invalid request body: " + err.Error(),
+		})
+		return
+	}
+	if err := backup.ValidateLabels(req.Label, req.Annotations); err != nil {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"err": err.Error(),
+		})
+		return
+	}
+	opts := backupsv.RunOpts{
+		IncludeWAL:  req.IncludeWAL,
+		Label:       req.Label,
+		Annotations: req.Annotations,
+		Pinned:      req.Pinned,
+	}
+	if v := r.URL.Query().Get("include_wal"); v != "" {
+		includeWAL, err := strconv.ParseBool(v)
+		if err != nil {
+			httpx.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"err": "include_wal must be a boolean",
+			})
+			return
+		}
+		opts.IncludeWAL = includeWAL
+	}
+
+	status, err := c.Service.Start(opts)
 	if err != nil {
 		writeStartBackupError(w, err)
 		return
@@ -30,6 +79,29 @@ func (c *Handler) Start(w http.ResponseWriter, _ *http.Request) {
 	httpx.WriteJSON(w, http.StatusOK, status)
 }
 
+// Cancel cancels the running basebackup. The backup is aborted in the
+// background, its final status is reported as "cancelled" by Status.
+func (c *Handler) Cancel(w http.ResponseWriter, _ *http.Request) {
+	if err := c.Service.Cancel(); err != nil {
+		if errors.Is(err, backupsv.ErrNoBackupRunning) {
+			httpx.WriteJSON(w, http.StatusConflict, map[string]any{
+				"status": "not_running",
+				"error":  err.Error(),
+			})
+			return
+		}
+		slog.Error("basebackup cancellation failed", slog.Any("err", err))
+		httpx.WriteJSON(w, http.StatusInternalServerError, map[string]any{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return
+	}
+	httpx.WriteJSON(w, http.StatusAccepted, map[string]any{
+		"status": "cancelling",
+	})
+}
+
 func (c *Handler) Status(w http.ResponseWriter, _ *http.Request) {
 	status := c.Service.Status()
 	httpx.WriteJSON(w, http.StatusOK, status)
@@ -9,7 +9,8 @@ import (
 )
 
 type Service interface {
-	Start() (*backupsv.BackupRunState, error)
+	Start(opts backupsv.RunOpts) (*backupsv.BackupRunState, error)
+	Cancel() error
 	Status() backupsv.BackupRunState
 }
 
@@ -29,7 +30,7 @@ func NewService(opts *Opts) Service {
 	}
 }
 
-func (s *svc) Start() (*backupsv.BackupRunState, error) {
+func (s *svc) Start(opts backupsv.RunOpts) (*backupsv.BackupRunState, error) {
 	if s.supervisor == nil {
 		return nil, fmt.Errorf("backup supervisor is nil")
 	}
@@ -38,7 +39,7 @@ func (s *svc) Start() (*backupsv.BackupRunState, error) {
 		return nil, err
 	}
 
-	state, err := s.supervisor.TriggerAsync(s.appCtx, "manual")
+	state, err := s.supervisor.TriggerAsync(s.appCtx, "manual", opts)
 	if err != nil {
 		return nil, err
 	}
@@ -47,6 +48,19 @@ func (s *svc) Start() (*backupsv.BackupRunState, error) {
 	return state, nil
 }
 
+func (s *svc) Cancel() error {
+	if s.supervisor == nil {
+		return fmt.Errorf("backup supervisor is nil")
+	}
+
+	if err := s.supervisor.Cancel(); err != nil {
+		return err
+	}
+
+	s.l.Info("basebackup cancellation requested")
+	return nil
+}
+
 func (s *svc) Status() backupsv.BackupRunState {
 	if s.supervisor == nil {
 		return backupsv.BackupRunState{
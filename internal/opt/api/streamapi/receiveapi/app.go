@@ -3,6 +3,8 @@ package receiveapi
 import (
 	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/core/xlog"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/lease"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 )
 
@@ -11,4 +13,6 @@ type Opts struct {
 	BaseDir string
 	Storage *st.VariadicStorage
 	Cfg     *config.Config
+	Lease   lease.Lease      // nil when the repository lease is disabled
+	Catalog *catalog.Catalog // nil when backups are listed from their markers only
 }
@@ -1,8 +1,15 @@
 package receiveapi
 
 import (
+	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/httpx"
 )
 
@@ -34,8 +41,139 @@ func (c *Handler) FullRedactedConfig(w http.ResponseWriter, r *http.Request) {
 	httpx.WriteJSON(w, http.StatusOK, briefConfig)
 }
 
+// WalsHandler streams the WAL archive listing as a JSON array.
+//
+// Query parameters:
+//   - prefix: only files whose path starts with it
+//   - contains: only files whose file name contains it, ignoring case
+//   - ext: only files compressed with gz, zst, lz4 or xz, or "plain"
+//   - name_after: only files whose name sorts after it
+//   - start_after: path of the last file of the previous page
+//   - limit: page size, unlimited when absent
+//   - order: "asc" (default) or "desc"
+//   - end_before: with order=desc, path of the last file of the previous page
+//
+// A page shorter than limit is the last one. With order=desc, the last files
+// come first, X-Total-Count is the number of files under prefix and
+// X-Match-Count the number of those passing the other filters.
 func (c *Handler) WalsHandler(w http.ResponseWriter, r *http.Request) {
-	snap, err := c.Service.ListWALFiles(r.Context())
+	q := r.URL.Query()
+	opts := ListWALOpts{
+		Prefix:     q.Get("prefix"),
+		StartAfter: q.Get("start_after"),
+		Contains:   q.Get("contains"),
+		Ext:        q.Get("ext"),
+		NameAfter:  q.Get("name_after"),
+	}
+
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			httpx.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"err": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = n
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		c.walsDesc(w, r, opts, q.Get("end_before"), limit)
+		return
+	default:
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"err": "order must be asc or desc",
+		})
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	written := 0
+	for f, err := range c.Service.ListWALFiles(r.Context(), opts) {
+		if err != nil {
+			if written == 0 {
+				httpx.WriteJSON(w, http.StatusInternalServerError, map[string]string{
+					"err": err.Error(),
+				})
+				return
+			}
+			// The status line is already sent, an unterminated array lets
+			// the client notice the listing is incomplete.
+			slog.Error("cannot stream WAL listing", slog.Any("err", err))
+			return
+		}
+
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, "[")
+		} else {
+			_, _ = io.WriteString(w, ",")
+		}
+		if err := enc.Encode(f); err != nil {
+			return
+		}
+
+		written++
+		if limit > 0 && written >= limit {
+			break
+		}
+	}
+
+	if written == 0 {
+		httpx.WriteJSON(w, http.StatusOK, []WALFile{})
+		return
+	}
+	_, _ = io.WriteString(w, "]\n")
+}
+
+// walsDesc sends the last limit files of the listing, the last one first.
+// Object stores list in ascending order only, so the whole listing is read,
+// keeping only the files of the page.
+func (c *Handler) walsDesc(w http.ResponseWriter, r *http.Request, opts ListWALOpts, endBefore string, limit int) {
+	// the filters and bounds apply here, so that every file is counted
+	filters, startAfter := opts, opts.StartAfter
+	opts = ListWALOpts{Prefix: opts.Prefix}
+
+	var page []WALFile
+	total, matched := 0, 0
+	for f, err := range c.Service.ListWALFiles(r.Context(), opts) {
+		if err != nil {
+			httpx.WriteJSON(w, http.StatusInternalServerError, map[string]string{
+				"err": err.Error(),
+			})
+			return
+		}
+		total++
+		if !filters.match(&f) {
+			continue
+		}
+		matched++
+
+		if f.Path <= startAfter || (endBefore != "" && f.Path >= endBefore) {
+			continue
+		}
+		page = append(page, f)
+		if limit > 0 && len(page) > limit {
+			page = page[1:]
+		}
+	}
+
+	slices.Reverse(page)
+	if page == nil {
+		page = []WALFile{}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("X-Match-Count", strconv.Itoa(matched))
+	httpx.WriteJSON(w, http.StatusOK, page)
+}
+
+func (c *Handler) BackupsHandler(w http.ResponseWriter, r *http.Request) {
+	snap, err := c.Service.ListBackups(r.Context())
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusInternalServerError, map[string]string{
 			"err": err.Error(),
@@ -44,12 +182,62 @@ func (c *Handler) WalsHandler(w http.ResponseWriter, r *http.Request) {
 	httpx.WriteJSON(w, http.StatusOK, snap)
 }
 
-func (c *Handler) BackupsHandler(w http.ResponseWriter, r *http.Request) {
-	snap, err := c.Service.ListBackups(r.Context())
+// BackupHistoryHandler returns the backup runs of the catalog, the latest first.
+//
+// Query parameters:
+//   - status: succeeded, failed or cancelled
+//   - source: what started the runs, e.g. cron or manual
+//   - schedule: name of the schedule
+//   - since, until: RFC 3339 bounds of the start of the runs
+//   - limit: number of runs, unlimited when absent
+func (c *Handler) BackupHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := catalog.Filter{
+		Status:   q.Get("status"),
+		Source:   q.Get("source"),
+		Schedule: q.Get("schedule"),
+	}
+
+	badRequest := func(msg string) {
+		httpx.WriteJSON(w, http.StatusBadRequest, map[string]string{"err": msg})
+	}
+
+	switch f.Status {
+	case "", catalog.StatusSucceeded, catalog.StatusFailed, catalog.StatusCancelled:
+	default:
+		badRequest("status must be one of: succeeded, failed, cancelled")
+		return
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			badRequest(p.name + " must be an RFC 3339 time")
+			return
+		}
+		*p.dst = t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			badRequest("limit must be a positive integer")
+			return
+		}
+		f.Limit = n
+	}
+
+	history, err := c.Service.BackupHistory(r.Context(), f)
 	if err != nil {
 		httpx.WriteJSON(w, http.StatusInternalServerError, map[string]string{
 			"err": err.Error(),
 		})
+		return
 	}
-	httpx.WriteJSON(w, http.StatusOK, snap)
+	httpx.WriteJSON(w, http.StatusOK, history)
 }
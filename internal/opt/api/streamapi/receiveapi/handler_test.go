@@ -0,0 +1,102 @@
+package receiveapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walService lists files, applying the filters as svc does.
+type walService struct {
+	Service
+	files []WALFile
+}
+
+func (s *walService) ListWALFiles(_ context.Context, opts ListWALOpts) iter.Seq2[WALFile, error] {
+	return func(yield func(WALFile, error) bool) {
+		for _, f := range s.files {
+			if f.Path <= opts.StartAfter || !opts.match(&f) {
+				continue
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestListWALOptsMatch(t *testing.T) {
+	files := []WALFile{
+		{Name: "000000010000000000000001", Filename: "000000010000000000000001.zst.aes", Ext: ".zst.aes"},
+		{Name: "000000010000000000000002", Filename: "000000010000000000000002.gz", Ext: ".gz"},
+		{Name: "000000010000000000000003", Filename: "000000010000000000000003.aes", Ext: ".aes"},
+	}
+	match := func(opts ListWALOpts) []string {
+		var names []string
+		for _, f := range files {
+			if opts.match(&f) {
+				names = append(names, f.Name[len(f.Name)-1:])
+			}
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"1", "2", "3"}, match(ListWALOpts{Ext: "all"}))
+	assert.Equal(t, []string{"2"}, match(ListWALOpts{Contains: "02.GZ"}))
+	assert.Equal(t, []string{"1"}, match(ListWALOpts{Ext: "zst"}))
+	assert.Equal(t, []string{"3"}, match(ListWALOpts{Ext: "plain"}))
+	assert.Equal(t, []string{"2", "3"}, match(ListWALOpts{NameAfter: "000000010000000000000001"}))
+}
+
+func TestWalsHandlerDescPages(t *testing.T) {
+	var files []WALFile
+	for i := range 5 {
+		name := fmt.Sprintf("%024X", i+1)
+		ext := ".gz"
+		if i == 2 {
+			ext = ".zst"
+		}
+		files = append(files, WALFile{Name: name, Filename: name + ext, Path: name + ext, Ext: ext})
+	}
+	h := NewHandler(&walService{files: files})
+
+	get := func(query string) ([]WALFile, http.Header) {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.WalsHandler(res, httptest.NewRequest(http.MethodGet, "/api/v1/wals?"+query, nil))
+		require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		var page []WALFile
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+		return page, res.Header()
+	}
+	paths := func(page []WALFile) []string {
+		var p []string
+		for _, f := range page {
+			p = append(p, f.Path)
+		}
+		return p
+	}
+
+	page, header := get("order=desc&limit=2")
+	assert.Equal(t, []string{files[4].Path, files[3].Path}, paths(page))
+	assert.Equal(t, "5", header.Get("X-Total-Count"))
+	assert.Equal(t, "5", header.Get("X-Match-Count"))
+
+	page, _ = get("order=desc&limit=2&end_before=" + files[3].Path)
+	assert.Equal(t, []string{files[2].Path, files[1].Path}, paths(page))
+
+	page, header = get("order=desc&ext=gz&limit=3")
+	assert.Equal(t, []string{files[4].Path, files[3].Path, files[1].Path}, paths(page))
+	assert.Equal(t, "5", header.Get("X-Total-Count"))
+	assert.Equal(t, "4", header.Get("X-Match-Count"))
+
+	page, _ = get("limit=2&start_after=" + files[0].Path)
+	assert.Equal(t, []string{files[1].Path, files[2].Path}, paths(page))
+}
@@ -1,6 +1,9 @@
 package receiveapi
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type StreamStatus struct {
 	Slot         string `json:"slot,omitempty"`
@@ -10,10 +13,21 @@ type StreamStatus struct {
 	Running      bool   `json:"running"`
 }
 
+// LockStatus reports the repository lease as seen by this receiver.
+type LockStatus struct {
+	Owner      string     `json:"owner"`
+	Held       bool       `json:"held"`
+	Holder     string     `json:"holder,omitempty"`
+	HolderHost string     `json:"holder_host,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
 // PgrwlStatus is the top-level status response for the receiver service.
 type PgrwlStatus struct {
 	RunningMode  string        `json:"running_mode"`
 	StreamStatus *StreamStatus `json:"stream_status,omitempty"`
+	Lock         *LockStatus   `json:"lock,omitempty"`
 }
 
 // BriefConfig exposes a minimal, UI-friendly subset of the active config.
@@ -35,20 +49,72 @@ type WALFile struct {
 	Name       string    `json:"name"`
 	Ext        string    `json:"ext"`
 	Filename   string    `json:"filename"`
+	Path       string    `json:"path"`
 	SizeMB     float64   `json:"size_mb"`
 	UploadedAt time.Time `json:"uploaded_at"`
 	Encrypted  bool      `json:"encrypted"`
 }
 
+// ListWALOpts selects a page of the WAL archive listing.
+type ListWALOpts struct {
+	// Prefix keeps only files whose path starts with it.
+	Prefix string
+	// StartAfter is the path of the last file of the previous page.
+	StartAfter string
+	// Contains keeps only files whose file name contains it, ignoring case.
+	Contains string
+	// Ext keeps only files compressed with it ("gz", "zst", "lz4", "xz"), or
+	// not compressed for "plain". Empty and "all" keep every file.
+	Ext string
+	// NameAfter keeps only files whose name, without extensions, sorts after it.
+	NameAfter string
+}
+
+// match reports whether f passes the filters of o.
+func (o *ListWALOpts) match(f *WALFile) bool {
+	if o.NameAfter != "" && f.Name <= o.NameAfter {
+		return false
+	}
+	if o.Contains != "" && !strings.Contains(strings.ToLower(f.Filename), strings.ToLower(o.Contains)) {
+		return false
+	}
+	switch o.Ext {
+	case "", "all":
+		return true
+	case "plain":
+		return walCompression(f.Ext) == ""
+	default:
+		return walCompression(f.Ext) == o.Ext
+	}
+}
+
+// walCompression returns the compression of a WAL file by its extensions,
+// empty when it is not compressed.
+func walCompression(ext string) string {
+	for e := range strings.SplitSeq(ext, ".") {
+		switch e {
+		case "gz", "zst", "lz4", "xz":
+			return e
+		}
+	}
+	return ""
+}
+
 // Backup represents a completed (or in-progress) base backup.
 type Backup struct {
-	Label       string    `json:"label"`
-	Started     time.Time `json:"started"`
-	Finished    time.Time `json:"finished"`
-	SizeGB      float64   `json:"size_gb"`
-	WALStartLSN string    `json:"wal_start_lsn"`
-	WALStopLSN  string    `json:"wal_stop_lsn"`
-	Status      string    `json:"status"`
+	ID          string            `json:"id"`
+	Label       string            `json:"label"`
+	Started     time.Time         `json:"started"`
+	Finished    time.Time         `json:"finished"`
+	SizeGB      float64           `json:"size_gb"`
+	WALStartLSN string            `json:"wal_start_lsn"`
+	WALStopLSN  string            `json:"wal_stop_lsn"`
+	Status      string            `json:"status"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Pinned      bool              `json:"pinned"`
+	// Schedule and RetentionClass are set for backups taken by a schedule.
+	Schedule       string `json:"schedule,omitempty"`
+	RetentionClass string `json:"retention_class,omitempty"`
 }
 
 // Snapshot is the composite payload returned by GET /api/v1/snapshot.
@@ -3,6 +3,7 @@ package receiveapi
 import (
 	"context"
 	"encoding/json"
+	"iter"
 	"log/slog"
 	"path/filepath"
 	"slices"
@@ -11,7 +12,10 @@ import (
 	"github.com/pgrwl/pgrwl/config"
 
 	"github.com/pgrwl/pgrwl/internal/opt/api"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backup"
 	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/lease"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 
 	"github.com/pgrwl/pgrwl/internal/core/xlog"
@@ -21,8 +25,9 @@ type Service interface {
 	Status() *PgrwlStatus
 	BriefConfig(ctx context.Context) (*BriefConfig, error)
 	FullRedactedConfig(ctx context.Context) *config.Config
-	ListWALFiles(ctx context.Context) ([]WALFile, error)
+	ListWALFiles(ctx context.Context, opts ListWALOpts) iter.Seq2[WALFile, error]
 	ListBackups(ctx context.Context) ([]Backup, error)
+	BackupHistory(ctx context.Context, f catalog.Filter) ([]catalog.Entry, error)
 }
 
 type svc struct {
@@ -30,6 +35,8 @@ type svc struct {
 	pgrw    xlog.PgReceiveWal // direct access to running state
 	baseDir string
 	storage *st.VariadicStorage
+	lease   lease.Lease
+	catalog *catalog.Catalog
 }
 
 var _ Service = &svc{}
@@ -40,6 +47,8 @@ func NewService(opts *Opts) Service {
 		pgrw:    opts.PGRW,
 		baseDir: opts.BaseDir,
 		storage: opts.Storage,
+		lease:   opts.Lease,
+		catalog: opts.Catalog,
 	}
 }
 
@@ -66,9 +75,29 @@ func (s *svc) Status() *PgrwlStatus {
 	}
 	return &PgrwlStatus{
 		StreamStatus: streamStatusResp,
+		Lock:         s.lockStatus(),
 	}
 }
 
+func (s *svc) lockStatus() *LockStatus {
+	if s.lease == nil {
+		return nil
+	}
+	ls := s.lease.Status()
+	resp := &LockStatus{
+		Owner:     ls.Owner,
+		Held:      ls.Held,
+		LastError: ls.LastError,
+	}
+	if ls.Holder != nil {
+		expiresAt := ls.Holder.ExpiresAt
+		resp.Holder = ls.Holder.Owner
+		resp.HolderHost = ls.Holder.Hostname
+		resp.ExpiresAt = &expiresAt
+	}
+	return resp
+}
+
 func (s *svc) BriefConfig(_ context.Context) (*BriefConfig, error) {
 	cfg, err := config.Cfg()
 	if err != nil {
@@ -82,51 +111,71 @@ func (s *svc) FullRedactedConfig(_ context.Context) *config.Config {
 	return &c
 }
 
-// ListWALFiles returns metadata for every WAL file currently held in storage.
-func (s *svc) ListWALFiles(ctx context.Context) ([]WALFile, error) {
-	cfg, err := config.Cfg()
-	if err != nil {
-		return nil, err
-	}
+// ListWALFiles streams metadata for the WAL files held in storage that
+// pass the filters of opts, in lexical order of their storage paths.
+func (s *svc) ListWALFiles(ctx context.Context, opts ListWALOpts) iter.Seq2[WALFile, error] {
+	return func(yield func(WALFile, error) bool) {
+		cfg, err := config.Cfg()
+		if err != nil {
+			yield(WALFile{}, err)
+			return
+		}
 
-	encrypted := cfg.Storage.Encryption.Algo != ""
+		encrypted := cfg.Storage.Encryption.Algo != ""
 
-	infos, err := s.storage.ListInfoRaw(ctx, "")
-	if err != nil {
-		return nil, err
+		iterOpts := st.IterateOpts{
+			Prefix:     opts.Prefix,
+			StartAfter: opts.StartAfter,
+		}
+		for fi, err := range s.storage.IterateRaw(ctx, "", iterOpts) {
+			if err != nil {
+				yield(WALFile{}, err)
+				return
+			}
+			f := walFileFromInfo(fi, encrypted)
+			if !opts.match(&f) {
+				continue
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
 	}
+}
 
-	files := make([]WALFile, 0, len(infos))
-	for _, fi := range infos {
-		base := filepath.Base(fi.Path)
+func walFileFromInfo(fi st.FileInfo, encrypted bool) WALFile {
+	base := filepath.Base(fi.Path)
 
-		// logical name (sans transform ext) is fi.Path after VariadicStorage.decodePath
-		// base name without compression/encryption suffix
-		logicalBase := base
-		ext := ""
-		for _, suffix := range []string{".gz.aes", ".zst.aes", ".aes", ".gz", ".zst"} {
-			if strings.HasSuffix(base, suffix) {
-				logicalBase = strings.TrimSuffix(base, suffix)
-				ext = suffix
+	// base name without encryption, then compression suffix
+	logicalBase := base
+	for _, suffixes := range [][]string{
+		{".aes", ".chacha", ".x25519", ".kek"},
+		{".gz", ".zst", ".lz4", ".xz"},
+	} {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(logicalBase, suffix) {
+				logicalBase = strings.TrimSuffix(logicalBase, suffix)
 				break
 			}
 		}
+	}
+	ext := strings.TrimPrefix(base, logicalBase)
 
-		sizeMB := float64(fi.Size) / (1024 * 1024)
-		files = append(files, WALFile{
-			Name:       logicalBase,
-			Ext:        ext,
-			Filename:   base,
-			SizeMB:     sizeMB,
-			UploadedAt: fi.ModTime,
-			Encrypted:  encrypted,
-		})
-	}
-	return files, nil
+	sizeMB := float64(fi.Size) / (1024 * 1024)
+	return WALFile{
+		Name:       logicalBase,
+		Ext:        ext,
+		Filename:   base,
+		Path:       filepath.ToSlash(fi.Path),
+		SizeMB:     sizeMB,
+		UploadedAt: fi.ModTime,
+		Encrypted:  encrypted,
+	}
 }
 
 // ListBackups returns metadata for every base backup stored in the backup subpath.
-// It reads the per-backup manifest JSON to populate size and LSN fields.
+// Completed backups are described by the catalog, the per-backup manifest JSON
+// is read for those it does not know.
 func (s *svc) ListBackups(ctx context.Context) ([]Backup, error) {
 	backupStor, err := api.SetupStorage(&api.SetupStorageOpts{
 		BaseDir: filepath.ToSlash(s.baseDir),
@@ -142,17 +191,38 @@ func (s *svc) ListBackups(ctx context.Context) ([]Backup, error) {
 		return nil, err
 	}
 
+	completed := s.completedBackups(ctx)
+
 	backups := make([]Backup, 0, len(dirs))
 	for dir := range dirs {
-		label := filepath.Base(dir)
+		id := filepath.Base(dir)
 
 		b := Backup{
-			Label:  "pgrwl_" + label,
+			ID:     id,
+			Label:  backup.DefaultLabel(id),
 			Status: "unknown",
 		}
 
+		if e, ok := completed[id]; ok {
+			b.SizeGB = float64(e.BytesTotal) / (1024 * 1024 * 1024)
+			b.WALStartLSN = e.StartLSN
+			b.WALStopLSN = e.StopLSN
+			b.Status = "completed"
+			b.Started = e.StartedAt
+			b.Finished = e.FinishedAt
+			if e.Label != "" {
+				b.Label = e.Label
+			}
+			b.Annotations = e.Annotations
+			b.Pinned = e.Pinned
+			b.Schedule = e.Schedule
+			b.RetentionClass = e.RetentionClass
+			backups = append(backups, b)
+			continue
+		}
+
 		// Try to read the manifest to enrich the entry.
-		manifestPath := filepath.ToSlash(filepath.Join(label, label+".json"))
+		manifestPath := filepath.ToSlash(filepath.Join(id, id+".json"))
 		rc, readErr := backupStor.Get(ctx, manifestPath)
 		if readErr == nil {
 			var result backupdto.Result
@@ -163,6 +233,13 @@ func (s *svc) ListBackups(ctx context.Context) ([]Backup, error) {
 				b.Status = "completed"
 				b.Started = result.StartedAt
 				b.Finished = result.FinishedAt
+				if result.Label != "" {
+					b.Label = result.Label
+				}
+				b.Annotations = result.Annotations
+				b.Pinned = result.Pinned
+				b.Schedule = result.Schedule
+				b.RetentionClass = result.RetentionClass
 			}
 			_ = rc.Close()
 		} else {
@@ -173,12 +250,12 @@ func (s *svc) ListBackups(ctx context.Context) ([]Backup, error) {
 		backups = append(backups, b)
 	}
 
-	// Sort newest first by label (labels are timestamp strings, so lexicographic = chronological).
+	// Sort newest first by ID (IDs are timestamp strings, so lexicographic = chronological).
 	slices.SortFunc(backups, func(a, b Backup) int {
-		if a.Label > b.Label {
+		if a.ID > b.ID {
 			return -1
 		}
-		if a.Label < b.Label {
+		if a.ID < b.ID {
 			return 1
 		}
 		return 0
@@ -186,3 +263,33 @@ func (s *svc) ListBackups(ctx context.Context) ([]Backup, error) {
 
 	return backups, nil
 }
+
+// completedBackups returns the catalog entries of the completed backups by
+// ID, none when the catalog is missing or cannot be read.
+func (s *svc) completedBackups(ctx context.Context) map[string]catalog.Entry {
+	if s.catalog == nil {
+		return nil
+	}
+	entries, err := s.catalog.Entries(ctx)
+	if err != nil {
+		s.log().Warn("cannot read the backup catalog, reading the backup markers", slog.Any("err", err))
+		return nil
+	}
+
+	completed := make(map[string]catalog.Entry, len(entries))
+	for _, e := range entries {
+		if e.Status == catalog.StatusSucceeded && e.BackupID != "" {
+			completed[e.BackupID] = e
+		}
+	}
+	return completed
+}
+
+// BackupHistory returns the backup runs recorded in the catalog, the latest
+// first.
+func (s *svc) BackupHistory(ctx context.Context, f catalog.Filter) ([]catalog.Entry, error) {
+	if s.catalog == nil {
+		return []catalog.Entry{}, nil
+	}
+	return s.catalog.History(ctx, f)
+}
@@ -2,31 +2,75 @@ package backup
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/opt/api"
 	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
 )
 
+const (
+	// connCloseTimeout limits the graceful close of the replication connection.
+	connCloseTimeout = 10 * time.Second
+	// cleanupTimeout limits the deletion of a partial backup.
+	cleanupTimeout = 5 * time.Minute
+)
+
 type CreateBaseBackupOpts struct {
 	Directory string
+
+	// Incremental takes an incremental backup, as backup.incremental.enable does.
+	Incremental bool
+	// Full takes a full backup, even with backup.incremental.enable.
+	Full bool
+
+	// ServerCompression replaces backup.server_compression when not nil.
+	ServerCompression *config.CompressionOverride
+
+	// IncludeWAL makes the backup self-contained, as backup.include_wal does.
+	IncludeWAL bool
+
+	// Label replaces the default "pgrwl_<id>" label of the backup.
+	Label string
+	// Annotations are free-form key/value pairs stored in the marker.
+	Annotations map[string]string
+	// Pinned makes retention keep the backup and the WAL it needs.
+	Pinned bool
+
+	// Schedule is the name of the schedule taking the backup.
+	Schedule string
+	// RetentionClass is recorded in the marker, retention keeps the backup
+	// as the class says.
+	RetentionClass string
+
+	// Progress receives the progress of the backup, may be nil.
+	Progress ProgressFunc
+
+	// Archive is the WAL of the receiver, backups taken from a standby wait
+	// for it. Nil outside of the receiver.
+	Archive WALArchive
 }
 
-func CreateBaseBackup(opts *CreateBaseBackupOpts) (*backupdto.Result, error) {
+// CreateBaseBackup takes a basebackup. When ctx is canceled the backup is
+// aborted on the server and its partially uploaded files are deleted.
+func CreateBaseBackup(ctx context.Context, opts *CreateBaseBackupOpts) (*backupdto.Result, error) {
 	var err error
 
+	if err := ValidateLabels(opts.Label, opts.Annotations); err != nil {
+		return nil, err
+	}
+
 	// setup context
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
 	// timestamp
-	ts := time.Now().UTC().Format("20060102150405")
+	ts := time.Now().UTC().Format(backupdto.IDLayout)
 	loggr := slog.With(slog.String("component", "basebackup"), slog.String("id", ts))
 
 	// setup storage
@@ -39,15 +83,84 @@ func CreateBaseBackup(opts *CreateBaseBackupOpts) (*backupdto.Result, error) {
 		return nil, err
 	}
 
+	cfg, err := config.Cfg()
+	if err != nil {
+		return nil, err
+	}
+
 	// create connection
-	conn, err := pgconn.Connect(ctx, "application_name=pgrwl_basebackup replication=yes")
+	conn, node, err := connect(ctx, cfg.Backup.Source.Conninfo)
 	if err != nil {
 		loggr.Error("cannot establish connection", slog.Any("err", err))
 		return nil, err
 	}
+	// the server aborts a running backup when its connection is closed
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), connCloseTimeout)
+		defer cancel()
+		_ = conn.Close(closeCtx)
+	}()
+	if node.Standby {
+		loggr.Info("taking backup from a standby", slog.String("host", node.Host), slog.Int("timeline", int(node.Timeline)))
+	}
+	signer, err := api.NewSigner(cfg)
+	if err != nil {
+		loggr.Error("cannot init signer", slog.Any("err", err))
+		return nil, err
+	}
+
+	var parent *Parent
+	if !opts.Full && (opts.Incremental || cfg.Backup.Incremental.Enable) {
+		parent, err = incrementalParent(ctx, opts.Directory, cfg)
+		if err != nil {
+			loggr.Error("cannot choose parent backup", slog.Any("err", err))
+			return nil, err
+		}
+		if parent == nil {
+			loggr.Info("no parent backup to take an incremental backup against, taking a full backup")
+		}
+	}
+
+	sc := cfg.Backup.ServerCompression
+	if opts.ServerCompression != nil {
+		sc = *opts.ServerCompression
+	}
+	var compression *ServerCompression
+	if sc.Algo != "" {
+		compression = &ServerCompression{Algo: sc.Algo, Level: sc.Level}
+	}
+
+	var split *SplitOpts
+	if cfg.Backup.Split.SizeParsed > 0 {
+		// split.size bounds the stored parts, compression and encryption included
+		split = &SplitOpts{
+			PartSize: stor.MaxPlainSize(cfg.Backup.Split.SizeParsed),
+			Retries:  cfg.Backup.Split.Retries,
+		}
+	}
 
 	// init module
-	baseBackup, err := NewBaseBackup(conn, stor, ts)
+	baseBackup, err := NewBaseBackup(&BaseBackupOpts{
+		Conn:        conn,
+		Storage:     stor,
+		Timestamp:   ts,
+		Signer:      signer,
+		Parent:      parent,
+		Compression: compression,
+		Split:       split,
+		IncludeWAL:  opts.IncludeWAL || cfg.Backup.IncludeWAL,
+		Progress:    opts.Progress,
+		Label:       opts.Label,
+		Annotations: opts.Annotations,
+		Pinned:      opts.Pinned,
+
+		Schedule:       opts.Schedule,
+		RetentionClass: opts.RetentionClass,
+
+		Node:           node,
+		Archive:        opts.Archive,
+		WALWaitTimeout: cfg.Backup.Source.WALWaitTimeoutParsed,
+	})
 	if err != nil {
 		loggr.Error("cannot init basebackup module", slog.Any("err", err))
 		return nil, err
@@ -56,10 +169,50 @@ func CreateBaseBackup(opts *CreateBaseBackupOpts) (*backupdto.Result, error) {
 	// stream basebackup to defined storage
 	bbResult, err := baseBackup.StreamBackup(ctx)
 	if err != nil {
-		loggr.Error("cannot create basebackup", slog.Any("err", err))
+		if errors.Is(err, context.Canceled) {
+			loggr.Warn("basebackup canceled", slog.Any("err", err))
+		} else {
+			loggr.Error("cannot create basebackup", slog.Any("err", err))
+		}
+		removePartial(ctx, loggr, opts.Directory, ts)
 		return nil, err
 	}
 
 	loggr.Info("basebackup successfully created")
 	return bbResult, nil
 }
+
+// removePartial deletes the files of a failed backup. It runs after ctx is
+// canceled, on a context of its own.
+func removePartial(ctx context.Context, loggr *slog.Logger, dir, id string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	stor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir: dir,
+		SubPath: config.BaseBackupSubpath,
+	})
+	if err == nil {
+		err = stor.DeleteDir(ctx, id)
+	}
+	if err != nil {
+		loggr.Warn("cannot delete partial basebackup", slog.Any("err", err))
+		return
+	}
+	loggr.Info("partial basebackup deleted")
+}
+
+func incrementalParent(ctx context.Context, dir string, cfg *config.Config) (*Parent, error) {
+	stor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir: dir,
+		SubPath: config.BaseBackupSubpath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	maxChain := cfg.Backup.Incremental.MaxChain
+	if maxChain == 0 {
+		maxChain = config.DefaultIncrementalMaxChain
+	}
+	return chooseParent(ctx, stor, maxChain)
+}
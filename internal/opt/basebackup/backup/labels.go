@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxLabelLen           = 128
+	maxAnnotationKeyLen   = 63
+	maxAnnotationValueLen = 256
+)
+
+var annotationKeyRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// DefaultLabel is the label of a backup taken without one.
+func DefaultLabel(id string) string {
+	return "pgrwl_" + id
+}
+
+// ValidateLabels checks a backup label and annotations. The label ends up
+// in the backup_label file of the server, it must be a single line.
+func ValidateLabels(label string, annotations map[string]string) error {
+	if len(label) > maxLabelLen {
+		return fmt.Errorf("label is longer than %d bytes", maxLabelLen)
+	}
+	if strings.ContainsFunc(label, unicode.IsControl) {
+		return fmt.Errorf("label must not contain control characters")
+	}
+	for k, v := range annotations {
+		if len(k) > maxAnnotationKeyLen || !annotationKeyRe.MatchString(k) {
+			return fmt.Errorf("invalid annotation key %q: up to %d letters, digits, '.', '_', '-' or '/'", k, maxAnnotationKeyLen)
+		}
+		if len(v) > maxAnnotationValueLen {
+			return fmt.Errorf("annotation %q is longer than %d bytes", k, maxAnnotationValueLen)
+		}
+		if strings.ContainsFunc(v, unicode.IsControl) {
+			return fmt.Errorf("annotation %q must not contain control characters", k)
+		}
+	}
+	return nil
+}
+
+// ParseAnnotations parses "key=value" pairs, as given on the command line.
+func ParseAnnotations(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	annotations := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("annotation %q must be key=value", pair)
+		}
+		annotations[k] = v
+	}
+	return annotations, nil
+}
@@ -0,0 +1,33 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels("", nil))
+	assert.NoError(t, ValidateLabels("pre-upgrade-17", map[string]string{"ticket": "OPS-1234", "team/owner": "dba"}))
+
+	assert.ErrorContains(t, ValidateLabels(strings.Repeat("x", 129), nil), "longer than 128")
+	assert.ErrorContains(t, ValidateLabels("two\nlines", nil), "control characters")
+	assert.ErrorContains(t, ValidateLabels("", map[string]string{"": "x"}), "invalid annotation key")
+	assert.ErrorContains(t, ValidateLabels("", map[string]string{"a b": "x"}), "invalid annotation key")
+	assert.ErrorContains(t, ValidateLabels("", map[string]string{"k": strings.Repeat("v", 257)}), "longer than 256")
+}
+
+func TestParseAnnotations(t *testing.T) {
+	got, err := ParseAnnotations([]string{"ticket=OPS-1234", "note=a=b", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ticket": "OPS-1234", "note": "a=b", "empty": ""}, got)
+
+	got, err = ParseAnnotations(nil)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	_, err = ParseAnnotations([]string{"ticket"})
+	assert.ErrorContains(t, err, "must be key=value")
+}
@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// chooseParent returns the parent for the next incremental backup: the
+// latest complete backup, as long as its chain is shorter than maxChain.
+// It returns nil when the next backup has to be a full one.
+func chooseParent(ctx context.Context, stor st.Storage, maxChain int) (*Parent, error) {
+	dirs, err := stor.ListTopLevelDirs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	ids := slices.Sorted(maps.Keys(dirs))
+
+	for _, id := range slices.Backward(ids) {
+		markerPath := path.Join(id, id+".json")
+		ok, err := stor.Exists(ctx, markerPath)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// an unfinished or failed backup, it cannot be a parent
+			slog.Debug("skipping backup without marker", slog.String("id", id))
+			continue
+		}
+
+		var result backupdto.Result
+		if err := readJSON(ctx, stor, markerPath, &result); err != nil {
+			return nil, err
+		}
+		if len(result.Chain) >= maxChain {
+			return nil, nil
+		}
+
+		manifestPath := path.Join(id, backupdto.ManifestFileName)
+		ok, err = stor.Exists(ctx, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// taken before the raw manifest was stored
+			return nil, nil
+		}
+		manifest, err := readObject(ctx, stor, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		return &Parent{ID: id, Chain: result.Chain, Manifest: manifest}, nil
+	}
+	return nil, nil
+}
+
+func readObject(ctx context.Context, stor st.Storage, p string) ([]byte, error) {
+	rc, err := stor.Get(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", p, err)
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, fmt.Errorf("read %s: %w", p, err)
+	}
+	return data, rc.Close()
+}
+
+func readJSON(ctx context.Context, stor st.Storage, p string, v any) error {
+	data, err := readObject(ctx, stor, p)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putTestBackup(t *testing.T, stor st.Storage, id string, chain []string, withManifest bool) {
+	t.Helper()
+	ctx := context.Background()
+
+	result := backupdto.Result{ID: id, Chain: chain}
+	if len(chain) > 0 {
+		result.Parent = chain[len(chain)-1]
+	}
+	marker, err := json.Marshal(result)
+	require.NoError(t, err)
+	require.NoError(t, stor.Put(ctx, id+"/base.tar", strings.NewReader("tar")))
+	require.NoError(t, stor.Put(ctx, id+"/"+id+".json", strings.NewReader(string(marker))))
+	if withManifest {
+		require.NoError(t, stor.Put(ctx, id+"/"+backupdto.ManifestFileName, strings.NewReader("manifest of "+id)))
+	}
+}
+
+func TestChooseParent(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no backups", func(t *testing.T) {
+		parent, err := chooseParent(ctx, st.NewInMemoryStorage(), 6)
+		require.NoError(t, err)
+		assert.Nil(t, parent)
+	})
+
+	t.Run("latest complete backup", func(t *testing.T) {
+		stor := st.NewInMemoryStorage()
+		putTestBackup(t, stor, "20250101000000", nil, true)
+		putTestBackup(t, stor, "20250102000000", []string{"20250101000000"}, true)
+		// a backup in progress has no marker yet
+		require.NoError(t, stor.Put(ctx, "20250103000000/base.tar", strings.NewReader("tar")))
+
+		parent, err := chooseParent(ctx, stor, 6)
+		require.NoError(t, err)
+		require.NotNil(t, parent)
+		assert.Equal(t, "20250102000000", parent.ID)
+		assert.Equal(t, []string{"20250101000000"}, parent.Chain)
+		assert.Equal(t, "manifest of 20250102000000", string(parent.Manifest))
+	})
+
+	t.Run("chain is full", func(t *testing.T) {
+		stor := st.NewInMemoryStorage()
+		putTestBackup(t, stor, "20250101000000", nil, true)
+		putTestBackup(t, stor, "20250102000000", []string{"20250101000000"}, true)
+
+		parent, err := chooseParent(ctx, stor, 1)
+		require.NoError(t, err)
+		assert.Nil(t, parent)
+	})
+
+	t.Run("latest backup has no raw manifest", func(t *testing.T) {
+		stor := st.NewInMemoryStorage()
+		putTestBackup(t, stor, "20250101000000", nil, false)
+
+		parent, err := chooseParent(ctx, stor, 6)
+		require.NoError(t, err)
+		assert.Nil(t, parent)
+	})
+}
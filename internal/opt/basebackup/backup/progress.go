@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"math"
+	"time"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+)
+
+// ProgressFunc receives the progress of a running basebackup.
+type ProgressFunc func(backupdto.Progress)
+
+// progressTracker turns the progress reports of the server into the
+// progress of the whole backup. The server reports the bytes done of the
+// whole backup, over all archives (one per tablespace).
+type progressTracker struct {
+	startedAt  time.Time
+	total      int64
+	done       int64
+	archive    string
+	tablespace string
+}
+
+func newProgressTracker(startedAt time.Time, total int64) *progressTracker {
+	return &progressTracker{startedAt: startedAt, total: total}
+}
+
+// nextArchive records the archive being streamed.
+func (t *progressTracker) nextArchive(archive, tablespace string) {
+	t.archive = archive
+	t.tablespace = tablespace
+}
+
+// update records the bytes done of the backup.
+func (t *progressTracker) update(done int64, now time.Time) backupdto.Progress {
+	t.done = done
+	return t.progress(now)
+}
+
+// finish returns the final progress, the estimate is replaced by the bytes
+// actually streamed.
+func (t *progressTracker) finish(now time.Time) backupdto.Progress {
+	t.total = t.done
+	return t.progress(now)
+}
+
+func (t *progressTracker) progress(now time.Time) backupdto.Progress {
+	done := t.done
+	p := backupdto.Progress{
+		BytesDone:  done,
+		BytesTotal: t.total,
+		Archive:    t.archive,
+		Tablespace: t.tablespace,
+		UpdatedAt:  now.UTC(),
+	}
+	if elapsed := now.Sub(t.startedAt).Seconds(); elapsed > 0 {
+		p.BytesPerSecond = float64(done) / elapsed
+	}
+	if t.total > 0 {
+		// the estimate is taken at the start, the data may have grown since
+		p.Percent = math.Min(100, float64(done)*100/float64(t.total))
+		if left := t.total - done; left > 0 && p.BytesPerSecond > 0 {
+			p.ETASeconds = int64(math.Ceil(float64(left) / p.BytesPerSecond))
+		}
+	}
+	return p
+}
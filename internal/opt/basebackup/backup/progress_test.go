@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTracker(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := newProgressTracker(start, 1000)
+
+	tr.nextArchive("base.tar", "")
+	p := tr.update(200, start.Add(2*time.Second))
+	assert.Equal(t, int64(200), p.BytesDone)
+	assert.Equal(t, int64(1000), p.BytesTotal)
+	assert.InDelta(t, 20.0, p.Percent, 0.001)
+	assert.InDelta(t, 100.0, p.BytesPerSecond, 0.001)
+	assert.Equal(t, int64(8), p.ETASeconds)
+	assert.Equal(t, "base.tar", p.Archive)
+	assert.Empty(t, p.Tablespace)
+
+	// the server reports the bytes of the whole backup, not of the archive
+	p = tr.update(400, start.Add(4*time.Second))
+	assert.Equal(t, int64(400), p.BytesDone)
+	tr.nextArchive("16384.tar", "/mnt/ts1")
+	p = tr.update(500, start.Add(5*time.Second))
+	assert.Equal(t, int64(500), p.BytesDone)
+	assert.InDelta(t, 50.0, p.Percent, 0.001)
+	assert.Equal(t, int64(5), p.ETASeconds)
+	assert.Equal(t, "/mnt/ts1", p.Tablespace)
+
+	t.Run("estimate exceeded", func(t *testing.T) {
+		p := tr.update(1300, start.Add(10*time.Second))
+		assert.Equal(t, int64(1300), p.BytesDone)
+		assert.InDelta(t, 100.0, p.Percent, 0.001)
+		assert.Zero(t, p.ETASeconds)
+	})
+
+	t.Run("finish", func(t *testing.T) {
+		p := tr.finish(start.Add(13 * time.Second))
+		assert.Equal(t, int64(1300), p.BytesDone)
+		assert.Equal(t, int64(1300), p.BytesTotal)
+		assert.InDelta(t, 100.0, p.Percent, 0.001)
+		assert.Zero(t, p.ETASeconds)
+	})
+}
+
+func TestProgressTrackerNoEstimate(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := newProgressTracker(start, 0)
+	tr.nextArchive("base.tar", "")
+
+	p := tr.update(100, start.Add(time.Second))
+	assert.Equal(t, int64(100), p.BytesDone)
+	assert.Zero(t, p.Percent)
+	assert.Zero(t, p.ETASeconds)
+	assert.InDelta(t, 100.0, p.BytesPerSecond, 0.001)
+}
@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+)
+
+// walWaitPollInterval is how often the archived WAL position is checked
+// after a backup taken from a standby.
+const walWaitPollInterval = time.Second
+
+// cannotConnectNow is the SQLSTATE of a server that does not accept
+// connections yet, such as a standby without hot_standby.
+const cannotConnectNow = "57P03"
+
+// WALArchive is the WAL archived by the receiver. Backups taken from a
+// standby are checked against it.
+type WALArchive interface {
+	// Stream returns the system identifier and the timeline of the cluster
+	// the receiver streams from, ok is false while nothing is streamed.
+	Stream() (systemID string, tli uint32, ok bool)
+
+	// Archived returns the position up to which the WAL of the timeline is
+	// stored in the archive without a gap from start on, at most stop.
+	Archived(ctx context.Context, tli uint32, start, stop pglogrepl.LSN) (pglogrepl.LSN, error)
+}
+
+// connect opens a replication connection to the server backups are taken
+// from, conninfo may be empty to use the PG* environment variables only.
+func connect(ctx context.Context, conninfo string) (*pgconn.PgConn, *backupdto.Node, error) {
+	cfg, err := pgconn.ParseConfig(conninfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse backup source conninfo: %w", err)
+	}
+	if cfg.RuntimeParams["application_name"] == "" {
+		cfg.RuntimeParams["application_name"] = "pgrwl_basebackup"
+	}
+	standby, recoveryErr := inRecovery(ctx, cfg)
+	cfg.RuntimeParams["replication"] = "yes"
+
+	conn, err := pgconn.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	sys, err := pglogrepl.IdentifySystem(ctx, conn)
+	if err != nil {
+		_ = conn.Close(ctx)
+		return nil, nil, fmt.Errorf("identify system: %w", err)
+	}
+	if recoveryErr != nil {
+		// e.g. a role allowed to replicate only, in_hot_standby misses a
+		// standby without hot_standby
+		slog.Warn("cannot check whether the backup source is a standby, relying on in_hot_standby",
+			slog.String("component", "basebackup"),
+			slog.Any("err", recoveryErr),
+		)
+		standby = conn.ParameterStatus("in_hot_standby") == "on"
+	}
+	return conn, &backupdto.Node{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		SystemID: sys.SystemID,
+		Timeline: sys.Timeline,
+		Standby:  standby,
+	}, nil
+}
+
+// inRecovery asks the server whether it is a standby. A replication
+// connection runs no SQL, so a regular connection is opened for it. A
+// standby without hot_standby refuses the connection, which tells as well.
+func inRecovery(ctx context.Context, cfg *pgconn.Config) (bool, error) {
+	conn, err := pgconn.ConnectConfig(ctx, cfg.Copy())
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == cannotConnectNow {
+			return true, nil
+		}
+		return false, fmt.Errorf("check recovery of the backup source: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	results, err := conn.Exec(ctx, "SELECT pg_is_in_recovery()").ReadAll()
+	if err != nil {
+		return false, fmt.Errorf("check recovery of the backup source: %w", err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) != 1 {
+		return false, errors.New("check recovery of the backup source: unexpected result")
+	}
+	return string(results[0].Rows[0][0]) == "t", nil
+}
+
+// checkSource fails when the receiver streams another cluster than the
+// backup source, or when a standby does not replay the timeline the
+// receiver archives: the backup could not be recovered with that WAL.
+func checkSource(node *backupdto.Node, archive WALArchive) error {
+	systemID, tli, ok := archive.Stream()
+	if !ok {
+		// checked again while waiting for the WAL
+		return nil
+	}
+	if systemID != "" && node.SystemID != systemID {
+		return fmt.Errorf("%s has system identifier %s, the archive holds the WAL of %s", node.Host, node.SystemID, systemID)
+	}
+	//nolint:gosec
+	if node.Standby && uint32(node.Timeline) != tli {
+		return fmt.Errorf("standby %s is on timeline %d, the archive is on timeline %d", node.Host, node.Timeline, tli)
+	}
+	return nil
+}
+
+// waitForWAL waits until the receiver archived the WAL from start up to
+// stop. Unlike a primary, a standby cannot switch to a new WAL segment at
+// the end of a backup, the WAL it needs arrives with the traffic of the
+// primary. The WAL counts once it is stored in the archive, not when the
+// receiver flushed it.
+func waitForWAL(
+	ctx context.Context,
+	log *slog.Logger,
+	archive WALArchive,
+	tli int32,
+	start, stop pglogrepl.LSN,
+	timeout time.Duration,
+	poll time.Duration,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	archived := start
+	for {
+		//nolint:gosec
+		if _, archivedTLI, ok := archive.Stream(); ok && archivedTLI != uint32(tli) {
+			return fmt.Errorf("the archive switched to timeline %d, the backup is on timeline %d", archivedTLI, tli)
+		}
+		//nolint:gosec
+		pos, err := archive.Archived(ctx, uint32(tli), archived, stop)
+		switch {
+		case err == nil:
+			archived = pos
+			if archived >= stop {
+				return nil
+			}
+		case ctx.Err() == nil:
+			log.Warn("cannot check the archived WAL", slog.Any("err", err))
+		}
+		log.Debug("waiting for WAL to be archived",
+			slog.String("stop_lsn", stop.String()),
+			slog.String("archived_lsn", archived.String()),
+		)
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("WAL up to %s is not archived after %s (archived: %s)", stop, timeout, archived)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeArchive struct {
+	mu       sync.Mutex
+	systemID string
+	tli      uint32
+	archived pglogrepl.LSN
+	ok       bool
+	starts   []pglogrepl.LSN
+}
+
+func (a *fakeArchive) Stream() (string, uint32, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.systemID, a.tli, a.ok
+}
+
+func (a *fakeArchive) Archived(_ context.Context, tli uint32, start, stop pglogrepl.LSN) (pglogrepl.LSN, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.starts = append(a.starts, start)
+	if !a.ok || tli != a.tli {
+		return start, nil
+	}
+	return max(start, min(a.archived, stop)), nil
+}
+
+func (a *fakeArchive) set(tli uint32, archived pglogrepl.LSN) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tli, a.archived, a.ok = tli, archived, true
+}
+
+func TestCheckSource(t *testing.T) {
+	standby := &backupdto.Node{Host: "standby", SystemID: "7001", Timeline: 2, Standby: true}
+
+	assert.NoError(t, checkSource(standby, &fakeArchive{}))
+	assert.NoError(t, checkSource(standby, &fakeArchive{systemID: "7001", tli: 2, ok: true}))
+	assert.ErrorContains(t, checkSource(standby, &fakeArchive{systemID: "7001", tli: 3, ok: true}),
+		"standby standby is on timeline 2, the archive is on timeline 3")
+	assert.ErrorContains(t, checkSource(standby, &fakeArchive{systemID: "7002", tli: 2, ok: true}),
+		"standby has system identifier 7001, the archive holds the WAL of 7002")
+
+	// a primary may be ahead of the archived timeline, not on another cluster
+	primary := &backupdto.Node{Host: "primary", SystemID: "7001", Timeline: 3}
+	assert.NoError(t, checkSource(primary, &fakeArchive{systemID: "7001", tli: 2, ok: true}))
+	assert.Error(t, checkSource(primary, &fakeArchive{systemID: "7002", tli: 3, ok: true}))
+}
+
+func TestWaitForWAL(t *testing.T) {
+	ctx := context.Background()
+	log := slog.Default()
+
+	t.Run("archived later", func(t *testing.T) {
+		archive := &fakeArchive{tli: 1, archived: 0x1800000, ok: true}
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			archive.set(1, 0x3000000)
+		}()
+		require.NoError(t, waitForWAL(ctx, log, archive, 1, 0x1000028, 0x2000028, time.Second, time.Millisecond))
+
+		// the archived WAL is not looked up again
+		archive.mu.Lock()
+		defer archive.mu.Unlock()
+		assert.Equal(t, pglogrepl.LSN(0x1000028), archive.starts[0])
+		assert.Equal(t, pglogrepl.LSN(0x1800000), archive.starts[len(archive.starts)-1])
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		archive := &fakeArchive{tli: 1, archived: 0x1800000, ok: true}
+		err := waitForWAL(ctx, log, archive, 1, 0x1000028, 0x2000028, 20*time.Millisecond, time.Millisecond)
+		assert.ErrorContains(t, err, "WAL up to 0/2000028 is not archived after 20ms (archived: 0/1800000)")
+	})
+
+	t.Run("timeline switch", func(t *testing.T) {
+		archive := &fakeArchive{tli: 2, archived: 0x3000000, ok: true}
+		err := waitForWAL(ctx, log, archive, 1, 0x1000028, 0x2000028, time.Second, time.Millisecond)
+		assert.ErrorContains(t, err, "the archive switched to timeline 2")
+	})
+}
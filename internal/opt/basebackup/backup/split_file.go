@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/retry"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// defaultPartRetryDelay is the wait between the uploads of a failed part.
+const defaultPartRetryDelay = 5 * time.Second
+
+// SplitOpts makes the archives be stored as numbered parts.
+type SplitOpts struct {
+	// PartSize is the maximum size of a part, before storage compression
+	// and encryption.
+	PartSize int64
+	// Retries is how many times a failed part upload is retried,
+	// config.DefaultSplitRetries when zero.
+	Retries int
+	// RetryDelay is the wait between the uploads of a part,
+	// defaultPartRetryDelay when zero.
+	RetryDelay time.Duration
+}
+
+// SplitFile stores an archive as parts of at most PartSize bytes, named
+// backupdto.PartName. A part is spooled to a temporary file before it is
+// uploaded, so that a failed upload is retried without the rest of the
+// archive.
+type SplitFile struct {
+	ctx     context.Context
+	log     *slog.Logger
+	storage st.Storage
+	path    string
+	opts    SplitOpts
+
+	spool   *os.File
+	spoolN  int64
+	partSum hash.Hash
+	parts   []backupdto.Part
+
+	// checksum of the whole archive
+	sum  hash.Hash
+	size int64
+
+	closed bool
+}
+
+func NewSplitFile(ctx context.Context, log *slog.Logger, storage st.Storage, path string, opts SplitOpts) (*SplitFile, error) {
+	if opts.PartSize <= 0 {
+		return nil, fmt.Errorf("split %s: part size must be positive", path)
+	}
+	spool, err := os.CreateTemp("", "pgrwl-part-*")
+	if err != nil {
+		return nil, fmt.Errorf("split %s: create spool file: %w", path, err)
+	}
+	return &SplitFile{
+		ctx:     ctx,
+		log:     log,
+		storage: storage,
+		path:    path,
+		opts:    opts,
+		spool:   spool,
+		partSum: sha256.New(),
+		sum:     sha256.New(),
+	}, nil
+}
+
+func (sf *SplitFile) Write(p []byte) (int, error) {
+	if sf.closed {
+		return 0, fmt.Errorf("write to closed split file: %s", sf.path)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if free := sf.opts.PartSize - sf.spoolN; int64(len(chunk)) > free {
+			chunk = chunk[:free]
+		}
+		n, err := sf.spool.Write(chunk)
+		sf.partSum.Write(chunk[:n])
+		sf.sum.Write(chunk[:n])
+		sf.spoolN += int64(n)
+		sf.size += int64(n)
+		written += n
+		if err != nil {
+			return written, fmt.Errorf("spool %s: %w", sf.path, err)
+		}
+		p = p[n:]
+
+		if sf.spoolN == sf.opts.PartSize {
+			if err := sf.flushPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flushPart uploads the spooled part and empties the spool.
+func (sf *SplitFile) flushPart() error {
+	part := backupdto.Part{
+		Name:   backupdto.PartName(path.Base(sf.path), len(sf.parts)+1),
+		Size:   sf.spoolN,
+		SHA256: hex.EncodeToString(sf.partSum.Sum(nil)),
+	}
+	remotePath := path.Join(path.Dir(sf.path), part.Name)
+
+	retries := sf.opts.Retries
+	if retries <= 0 {
+		retries = config.DefaultSplitRetries
+	}
+	delay := sf.opts.RetryDelay
+	if delay <= 0 {
+		delay = defaultPartRetryDelay
+	}
+	attempt := 0
+	_, err := retry.Do(sf.ctx, retry.Policy{
+		MaxAttempts: retries + 1,
+		Delay:       delay,
+		Logger:      sf.log,
+	}, func(ctx context.Context) (struct{}, error) {
+		attempt++
+		if attempt > 1 {
+			sf.log.Warn("retrying part upload", slog.String("part", remotePath), slog.Int("attempt", attempt))
+		}
+		return struct{}{}, sf.storage.Put(ctx, remotePath, io.NewSectionReader(sf.spool, 0, part.Size))
+	})
+	if err != nil {
+		return fmt.Errorf("upload part %s: %w", remotePath, err)
+	}
+	sf.log.Info("part uploaded", slog.String("part", remotePath), slog.Int64("size", part.Size))
+	sf.parts = append(sf.parts, part)
+
+	if err := sf.spool.Truncate(0); err != nil {
+		return fmt.Errorf("spool %s: %w", sf.path, err)
+	}
+	if _, err := sf.spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("spool %s: %w", sf.path, err)
+	}
+	sf.spoolN = 0
+	sf.partSum.Reset()
+	return nil
+}
+
+// Close uploads the last part and removes the spool file.
+func (sf *SplitFile) Close() error {
+	if sf == nil || sf.closed {
+		return nil
+	}
+	sf.closed = true
+	defer sf.removeSpool()
+
+	if sf.spoolN > 0 || len(sf.parts) == 0 {
+		return sf.flushPart()
+	}
+	return nil
+}
+
+// Abort drops the spooled part, the parts already uploaded are left to the
+// cleanup of the backup.
+func (sf *SplitFile) Abort(_ error) {
+	if sf == nil || sf.closed {
+		return
+	}
+	sf.closed = true
+	sf.removeSpool()
+}
+
+func (sf *SplitFile) removeSpool() {
+	_ = sf.spool.Close()
+	if err := os.Remove(sf.spool.Name()); err != nil {
+		sf.log.Warn("cannot remove spool file", slog.String("path", sf.spool.Name()), slog.Any("err", err))
+	}
+}
+
+// Checksum returns the size and the hex SHA-256 of the archive written so far.
+func (sf *SplitFile) Checksum() (int64, string) {
+	return sf.size, hex.EncodeToString(sf.sum.Sum(nil))
+}
+
+// Parts returns the uploaded parts, in order.
+func (sf *SplitFile) Parts() []backupdto.Part {
+	return sf.parts
+}
@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	stormock "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// flakyStorage fails the first Put of every path failures times.
+type flakyStorage struct {
+	*stormock.InMemoryStorage
+	failures int
+	puts     map[string]int
+}
+
+func (s *flakyStorage) Put(ctx context.Context, path string, r io.Reader) error {
+	s.puts[path]++
+	if s.puts[path] <= s.failures {
+		// consume part of the content, as an interrupted upload does
+		_, _ = io.CopyN(io.Discard, r, 3)
+		return errors.New("connection reset")
+	}
+	return s.InMemoryStorage.Put(ctx, path, r)
+}
+
+func TestSplitFile_StoresNumberedParts(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	stor := stormock.NewInMemoryStorage()
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	sf, err := NewSplitFile(context.Background(), newTestLogger(t), stor, "20260101000000/base.tar", SplitOpts{PartSize: 16})
+	require.NoError(t, err)
+	// writes across part boundaries
+	for _, chunk := range [][]byte{data[:5], data[5:30], data[30:]} {
+		n, err := sf.Write(chunk)
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, sf.Close())
+
+	assert.Equal(t, []backupdto.Part{
+		{Name: "base.tar.part00001", Size: 16, SHA256: sha256Hex(data[:16])},
+		{Name: "base.tar.part00002", Size: 16, SHA256: sha256Hex(data[16:32])},
+		{Name: "base.tar.part00003", Size: 4, SHA256: sha256Hex(data[32:])},
+	}, sf.Parts())
+	assert.Equal(t, data[:16], stor.Files["20260101000000/base.tar.part00001"])
+	assert.Equal(t, data[16:32], stor.Files["20260101000000/base.tar.part00002"])
+	assert.Equal(t, data[32:], stor.Files["20260101000000/base.tar.part00003"])
+	assert.NotContains(t, stor.Files, "20260101000000/base.tar")
+
+	size, sum := sf.Checksum()
+	assert.Equal(t, int64(len(data)), size)
+	assert.Equal(t, sha256Hex(data), sum)
+
+	spools, err := filepath.Glob(filepath.Join(os.Getenv("TMPDIR"), "pgrwl-part-*"))
+	require.NoError(t, err)
+	assert.Empty(t, spools)
+}
+
+func TestSplitFile_ExactMultipleHasNoEmptyPart(t *testing.T) {
+	stor := stormock.NewInMemoryStorage()
+
+	sf, err := NewSplitFile(context.Background(), newTestLogger(t), stor, "base.tar", SplitOpts{PartSize: 4})
+	require.NoError(t, err)
+	_, err = sf.Write([]byte("abcdefgh"))
+	require.NoError(t, err)
+	require.NoError(t, sf.Close())
+
+	assert.Len(t, sf.Parts(), 2)
+	assert.Len(t, stor.Files, 2)
+}
+
+func TestSplitFile_RetriesFailedPart(t *testing.T) {
+	stor := &flakyStorage{InMemoryStorage: stormock.NewInMemoryStorage(), failures: 2, puts: map[string]int{}}
+
+	sf, err := NewSplitFile(context.Background(), newTestLogger(t), stor, "base.tar", SplitOpts{
+		PartSize:   8,
+		RetryDelay: time.Millisecond,
+	})
+	require.NoError(t, err)
+	_, err = sf.Write([]byte("part-onepart-two"))
+	require.NoError(t, err)
+	require.NoError(t, sf.Close())
+
+	assert.Equal(t, []byte("part-one"), stor.Files["base.tar.part00001"])
+	assert.Equal(t, []byte("part-two"), stor.Files["base.tar.part00002"])
+	assert.Equal(t, 3, stor.puts["base.tar.part00001"])
+	assert.Equal(t, 3, stor.puts["base.tar.part00002"])
+}
+
+func TestSplitFile_FailsAfterRetries(t *testing.T) {
+	stor := &flakyStorage{InMemoryStorage: stormock.NewInMemoryStorage(), failures: 10, puts: map[string]int{}}
+
+	sf, err := NewSplitFile(context.Background(), newTestLogger(t), stor, "base.tar", SplitOpts{
+		PartSize:   8,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	})
+	require.NoError(t, err)
+	_, err = sf.Write(bytes.Repeat([]byte("x"), 8))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "upload part base.tar.part00001")
+	assert.Equal(t, 2, stor.puts["base.tar.part00001"])
+	sf.Abort(err)
+}
+
+func TestSplitFile_AbortDropsSpooledPart(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	stor := stormock.NewInMemoryStorage()
+
+	sf, err := NewSplitFile(context.Background(), newTestLogger(t), stor, "base.tar", SplitOpts{PartSize: 8})
+	require.NoError(t, err)
+	_, err = sf.Write([]byte("complete-part"))
+	require.NoError(t, err)
+	sf.Abort(errBackupAborted)
+
+	// the uploaded part is deleted with the failed backup
+	assert.Equal(t, []byte("complete"), stor.Files["base.tar.part00001"])
+	assert.Len(t, stor.Files, 1)
+	assert.NoError(t, sf.Close())
+
+	spools, err := filepath.Glob(filepath.Join(os.Getenv("TMPDIR"), "pgrwl-part-*"))
+	require.NoError(t, err)
+	assert.Empty(t, spools)
+}
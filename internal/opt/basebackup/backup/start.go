@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
+)
+
+// ServerCompression is the compression applied by the server to the
+// archives of a basebackup (PostgreSQL 15+).
+type ServerCompression struct {
+	// Algo is "gzip", "lz4" or "zstd".
+	Algo string
+	// Level is the compression level, the server default when zero.
+	Level int
+}
+
+// decompressor returns the codec the archives are compressed with. The
+// server appends the same extension to the archive names.
+func (c *ServerCompression) decompressor() (codec.Decompressor, error) {
+	switch c.Algo {
+	case codec.GzipCompName:
+		return codec.GzipDecompressor{}, nil
+	case codec.Lz4CompName:
+		return codec.Lz4Decompressor{}, nil
+	case codec.ZstdCompName:
+		return codec.ZstdDecompressor{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported server compression: %q", c.Algo)
+	}
+}
+
+// startResult is the response to BASE_BACKUP.
+type startResult struct {
+	pglogrepl.BaseBackupResult
+
+	// EstimatedBytes is the size of all tablespaces estimated by the server,
+	// sent with PROGRESS only.
+	EstimatedBytes int64
+}
+
+// startBaseBackup runs BASE_BACKUP. It is pglogrepl.StartBaseBackup with
+// server-side compression, which pglogrepl has no option for, and with the
+// tablespace size estimates of PROGRESS. The archives are then streamed with
+// the protocol of PostgreSQL 15+, older servers are rejected.
+func startBaseBackup(
+	ctx context.Context,
+	conn *pgconn.PgConn,
+	opts *pglogrepl.BaseBackupOptions,
+	compression *ServerCompression,
+) (*startResult, error) {
+	version, err := serverMajorVersion(conn)
+	if err != nil {
+		return nil, err
+	}
+	// the archives are received with the CopyData protocol of PostgreSQL 15
+	if version < 15 {
+		return nil, fmt.Errorf("basebackups require PostgreSQL 15 or later (server: %d)", version)
+	}
+	if opts.Incremental && version < 17 {
+		return nil, fmt.Errorf("incremental backups require PostgreSQL 17 or later (server: %d)", version)
+	}
+
+	conn.Frontend().SendQuery(&pgproto3.Query{String: baseBackupCommand(opts, compression)})
+	if err := conn.Frontend().Flush(); err != nil {
+		return nil, fmt.Errorf("send BASE_BACKUP: %w", err)
+	}
+
+	// the start position, then the tablespaces, then the archives
+	rows, err := readResultSet(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 || len(rows[0]) != 2 {
+		return nil, fmt.Errorf("unexpected BASE_BACKUP start position: %d rows", len(rows))
+	}
+	result := &startResult{}
+	result.LSN, err = pglogrepl.ParseLSN(string(rows[0][0]))
+	if err != nil {
+		return nil, fmt.Errorf("parse start position: %w", err)
+	}
+	tli, err := strconv.ParseInt(string(rows[0][1]), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parse timeline: %w", err)
+	}
+	result.TimelineID = int32(tli)
+
+	rows, err = readResultSet(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) != 3 {
+			return nil, fmt.Errorf("expected 3 tablespace columns, received: %d", len(row))
+		}
+		// the size in kB, null without PROGRESS
+		if row[2] != nil {
+			kb, err := strconv.ParseInt(string(row[2]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse tablespace size: %w", err)
+			}
+			result.EstimatedBytes += kb * 1024
+		}
+		// the main data directory has no oid
+		if row[0] == nil {
+			continue
+		}
+		oid, err := strconv.ParseInt(string(row[0]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse tablespace oid: %w", err)
+		}
+		result.Tablespaces = append(result.Tablespaces, pglogrepl.BaseBackupTablespace{
+			OID:      int32(oid),
+			Location: string(row[1]),
+		})
+	}
+	return result, nil
+}
+
+// baseBackupCommand builds the BASE_BACKUP command (PostgreSQL 15+ syntax).
+func baseBackupCommand(opts *pglogrepl.BaseBackupOptions, compression *ServerCompression) string {
+	var parts []string
+	if opts.Label != "" {
+		parts = append(parts, "LABEL "+quote(opts.Label))
+	}
+	if opts.Progress {
+		parts = append(parts, "PROGRESS")
+	}
+	if opts.Fast {
+		parts = append(parts, "CHECKPOINT 'fast'")
+	}
+	if opts.WAL {
+		parts = append(parts, "WAL")
+	}
+	if opts.NoWait {
+		parts = append(parts, "WAIT false")
+	}
+	if opts.MaxRate >= 32 {
+		parts = append(parts, fmt.Sprintf("MAX_RATE %d", opts.MaxRate))
+	}
+	if opts.TablespaceMap {
+		parts = append(parts, "TABLESPACE_MAP")
+	}
+	if opts.NoVerifyChecksums {
+		parts = append(parts, "VERIFY_CHECKSUMS false")
+	}
+	if opts.Manifest {
+		parts = append(parts, "MANIFEST 'yes'")
+		if opts.ManifestChecksums != "" {
+			parts = append(parts, "MANIFEST_CHECKSUMS "+quote(opts.ManifestChecksums))
+		}
+	}
+	if opts.Incremental {
+		parts = append(parts, "INCREMENTAL")
+	}
+	if compression != nil {
+		parts = append(parts, "COMPRESSION "+quote(compression.Algo))
+		if compression.Level != 0 {
+			parts = append(parts, fmt.Sprintf("COMPRESSION_DETAIL 'level=%d'", compression.Level))
+		}
+	}
+	return "BASE_BACKUP (" + strings.Join(parts, ", ") + ")"
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// readResultSet reads the rows of one result set, up to its CommandComplete.
+func readResultSet(ctx context.Context, conn *pgconn.PgConn) ([][][]byte, error) {
+	var rows [][][]byte
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("receive message: %w", err)
+		}
+		switch m := msg.(type) {
+		case *pgproto3.RowDescription, *pgproto3.NoticeResponse:
+		case *pgproto3.DataRow:
+			row := make([][]byte, len(m.Values))
+			for i, v := range m.Values {
+				if v != nil {
+					row[i] = append([]byte{}, v...)
+				}
+			}
+			rows = append(rows, row)
+		case *pgproto3.CommandComplete:
+			return rows, nil
+		case *pgproto3.ErrorResponse:
+			return nil, pgconn.ErrorResponseToPgError(m)
+		default:
+			return nil, fmt.Errorf("unexpected message type: %T", msg)
+		}
+	}
+}
+
+func serverMajorVersion(conn *pgconn.PgConn) (int, error) {
+	v := conn.ParameterStatus("server_version")
+	// "17.2", "17beta1", "16.4 (Debian 16.4-1)"
+	end := strings.IndexFunc(v, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(v)
+	}
+	n, err := strconv.Atoi(v[:end])
+	if err != nil {
+		return 0, fmt.Errorf("bad server version: %q", v)
+	}
+	return n, nil
+}
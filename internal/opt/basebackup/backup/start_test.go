@@ -0,0 +1,43 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseBackupCommand(t *testing.T) {
+	opts := &pglogrepl.BaseBackupOptions{
+		Label:         "pgrwl_20250101000000",
+		Fast:          true,
+		NoWait:        true,
+		TablespaceMap: true,
+		Manifest:      true,
+	}
+
+	assert.Equal(t,
+		"BASE_BACKUP (LABEL 'pgrwl_20250101000000', CHECKPOINT 'fast', WAIT false, TABLESPACE_MAP, MANIFEST 'yes', "+
+			"COMPRESSION 'zstd', COMPRESSION_DETAIL 'level=3')",
+		baseBackupCommand(opts, &ServerCompression{Algo: "zstd", Level: 3}))
+
+	opts.Incremental = true
+	assert.Equal(t,
+		"BASE_BACKUP (LABEL 'pgrwl_20250101000000', CHECKPOINT 'fast', WAIT false, TABLESPACE_MAP, MANIFEST 'yes', "+
+			"INCREMENTAL, COMPRESSION 'lz4')",
+		baseBackupCommand(opts, &ServerCompression{Algo: "lz4"}))
+
+	assert.Equal(t,
+		"BASE_BACKUP (LABEL 'it''s', PROGRESS, CHECKPOINT 'fast', WAIT false)",
+		baseBackupCommand(&pglogrepl.BaseBackupOptions{Label: "it's", Progress: true, Fast: true, NoWait: true}, nil))
+}
+
+func TestServerCompression_Decompressor(t *testing.T) {
+	for algo, ext := range map[string]string{"gzip": ".gz", "lz4": ".lz4", "zstd": ".zst"} {
+		dec, err := (&ServerCompression{Algo: algo}).decompressor()
+		assert.NoError(t, err)
+		assert.Equal(t, ext, dec.FileExtension())
+	}
+	_, err := (&ServerCompression{Algo: "xz"}).decompressor()
+	assert.Error(t, err)
+}
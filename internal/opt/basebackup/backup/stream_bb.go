@@ -5,51 +5,180 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
 	"github.com/pgrwl/pgrwl/internal/opt/metrics/backupmetrics"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/fsx"
 
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
 )
 
 // https://www.postgresql.org/docs/current/protocol-replication.html#PROTOCOL-REPLICATION-BASE-BACKUP
 
+// errBackupAborted fails the upload of an archive that was not streamed
+// completely.
+var errBackupAborted = errors.New("basebackup aborted")
+
+// archiveFile stores an archive as it is streamed: a StreamingFile, or a
+// SplitFile for split archives.
+type archiveFile interface {
+	io.Writer
+	Close() error
+	Abort(cause error)
+	Checksum() (int64, string)
+}
+
+var (
+	_ archiveFile = (*StreamingFile)(nil)
+	_ archiveFile = (*SplitFile)(nil)
+)
+
 // BaseBackup is an API for streaming basebackup
 type BaseBackup interface {
 	StreamBackup(ctx context.Context) (*backupdto.Result, error)
 }
 
 type baseBackup struct {
-	l         *slog.Logger
-	conn      *pgconn.PgConn
-	storage   st.Storage
-	timestamp string
+	l           *slog.Logger
+	conn        *pgconn.PgConn
+	storage     st.Storage
+	timestamp   string
+	signer      *signing.Signer
+	parent      *Parent
+	compression *ServerCompression
+	split       *SplitOpts
+	includeWAL  bool
+	progress    ProgressFunc
+
+	label       string
+	annotations map[string]string
+	pinned      bool
+
+	schedule       string
+	retentionClass string
+
+	node           *backupdto.Node
+	archive        WALArchive
+	walWaitTimeout time.Duration
 }
 
-func NewBaseBackup(conn *pgconn.PgConn, storage st.Storage, timestamp string) (BaseBackup, error) {
-	if conn == nil {
+// Parent is the backup an incremental backup is taken against.
+type Parent struct {
+	ID string
+	// Chain is the chain of the parent itself, empty for a full backup.
+	Chain []string
+	// Manifest is the raw backup manifest of the parent.
+	Manifest []byte
+}
+
+type BaseBackupOpts struct {
+	Conn      *pgconn.PgConn
+	Storage   st.Storage
+	Timestamp string
+
+	// Signer signs the marker, nil when signing is disabled.
+	Signer *signing.Signer
+
+	// Parent makes the backup incremental (PostgreSQL 17+), nil for a full backup.
+	Parent *Parent
+
+	// Compression makes the server compress the archives, nil to receive plain tar.
+	Compression *ServerCompression
+
+	// Split stores the archives as parts, nil to store each as one object.
+	// It cannot be combined with Compression.
+	Split *SplitOpts
+
+	// IncludeWAL makes the server add the WAL from the start to the end of
+	// the backup to base.tar, the backup restores without the WAL archive.
+	IncludeWAL bool
+
+	// Progress receives the progress reports of the server, may be nil.
+	Progress ProgressFunc
+
+	// Label is sent to the server and recorded in the marker, "pgrwl_<ts>"
+	// when empty.
+	Label string
+	// Annotations are recorded in the marker as given.
+	Annotations map[string]string
+	// Pinned makes retention keep the backup and its WAL.
+	Pinned bool
+
+	// Schedule and RetentionClass are recorded in the marker.
+	Schedule       string
+	RetentionClass string
+
+	// Node is the server Conn is connected to, recorded in the marker.
+	Node *backupdto.Node
+
+	// Archive is the WAL of the receiver. A backup taken from a standby is
+	// only marked complete once its WAL is archived. Nil outside of the
+	// receiver, the wait is skipped then.
+	Archive WALArchive
+
+	// WALWaitTimeout limits the wait for the WAL of a backup taken from a
+	// standby, config.DefaultWALWaitTimeout when zero.
+	WALWaitTimeout time.Duration
+}
+
+// NewBaseBackup creates a basebackup streamer. The marker is signed when
+// opts.Signer is not nil.
+func NewBaseBackup(opts *BaseBackupOpts) (BaseBackup, error) {
+	if opts.Conn == nil {
 		return nil, fmt.Errorf("basebackup: connection is required")
 	}
-	if storage == nil {
+	if opts.Storage == nil {
 		return nil, fmt.Errorf("basebackup: storage is required")
 	}
-	if timestamp == "" {
+	if opts.Timestamp == "" {
 		return nil, fmt.Errorf("basebackup: timestamp is required")
 	}
+	if opts.Parent != nil && len(opts.Parent.Manifest) == 0 {
+		return nil, fmt.Errorf("basebackup: parent %s has no backup manifest", opts.Parent.ID)
+	}
+	if opts.Compression != nil {
+		if _, err := opts.Compression.decompressor(); err != nil {
+			return nil, fmt.Errorf("basebackup: %w", err)
+		}
+		if opts.Split != nil {
+			return nil, fmt.Errorf("basebackup: split archives cannot be compressed by the server")
+		}
+	}
 	return &baseBackup{
-		l:         slog.With(slog.String("component", "basebackup"), slog.String("id", timestamp)),
-		conn:      conn,
-		storage:   storage,
-		timestamp: timestamp,
+		l:           slog.With(slog.String("component", "basebackup"), slog.String("id", opts.Timestamp)),
+		conn:        opts.Conn,
+		storage:     opts.Storage,
+		timestamp:   opts.Timestamp,
+		signer:      opts.Signer,
+		parent:      opts.Parent,
+		compression: opts.Compression,
+		split:       opts.Split,
+		includeWAL:  opts.IncludeWAL,
+		progress:    opts.Progress,
+
+		label:       opts.Label,
+		annotations: opts.Annotations,
+		pinned:      opts.Pinned,
+
+		schedule:       opts.Schedule,
+		retentionClass: opts.RetentionClass,
+
+		node:           opts.Node,
+		archive:        opts.Archive,
+		walWaitTimeout: opts.WALWaitTimeout,
 	}, nil
 }
 
@@ -60,11 +189,47 @@ func (bb *baseBackup) log() *slog.Logger {
 	return slog.With(slog.String("component", "basebackup"), slog.String("id", bb.timestamp))
 }
 
+func (bb *baseBackup) backupLabel() string {
+	if bb.label != "" {
+		return bb.label
+	}
+	return DefaultLabel(bb.timestamp)
+}
+
 func (bb *baseBackup) StreamBackup(ctx context.Context) (*backupdto.Result, error) {
-	result, err := bb.streamBaseBackup(ctx)
+	standby := bb.node != nil && bb.node.Standby
+	if bb.node != nil && bb.archive != nil {
+		if err := checkSource(bb.node, bb.archive); err != nil {
+			return nil, err
+		}
+	}
+
+	result, manifest, err := bb.streamBaseBackup(ctx)
 	if err != nil {
 		return nil, err
 	}
+	result.ID = bb.timestamp
+	result.Label = bb.backupLabel()
+	result.Annotations = bb.annotations
+	result.Pinned = bb.pinned
+	result.Schedule = bb.schedule
+	result.RetentionClass = bb.retentionClass
+	result.Node = bb.node
+
+	// the marker makes the backup complete, it must be restorable by then
+	if standby && !bb.includeWAL {
+		if err := bb.waitForWAL(ctx, result); err != nil {
+			return nil, err
+		}
+	}
+
+	// upload the manifest as received, its checksum covers the exact bytes
+	if len(manifest) > 0 {
+		bb.log().Debug("uploading backup manifest", slog.Int("len", len(manifest)))
+		if err := st.PutMeta(ctx, bb.storage, backupdto.ManifestFileName, bytes.NewReader(manifest)); err != nil {
+			return nil, fmt.Errorf("upload backup manifest: %w", err)
+		}
+	}
 
 	// upload marker
 	markerFileName := bb.timestamp + ".json"
@@ -73,7 +238,8 @@ func (bb *baseBackup) StreamBackup(ctx context.Context) (*backupdto.Result, erro
 	if err != nil {
 		return nil, err
 	}
-	err = bb.storage.Put(ctx, markerFileName, io.NopCloser(bytes.NewReader(markerFileData)))
+	// the marker is read back by retention, keep it readable for write-only encryption
+	err = signing.PutSigned(ctx, bb.storage, bb.signer, signing.ContextBackupMarker, markerFileName, markerFileData)
 	if err != nil {
 		return nil, err
 	}
@@ -84,35 +250,62 @@ func (bb *baseBackup) StreamBackup(ctx context.Context) (*backupdto.Result, erro
 	return result, nil
 }
 
-func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result, error) {
-	startResp, err := pglogrepl.StartBaseBackup(ctx, bb.conn, pglogrepl.BaseBackupOptions{
-		Label:         fmt.Sprintf("pgrwl_%s", bb.timestamp),
-		Progress:      false, // or true if you want to use 'p'
+// streamBaseBackup returns the result together with the raw backup manifest.
+func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result, []byte, error) {
+	// an incremental backup sends the parent manifest first, the server
+	// compares it with its WAL summaries (summarize_wal must be on)
+	if bb.parent != nil {
+		bb.log().Info("taking incremental backup", slog.String("parent", bb.parent.ID))
+		if err := pglogrepl.UploadManifest(ctx, bb.conn, bytes.NewReader(bb.parent.Manifest)); err != nil {
+			return nil, nil, fmt.Errorf("upload parent manifest: %w", err)
+		}
+	}
+
+	startResp, err := startBaseBackup(ctx, bb.conn, &pglogrepl.BaseBackupOptions{
+		Label:         bb.backupLabel(),
+		Progress:      true,
 		Fast:          true,
-		WAL:           false,
+		WAL:           bb.includeWAL,
 		NoWait:        true,
 		MaxRate:       0,
 		TablespaceMap: true,
 		Manifest:      true,
-	})
+		Incremental:   bb.parent != nil,
+	}, bb.compression)
 	if err != nil {
-		return nil, fmt.Errorf("start base backup: %w", err)
+		return nil, nil, fmt.Errorf("start base backup: %w", err)
 	}
 
 	result := &backupdto.Result{
 		StartLSN:    startResp.LSN,
 		TimelineID:  startResp.TimelineID,
 		Tablespaces: getTblspcInfo(startResp.Tablespaces),
+		IncludesWAL: bb.includeWAL,
+	}
+	if bb.parent != nil {
+		result.Parent = bb.parent.ID
+		result.Chain = append(slices.Clone(bb.parent.Chain), bb.parent.ID)
+	}
+
+	// compressed archives are stored as received
+	var dec codec.Decompressor
+	if bb.compression != nil {
+		dec, err = bb.compression.decompressor()
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	log := bb.log()
 	log.Info("started backup",
 		slog.String("StartLSN", startResp.LSN.String()),
 		slog.Int("tablespaces", len(startResp.Tablespaces)),
+		slog.String("estimated_size_iec", fsx.ByteCountIEC(startResp.EstimatedBytes)),
 	)
 
 	startTime := time.Now()
-	var curFile *StreamingFile
+	progress := newProgressTracker(startTime, startResp.EstimatedBytes)
+	var curFile archiveFile
 	var totalBytes int64
 	var remotePath string
 
@@ -126,16 +319,29 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 		if err := curFile.Close(); err != nil {
 			return err
 		}
+		size, sum := curFile.Checksum()
+		f := backupdto.File{Name: remotePath, Size: size, SHA256: sum}
+		if bb.compression != nil {
+			f.Compression = bb.compression.Algo
+		}
+		if split, ok := curFile.(*SplitFile); ok {
+			f.Parts = split.Parts()
+		}
+		result.Files = append(result.Files, f)
 		curFile = nil
 		return nil
 	}
+	// an unfinished archive must not be stored as if it was complete
+	defer func() {
+		if curFile != nil {
+			curFile.Abort(errBackupAborted)
+		}
+	}()
 
 	for {
 		msg, err := bb.conn.ReceiveMessage(ctx)
 		if err != nil {
-			//nolint:errcheck
-			_ = closeCurrent()
-			return nil, fmt.Errorf("receive message: %w", err)
+			return nil, nil, fmt.Errorf("receive message: %w", err)
 		}
 
 		switch m := msg.(type) {
@@ -153,22 +359,36 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 				inManifest = false
 
 				if err := closeCurrent(); err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 
 				filename, rest, err := readCString(m.Data[1:])
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 
 				tsPath, _, err := readCString(rest)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 
 				remotePath = strings.TrimPrefix(filename, "./")
-				curFile = NewStreamingFile(ctx, log, bb.storage, remotePath)
+				switch {
+				case dec != nil:
+					// "base.tar.zst" is stored as "base.tar" with the codec extension
+					remotePath = strings.TrimSuffix(remotePath, dec.FileExtension())
+					curFile = NewCompressedStreamingFile(ctx, log, bb.storage, remotePath, dec)
+				case bb.split != nil:
+					sf, err := NewSplitFile(ctx, log, bb.storage, remotePath, *bb.split)
+					if err != nil {
+						return nil, nil, err
+					}
+					curFile = sf
+				default:
+					curFile = NewStreamingFile(ctx, log, bb.storage, remotePath)
+				}
 
+				progress.nextArchive(remotePath, tsPath)
 				log.Info("streaming file",
 					slog.String("path", remotePath),
 					slog.String("tablespace-path", tsPath),
@@ -183,7 +403,7 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 					mData := m.Data[1:]
 					log.Info("writing manifest data", slog.Int("len", len(mData)))
 					if _, err := manifestBuf.Write(mData); err != nil {
-						return nil, fmt.Errorf("write manifest buffer: %w", err)
+						return nil, nil, fmt.Errorf("write manifest buffer: %w", err)
 					}
 					continue
 				}
@@ -191,15 +411,11 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 				// archive
 
 				if curFile == nil {
-					//nolint:errcheck
-					_ = closeCurrent()
-					return nil, fmt.Errorf("received data but no active file")
+					return nil, nil, fmt.Errorf("received data but no active file")
 				}
 				n, err := curFile.Write(m.Data[1:])
 				if err != nil {
-					//nolint:errcheck
-					_ = closeCurrent()
-					return nil, fmt.Errorf("write to storage pipe: %w", err)
+					return nil, nil, fmt.Errorf("write to storage pipe: %w", err)
 				}
 				totalBytes += int64(n)
 
@@ -208,7 +424,7 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 				log.Debug("received manifest start")
 
 				if err := closeCurrent(); err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 
 				inManifest = true
@@ -216,17 +432,19 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 
 				// Identifies the message as a progress report.
 			case 'p':
-				// only if Progress: true
+				// the bytes done of the whole backup, as pg_basebackup reads it
 				if len(m.Data) >= 9 {
 					//nolint:gosec
 					bytesDone := int64(binary.BigEndian.Uint64(m.Data[1:9]))
-					elapsed := time.Since(startTime)
-					log.Info("progress",
+					p := progress.update(bytesDone, time.Now())
+					log.Debug("progress",
 						slog.String("file", remotePath),
-						slog.Int64("bytes_done", bytesDone),
-						slog.String("bytes_done_iec", fsx.ByteCountIEC(bytesDone)),
-						slog.String("elapsed", elapsed.Round(time.Millisecond).String()),
+						slog.String("bytes_done_iec", fsx.ByteCountIEC(p.BytesDone)),
+						slog.String("bytes_total_iec", fsx.ByteCountIEC(p.BytesTotal)),
+						slog.Float64("percent", p.Percent),
+						slog.Int64("eta_seconds", p.ETASeconds),
 					)
+					bb.reportProgress(p)
 				}
 
 			default:
@@ -235,15 +453,17 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 
 		case *pgproto3.CopyDone:
 			if err := closeCurrent(); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			log.Info("backup stream complete")
 
 			stopRes, err := pglogrepl.FinishBaseBackup(ctx, bb.conn)
 			if err != nil {
-				return nil, fmt.Errorf("finish base backup: %w", err)
+				return nil, nil, fmt.Errorf("finish base backup: %w", err)
 			}
 
+			bb.reportProgress(progress.finish(time.Now()))
+
 			elapsed := time.Since(startTime)
 			log.Info("finished backup",
 				slog.String("StopLSN", stopRes.LSN.String()),
@@ -260,19 +480,47 @@ func (bb *baseBackup) streamBaseBackup(ctx context.Context) (*backupdto.Result,
 			if manifestBuf.Len() > 0 {
 				manifest := backupdto.BackupManifest{}
 				if err := json.Unmarshal(manifestBuf.Bytes(), &manifest); err != nil {
-					return nil, fmt.Errorf("parse manifest: %w", err)
+					return nil, nil, fmt.Errorf("parse manifest: %w", err)
 				}
 				result.Manifest = &manifest
 			}
 
-			return result, nil
+			return result, manifestBuf.Bytes(), nil
 
 		default:
-			return nil, fmt.Errorf("unexpected message type: %T", msg)
+			return nil, nil, fmt.Errorf("unexpected message type: %T", msg)
 		}
 	}
 }
 
+func (bb *baseBackup) waitForWAL(ctx context.Context, result *backupdto.Result) error {
+	if bb.archive == nil {
+		bb.log().Warn("backup taken from a standby without a WAL receiver, it is restorable once WAL up to the stop LSN is archived",
+			slog.String("stop_lsn", result.StopLSN.String()),
+		)
+		return nil
+	}
+	timeout := bb.walWaitTimeout
+	if timeout == 0 {
+		timeout = config.DefaultWALWaitTimeout
+	}
+	bb.log().Info("waiting for the receiver to archive the WAL of the backup",
+		slog.String("stop_lsn", result.StopLSN.String()),
+		slog.Duration("timeout", timeout),
+	)
+	if err := waitForWAL(ctx, bb.log(), bb.archive, result.TimelineID, result.StartLSN, result.StopLSN, timeout, walWaitPollInterval); err != nil {
+		return fmt.Errorf("wait for WAL: %w", err)
+	}
+	return nil
+}
+
+func (bb *baseBackup) reportProgress(p backupdto.Progress) {
+	backupmetrics.M.SetBasebackupProgress(float64(p.BytesDone), float64(p.BytesTotal), p.BytesPerSecond, float64(p.ETASeconds))
+	if bb.progress != nil {
+		bb.progress(p)
+	}
+}
+
 //nolint:gocritic
 func readCString(buf []byte) (string, []byte, error) {
 	idx := bytes.IndexByte(buf, 0)
@@ -2,12 +2,16 @@ package backup
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"log/slog"
 	"sync"
 
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
 )
 
 type StreamingFile struct {
@@ -16,12 +20,62 @@ type StreamingFile struct {
 	done chan struct{}
 	log  *slog.Logger
 
+	// checksum of the content written so far
+	sum  hash.Hash
+	size int64
+
+	// compressed content is decompressed through hw for the checksum, so
+	// that it covers the archive itself
+	hw       *io.PipeWriter
+	hashDone chan struct{}
+	hashErr  error
+
 	mu     sync.Mutex
 	putErr error
 	closed bool
 }
 
 func NewStreamingFile(ctx context.Context, log *slog.Logger, storage st.Storage, path string) *StreamingFile {
+	return newStreamingFile(log, path, func(r io.Reader) error {
+		return storage.Put(ctx, path, r)
+	})
+}
+
+// NewCompressedStreamingFile streams content compressed with dec's codec,
+// which is stored without recompression. The checksum is the one of the
+// decompressed content.
+func NewCompressedStreamingFile(
+	ctx context.Context,
+	log *slog.Logger,
+	storage st.Storage,
+	path string,
+	dec codec.Decompressor,
+) *StreamingFile {
+	sf := newStreamingFile(log, path, func(r io.Reader) error {
+		return st.PutCompressed(ctx, storage, path, dec, r)
+	})
+
+	hr, hw := io.Pipe()
+	sf.hw = hw
+	sf.hashDone = make(chan struct{})
+	go func() {
+		defer close(sf.hashDone)
+		rc, err := dec.Decompress(hr)
+		if err == nil {
+			sf.size, err = io.Copy(sf.sum, rc)
+			_ = rc.Close()
+		}
+		if err == nil {
+			// anything after the end of the compressed stream
+			_, err = io.Copy(io.Discard, hr)
+		}
+		sf.hashErr = err
+		_ = hr.CloseWithError(err)
+	}()
+	return sf
+}
+
+func newStreamingFile(log *slog.Logger, path string, put func(r io.Reader) error) *StreamingFile {
 	pr, pw := io.Pipe()
 
 	sf := &StreamingFile{
@@ -29,6 +83,7 @@ func NewStreamingFile(ctx context.Context, log *slog.Logger, storage st.Storage,
 		pw:   pw,
 		done: make(chan struct{}),
 		log:  log,
+		sum:  sha256.New(),
 	}
 
 	go func() {
@@ -38,7 +93,7 @@ func NewStreamingFile(ctx context.Context, log *slog.Logger, storage st.Storage,
 			close(sf.done)
 		}()
 
-		err := storage.Put(ctx, path, pr)
+		err := put(pr)
 
 		sf.mu.Lock()
 		sf.putErr = err
@@ -66,6 +121,14 @@ func (sf *StreamingFile) Write(p []byte) (int, error) {
 	}
 
 	n, werr := sf.pw.Write(p)
+	if sf.hw != nil {
+		if _, err := sf.hw.Write(p[:n]); err != nil {
+			return n, fmt.Errorf("decompress %s: %w", sf.path, err)
+		}
+	} else {
+		sf.sum.Write(p[:n])
+		sf.size += int64(n)
+	}
 	if werr != nil {
 		sf.mu.Lock()
 		err = sf.putErr
@@ -97,11 +160,49 @@ func (sf *StreamingFile) Close() error {
 
 	<-sf.done
 
+	if sf.hw != nil {
+		_ = sf.hw.Close()
+		<-sf.hashDone
+	}
+
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
 
 	if sf.putErr != nil {
 		return fmt.Errorf("storage put failed for %s: %w", sf.path, sf.putErr)
 	}
+	if sf.hashErr != nil {
+		return fmt.Errorf("decompress %s: %w", sf.path, sf.hashErr)
+	}
 	return nil
 }
+
+// Abort stops the upload with cause instead of completing it, a partial
+// multipart upload is aborted by the storage.
+func (sf *StreamingFile) Abort(cause error) {
+	if sf == nil {
+		return
+	}
+
+	sf.mu.Lock()
+	if sf.closed {
+		sf.mu.Unlock()
+		return
+	}
+	sf.closed = true
+	sf.mu.Unlock()
+
+	_ = sf.pw.CloseWithError(cause)
+	<-sf.done
+
+	if sf.hw != nil {
+		_ = sf.hw.CloseWithError(cause)
+		<-sf.hashDone
+	}
+}
+
+// Checksum returns the size and the hex SHA-256 of the content written so far,
+// decompressed for a compressed streaming file.
+func (sf *StreamingFile) Checksum() (int64, string) {
+	return sf.size, hex.EncodeToString(sf.sum.Sum(nil))
+}
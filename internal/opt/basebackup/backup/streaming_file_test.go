@@ -1,13 +1,18 @@
 package backup
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"log/slog"
 	"testing"
 
 	stormock "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newTestLogger(t *testing.T) *slog.Logger {
@@ -74,6 +79,57 @@ func TestStreamingFile_MultipleWritesAreConcatenated(t *testing.T) {
 	}
 }
 
+func TestStreamingFile_ChecksumCoversAllWrites(t *testing.T) {
+	t.Parallel()
+
+	sf := NewStreamingFile(context.Background(), newTestLogger(t), stormock.NewInMemoryStorage(), "base.tar")
+	_, err := sf.Write([]byte("hello "))
+	assert.NoError(t, err)
+	_, err = sf.Write([]byte("world"))
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Close())
+
+	size, sum := sf.Checksum()
+	want := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, int64(11), size)
+	assert.Equal(t, hex.EncodeToString(want[:]), sum)
+}
+
+func TestCompressedStreamingFile_StoresDecompressedContentChecksum(t *testing.T) {
+	t.Parallel()
+
+	var compressed bytes.Buffer
+	w, err := codec.ZstdCompressor{}.NewWriter(&compressed)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// the in-memory storage keeps no compressed objects, it gets the tar
+	stor := stormock.NewInMemoryStorage()
+	sf := NewCompressedStreamingFile(context.Background(), newTestLogger(t), stor, "base.tar", codec.ZstdDecompressor{})
+	data := compressed.Bytes()
+	_, err = sf.Write(data[:len(data)/2])
+	require.NoError(t, err)
+	_, err = sf.Write(data[len(data)/2:])
+	require.NoError(t, err)
+	require.NoError(t, sf.Close())
+
+	size, sum := sf.Checksum()
+	want := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, int64(11), size)
+	assert.Equal(t, hex.EncodeToString(want[:]), sum)
+	assert.Equal(t, []byte("hello world"), stor.Files["base.tar"])
+}
+
+func TestCompressedStreamingFile_CorruptStream(t *testing.T) {
+	t.Parallel()
+
+	sf := NewCompressedStreamingFile(context.Background(), newTestLogger(t), stormock.NewInMemoryStorage(), "base.tar", codec.ZstdDecompressor{})
+	_, _ = sf.Write([]byte("not zstd"))
+	assert.Error(t, sf.Close())
+}
+
 func TestStreamingFile_CloseIsIdempotent(t *testing.T) {
 	t.Parallel()
 
@@ -104,3 +160,31 @@ func TestStreamingFile_CloseOnNilDoesNothing(t *testing.T) {
 	err := sf.Close()
 	assert.NoError(t, err)
 }
+
+func TestStreamingFile_AbortDoesNotStoreFile(t *testing.T) {
+	t.Parallel()
+
+	stor := stormock.NewInMemoryStorage()
+	path := "base/20251128_abort"
+
+	sf := NewStreamingFile(context.Background(), newTestLogger(t), stor, path)
+	_, err := sf.Write([]byte("partial"))
+	require.NoError(t, err)
+
+	sf.Abort(errBackupAborted)
+	assert.NotContains(t, stor.Files, path)
+
+	// closing an aborted file is a no-op
+	assert.NoError(t, sf.Close())
+}
+
+func TestCompressedStreamingFile_Abort(t *testing.T) {
+	t.Parallel()
+
+	stor := stormock.NewInMemoryStorage()
+	sf := NewCompressedStreamingFile(context.Background(), newTestLogger(t), stor, "base.tar", codec.ZstdDecompressor{})
+	_, _ = sf.Write([]byte("partial"))
+
+	sf.Abort(errBackupAborted)
+	assert.NotContains(t, stor.Files, "base.tar")
+}
@@ -1,6 +1,8 @@
 package backupdto
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pglogrepl"
@@ -14,8 +16,16 @@ type Tablespace struct {
 	Location string `json:"location,omitempty"`
 }
 
+// IDLayout is the time layout of backup IDs, the UTC start of the backup.
+const IDLayout = "20060102150405"
+
+// ManifestFileName is the name of the PostgreSQL backup manifest, stored
+// next to the archives as it was received.
+const ManifestFileName = "backup_manifest"
+
 // Result will hold the return values  of the BaseBackup command
 type Result struct {
+	ID          string          `json:"id,omitempty"`
 	StartLSN    pglogrepl.LSN   `json:"start_lsn,omitempty"`
 	StopLSN     pglogrepl.LSN   `json:"stop_lsn,omitempty"`
 	TimelineID  int32           `json:"timeline_id,omitempty"`
@@ -24,6 +34,91 @@ type Result struct {
 	StartedAt   time.Time       `json:"started_at"`
 	FinishedAt  time.Time       `json:"finished_at"`
 	Manifest    *BackupManifest `json:"manifest,omitempty"`
+	Files       []File          `json:"files,omitempty"`
+
+	// Parent is the backup an incremental backup was taken against.
+	Parent string `json:"parent,omitempty"`
+	// Chain lists the backups an incremental backup is restored from, the
+	// full backup first and Parent last. Empty for full backups.
+	Chain []string `json:"chain,omitempty"`
+
+	// Label is the label of the backup, "pgrwl_<id>" unless one was given.
+	Label string `json:"label,omitempty"`
+	// Annotations are free-form key/value pairs given with the backup.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Pinned backups and the WAL they need are kept by retention.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Schedule is the name of the schedule that took the backup, empty
+	// for a manual one.
+	Schedule string `json:"schedule,omitempty"`
+	// RetentionClass names the retention class that keeps the backup.
+	RetentionClass string `json:"retention_class,omitempty"`
+
+	// IncludesWAL is set when base.tar holds the WAL needed to restore the
+	// backup, in pg_wal.
+	IncludesWAL bool `json:"includes_wal,omitempty"`
+
+	// Node is the server the backup was taken from.
+	Node *Node `json:"node,omitempty"`
+}
+
+// Node identifies the server a backup was taken from.
+type Node struct {
+	Host     string `json:"host,omitempty"`
+	Port     uint16 `json:"port,omitempty"`
+	SystemID string `json:"system_id,omitempty"`
+	Timeline int32  `json:"timeline,omitempty"`
+	Standby  bool   `json:"standby"`
+}
+
+// Incremental reports whether the backup needs its parents to be restored.
+func (r *Result) Incremental() bool {
+	return r.Parent != ""
+}
+
+// File is an archive of the backup with the checksum of its content,
+// before compression and encryption.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// Compression is the server-side compression the archive was received
+	// and stored with. Size and SHA256 are those of the tar itself.
+	Compression string `json:"compression,omitempty"`
+
+	// Parts lists the objects a split archive is stored as, in order, empty
+	// when it is stored as one object.
+	Parts []Part `json:"parts,omitempty"`
+}
+
+// Part is an object of a split archive, with the checksum of its content.
+type Part struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// partInfix separates the archive name from the part number: "base.tar.part00001".
+const partInfix = ".part"
+
+// PartName returns the name of part n of an archive, numbered from 1.
+func PartName(archive string, n int) string {
+	return fmt.Sprintf("%s%s%05d", archive, partInfix, n)
+}
+
+// PartOf returns the archive a part belongs to, false when name is not a part.
+func PartOf(name string) (string, bool) {
+	i := strings.LastIndex(name, partInfix)
+	if i <= 0 {
+		return "", false
+	}
+	num := name[i+len(partInfix):]
+	if len(num) < 5 || strings.Trim(num, "0123456789") != "" {
+		return "", false
+	}
+	return name[:i], true
 }
 
 // PostgreSQL manifest
@@ -66,7 +161,9 @@ type BackupManifest struct {
 
 // ManifestFile represents a single file entry in manifest
 type ManifestFile struct {
-	Path              string `json:"Path"`
+	Path string `json:"Path,omitempty"`
+	// EncodedPath is the hex-encoded path of a file whose name is not valid UTF-8
+	EncodedPath       string `json:"Encoded-Path,omitempty"`
 	Size              int64  `json:"Size"`
 	LastModified      string `json:"Last-Modified"`
 	ChecksumAlgorithm string `json:"Checksum-Algorithm"`
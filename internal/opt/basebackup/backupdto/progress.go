@@ -0,0 +1,25 @@
+package backupdto
+
+import "time"
+
+// Progress is the progress of a running basebackup, from the progress
+// reports of the server. Bytes are of the uncompressed archives.
+type Progress struct {
+	// BytesDone is the number of bytes streamed so far.
+	BytesDone int64 `json:"bytes_done"`
+	// BytesTotal is the size of all tablespaces estimated by the server
+	// when the backup started, 0 when unknown.
+	BytesTotal int64 `json:"bytes_total"`
+	// Percent is BytesDone of BytesTotal, at most 100.
+	Percent float64 `json:"percent"`
+	// BytesPerSecond is the average throughput since the backup started.
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	// ETASeconds is the estimated time left, 0 when unknown.
+	ETASeconds int64 `json:"eta_seconds"`
+	// Archive is the archive being streamed, "base.tar" for the data directory.
+	Archive string `json:"archive,omitempty"`
+	// Tablespace is the location of the tablespace being streamed, empty
+	// for the data directory.
+	Tablespace string    `json:"tablespace,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
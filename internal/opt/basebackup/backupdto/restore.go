@@ -4,4 +4,7 @@ type RestoreInfo struct {
 	BaseTar         string
 	TablespacesTars []string
 	ManifestFile    string
+	// BackupManifest is the raw PostgreSQL manifest, empty for backups
+	// that only kept the parsed one in ManifestFile.
+	BackupManifest string
 }
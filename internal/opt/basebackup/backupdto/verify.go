@@ -0,0 +1,81 @@
+package backupdto
+
+import "time"
+
+// Signature states of a verified backup marker.
+const (
+	SignatureVerified = "verified"
+	SignatureUnsigned = "unsigned"
+	SignatureInvalid  = "invalid"
+	SignatureDisabled = "disabled"
+)
+
+// Manifest checksum states of a verified backup.
+const (
+	ManifestChecksumVerified = "verified"
+	ManifestChecksumMismatch = "mismatch"
+	// ManifestChecksumSkipped is reported for backups that kept only the
+	// parsed manifest, its checksum cannot be recomputed.
+	ManifestChecksumSkipped = "skipped"
+)
+
+// Problem kinds of a verified backup.
+const (
+	ProblemBadSignature     = "bad_signature"
+	ProblemUnsigned         = "unsigned"
+	ProblemNoManifest       = "no_manifest"
+	ProblemManifestChecksum = "manifest_checksum_mismatch"
+	ProblemMissingArchive   = "missing_archive"
+	ProblemArchiveChecksum  = "archive_checksum_mismatch"
+	ProblemMissingFile      = "missing_file"
+	ProblemUnexpectedFile   = "unexpected_file"
+	ProblemSizeMismatch     = "size_mismatch"
+	ProblemChecksumMismatch = "checksum_mismatch"
+	ProblemMissingWAL       = "missing_wal"
+)
+
+// VerifyReport is the machine-readable result of a backup verification.
+type VerifyReport struct {
+	BackupID         string          `json:"backup_id"`
+	OK               bool            `json:"ok"`
+	StartedAt        time.Time       `json:"started_at"`
+	FinishedAt       time.Time       `json:"finished_at"`
+	Signature        string          `json:"signature"`
+	ManifestChecksum string          `json:"manifest_checksum"`
+	Archives         []ArchiveReport `json:"archives"`
+	FilesVerified    int             `json:"files_verified"`
+	BytesVerified    int64           `json:"bytes_verified"`
+	WAL              WALReport       `json:"wal"`
+	Problems         []Problem       `json:"problems,omitempty"`
+}
+
+// ArchiveReport is the result of one streamed archive.
+type ArchiveReport struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Files  int    `json:"files"`
+}
+
+// WALReport lists the WAL segments required by the backup.
+type WALReport struct {
+	Required int      `json:"required"`
+	Missing  []string `json:"missing,omitempty"`
+	// Pending segments are not archived yet, but wait for upload in the
+	// receive directory.
+	Pending []string `json:"pending,omitempty"`
+	// Included segments are part of the backup itself.
+	Included []string `json:"included,omitempty"`
+}
+
+// Problem is one failed check.
+type Problem struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AddProblem records a failed check.
+func (r *VerifyReport) AddProblem(kind, path, detail string) {
+	r.Problems = append(r.Problems, Problem{Kind: kind, Path: path, Detail: detail})
+}
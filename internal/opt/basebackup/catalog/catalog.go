@@ -0,0 +1,372 @@
+// Package catalog keeps the history of backup runs in the repository.
+//
+// The catalog is a single JSON object, rewritten after every run by the
+// receiver that takes the backups. It records failed runs, which leave no
+// backup marker, and saves reading the marker of every backup to list them.
+// A lost catalog is rebuilt from the markers, without the failed runs.
+package catalog
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+const (
+	// ObjectName is the name of the catalog object.
+	ObjectName = "catalog.json"
+
+	// MaxEntries bounds the catalog, the oldest entries are dropped first.
+	MaxEntries = 10000
+
+	// version of the catalog object.
+	version = 1
+)
+
+// Status of a run.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// SourceRebuild is the source of the entries rebuilt from backup markers.
+const SourceRebuild = "rebuild"
+
+// Entry is a backup run.
+type Entry struct {
+	// BackupID is empty for runs that failed before the backup was stored.
+	BackupID string `json:"backup_id,omitempty"`
+	Status   string `json:"status"`
+	// Source is what started the run, e.g. cron or manual.
+	Source   string `json:"source,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+	// Type is config.BackupTypeFull or config.BackupTypeIncremental.
+	Type   string `json:"type,omitempty"`
+	Parent string `json:"parent,omitempty"`
+
+	Label          string            `json:"label,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	Pinned         bool              `json:"pinned,omitempty"`
+	RetentionClass string            `json:"retention_class,omitempty"`
+
+	// StartedAt and FinishedAt are those of the backup, or of the run when
+	// it failed.
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+
+	StartLSN string `json:"start_lsn,omitempty"`
+	StopLSN  string `json:"stop_lsn,omitempty"`
+
+	// BytesTotal is the size of the backup as sent by the server,
+	// BytesStored its size in the storage, after compression.
+	BytesTotal       int64   `json:"bytes_total,omitempty"`
+	BytesStored      int64   `json:"bytes_stored,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// EntryFromResult describes a stored backup.
+func EntryFromResult(r *backupdto.Result) Entry {
+	e := Entry{
+		BackupID:       r.ID,
+		Status:         StatusSucceeded,
+		Schedule:       r.Schedule,
+		Type:           config.BackupTypeFull,
+		Parent:         r.Parent,
+		Label:          r.Label,
+		Annotations:    r.Annotations,
+		Pinned:         r.Pinned,
+		RetentionClass: r.RetentionClass,
+		StartedAt:      r.StartedAt,
+		FinishedAt:     r.FinishedAt,
+		StartLSN:       r.StartLSN.String(),
+		StopLSN:        r.StopLSN.String(),
+		BytesTotal:     r.BytesTotal,
+	}
+	if r.Parent != "" {
+		e.Type = config.BackupTypeIncremental
+	}
+	return e
+}
+
+func (e *Entry) setDuration() {
+	if !e.StartedAt.IsZero() && e.FinishedAt.After(e.StartedAt) {
+		e.DurationSeconds = e.FinishedAt.Sub(e.StartedAt).Seconds()
+	}
+}
+
+func (e *Entry) setStored(stored int64) {
+	e.BytesStored = stored
+	if stored > 0 && e.BytesTotal > 0 {
+		e.CompressionRatio = math.Round(float64(e.BytesTotal)/float64(stored)*100) / 100
+	}
+}
+
+// Filter selects entries of the history, zero fields match all.
+type Filter struct {
+	Status   string
+	Source   string
+	Schedule string
+	// Since and Until bound the start of the runs.
+	Since time.Time
+	Until time.Time
+	// Limit is the number of entries returned, unlimited when zero.
+	Limit int
+}
+
+func (f *Filter) match(e *Entry) bool {
+	switch {
+	case f.Status != "" && e.Status != f.Status,
+		f.Source != "" && e.Source != f.Source,
+		f.Schedule != "" && e.Schedule != f.Schedule,
+		!f.Since.IsZero() && e.StartedAt.Before(f.Since),
+		!f.Until.IsZero() && !e.StartedAt.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+type document struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Catalog is the catalog object in stor, of the backups in backups.
+type Catalog struct {
+	l       *slog.Logger
+	stor    st.Storage
+	backups st.Storage
+
+	mu sync.Mutex
+}
+
+func New(stor, backups st.Storage) *Catalog {
+	return &Catalog{
+		l:       slog.With(slog.String("component", "backup-catalog")),
+		stor:    stor,
+		backups: backups,
+	}
+}
+
+// Append records a run, it replaces an entry of the same backup. The stored
+// size of a succeeded backup is read from the storage. A missing catalog is
+// rebuilt first.
+func (c *Catalog) Append(ctx context.Context, e Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.setDuration()
+	if e.Status == StatusSucceeded && e.BackupID != "" && e.BytesStored == 0 {
+		stored, err := c.storedSize(ctx, e.BackupID)
+		if err != nil {
+			c.l.Warn("cannot read the stored size of the backup",
+				slog.String("backup_id", e.BackupID),
+				slog.Any("err", err),
+			)
+		} else {
+			e.setStored(stored)
+		}
+	}
+
+	entries, err := c.read(ctx)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.l.Info("catalog not found, rebuilding it from the backup markers")
+		entries, err = c.fromMarkers(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.BackupID != "" {
+		entries = slices.DeleteFunc(entries, func(old Entry) bool {
+			return old.BackupID == e.BackupID
+		})
+	}
+	return c.write(ctx, append(entries, e))
+}
+
+// Entries returns the entries in the order of the runs, nil when there is no
+// catalog yet.
+func (c *Catalog) Entries(ctx context.Context) ([]Entry, error) {
+	entries, err := c.read(ctx)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// History returns the entries matching f, the latest run first. Without a
+// catalog, the entries are rebuilt from the markers, but not stored.
+func (c *Catalog) History(ctx context.Context, f Filter) ([]Entry, error) {
+	entries, err := c.read(ctx)
+	if errors.Is(err, fs.ErrNotExist) {
+		entries, err = c.fromMarkers(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]Entry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !f.match(&entries[i]) {
+			continue
+		}
+		history = append(history, entries[i])
+		if f.Limit > 0 && len(history) == f.Limit {
+			break
+		}
+	}
+	return history, nil
+}
+
+// Rebuild adds the backups that have a marker but no entry to the catalog,
+// and returns the number of added entries. An unreadable catalog is
+// replaced, its failed runs are lost.
+func (c *Catalog) Rebuild(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.read(ctx)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.l.Warn("catalog cannot be read, it is replaced", slog.Any("err", err))
+		}
+		entries = nil
+	}
+	known := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.Status == StatusSucceeded {
+			known[e.BackupID] = true
+		}
+	}
+
+	rebuilt, err := c.fromMarkers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, e := range rebuilt {
+		if !known[e.BackupID] {
+			entries = append(entries, e)
+			added++
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return added, c.write(ctx, entries)
+}
+
+// fromMarkers returns an entry of every backup with a readable marker.
+func (c *Catalog) fromMarkers(ctx context.Context) ([]Entry, error) {
+	dirs, err := c.backups.ListTopLevelDirs(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+
+	var entries []Entry
+	for _, dir := range slices.Sorted(maps.Keys(dirs)) {
+		id := path.Base(dir)
+
+		r, err := c.readMarker(ctx, id)
+		if errors.Is(err, fs.ErrNotExist) {
+			// running or failed
+			continue
+		}
+		if err != nil {
+			c.l.Warn("backup skipped by the catalog because its marker cannot be read",
+				slog.String("backup_id", id),
+				slog.Any("err", err),
+			)
+			continue
+		}
+
+		e := EntryFromResult(r)
+		e.Source = SourceRebuild
+		e.setDuration()
+		if stored, err := c.storedSize(ctx, id); err == nil {
+			e.setStored(stored)
+		}
+		entries = append(entries, e)
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return cmp.Or(a.StartedAt.Compare(b.StartedAt), cmp.Compare(a.BackupID, b.BackupID))
+	})
+	return entries, nil
+}
+
+func (c *Catalog) readMarker(ctx context.Context, id string) (*backupdto.Result, error) {
+	rc, err := c.backups.Get(ctx, path.Join(id, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var r backupdto.Result
+	if err := json.NewDecoder(rc).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// storedSize returns the size of the objects of a backup.
+func (c *Catalog) storedSize(ctx context.Context, id string) (int64, error) {
+	var size int64
+	for fi, err := range c.backups.Iterate(ctx, id, st.IterateOpts{}) {
+		if err != nil {
+			return 0, err
+		}
+		size += fi.Size
+	}
+	return size, nil
+}
+
+func (c *Catalog) read(ctx context.Context) ([]Entry, error) {
+	rc, err := c.stor.Get(ctx, ObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var doc document
+	if err := json.NewDecoder(rc).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("read catalog: %w", err)
+	}
+	if doc.Version > version {
+		return nil, fmt.Errorf("read catalog: version %d is not supported, upgrade pgrwl", doc.Version)
+	}
+	return doc.Entries, nil
+}
+
+func (c *Catalog) write(ctx context.Context, entries []Entry) error {
+	if len(entries) > MaxEntries {
+		entries = entries[len(entries)-MaxEntries:]
+	}
+	data, err := json.Marshal(document{Version: version, Entries: entries})
+	if err != nil {
+		return err
+	}
+	// read back by the receiver, keep it readable for write-only encryption
+	if err := st.PutMeta(ctx, c.stor, ObjectName, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("write catalog: %w", err)
+	}
+	return nil
+}
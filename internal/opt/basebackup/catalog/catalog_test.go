@@ -0,0 +1,235 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+var t0 = time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+
+// putBackup stores a completed backup with an archive of size bytes.
+func putBackup(t *testing.T, stor st.Storage, r *backupdto.Result, size int) {
+	t.Helper()
+	ctx := context.Background()
+
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	require.NoError(t, stor.Put(ctx, r.ID+"/"+r.ID+".json", strings.NewReader(string(data))))
+	require.NoError(t, stor.Put(ctx, r.ID+"/base.tar.gz", strings.NewReader(strings.Repeat("x", size))))
+}
+
+func result(id string, started time.Time) *backupdto.Result {
+	return &backupdto.Result{
+		ID:         id,
+		StartLSN:   pglogrepl.LSN(0x1000000),
+		StopLSN:    pglogrepl.LSN(0x2000000),
+		BytesTotal: 4000,
+		StartedAt:  started,
+		FinishedAt: started.Add(90 * time.Second),
+	}
+}
+
+func readEntries(t *testing.T, stor *st.InMemoryStorage) []Entry {
+	t.Helper()
+	require.Contains(t, stor.Files, ObjectName)
+	var doc document
+	require.NoError(t, json.Unmarshal(stor.Files[ObjectName], &doc))
+	assert.Equal(t, version, doc.Version)
+	return doc.Entries
+}
+
+func TestAppendRecordsRuns(t *testing.T) {
+	ctx := context.Background()
+	catStor, backups := st.NewInMemoryStorage(), st.NewInMemoryStorage()
+	c := New(catStor, backups)
+
+	r := result("20260301020000", t0)
+	r.Parent = "20260228020000"
+	putBackup(t, backups, r, 1000)
+
+	e := EntryFromResult(r)
+	e.Source = "cron"
+	require.NoError(t, c.Append(ctx, e))
+	require.NoError(t, c.Append(ctx, Entry{
+		Status:     StatusFailed,
+		Source:     "manual",
+		StartedAt:  t0.Add(time.Hour),
+		FinishedAt: t0.Add(time.Hour + time.Second),
+		Error:      "create basebackup: connection refused",
+	}))
+
+	entries := readEntries(t, catStor)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "20260301020000", entries[0].BackupID)
+	assert.Equal(t, StatusSucceeded, entries[0].Status)
+	assert.Equal(t, config.BackupTypeIncremental, entries[0].Type)
+	assert.Equal(t, "0/1000000", entries[0].StartLSN)
+	assert.InDelta(t, 90, entries[0].DurationSeconds, 0.001)
+	// archive and marker
+	stored := int64(1000 + len(backups.Files["20260301020000/20260301020000.json"]))
+	assert.Equal(t, stored, entries[0].BytesStored)
+	assert.InDelta(t, 4000/float64(stored), entries[0].CompressionRatio, 0.01)
+
+	assert.Equal(t, StatusFailed, entries[1].Status)
+	assert.Empty(t, entries[1].BackupID)
+	assert.InDelta(t, 1, entries[1].DurationSeconds, 0.001)
+	assert.Equal(t, "create basebackup: connection refused", entries[1].Error)
+}
+
+func TestAppendRebuildsMissingCatalog(t *testing.T) {
+	ctx := context.Background()
+	catStor, backups := st.NewInMemoryStorage(), st.NewInMemoryStorage()
+	c := New(catStor, backups)
+
+	putBackup(t, backups, result("20260301020000", t0), 100)
+	r := result("20260302020000", t0.Add(24*time.Hour))
+	putBackup(t, backups, r, 100)
+	// failed backup, without marker
+	require.NoError(t, backups.Put(ctx, "20260303020000/base.tar.gz", strings.NewReader("x")))
+
+	e := EntryFromResult(r)
+	e.Source = "manual"
+	require.NoError(t, c.Append(ctx, e))
+
+	entries := readEntries(t, catStor)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "20260301020000", entries[0].BackupID)
+	assert.Equal(t, SourceRebuild, entries[0].Source)
+	// the run replaces the rebuilt entry of its backup
+	assert.Equal(t, "20260302020000", entries[1].BackupID)
+	assert.Equal(t, "manual", entries[1].Source)
+}
+
+func TestAppendDropsOldestEntries(t *testing.T) {
+	ctx := context.Background()
+	catStor := st.NewInMemoryStorage()
+	c := New(catStor, st.NewInMemoryStorage())
+
+	entries := make([]Entry, MaxEntries)
+	for i := range entries {
+		entries[i] = Entry{Status: StatusFailed, StartedAt: t0.Add(time.Duration(i) * time.Minute)}
+	}
+	require.NoError(t, c.write(ctx, entries))
+
+	require.NoError(t, c.Append(ctx, Entry{Status: StatusFailed, Error: "last"}))
+
+	got := readEntries(t, catStor)
+	require.Len(t, got, MaxEntries)
+	assert.Equal(t, t0.Add(time.Minute), got[0].StartedAt)
+	assert.Equal(t, "last", got[MaxEntries-1].Error)
+}
+
+func TestHistoryFilters(t *testing.T) {
+	ctx := context.Background()
+	c := New(st.NewInMemoryStorage(), st.NewInMemoryStorage())
+
+	runs := []Entry{
+		{BackupID: "a", Status: StatusSucceeded, Source: "cron", Schedule: "daily", StartedAt: t0},
+		{Status: StatusFailed, Source: "cron", Schedule: "daily", StartedAt: t0.Add(24 * time.Hour)},
+		{BackupID: "c", Status: StatusSucceeded, Source: "manual", StartedAt: t0.Add(48 * time.Hour)},
+		{Status: StatusCancelled, Source: "manual", StartedAt: t0.Add(72 * time.Hour)},
+	}
+	require.NoError(t, c.write(ctx, runs))
+
+	starts := func(entries []Entry) []time.Time {
+		var ts []time.Time
+		for _, e := range entries {
+			ts = append(ts, e.StartedAt)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name string
+		f    Filter
+		want []time.Time
+	}{
+		{"all, latest first", Filter{}, []time.Time{runs[3].StartedAt, runs[2].StartedAt, runs[1].StartedAt, runs[0].StartedAt}},
+		{"status", Filter{Status: StatusSucceeded}, []time.Time{runs[2].StartedAt, runs[0].StartedAt}},
+		{"source", Filter{Source: "cron"}, []time.Time{runs[1].StartedAt, runs[0].StartedAt}},
+		{"schedule", Filter{Schedule: "daily", Status: StatusFailed}, []time.Time{runs[1].StartedAt}},
+		{"since and until", Filter{Since: t0.Add(24 * time.Hour), Until: t0.Add(72 * time.Hour)}, []time.Time{runs[2].StartedAt, runs[1].StartedAt}},
+		{"limit", Filter{Limit: 1}, []time.Time{runs[3].StartedAt}},
+		{"none", Filter{Source: "api"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.History(ctx, tt.f)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, starts(got))
+		})
+	}
+}
+
+func TestHistoryWithoutCatalogReadsMarkers(t *testing.T) {
+	ctx := context.Background()
+	catStor, backups := st.NewInMemoryStorage(), st.NewInMemoryStorage()
+	c := New(catStor, backups)
+	putBackup(t, backups, result("20260301020000", t0), 100)
+
+	got, err := c.History(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "20260301020000", got[0].BackupID)
+	assert.NotContains(t, catStor.Files, ObjectName)
+
+	entries, err := c.Entries(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, entries)
+}
+
+func TestRebuildKeepsRecordedRuns(t *testing.T) {
+	ctx := context.Background()
+	catStor, backups := st.NewInMemoryStorage(), st.NewInMemoryStorage()
+	c := New(catStor, backups)
+
+	r1 := result("20260301020000", t0)
+	putBackup(t, backups, r1, 100)
+	e := EntryFromResult(r1)
+	e.Source = "cron"
+	require.NoError(t, c.Append(ctx, e))
+	require.NoError(t, c.Append(ctx, Entry{Status: StatusFailed, StartedAt: t0.Add(time.Hour), Error: "boom"}))
+
+	// taken while the catalog was not written
+	putBackup(t, backups, result("20260301000000", t0.Add(-2*time.Hour)), 100)
+
+	added, err := c.Rebuild(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	entries := readEntries(t, catStor)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "20260301000000", entries[0].BackupID)
+	assert.Equal(t, SourceRebuild, entries[0].Source)
+	assert.Equal(t, "cron", entries[1].Source)
+	assert.Equal(t, "boom", entries[2].Error)
+}
+
+func TestRebuildReplacesUnreadableCatalog(t *testing.T) {
+	ctx := context.Background()
+	catStor, backups := st.NewInMemoryStorage(), st.NewInMemoryStorage()
+	c := New(catStor, backups)
+	putBackup(t, backups, result("20260301020000", t0), 100)
+	require.NoError(t, catStor.Put(ctx, ObjectName, strings.NewReader("{")))
+
+	_, err := c.Entries(ctx)
+	require.Error(t, err)
+	require.Error(t, c.Append(ctx, Entry{Status: StatusFailed}))
+
+	added, err := c.Rebuild(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	require.Len(t, readEntries(t, catStor), 1)
+}
@@ -0,0 +1,215 @@
+// Package incremental reads the incremental files of PostgreSQL 17 backups
+// and combines them with their parent backup, as pg_combinebackup does.
+//
+// An incremental backup stores changed relation segments as
+// "INCREMENTAL.<name>" files holding only the modified blocks:
+//
+//	uint32 magic
+//	uint32 number of blocks
+//	uint32 truncation block length
+//	uint32 block numbers, relative to the segment
+//	padding up to a multiple of the block size, when any block follows
+//	the blocks
+//
+// Integers are in the byte order of the server.
+package incremental
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Prefix marks an incremental file in an incremental backup.
+	Prefix = "INCREMENTAL."
+
+	// BlockSize is the PostgreSQL block size (BLCKSZ).
+	BlockSize = 8192
+
+	// relSegSize is the number of blocks of a relation segment (RELSEG_SIZE).
+	relSegSize = 131072
+
+	magic uint32 = 0xd3ae1f0d
+)
+
+// Header is the header of an incremental file.
+type Header struct {
+	// TruncationBlockLength is the number of blocks taken from the parent,
+	// the parent's blocks beyond it are dropped.
+	TruncationBlockLength uint32
+	// Blocks are the numbers of the blocks stored in the file, in order.
+	Blocks []uint32
+}
+
+// Name returns the name of the file an incremental file reconstructs.
+func Name(p string) (string, bool) {
+	dir, base := path.Split(p)
+	if !strings.HasPrefix(base, Prefix) || len(base) == len(Prefix) {
+		return "", false
+	}
+	return dir + strings.TrimPrefix(base, Prefix), true
+}
+
+// ReadHeader reads the header of an incremental file, including its
+// padding, so that r is left at the first block.
+func ReadHeader(r io.Reader) (*Header, error) {
+	var fixed [12]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, fmt.Errorf("read incremental header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(fixed[0:4]) == magic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(fixed[0:4]) == magic:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not an incremental file")
+	}
+
+	n := order.Uint32(fixed[4:8])
+	if n > relSegSize {
+		return nil, fmt.Errorf("incremental file has %d blocks, more than a segment", n)
+	}
+	h := &Header{
+		TruncationBlockLength: order.Uint32(fixed[8:12]),
+		Blocks:                make([]uint32, n),
+	}
+	if h.TruncationBlockLength > relSegSize {
+		return nil, fmt.Errorf("incremental truncation length %d is beyond a segment", h.TruncationBlockLength)
+	}
+
+	if n > 0 {
+		buf := make([]byte, 4*n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("read incremental block numbers: %w", err)
+		}
+		for i := range h.Blocks {
+			h.Blocks[i] = order.Uint32(buf[4*i:])
+			if h.Blocks[i] >= relSegSize {
+				return nil, fmt.Errorf("incremental block %d is beyond a segment", h.Blocks[i])
+			}
+		}
+	}
+
+	if pad := h.size() - int64(len(fixed)) - 4*int64(n); pad > 0 {
+		if _, err := io.CopyN(io.Discard, r, pad); err != nil {
+			return nil, fmt.Errorf("read incremental header padding: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// size returns the size of the header with its padding.
+func (h *Header) size() int64 {
+	size := int64(12 + 4*len(h.Blocks))
+	if len(h.Blocks) > 0 && size%BlockSize != 0 {
+		size += BlockSize - size%BlockSize
+	}
+	return size
+}
+
+// Length returns the length in blocks of the reconstructed file.
+func (h *Header) Length() uint32 {
+	length := h.TruncationBlockLength
+	for _, b := range h.Blocks {
+		if b >= length {
+			length = b + 1
+		}
+	}
+	return length
+}
+
+// Apply reads an incremental file from r and applies it to target, which
+// holds the file as of the parent backup (a missing target is empty). The
+// blocks of the parent beyond the truncation length are dropped, the blocks
+// of the incremental file replace the parent's ones.
+func Apply(r io.Reader, target string) (err error) {
+	br := bufio.NewReaderSize(r, BlockSize)
+	h, err := ReadHeader(br)
+	if err != nil {
+		return err
+	}
+
+	//nolint:gosec
+	f, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	keep := int64(h.TruncationBlockLength) * BlockSize
+	if st.Size() < keep && !h.covers(st.Size()/BlockSize) {
+		return fmt.Errorf("%s: parent file has %d bytes, the incremental file needs %d", target, st.Size(), keep)
+	}
+	if st.Size() > keep {
+		if err := f.Truncate(keep); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, BlockSize)
+	for _, b := range h.Blocks {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return fmt.Errorf("read incremental block %d: %w", b, err)
+		}
+		if _, err := f.WriteAt(buf, int64(b)*BlockSize); err != nil {
+			return err
+		}
+	}
+	return f.Truncate(int64(h.Length()) * BlockSize)
+}
+
+// covers reports whether every block from `from` up to the truncation
+// length is stored in the file, so none of them is taken from the parent.
+func (h *Header) covers(from int64) bool {
+	stored := make(map[uint32]bool, len(h.Blocks))
+	for _, b := range h.Blocks {
+		stored[b] = true
+	}
+	for b := from; b < int64(h.TruncationBlockLength); b++ {
+		//nolint:gosec
+		if !stored[uint32(b)] {
+			return false
+		}
+	}
+	return true
+}
+
+// RewriteBackupLabel removes the INCREMENTAL FROM lines from the backup_label
+// of a combined data directory. The server refuses to start from a
+// backup_label that still names an incremental backup.
+func RewriteBackupLabel(pgdata string) error {
+	p := filepath.Join(pgdata, "backup_label")
+	//nolint:gosec
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	for line := range bytes.Lines(data) {
+		if bytes.HasPrefix(line, []byte("INCREMENTAL FROM LSN: ")) ||
+			bytes.HasPrefix(line, []byte("INCREMENTAL FROM TLI: ")) {
+			continue
+		}
+		out = append(out, line...)
+	}
+	return os.WriteFile(p, out, 0o600)
+}
@@ -0,0 +1,178 @@
+package incremental
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func block(ch byte) []byte {
+	return bytes.Repeat([]byte{ch}, BlockSize)
+}
+
+// encode writes an incremental file the way the server does.
+func encode(order binary.ByteOrder, truncation uint32, blocks map[uint32]byte, numbers []uint32) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, order, magic)
+	_ = binary.Write(&buf, order, uint32(len(numbers)))
+	_ = binary.Write(&buf, order, truncation)
+	for _, b := range numbers {
+		_ = binary.Write(&buf, order, b)
+	}
+	if len(numbers) > 0 && buf.Len()%BlockSize != 0 {
+		buf.Write(make([]byte, BlockSize-buf.Len()%BlockSize))
+	}
+	for _, b := range numbers {
+		buf.Write(block(blocks[b]))
+	}
+	return buf.Bytes()
+}
+
+func writeParent(t *testing.T, blocks ...byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "16385")
+	var data []byte
+	for _, ch := range blocks {
+		data = append(data, block(ch)...)
+	}
+	require.NoError(t, os.WriteFile(p, data, 0o600))
+	return p
+}
+
+func readBlocks(t *testing.T, p string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.Zero(t, len(data)%BlockSize)
+	var out []byte
+	for i := 0; i < len(data); i += BlockSize {
+		out = append(out, data[i])
+	}
+	return out
+}
+
+func TestName(t *testing.T) {
+	name, ok := Name("base/5/INCREMENTAL.16385")
+	assert.True(t, ok)
+	assert.Equal(t, "base/5/16385", name)
+
+	_, ok = Name("base/5/16385")
+	assert.False(t, ok)
+	_, ok = Name("base/5/INCREMENTAL.")
+	assert.False(t, ok)
+}
+
+func TestReadHeader(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := encode(order, 3, map[uint32]byte{1: 'b', 5: 'f'}, []uint32{1, 5})
+		r := bytes.NewReader(data)
+
+		h, err := ReadHeader(r)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(3), h.TruncationBlockLength)
+		assert.Equal(t, []uint32{1, 5}, h.Blocks)
+		assert.Equal(t, uint32(6), h.Length())
+		// the reader is left at the first block
+		assert.Equal(t, int64(2*BlockSize), int64(r.Len()))
+	}
+
+	_, err := ReadHeader(bytes.NewReader(make([]byte, 12)))
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	t.Run("replaces blocks and grows", func(t *testing.T) {
+		p := writeParent(t, 'a', 'a', 'a')
+		data := encode(binary.LittleEndian, 3, map[uint32]byte{1: 'b', 4: 'e'}, []uint32{1, 4})
+
+		require.NoError(t, Apply(bytes.NewReader(data), p))
+		// block 3 was never written: a hole, as in the server's file
+		assert.Equal(t, []byte{'a', 'b', 'a', 0, 'e'}, readBlocks(t, p))
+	})
+
+	t.Run("drops blocks beyond the truncation length", func(t *testing.T) {
+		p := writeParent(t, 'a', 'a', 'a', 'a')
+		data := encode(binary.LittleEndian, 2, map[uint32]byte{0: 'x'}, []uint32{0})
+
+		require.NoError(t, Apply(bytes.NewReader(data), p))
+		assert.Equal(t, []byte{'x', 'a'}, readBlocks(t, p))
+	})
+
+	t.Run("unchanged file", func(t *testing.T) {
+		p := writeParent(t, 'a', 'a')
+		require.NoError(t, Apply(bytes.NewReader(encode(binary.LittleEndian, 2, nil, nil)), p))
+		assert.Equal(t, []byte{'a', 'a'}, readBlocks(t, p))
+	})
+
+	t.Run("parent too short", func(t *testing.T) {
+		p := writeParent(t, 'a')
+		data := encode(binary.LittleEndian, 3, map[uint32]byte{1: 'b'}, []uint32{1})
+		assert.Error(t, Apply(bytes.NewReader(data), p))
+	})
+
+	t.Run("new file", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "16386")
+		data := encode(binary.LittleEndian, 0, map[uint32]byte{0: 'n', 1: 'm'}, []uint32{0, 1})
+		require.NoError(t, Apply(bytes.NewReader(data), p))
+		assert.Equal(t, []byte{'n', 'm'}, readBlocks(t, p))
+	})
+}
+
+func TestUntar(t *testing.T) {
+	dest := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "base/5"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "base/5/16385"), append(block('a'), block('a')...), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "PG_VERSION"), []byte("16\n"), 0o600))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	add := func(name string, data []byte) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600, Size: int64(len(data))}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	add("PG_VERSION", []byte("17\n"))
+	add("base/5/INCREMENTAL.16385", encode(binary.LittleEndian, 2, map[uint32]byte{1: 'b'}, []uint32{1}))
+	require.NoError(t, tw.Close())
+
+	require.NoError(t, Untar(&buf, dest))
+
+	assert.Equal(t, []byte{'a', 'b'}, readBlocks(t, filepath.Join(dest, "base/5/16385")))
+	version, err := os.ReadFile(filepath.Join(dest, "PG_VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, "17\n", string(version))
+	assert.NoFileExists(t, filepath.Join(dest, "base/5/INCREMENTAL.16385"))
+}
+
+func TestUntar_RejectsEscapingPaths(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o600}))
+	require.NoError(t, tw.Close())
+
+	assert.Error(t, Untar(&buf, t.TempDir()))
+}
+
+func TestRewriteBackupLabel(t *testing.T) {
+	dir := t.TempDir()
+	label := "START WAL LOCATION: 0/4000028 (file 000000010000000000000004)\n" +
+		"CHECKPOINT LOCATION: 0/4000080\n" +
+		"INCREMENTAL FROM LSN: 0/2000028\n" +
+		"INCREMENTAL FROM TLI: 1\n" +
+		"START TIMELINE: 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "backup_label"), []byte(label), 0o600))
+
+	require.NoError(t, RewriteBackupLabel(dir))
+
+	data, err := os.ReadFile(filepath.Join(dir, "backup_label"))
+	require.NoError(t, err)
+	assert.Equal(t, "START WAL LOCATION: 0/4000028 (file 000000010000000000000004)\n"+
+		"CHECKPOINT LOCATION: 0/4000080\n"+
+		"START TIMELINE: 1\n", string(data))
+}
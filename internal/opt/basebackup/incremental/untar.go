@@ -0,0 +1,69 @@
+package incremental
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Untar extracts an archive of an incremental backup over dest, which holds
+// the parent backup. Incremental files are applied to their parent file,
+// every other file replaces it.
+func Untar(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(filepath.Clean(hdr.Name))
+		if name == ".." || strings.HasPrefix(name, "../") || filepath.IsAbs(hdr.Name) {
+			return &fs.PathError{Op: "untar", Path: hdr.Name, Err: fs.ErrInvalid}
+		}
+		target := filepath.Join(dest, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+				return err
+			}
+			if orig, ok := Name(name); ok {
+				if err := Apply(tr, filepath.Join(dest, orig)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writeFile(tr, target); err != nil {
+				return err
+			}
+		default:
+			// skip other types (e.g., symlinks in tar)
+		}
+	}
+}
+
+func writeFile(r io.Reader, target string) error {
+	//nolint:gosec
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	//nolint:gosec
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
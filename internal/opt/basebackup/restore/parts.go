@@ -0,0 +1,116 @@
+package restore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// openArchive opens the archive p, reassembling its parts when the marker
+// records it as split. A modified part fails the read, unless modified is
+// set: it is called with the part and the read goes on.
+func openArchive(
+	ctx context.Context,
+	stor st.Storage,
+	p string,
+	files map[string]backupdto.File,
+	modified func(part backupdto.Part),
+) (io.ReadCloser, error) {
+	if f, ok := files[path.Base(p)]; ok && len(f.Parts) > 0 {
+		return &partsReader{ctx: ctx, stor: stor, dir: path.Dir(p), parts: f.Parts, modified: modified}, nil
+	}
+	rc, err := stor.Get(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", p, err)
+	}
+	return rc, nil
+}
+
+// partsReader reads the parts of a split archive in order, as one stream.
+// Every part is checked against its recorded size and checksum once read.
+type partsReader struct {
+	ctx   context.Context
+	stor  st.Storage
+	dir   string
+	parts []backupdto.Part
+
+	modified func(part backupdto.Part)
+
+	next int
+	cur  io.ReadCloser
+	sum  hash.Hash
+	n    int64
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if r.next == len(r.parts) {
+				return 0, io.EOF
+			}
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.cur.Read(p)
+		r.sum.Write(p[:n])
+		r.n += int64(n)
+		if errors.Is(err, io.EOF) {
+			if err := r.finishPart(); err != nil {
+				return n, err
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *partsReader) open() error {
+	part := r.parts[r.next]
+	rc, err := r.stor.Get(r.ctx, path.Join(r.dir, part.Name))
+	if err != nil {
+		return fmt.Errorf("get part %s: %w", part.Name, err)
+	}
+	r.cur = rc
+	r.sum = sha256.New()
+	r.n = 0
+	return nil
+}
+
+func (r *partsReader) finishPart() error {
+	part := r.parts[r.next]
+	err := r.cur.Close()
+	r.cur = nil
+	r.next++
+	if err != nil {
+		return fmt.Errorf("read part %s: %w", part.Name, err)
+	}
+	if r.n == part.Size && hex.EncodeToString(r.sum.Sum(nil)) == part.SHA256 {
+		return nil
+	}
+	if r.modified != nil {
+		r.modified(part)
+		return nil
+	}
+	return fmt.Errorf("checksum mismatch for part %s: the part was modified", part.Name)
+}
+
+func (r *partsReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
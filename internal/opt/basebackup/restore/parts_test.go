@@ -0,0 +1,97 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/x/tarx"
+)
+
+func TestMakeRestoreInfoGroupsParts(t *testing.T) {
+	b := newTestBackup(t)
+	b.partSize = 512
+	b.put(t)
+
+	ri, err := makeRestoreInfo(testBackupID, b.stor.Iterate(context.Background(), testBackupID, st.IterateOpts{}))
+
+	require.NoError(t, err)
+	assert.Equal(t, testBackupID+"/base.tar", ri.BaseTar)
+	assert.Equal(t, []string{testBackupID + "/16384.tar"}, ri.TablespacesTars)
+	assert.Equal(t, testBackupID+"/"+testBackupID+".json", ri.ManifestFile)
+}
+
+func TestUntarCheckedReassemblesParts(t *testing.T) {
+	b := newTestBackup(t)
+	b.partSize = 512
+	b.put(t)
+	ctx := context.Background()
+
+	target, err := loadBackup(ctx, b.stor, testBackupID, nil, false)
+	require.NoError(t, err)
+	require.Greater(t, len(target.files["base.tar"].Parts), 1)
+
+	dest := t.TempDir()
+	require.NoError(t, untarChecked(ctx, b.stor, target.ri.BaseTar, dest, target.files, tarx.Untar))
+
+	data, err := os.ReadFile(filepath.Join(dest, "global", "1262"))
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), 1000), data)
+}
+
+func TestUntarCheckedFailsOnModifiedPart(t *testing.T) {
+	b := newTestBackup(t)
+	b.partSize = 512
+	b.put(t)
+	ctx := context.Background()
+
+	name := modifyPart(t, b.stor, "base.tar")
+
+	target, err := loadBackup(ctx, b.stor, testBackupID, nil, false)
+	require.NoError(t, err)
+
+	err = untarChecked(ctx, b.stor, target.ri.BaseTar, t.TempDir(), target.files, tarx.Untar)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch for part "+name)
+}
+
+// modifyPart changes the content of a file in a part of archive, the tar
+// headers are left intact. It returns the name of the part.
+func modifyPart(t *testing.T, stor *st.InMemoryStorage, archive string) string {
+	t.Helper()
+	for i := 1; ; i++ {
+		name := backupdto.PartName(archive, i)
+		data, ok := stor.Files[testBackupID+"/"+name]
+		require.True(t, ok, "no part of %s holds file content", archive)
+		if j := bytes.Index(data, []byte("xxxx")); j >= 0 {
+			data = bytes.Clone(data)
+			data[j] = 'z'
+			stor.Files[testBackupID+"/"+name] = data
+			return name
+		}
+	}
+}
+
+func TestPartOf(t *testing.T) {
+	for name, want := range map[string]string{
+		"base.tar.part00001":  "base.tar",
+		"16384.tar.part12345": "16384.tar",
+		"base.tar.part123456": "base.tar",
+	} {
+		got, ok := backupdto.PartOf(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, want, got, name)
+	}
+	for _, name := range []string{"base.tar", "base.tar.part1", "base.tar.partxxxxx", ".part00001"} {
+		_, ok := backupdto.PartOf(name)
+		assert.False(t, ok, name)
+	}
+}
@@ -2,6 +2,7 @@ package restore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,13 +10,14 @@ import (
 
 	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/opt/api"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/incremental"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/hooks"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/fsx"
-	"github.com/pgrwl/pgrwl/internal/opt/shared/x/strx"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/tarx"
 )
 
 //nolint:revive
-func RestoreBaseBackup(ctx context.Context, cfg *config.Config, id, dest string) error {
+func RestoreBaseBackup(ctx context.Context, cfg *config.Config, id, dest string) (err error) {
 	loggr := slog.With(slog.String("component", "restore"), slog.String("id", id))
 
 	// safe check
@@ -42,72 +44,109 @@ func RestoreBaseBackup(ctx context.Context, cfg *config.Config, id, dest string)
 		return err
 	}
 
-	// get all backups available
-	backupsTs, err := stor.ListTopLevelDirs(ctx, "")
+	// decide which backup to use for restore, the 'latest' when no ID is given
+	backupID, err := resolveBackupID(ctx, stor, id)
 	if err != nil {
 		return err
 	}
-
-	// sort backup ids, decide which to use for restore
-	iDsSortedDesc := strx.SortDesc(backupsTs)
-	var backupID string
-	if id != "" {
-		if !strx.IsInList(id, iDsSortedDesc) {
-			// given backup ID is not present in backups list
-			return fmt.Errorf("no such backup: %s", id)
-		}
-		backupID = id
-	} else {
-		// a backup ID was not given, and there are no backups available, warn and return
-		if len(iDsSortedDesc) == 0 {
-			loggr.Warn("no backups in a storage")
-			return nil
-		}
-		// get the 'latest' backup available
-		backupID = iDsSortedDesc[0]
+	if backupID == "" {
+		// there are no backups available, warn and return
+		loggr.Warn("no backups in a storage")
+		return nil
 	}
 
-	// get backup files for restore (*.tar)
-	loggr.Info("querying backup files in storage")
-	backupFiles, err := stor.List(ctx, backupID)
+	verifier, err := api.NewVerifier(cfg)
 	if err != nil {
 		return err
 	}
-
-	// construct restore info, prepare manifest
-	loggr.Info("construct restore info")
-	ri := makeRestoreInfo(backupID, backupFiles)
-	mf, err := readManifestFile(ctx, backupID, stor, ri)
+	target, err := loadBackup(ctx, stor, backupID, verifier, cfg.Signing.AllowUnsigned)
 	if err != nil {
 		return err
 	}
 
-	// preflight checks
-	loggr.Info("running preflight checks")
-	err = checkTblspcDirsEmpty(backupID, ri, mf)
-	if err != nil {
+	// the hooks see the backup being restored, post hooks run whatever the
+	// outcome once the pre hooks passed
+	hookRunner := hooks.NewRunner(&cfg.Hooks)
+	if err := hookRunner.Run(ctx, restoreEvent(hooks.PreRestore, target, dest)); err != nil {
 		return err
 	}
+	defer func() {
+		ev := restoreEvent(hooks.PostRestore, target, dest)
+		ev.Status = hooks.StatusSucceeded
+		if err != nil {
+			ev.Status = hooks.StatusFailed
+			ev.Error = err.Error()
+		}
+		if hookErr := hookRunner.Run(ctx, ev); hookErr != nil {
+			err = errors.Join(err, hookErr)
+		}
+	}()
 
-	// 1) restore base
-	loggr.Info("restoring basebackup")
-	rc, err := stor.Get(ctx, ri.BaseTar)
+	// an incremental backup is restored on top of its parents, the full
+	// backup first
+	backups, err := loadChain(ctx, stor, target, verifier, cfg.Signing.AllowUnsigned)
 	if err != nil {
-		return fmt.Errorf("get %s: %w", id, err)
+		return err
 	}
-	if err := tarx.Untar(rc, dest); err != nil {
-		return fmt.Errorf("untar %s: %w", id, err)
+	if len(backups) > 1 {
+		loggr.Info("restoring incremental backup", slog.Any("chain", target.mf.Chain))
 	}
-	if err := rc.Close(); err != nil {
-		return err
+	if target.mf.IncludesWAL {
+		loggr.Info("backup includes its WAL, restoring it to pg_wal")
 	}
 
-	// 2) restore tablespaces
-	loggr.Info("restoring tablespaces")
-	err = restoreTblspc(ctx, backupID, dest, stor, ri, mf)
-	if err != nil {
-		return err
+	// preflight checks
+	loggr.Info("running preflight checks")
+	for _, b := range backups {
+		if err := checkTblspcDirsEmpty(b.id, b.ri, b.mf); err != nil {
+			return err
+		}
 	}
 
+	for i, b := range backups {
+		untar := tarx.Untar
+		if i > 0 {
+			untar = incremental.Untar
+		}
+
+		// 1) restore base
+		loggr.Info("restoring basebackup", slog.String("backup", b.id))
+		if err := untarChecked(ctx, stor, b.ri.BaseTar, dest, b.files, untar); err != nil {
+			return err
+		}
+
+		// 2) restore tablespaces
+		loggr.Info("restoring tablespaces", slog.String("backup", b.id))
+		if err := restoreTblspc(ctx, b.id, dest, stor, b.ri, b.mf, b.files, untar); err != nil {
+			return err
+		}
+
+		// 3) drop the files deleted since the parent was taken
+		if i > 0 {
+			if err := pruneFiles(dest, b, tablespaceLocations(backups[:i+1])); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(backups) > 1 {
+		if err := incremental.RewriteBackupLabel(dest); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// restoreEvent describes the restore of b into dest to its hooks.
+func restoreEvent(phase hooks.Phase, b *chainBackup, dest string) *hooks.Event {
+	mf := b.mf
+	return &hooks.Event{
+		Phase:      phase,
+		BackupID:   b.id,
+		Label:      mf.Label,
+		StartLSN:   mf.StartLSN.String(),
+		StopLSN:    mf.StopLSN.String(),
+		BytesTotal: mf.BytesTotal,
+		Dest:       filepath.ToSlash(dest),
+	}
+}
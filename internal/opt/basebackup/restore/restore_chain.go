@@ -0,0 +1,168 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/incremental"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// chainBackup is one backup of the chain an incremental backup is restored from.
+type chainBackup struct {
+	id    string
+	ri    *backupdto.RestoreInfo
+	mf    *backupdto.Result
+	files map[string]backupdto.File
+}
+
+func loadBackup(
+	ctx context.Context,
+	stor st.Storage,
+	backupID string,
+	verifier *signing.Verifier,
+	allowUnsigned bool,
+) (*chainBackup, error) {
+	// get backup files for restore (*.tar)
+	slog.Info("querying backup files in storage", slog.String("component", "restore"), slog.String("id", backupID))
+	ri, err := makeRestoreInfo(backupID, stor.Iterate(ctx, backupID, st.IterateOpts{}))
+	if err != nil {
+		return nil, err
+	}
+	mf, err := readManifestFile(ctx, backupID, stor, ri, verifier, allowUnsigned)
+	if err != nil {
+		return nil, err
+	}
+	// a signed marker covers the archives through their checksums
+	files, err := checkedFiles(ri, mf, verifier != nil && !allowUnsigned)
+	if err != nil {
+		return nil, err
+	}
+	return &chainBackup{id: backupID, ri: ri, mf: mf, files: files}, nil
+}
+
+// loadChain returns the backups to restore, in order: the parents listed in
+// the marker of target, then target itself.
+func loadChain(
+	ctx context.Context,
+	stor st.Storage,
+	target *chainBackup,
+	verifier *signing.Verifier,
+	allowUnsigned bool,
+) ([]*chainBackup, error) {
+	chain := target.mf.Chain
+	backups := make([]*chainBackup, 0, len(chain)+1)
+	for i, id := range chain {
+		b, err := loadBackup(ctx, stor, id, verifier, allowUnsigned)
+		if err != nil {
+			return nil, fmt.Errorf("parent backup %s of %s: %w", id, target.id, err)
+		}
+		// every parent must have been taken against the ones before it
+		if !slices.Equal(b.mf.Chain, chain[:i]) {
+			return nil, fmt.Errorf("backup %s is not a parent of %s", id, target.id)
+		}
+		backups = append(backups, b)
+	}
+	backups = append(backups, target)
+
+	for _, b := range backups[1:] {
+		if b.mf.Manifest == nil {
+			return nil, fmt.Errorf("incremental backup %s has no PostgreSQL manifest", b.id)
+		}
+	}
+	return backups, nil
+}
+
+// tablespaceLocations returns the locations of the tablespaces restored by
+// the given backups.
+func tablespaceLocations(backups []*chainBackup) map[int32]string {
+	locations := make(map[int32]string)
+	for _, b := range backups {
+		for _, ts := range b.mf.Tablespaces {
+			locations[ts.OID] = ts.Location
+		}
+	}
+	return locations
+}
+
+// pruneFiles removes the files of the parents that an incremental backup
+// does not list in its manifest: they were deleted after the parent was
+// taken. Tablespaces dropped since then lose their pg_tblspc link.
+func pruneFiles(pgdata string, b *chainBackup, locations map[int32]string) error {
+	keep := make(map[string]bool, len(b.mf.Manifest.Files))
+	for _, f := range b.mf.Manifest.Files {
+		p, err := manifestPath(f)
+		if err != nil {
+			return err
+		}
+		if orig, ok := incremental.Name(p); ok {
+			p = orig
+		}
+		keep[p] = true
+	}
+
+	// pg_tblspc/<oid> are links, WalkDir does not follow them
+	if err := pruneDir(pgdata, "", keep); err != nil {
+		return err
+	}
+
+	current := make(map[int32]bool, len(b.mf.Tablespaces))
+	for _, ts := range b.mf.Tablespaces {
+		current[ts.OID] = true
+	}
+	for oid, location := range locations {
+		oidStr := strconv.FormatInt(int64(oid), 10)
+		if err := pruneDir(location, "pg_tblspc/"+oidStr+"/", keep); err != nil {
+			return err
+		}
+		if !current[oid] {
+			link := filepath.Join(pgdata, "pg_tblspc", oidStr)
+			if err := os.Remove(link); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneDir removes the regular files under dir that are not in keep. The
+// files are looked up as prefix + their path relative to dir.
+func pruneDir(dir, prefix string, keep map[string]bool) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := prefix + filepath.ToSlash(rel)
+		if d.IsDir() {
+			// WAL is not part of the manifest
+			if name == "pg_wal" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || keep[name] {
+			return nil
+		}
+		slog.Debug("removing file deleted since the parent backup",
+			slog.String("component", "restore"),
+			slog.String("path", name),
+		)
+		return os.Remove(p)
+	})
+}
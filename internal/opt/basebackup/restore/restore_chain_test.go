@@ -0,0 +1,104 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putChainBackup(t *testing.T, stor st.Storage, id string, chain []string) {
+	t.Helper()
+	ctx := context.Background()
+	result := backupdto.Result{ID: id, Chain: chain, Manifest: &backupdto.BackupManifest{}}
+	marker, err := json.Marshal(result)
+	require.NoError(t, err)
+	require.NoError(t, stor.Put(ctx, id+"/base.tar", strings.NewReader("tar")))
+	require.NoError(t, stor.Put(ctx, id+"/"+id+".json", strings.NewReader(string(marker))))
+}
+
+func TestLoadChain(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	putChainBackup(t, stor, "20250101000000", nil)
+	putChainBackup(t, stor, "20250102000000", []string{"20250101000000"})
+	putChainBackup(t, stor, "20250103000000", []string{"20250101000000", "20250102000000"})
+
+	target, err := loadBackup(ctx, stor, "20250103000000", nil, false)
+	require.NoError(t, err)
+	backups, err := loadChain(ctx, stor, target, nil, false)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, b := range backups {
+		ids = append(ids, b.id)
+	}
+	assert.Equal(t, []string{"20250101000000", "20250102000000", "20250103000000"}, ids)
+
+	t.Run("missing parent", func(t *testing.T) {
+		require.NoError(t, stor.DeleteDir(ctx, "20250102000000"))
+		_, err := loadChain(ctx, stor, target, nil, false)
+		assert.ErrorContains(t, err, "parent backup 20250102000000")
+	})
+
+	t.Run("parent of another chain", func(t *testing.T) {
+		putChainBackup(t, stor, "20250102000000", nil)
+		_, err := loadChain(ctx, stor, target, nil, false)
+		assert.ErrorContains(t, err, "is not a parent")
+	})
+}
+
+func TestPruneFiles(t *testing.T) {
+	pgdata := t.TempDir()
+	tblspc := t.TempDir()
+	dropped := t.TempDir()
+
+	write := func(p string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o700))
+		require.NoError(t, os.WriteFile(p, []byte("x"), 0o600))
+	}
+	write(filepath.Join(pgdata, "PG_VERSION"))
+	write(filepath.Join(pgdata, "base/5/16385"))
+	write(filepath.Join(pgdata, "base/5/16390"))
+	write(filepath.Join(pgdata, "pg_wal/000000010000000000000002"))
+	write(filepath.Join(tblspc, "PG_17_202406281/5/16400"))
+	write(filepath.Join(tblspc, "PG_17_202406281/5/16401"))
+	write(filepath.Join(dropped, "PG_17_202406281/5/16500"))
+	require.NoError(t, os.MkdirAll(filepath.Join(pgdata, "pg_tblspc"), 0o700))
+	require.NoError(t, os.Symlink(tblspc, filepath.Join(pgdata, "pg_tblspc/16384")))
+	require.NoError(t, os.Symlink(dropped, filepath.Join(pgdata, "pg_tblspc/16385")))
+
+	b := &chainBackup{
+		id: "20250102000000",
+		mf: &backupdto.Result{
+			Tablespaces: []backupdto.Tablespace{{OID: 16384, Location: tblspc}},
+			Manifest: &backupdto.BackupManifest{Files: []backupdto.ManifestFile{
+				{Path: "PG_VERSION"},
+				{Path: "base/5/INCREMENTAL.16385"},
+				{Path: "pg_tblspc/16384/PG_17_202406281/5/INCREMENTAL.16400"},
+			}},
+		},
+	}
+	locations := map[int32]string{16384: tblspc, 16385: dropped}
+
+	require.NoError(t, pruneFiles(pgdata, b, locations))
+
+	assert.FileExists(t, filepath.Join(pgdata, "PG_VERSION"))
+	assert.FileExists(t, filepath.Join(pgdata, "base/5/16385"))
+	assert.NoFileExists(t, filepath.Join(pgdata, "base/5/16390"))
+	assert.FileExists(t, filepath.Join(pgdata, "pg_wal/000000010000000000000002"))
+	assert.FileExists(t, filepath.Join(tblspc, "PG_17_202406281/5/16400"))
+	assert.NoFileExists(t, filepath.Join(tblspc, "PG_17_202406281/5/16401"))
+	assert.NoFileExists(t, filepath.Join(dropped, "PG_17_202406281/5/16500"))
+	_, err := os.Lstat(filepath.Join(pgdata, "pg_tblspc/16385"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Lstat(filepath.Join(pgdata, "pg_tblspc/16384"))
+	assert.NoError(t, err)
+}
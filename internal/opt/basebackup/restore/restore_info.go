@@ -2,29 +2,66 @@ package restore
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"log/slog"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 )
 
-func makeRestoreInfo(backupID string, backupFiles []st.FileInfo) *backupdto.RestoreInfo {
+func makeRestoreInfo(backupID string, backupFiles iter.Seq2[st.FileInfo, error]) (*backupdto.RestoreInfo, error) {
 	loggr := slog.With(slog.String("component", "restore"), slog.String("id", backupID))
 	r := backupdto.RestoreInfo{}
 
 	// 0 = {string} "20251203150245/20251203150245.json"
 	// 1 = {string} "20251203150245/25222.tar"
 	// 2 = {string} "20251203150245/base.tar"
+	//
+	// a split archive is listed once, by the name of the archive:
+	// "20251203150245/base.tar.part00001" is "20251203150245/base.tar"
+
+	splitArchives := make(map[string]bool)
+	for fname, err := range backupFiles {
+		if err != nil {
+			return nil, err
+		}
 
-	for _, fname := range backupFiles {
 		// slight cleanup of path for querying
 		tmp := filepath.ToSlash(fname.Path)
 		tmp = strings.TrimPrefix(tmp, backupID+"/")
 
+		// the signature is read together with the marker
+		if tmp == backupID+".json"+signing.SigSuffix {
+			continue
+		}
+		if tmp == backupdto.ManifestFileName {
+			r.BackupManifest = fname.Path
+			continue
+		}
+		if archive, ok := backupdto.PartOf(tmp); ok && strings.HasSuffix(archive, ".tar") {
+			p := path.Join(path.Dir(filepath.ToSlash(fname.Path)), path.Base(archive))
+			if splitArchives[p] {
+				continue
+			}
+			splitArchives[p] = true
+			if strings.HasPrefix(archive, "base.") {
+				r.BaseTar = p
+			} else {
+				r.TablespacesTars = append(r.TablespacesTars, p)
+			}
+			continue
+		}
+
 		// check that files we have
 		isManifest := strings.HasPrefix(tmp, backupID+".json")
 		correctFile := isManifest || strings.HasSuffix(tmp, ".tar")
@@ -42,29 +79,129 @@ func makeRestoreInfo(backupID string, backupFiles []st.FileInfo) *backupdto.Rest
 			r.TablespacesTars = append(r.TablespacesTars, fname.Path)
 		}
 	}
-	return &r
+	return &r, nil
 }
 
+// readManifestFile reads the backup marker. With a verifier, its signature
+// is checked, and unsigned markers are accepted only when allowUnsigned is set.
 func readManifestFile(
 	ctx context.Context,
 	backupID string,
 	stor st.Storage,
 	ri *backupdto.RestoreInfo,
+	verifier *signing.Verifier,
+	allowUnsigned bool,
 ) (*backupdto.Result, error) {
 	if ri.ManifestFile == "" {
 		return nil, fmt.Errorf("no manifest file (*%s.json*) found for backup %s", backupID+".json", backupID)
 	}
-	mrc, err := stor.Get(ctx, ri.ManifestFile)
+
+	var data []byte
+	var err error
+	if verifier != nil {
+		data, err = signing.GetVerified(ctx, stor, verifier, signing.ContextBackupMarker, ri.ManifestFile)
+		if errors.Is(err, signing.ErrUnsigned) && allowUnsigned {
+			slog.Warn("backup marker is not signed", slog.String("id", backupID))
+			err = nil
+		}
+	} else {
+		data, err = readAll(ctx, stor, ri.ManifestFile)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("get manifest %s: %w", ri.ManifestFile, err)
 	}
+
 	var mf backupdto.Result
-	if err := json.NewDecoder(mrc).Decode(&mf); err != nil {
-		mrc.Close()
+	if err := json.Unmarshal(data, &mf); err != nil {
 		return nil, fmt.Errorf("decode manifest %s: %w", ri.ManifestFile, err)
 	}
-	if err := mrc.Close(); err != nil {
+	return &mf, nil
+}
+
+func readAll(ctx context.Context, stor st.Storage, path string) ([]byte, error) {
+	rc, err := stor.Get(ctx, path)
+	if err != nil {
 		return nil, err
 	}
-	return &mf, nil
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return data, rc.Close()
+}
+
+// checkedFiles returns the recorded checksums of the backup archives, nil
+// for markers written before they were recorded. With strict set, every
+// archive must be recorded, so a signed marker vouches for all of them.
+func checkedFiles(ri *backupdto.RestoreInfo, mf *backupdto.Result, strict bool) (map[string]backupdto.File, error) {
+	if len(mf.Files) == 0 {
+		if strict {
+			return nil, errors.New("backup marker has no archive checksums")
+		}
+		return nil, nil
+	}
+	files := make(map[string]backupdto.File, len(mf.Files))
+	for _, f := range mf.Files {
+		files[f.Name] = f
+	}
+	for _, p := range append([]string{ri.BaseTar}, ri.TablespacesTars...) {
+		if _, ok := files[path.Base(p)]; !ok {
+			return nil, fmt.Errorf("archive %s is not listed in the backup marker", p)
+		}
+	}
+	return files, nil
+}
+
+// untarFunc extracts an archive into dest: tarx.Untar for a full backup,
+// incremental.Untar for an incremental one.
+type untarFunc func(r io.Reader, dest string) error
+
+// untarChecked extracts an archive and compares its checksum with the
+// recorded one, when there is one.
+func untarChecked(ctx context.Context, stor st.Storage, p, dest string, files map[string]backupdto.File, untar untarFunc) error {
+	rc, err := openArchive(ctx, stor, p, files, nil)
+	if err != nil {
+		return err
+	}
+	if err := untarAndCompare(rc, p, dest, files, untar); err != nil {
+		_ = rc.Close()
+		return err
+	}
+	return rc.Close()
+}
+
+func untarAndCompare(r io.Reader, p, dest string, files map[string]backupdto.File, untar untarFunc) error {
+	want, ok := files[path.Base(p)]
+	if !ok {
+		if err := untar(r, dest); err != nil {
+			return fmt.Errorf("untar %s: %w", p, err)
+		}
+		return nil
+	}
+
+	sum := sha256.New()
+	cr := &countingReader{r: io.TeeReader(r, sum)}
+	if err := untar(cr, dest); err != nil {
+		return fmt.Errorf("untar %s: %w", p, err)
+	}
+	// the tar reader stops at the end-of-archive marker, hash the padding too
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return fmt.Errorf("read %s: %w", p, err)
+	}
+	if cr.n != want.Size || hex.EncodeToString(sum.Sum(nil)) != want.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: the archive was modified", p)
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
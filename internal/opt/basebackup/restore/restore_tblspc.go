@@ -10,7 +10,6 @@ import (
 	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/fsx"
-	"github.com/pgrwl/pgrwl/internal/opt/shared/x/tarx"
 )
 
 func getTblspcLocation(tarName string, mf *backupdto.Result) (backupdto.Tablespace, error) {
@@ -101,6 +100,8 @@ func restoreTblspc(
 	stor st.Storage,
 	ri *backupdto.RestoreInfo,
 	mf *backupdto.Result,
+	files map[string]backupdto.File,
+	untar untarFunc,
 ) error {
 	loggr := slog.With(slog.String("component", "restore"), slog.String("id", id))
 
@@ -109,10 +110,6 @@ func restoreTblspc(
 	}
 
 	for _, f := range ri.TablespacesTars {
-		rc, err := stor.Get(ctx, f)
-		if err != nil {
-			return fmt.Errorf("get %s: %w", id, err)
-		}
 		tsInfo, err := getTblspcLocation(f, mf)
 		if err != nil {
 			return err
@@ -121,10 +118,7 @@ func restoreTblspc(
 		dest := tsInfo.Location
 
 		loggr.Info("tblspc restore dest", slog.String("path", dest))
-		if err := tarx.Untar(rc, dest); err != nil {
-			return fmt.Errorf("untar %s: %w", id, err)
-		}
-		if err := rc.Close(); err != nil {
+		if err := untarChecked(ctx, stor, f, dest, files, untar); err != nil {
 			return err
 		}
 
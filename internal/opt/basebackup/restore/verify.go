@@ -0,0 +1,526 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/core/xlog"
+	"github.com/pgrwl/pgrwl/internal/opt/api"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/x/fsx"
+)
+
+// VerifyOpts configures VerifyBackup.
+type VerifyOpts struct {
+	// ID of the backup to verify, the latest one when empty.
+	ID string
+
+	BackupStor st.Storage
+	WalStor    st.Storage
+	WalSegSz   uint64
+
+	// LocalWALDir is the receive directory. WAL segments found there are
+	// reported as pending instead of missing.
+	LocalWALDir string
+
+	// Verifier checks the marker signature, nil when signing is disabled.
+	Verifier      *signing.Verifier
+	AllowUnsigned bool
+}
+
+// VerifyBaseBackup verifies a backup of the repository configured by cfg.
+func VerifyBaseBackup(ctx context.Context, cfg *config.Config, id string, walSegSz uint64) (*backupdto.VerifyReport, error) {
+	backupStor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir: filepath.ToSlash(cfg.Main.Directory),
+		SubPath: config.BaseBackupSubpath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	walStor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir:   filepath.ToSlash(cfg.Main.Directory),
+		SubPath:   config.LocalFSStorageSubpath,
+		WALLayout: cfg.Storage.WALLayout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := api.NewVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyBackup(ctx, &VerifyOpts{
+		ID:            id,
+		BackupStor:    backupStor,
+		WalStor:       walStor,
+		WalSegSz:      walSegSz,
+		Verifier:      verifier,
+		AllowUnsigned: cfg.Signing.AllowUnsigned,
+	})
+}
+
+// VerifyBackup streams every archive of a backup and checks it against the
+// PostgreSQL backup manifest, without extracting anything to disk, then
+// checks that the WAL needed to recover the backup is archived.
+//
+// Failed checks are reported in the result, an error is returned only when
+// the verification itself cannot run.
+func VerifyBackup(ctx context.Context, opts *VerifyOpts) (*backupdto.VerifyReport, error) {
+	if !xlog.IsValidWalSegSize(opts.WalSegSz) {
+		return nil, fmt.Errorf("invalid WAL segment size: %d", opts.WalSegSz)
+	}
+
+	backupID, err := resolveBackupID(ctx, opts.BackupStor, opts.ID)
+	if err != nil {
+		return nil, err
+	}
+	if backupID == "" {
+		return nil, errors.New("no backups in a storage")
+	}
+
+	loggr := slog.With(slog.String("component", "verify"), slog.String("id", backupID))
+	rep := &backupdto.VerifyReport{
+		BackupID:  backupID,
+		StartedAt: time.Now().UTC(),
+	}
+
+	ri, err := makeRestoreInfo(backupID, opts.BackupStor.Iterate(ctx, backupID, st.IterateOpts{}))
+	if err != nil {
+		return nil, err
+	}
+	mf, err := verifyMarker(ctx, opts, backupID, ri, rep)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := verifyBackupManifest(ctx, opts.BackupStor, ri, mf, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]backupdto.ManifestFile)
+	if manifest != nil {
+		for _, f := range manifest.Files {
+			p, err := manifestPath(f)
+			if err != nil {
+				return nil, err
+			}
+			expected[p] = f
+		}
+	}
+
+	recorded := make(map[string]backupdto.File, len(mf.Files))
+	for _, f := range mf.Files {
+		recorded[f.Name] = f
+	}
+	files := maps.Clone(recorded)
+	tars := ri.TablespacesTars
+	if ri.BaseTar != "" {
+		tars = append([]string{ri.BaseTar}, tars...)
+	} else {
+		rep.AddProblem(backupdto.ProblemMissingArchive, "base.tar", "")
+	}
+	seen := make(map[string]bool, len(expected))
+	for _, p := range tars {
+		loggr.Info("verifying archive", slog.String("path", p))
+		ar, err := verifyArchiveObject(ctx, opts.BackupStor, p, files, expected, seen, rep)
+		if err != nil {
+			return nil, err
+		}
+		rep.Archives = append(rep.Archives, ar)
+
+		want, ok := recorded[ar.Name]
+		delete(recorded, ar.Name)
+		switch {
+		case !ok && len(mf.Files) > 0:
+			rep.AddProblem(backupdto.ProblemArchiveChecksum, ar.Name, "not listed in the backup marker")
+		case ok && (want.Size != ar.Size || want.SHA256 != ar.SHA256):
+			rep.AddProblem(backupdto.ProblemArchiveChecksum, ar.Name, "the archive was modified")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(recorded)) {
+		rep.AddProblem(backupdto.ProblemMissingArchive, name, "listed in the backup marker")
+	}
+	for _, p := range slices.Sorted(maps.Keys(expected)) {
+		if !seen[p] {
+			rep.AddProblem(backupdto.ProblemMissingFile, p, "")
+		}
+	}
+
+	if manifest != nil {
+		loggr.Info("checking WAL ranges", slog.Int("ranges", len(manifest.WALRanges)))
+		if err := verifyWALRanges(ctx, opts, manifest.WALRanges, seen, rep); err != nil {
+			return nil, err
+		}
+	}
+
+	rep.OK = len(rep.Problems) == 0
+	rep.FinishedAt = time.Now().UTC()
+	loggr.Info("backup verification completed",
+		slog.Bool("ok", rep.OK),
+		slog.Int("files", rep.FilesVerified),
+		slog.Int("problems", len(rep.Problems)),
+	)
+	return rep, nil
+}
+
+// resolveBackupID returns id when the backup exists, the latest backup when
+// id is empty, and an empty string when there are no backups.
+func resolveBackupID(ctx context.Context, stor st.Storage, id string) (string, error) {
+	backupsTs, err := stor.ListTopLevelDirs(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	if id != "" {
+		if !backupsTs[id] {
+			return "", fmt.Errorf("no such backup: %s", id)
+		}
+		return id, nil
+	}
+	ids := slices.Sorted(maps.Keys(backupsTs))
+	if len(ids) == 0 {
+		return "", nil
+	}
+	return ids[len(ids)-1], nil
+}
+
+// verifyMarker reads the backup marker and records the state of its
+// signature. A marker with a wrong signature is still read, so that the
+// rest of the backup is checked as well.
+func verifyMarker(
+	ctx context.Context,
+	opts *VerifyOpts,
+	backupID string,
+	ri *backupdto.RestoreInfo,
+	rep *backupdto.VerifyReport,
+) (*backupdto.Result, error) {
+	if ri.ManifestFile == "" {
+		return nil, fmt.Errorf("no manifest file (*%s.json*) found for backup %s", backupID+".json", backupID)
+	}
+
+	var data []byte
+	var err error
+	rep.Signature = backupdto.SignatureDisabled
+	if opts.Verifier != nil {
+		data, err = signing.GetVerified(ctx, opts.BackupStor, opts.Verifier, signing.ContextBackupMarker, ri.ManifestFile)
+		switch {
+		case err == nil:
+			rep.Signature = backupdto.SignatureVerified
+		case errors.Is(err, signing.ErrUnsigned):
+			rep.Signature = backupdto.SignatureUnsigned
+			if !opts.AllowUnsigned {
+				rep.AddProblem(backupdto.ProblemUnsigned, ri.ManifestFile, "")
+			}
+			err = nil
+		case errors.Is(err, signing.ErrBadSignature):
+			rep.Signature = backupdto.SignatureInvalid
+			rep.AddProblem(backupdto.ProblemBadSignature, ri.ManifestFile, "")
+			data, err = readAll(ctx, opts.BackupStor, ri.ManifestFile)
+		}
+	} else {
+		data, err = readAll(ctx, opts.BackupStor, ri.ManifestFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get manifest %s: %w", ri.ManifestFile, err)
+	}
+
+	var mf backupdto.Result
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("decode manifest %s: %w", ri.ManifestFile, err)
+	}
+	return &mf, nil
+}
+
+// verifyBackupManifest returns the PostgreSQL manifest of the backup. The raw
+// manifest is checked against its Manifest-Checksum, and against the
+// checksum recorded in the (signed) marker.
+func verifyBackupManifest(
+	ctx context.Context,
+	stor st.Storage,
+	ri *backupdto.RestoreInfo,
+	mf *backupdto.Result,
+	rep *backupdto.VerifyReport,
+) (*backupdto.BackupManifest, error) {
+	if ri.BackupManifest == "" {
+		if mf.Manifest == nil {
+			rep.AddProblem(backupdto.ProblemNoManifest, "", "the backup has no PostgreSQL manifest")
+			return nil, nil
+		}
+		rep.ManifestChecksum = backupdto.ManifestChecksumSkipped
+		return mf.Manifest, nil
+	}
+
+	raw, err := readAll(ctx, stor, ri.BackupManifest)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", ri.BackupManifest, err)
+	}
+	var manifest backupdto.BackupManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", ri.BackupManifest, err)
+	}
+
+	rep.ManifestChecksum = backupdto.ManifestChecksumVerified
+	if err := checkManifestChecksum(raw, manifest.ManifestChecksum); err != nil {
+		rep.ManifestChecksum = backupdto.ManifestChecksumMismatch
+		rep.AddProblem(backupdto.ProblemManifestChecksum, backupdto.ManifestFileName, err.Error())
+	} else if mf.Manifest != nil && mf.Manifest.ManifestChecksum != manifest.ManifestChecksum {
+		rep.ManifestChecksum = backupdto.ManifestChecksumMismatch
+		rep.AddProblem(backupdto.ProblemManifestChecksum, backupdto.ManifestFileName, "does not match the backup marker")
+	}
+	return &manifest, nil
+}
+
+// checkManifestChecksum checks the SHA-256 of a raw manifest. As in
+// pg_verifybackup, the checksum covers everything up to and including the
+// newline before the last line, which holds the checksum itself.
+func checkManifestChecksum(raw []byte, want string) error {
+	body := bytes.TrimSuffix(raw, []byte("\n"))
+	idx := bytes.LastIndexByte(body, '\n')
+	if idx < 0 {
+		return errors.New("manifest has no checksum line")
+	}
+	sum := sha256.Sum256(raw[:idx+1])
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), want) {
+		return errors.New("manifest checksum does not match its content")
+	}
+	return nil
+}
+
+func manifestPath(f backupdto.ManifestFile) (string, error) {
+	if f.Path != "" || f.EncodedPath == "" {
+		return f.Path, nil
+	}
+	p, err := hex.DecodeString(f.EncodedPath)
+	if err != nil {
+		return "", fmt.Errorf("decode path: %w", err)
+	}
+	return string(p), nil
+}
+
+func verifyArchiveObject(
+	ctx context.Context,
+	stor st.Storage,
+	p string,
+	files map[string]backupdto.File,
+	expected map[string]backupdto.ManifestFile,
+	seen map[string]bool,
+	rep *backupdto.VerifyReport,
+) (backupdto.ArchiveReport, error) {
+	rc, err := openArchive(ctx, stor, p, files, func(part backupdto.Part) {
+		rep.AddProblem(backupdto.ProblemArchiveChecksum, part.Name, "the part was modified")
+	})
+	if err != nil {
+		return backupdto.ArchiveReport{}, err
+	}
+	ar, err := verifyArchive(rc, path.Base(p), expected, seen, rep)
+	if err != nil {
+		_ = rc.Close()
+		return ar, fmt.Errorf("read %s: %w", p, err)
+	}
+	return ar, rc.Close()
+}
+
+// verifyArchive reads one tar archive and checks every regular file in it
+// against the manifest. Tablespace archives ("<oid>.tar") hold the files of
+// pg_tblspc/<oid>/.
+func verifyArchive(
+	r io.Reader,
+	name string,
+	expected map[string]backupdto.ManifestFile,
+	seen map[string]bool,
+	rep *backupdto.VerifyReport,
+) (backupdto.ArchiveReport, error) {
+	ar := backupdto.ArchiveReport{Name: name}
+
+	prefix := ""
+	if oid := strings.TrimSuffix(name, ".tar"); oid != "base" {
+		prefix = "pg_tblspc/" + oid + "/"
+	}
+
+	sum := sha256.New()
+	cr := &countingReader{r: io.TeeReader(r, sum)}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ar, err
+		}
+		//nolint:staticcheck // old archives may use TypeRegA
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		p := prefix + strings.TrimPrefix(hdr.Name, "./")
+		if prefix == "" && p == backupdto.ManifestFileName {
+			continue
+		}
+
+		want, ok := expected[p]
+		// WAL segments included in the backup are not in the manifest,
+		// unlike their archive status and the timeline history files
+		if !ok && prefix == "" && strings.HasPrefix(p, "pg_wal/") {
+			if xlog.IsXLogFileName(path.Base(p)) {
+				seen[p] = true
+			}
+			continue
+		}
+		if !ok {
+			rep.AddProblem(backupdto.ProblemUnexpectedFile, p, "")
+			continue
+		}
+		seen[p] = true
+
+		if err := verifyFile(tr, p, want, rep); err != nil {
+			return ar, err
+		}
+		ar.Files++
+		rep.FilesVerified++
+		rep.BytesVerified += hdr.Size
+	}
+
+	// the tar reader stops at the end-of-archive marker, hash the padding too
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return ar, err
+	}
+	ar.Size = cr.n
+	ar.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return ar, nil
+}
+
+func verifyFile(r io.Reader, p string, want backupdto.ManifestFile, rep *backupdto.VerifyReport) error {
+	h, err := newFileHash(want.ChecksumAlgorithm)
+	if err != nil {
+		rep.AddProblem(backupdto.ProblemChecksumMismatch, p, err.Error())
+	}
+	w := io.Discard
+	if h != nil {
+		w = h
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	if n != want.Size {
+		rep.AddProblem(backupdto.ProblemSizeMismatch, p, fmt.Sprintf("size %d, manifest %d", n, want.Size))
+		return nil
+	}
+	if h != nil && !checksumMatches(h.Sum(nil), want.Checksum) {
+		rep.AddProblem(backupdto.ProblemChecksumMismatch, p, "")
+	}
+	return nil
+}
+
+// newFileHash returns nil for files without a checksum.
+func newFileHash(algo string) (hash.Hash, error) {
+	switch strings.ToUpper(algo) {
+	case "", "NONE":
+		return nil, nil
+	case "CRC32C":
+		return crc32cHash{crc32.New(crc32.MakeTable(crc32.Castagnoli))}, nil
+	case "SHA224":
+		return sha256.New224(), nil
+	case "SHA256":
+		return sha256.New(), nil
+	case "SHA384":
+		return sha512.New384(), nil
+	case "SHA512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+}
+
+func checksumMatches(sum []byte, want string) bool {
+	return strings.EqualFold(hex.EncodeToString(sum), want)
+}
+
+// crc32cHash sums as PostgreSQL writes a CRC32C into a manifest: the bytes
+// of the uint32 as the server holds it, little-endian on the platforms it
+// runs on, where the hash/crc32 sum is big-endian.
+type crc32cHash struct {
+	hash.Hash32
+}
+
+func (h crc32cHash) Sum(b []byte) []byte {
+	return binary.LittleEndian.AppendUint32(b, h.Sum32())
+}
+
+// verifyWALRanges checks that every segment of the WAL ranges of the backup
+// is archived or included in the backup, as listed in seen.
+func verifyWALRanges(
+	ctx context.Context,
+	opts *VerifyOpts,
+	ranges []backupdto.ManifestWALRange,
+	seen map[string]bool,
+	rep *backupdto.VerifyReport,
+) error {
+	for _, wr := range ranges {
+		start, err := pglogrepl.ParseLSN(wr.StartLSN)
+		if err != nil {
+			return fmt.Errorf("parse WAL range start %q: %w", wr.StartLSN, err)
+		}
+		end, err := pglogrepl.ParseLSN(wr.EndLSN)
+		if err != nil {
+			return fmt.Errorf("parse WAL range end %q: %w", wr.EndLSN, err)
+		}
+		//nolint:gosec
+		tli := uint32(wr.Timeline)
+
+		first := xlog.XLByteToSeg(uint64(start), opts.WalSegSz)
+		last := first
+		if end > start {
+			// the end LSN points past the last record
+			last = xlog.XLByteToSeg(uint64(end)-1, opts.WalSegSz)
+		}
+		for segNo := first; segNo <= last; segNo++ {
+			name := xlog.XLogFileName(tli, segNo, opts.WalSegSz)
+			rep.WAL.Required++
+
+			if seen["pg_wal/"+name] {
+				rep.WAL.Included = append(rep.WAL.Included, name)
+				continue
+			}
+			ok, err := opts.WalStor.Exists(ctx, name)
+			if err != nil {
+				return fmt.Errorf("check WAL %s: %w", name, err)
+			}
+			if ok {
+				continue
+			}
+			if opts.LocalWALDir != "" {
+				local := filepath.Join(opts.LocalWALDir, name)
+				if fsx.FileExists(local) || fsx.FileExists(local+xlog.PartialSuffix) {
+					rep.WAL.Pending = append(rep.WAL.Pending, name)
+					continue
+				}
+			}
+			rep.WAL.Missing = append(rep.WAL.Missing, name)
+			rep.AddProblem(backupdto.ProblemMissingWAL, name, "")
+		}
+	}
+	return nil
+}
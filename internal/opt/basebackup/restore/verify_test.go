@@ -0,0 +1,358 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBackupID = "20250101000000"
+	testWalSegSz = 16 * 1024 * 1024
+)
+
+type testBackup struct {
+	stor    *st.InMemoryStorage
+	walStor *st.InMemoryStorage
+	signer  *signing.Signer
+	files   map[string]map[string]string // archive -> path -> content
+	// wal holds the WAL segments included in base.tar, not in the manifest
+	wal map[string]string
+	// partSize splits the archives into parts of this size, when set
+	partSize int
+}
+
+func newTestBackup(t *testing.T) *testBackup {
+	t.Helper()
+	return &testBackup{
+		stor:    st.NewInMemoryStorage(),
+		walStor: st.NewInMemoryStorage(),
+		files: map[string]map[string]string{
+			"base.tar": {
+				"PG_VERSION":  "17\n",
+				"global/1262": strings.Repeat("x", 1000),
+			},
+			"16384.tar": {
+				"PG_17_202406281/5/16385": strings.Repeat("y", 512),
+			},
+		},
+	}
+}
+
+func buildTestTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "pg_wal/", Typeflag: tar.TypeDir, Mode: 0o700}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// crc32cHex encodes a CRC32C the way a little-endian server writes it.
+func crc32cHex(content string) string {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli)))
+	return hex.EncodeToString(b[:])
+}
+
+// rawManifest returns a manifest formatted as PostgreSQL writes it.
+func (b *testBackup) rawManifest() []byte {
+	var entries []string
+	for archive, files := range b.files {
+		prefix := ""
+		if archive != "base.tar" {
+			prefix = "pg_tblspc/" + strings.TrimSuffix(archive, ".tar") + "/"
+		}
+		for name, content := range files {
+			entries = append(entries, fmt.Sprintf(
+				`{ "Path": %q, "Size": %d, "Last-Modified": "2025-01-01 00:00:00 GMT", "Checksum-Algorithm": "CRC32C", "Checksum": %q }`,
+				prefix+name, len(content), crc32cHex(content)))
+		}
+	}
+	body := "{ \"PostgreSQL-Backup-Manifest-Version\": 1,\n\"Files\": [\n" +
+		strings.Join(entries, ",\n") + "\n],\n" +
+		"\"WAL-Ranges\": [\n{ \"Timeline\": 1, \"Start-LSN\": \"0/2000028\", \"End-LSN\": \"0/3000100\" }\n],\n"
+	sum := sha256.Sum256([]byte(body))
+	return []byte(body + fmt.Sprintf("\"Manifest-Checksum\": \"%s\"}\n", hex.EncodeToString(sum[:])))
+}
+
+func (b *testBackup) put(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+
+	result := backupdto.Result{ID: testBackupID, TimelineID: 1}
+	for archive, files := range b.files {
+		if archive == "base.tar" && len(b.wal) > 0 {
+			files = maps.Clone(files)
+			maps.Copy(files, b.wal)
+		}
+		data := buildTestTar(t, files)
+		sum := sha256.Sum256(data)
+		f := backupdto.File{Name: archive, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+		if b.partSize > 0 {
+			f.Parts = putParts(t, b.stor, testBackupID+"/"+archive, data, b.partSize)
+		} else {
+			require.NoError(t, b.stor.Put(ctx, testBackupID+"/"+archive, bytes.NewReader(data)))
+		}
+		result.Files = append(result.Files, f)
+	}
+
+	raw := b.rawManifest()
+	var manifest backupdto.BackupManifest
+	require.NoError(t, json.Unmarshal(raw, &manifest))
+	result.Manifest = &manifest
+	require.NoError(t, b.stor.Put(ctx, testBackupID+"/"+backupdto.ManifestFileName, bytes.NewReader(raw)))
+
+	marker, err := json.Marshal(result)
+	require.NoError(t, err)
+	require.NoError(t, signing.PutSigned(ctx, b.stor, b.signer, signing.ContextBackupMarker, testBackupID+"/"+testBackupID+".json", marker))
+
+	for _, seg := range []string{"000000010000000000000002", "000000010000000000000003"} {
+		require.NoError(t, b.walStor.Put(ctx, seg, strings.NewReader("wal")))
+	}
+}
+
+// putParts stores data as the parts of the archive p.
+func putParts(t *testing.T, stor st.Storage, p string, data []byte, size int) []backupdto.Part {
+	t.Helper()
+	var parts []backupdto.Part
+	for i := 0; len(data) > 0; i++ {
+		chunk := data[:min(size, len(data))]
+		data = data[len(chunk):]
+		part := backupdto.Part{Name: backupdto.PartName(filepath.Base(p), i+1), Size: int64(len(chunk))}
+		sum := sha256.Sum256(chunk)
+		part.SHA256 = hex.EncodeToString(sum[:])
+		require.NoError(t, stor.Put(context.Background(), filepath.Dir(p)+"/"+part.Name, bytes.NewReader(chunk)))
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func (b *testBackup) verify(t *testing.T, opts VerifyOpts) *backupdto.VerifyReport {
+	t.Helper()
+	opts.BackupStor = b.stor
+	opts.WalStor = b.walStor
+	opts.WalSegSz = testWalSegSz
+	rep, err := VerifyBackup(context.Background(), &opts)
+	require.NoError(t, err)
+	return rep
+}
+
+func problemKinds(rep *backupdto.VerifyReport) []string {
+	var kinds []string
+	for _, p := range rep.Problems {
+		kinds = append(kinds, p.Kind)
+	}
+	return kinds
+}
+
+func TestVerifyBackup_Valid(t *testing.T) {
+	b := newTestBackup(t)
+	b.put(t)
+
+	rep := b.verify(t, VerifyOpts{})
+
+	assert.True(t, rep.OK, "%+v", rep.Problems)
+	assert.Equal(t, testBackupID, rep.BackupID)
+	assert.Equal(t, 3, rep.FilesVerified)
+	assert.Len(t, rep.Archives, 2)
+	assert.Equal(t, backupdto.ManifestChecksumVerified, rep.ManifestChecksum)
+	assert.Equal(t, backupdto.SignatureDisabled, rep.Signature)
+	assert.Equal(t, 2, rep.WAL.Required)
+}
+
+func TestVerifyBackup_SplitArchives(t *testing.T) {
+	b := newTestBackup(t)
+	b.partSize = 1000
+	b.put(t)
+	require.Contains(t, b.stor.Files, testBackupID+"/base.tar.part00003")
+
+	rep := b.verify(t, VerifyOpts{})
+
+	assert.True(t, rep.OK, "%+v", rep.Problems)
+	assert.Equal(t, 3, rep.FilesVerified)
+	assert.Len(t, rep.Archives, 2)
+}
+
+func TestVerifyBackup_ModifiedPart(t *testing.T) {
+	b := newTestBackup(t)
+	b.partSize = 1000
+	b.put(t)
+
+	name := modifyPart(t, b.stor, "base.tar")
+
+	rep := b.verify(t, VerifyOpts{})
+
+	assert.False(t, rep.OK)
+	assert.Contains(t, rep.Problems, backupdto.Problem{
+		Kind:   backupdto.ProblemArchiveChecksum,
+		Path:   name,
+		Detail: "the part was modified",
+	})
+}
+
+func TestVerifyBackup_ModifiedFile(t *testing.T) {
+	b := newTestBackup(t)
+	b.put(t)
+
+	// same size, other content
+	files := map[string]string{
+		"PG_VERSION":  "17\n",
+		"global/1262": strings.Repeat("z", 1000),
+	}
+	require.NoError(t, b.stor.Put(context.Background(), testBackupID+"/base.tar", bytes.NewReader(buildTestTar(t, files))))
+
+	rep := b.verify(t, VerifyOpts{})
+
+	assert.False(t, rep.OK)
+	assert.ElementsMatch(t, []string{backupdto.ProblemChecksumMismatch, backupdto.ProblemArchiveChecksum}, problemKinds(rep))
+	assert.Equal(t, "global/1262", rep.Problems[0].Path)
+}
+
+func TestVerifyBackup_MissingAndUnexpectedFiles(t *testing.T) {
+	b := newTestBackup(t)
+	b.put(t)
+
+	files := map[string]string{
+		"PG_VERSION": "17\n",
+		"extra":      "e",
+	}
+	require.NoError(t, b.stor.Put(context.Background(), testBackupID+"/base.tar", bytes.NewReader(buildTestTar(t, files))))
+
+	rep := b.verify(t, VerifyOpts{})
+
+	assert.ElementsMatch(t, []string{
+		backupdto.ProblemUnexpectedFile,
+		backupdto.ProblemArchiveChecksum,
+		backupdto.ProblemMissingFile,
+	}, problemKinds(rep))
+}
+
+func TestVerifyBackup_ManifestChecksum(t *testing.T) {
+	b := newTestBackup(t)
+	b.put(t)
+
+	raw := bytes.Replace(b.rawManifest(), []byte(`"Size": 3`), []byte(`"Size": 4`), 1)
+	require.NoError(t, b.stor.Put(context.Background(), testBackupID+"/"+backupdto.ManifestFileName, bytes.NewReader(raw)))
+
+	rep := b.verify(t, VerifyOpts{})
+
+	assert.Equal(t, backupdto.ManifestChecksumMismatch, rep.ManifestChecksum)
+	assert.Contains(t, problemKinds(rep), backupdto.ProblemManifestChecksum)
+}
+
+func TestVerifyBackup_MissingWAL(t *testing.T) {
+	b := newTestBackup(t)
+	b.put(t)
+	require.NoError(t, b.walStor.Delete(context.Background(), "000000010000000000000003"))
+
+	rep := b.verify(t, VerifyOpts{})
+	assert.False(t, rep.OK)
+	assert.Equal(t, []string{"000000010000000000000003"}, rep.WAL.Missing)
+
+	// a segment waiting for upload in the receive directory is not missing
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "000000010000000000000003.partial"), []byte("wal"), 0o600))
+	rep = b.verify(t, VerifyOpts{LocalWALDir: dir})
+	assert.True(t, rep.OK, "%+v", rep.Problems)
+	assert.Equal(t, []string{"000000010000000000000003"}, rep.WAL.Pending)
+}
+
+func TestVerifyBackup_IncludedWAL(t *testing.T) {
+	b := newTestBackup(t)
+	b.files["base.tar"]["pg_wal/archive_status/000000010000000000000002.done"] = ""
+	b.wal = map[string]string{
+		"pg_wal/000000010000000000000002": "wal",
+		"pg_wal/000000010000000000000003": "wal",
+	}
+	b.put(t)
+	ctx := context.Background()
+	require.NoError(t, b.walStor.Delete(ctx, "000000010000000000000002"))
+	require.NoError(t, b.walStor.Delete(ctx, "000000010000000000000003"))
+
+	rep := b.verify(t, VerifyOpts{})
+	assert.True(t, rep.OK, "%+v", rep.Problems)
+	assert.Equal(t, 4, rep.FilesVerified)
+	assert.Equal(t, 2, rep.WAL.Required)
+	assert.Equal(t, []string{"000000010000000000000002", "000000010000000000000003"}, rep.WAL.Included)
+	assert.Empty(t, rep.WAL.Missing)
+}
+
+func TestVerifyBackup_Signature(t *testing.T) {
+	pub, priv, err := signing.GenerateKeyPair()
+	require.NoError(t, err)
+	signer, err := signing.NewSigner(priv)
+	require.NoError(t, err)
+	verifier, err := signing.NewVerifier(pub)
+	require.NoError(t, err)
+
+	b := newTestBackup(t)
+	b.signer = signer
+	b.put(t)
+
+	rep := b.verify(t, VerifyOpts{Verifier: verifier})
+	assert.True(t, rep.OK, "%+v", rep.Problems)
+	assert.Equal(t, backupdto.SignatureVerified, rep.Signature)
+
+	otherPub, _, err := signing.GenerateKeyPair()
+	require.NoError(t, err)
+	other, err := signing.NewVerifier(otherPub)
+	require.NoError(t, err)
+	rep = b.verify(t, VerifyOpts{Verifier: other})
+	assert.Equal(t, backupdto.SignatureInvalid, rep.Signature)
+	assert.Equal(t, []string{backupdto.ProblemBadSignature}, problemKinds(rep))
+}
+
+func TestVerifyBackup_LatestAndUnknownID(t *testing.T) {
+	b := newTestBackup(t)
+	b.put(t)
+
+	_, err := VerifyBackup(context.Background(), &VerifyOpts{
+		ID:         "20990101000000",
+		BackupStor: b.stor,
+		WalStor:    b.walStor,
+		WalSegSz:   testWalSegSz,
+	})
+	require.Error(t, err)
+
+	rep := b.verify(t, VerifyOpts{})
+	assert.Equal(t, testBackupID, rep.BackupID)
+}
+
+func TestChecksumMatches_CRC32CByteOrder(t *testing.T) {
+	h, err := newFileHash("CRC32C")
+	require.NoError(t, err)
+	_, _ = h.Write([]byte("data"))
+	sum := h.Sum(nil)
+
+	assert.True(t, checksumMatches(sum, crc32cHex("data")))
+	assert.True(t, checksumMatches(sum, strings.ToUpper(crc32cHex("data"))))
+	// only the byte order of the manifest
+	reversed := slices.Clone(sum)
+	slices.Reverse(reversed)
+	assert.False(t, checksumMatches(sum, hex.EncodeToString(reversed)))
+	assert.False(t, checksumMatches(sum, "00000000"))
+}
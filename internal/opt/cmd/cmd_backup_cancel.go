@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/x/cmdx"
+)
+
+type BackupCancelOpts struct {
+	Addr string
+}
+
+// ExecBackupCancel cancels the basebackup running in a pgrwl receiver.
+func ExecBackupCancel(ctx context.Context, w io.Writer, opts *BackupCancelOpts) error {
+	addr, err := cmdx.Addr(opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, addr+"/api/v1/basebackup", nil)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	// the body is informational, the status code decides
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		_, err = fmt.Fprintln(w, "basebackup cancellation requested")
+		return err
+	case http.StatusConflict:
+		return fmt.Errorf("no basebackup is running")
+	default:
+		if body.Error != "" {
+			return fmt.Errorf("server error: %s: %s", resp.Status, body.Error)
+		}
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/signal"
+	"syscall"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/restore"
+)
+
+type BackupVerifyOpts struct {
+	ID string
+	// WalSegSzMB is the WAL segment size of the cluster in megabytes.
+	WalSegSzMB uint64
+}
+
+// RunBackupVerify verifies a backup and writes its report as JSON. It fails
+// when any check failed, after the report is written.
+func RunBackupVerify(w io.Writer, cfg *config.Config, opts *BackupVerifyOpts) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	rep, err := restore.VerifyBaseBackup(ctx, cfg, opts.ID, opts.WalSegSzMB*1024*1024)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep); err != nil {
+		return err
+	}
+	if !rep.OK {
+		return fmt.Errorf("backup %s failed verification with %d problem(s)", rep.BackupID, len(rep.Problems))
+	}
+	return nil
+}
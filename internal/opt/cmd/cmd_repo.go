@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/api"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/x25519"
+)
+
+type RepoMigrateLayoutOpts struct {
+	Directory string
+	WALLayout string
+	DryRun    bool
+}
+
+// RunRepoMigrateLayout moves the WAL archive into the configured layout.
+// It may run next to a live receiver, and may be restarted after a failure.
+func RunRepoMigrateLayout(opts *RepoMigrateLayoutOpts) error {
+	loggr := slog.With("component", "repo-migrate-layout")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	layout := opts.WALLayout
+	if layout == "" {
+		layout = config.WALLayoutFlat
+	}
+
+	stor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir:   opts.Directory,
+		SubPath:   config.LocalFSStorageSubpath,
+		WALLayout: layout,
+	})
+	if err != nil {
+		return fmt.Errorf("setup storage: %w", err)
+	}
+
+	loggr.Info("migrating WAL archive", slog.String("layout", layout), slog.Bool("dry_run", opts.DryRun))
+
+	res, err := stor.MigrateWALLayout(ctx, st.MigrateWALLayoutOpts{
+		DryRun: opts.DryRun,
+		Log:    loggr,
+	})
+	if err != nil {
+		return fmt.Errorf("migrate WAL layout (moved %d files before the failure, safe to re-run): %w", res.Moved, err)
+	}
+	return nil
+}
+
+type RepoCopyOpts struct {
+	From         *config.Config
+	To           *config.Config
+	Parallel     int
+	DeleteSource bool
+	DryRun       bool
+}
+
+// RunRepoCopy copies the WAL archive and the base backups from one
+// repository into another, re-encoding them with the target settings.
+// The receiver must not write to either repository while it runs.
+func RunRepoCopy(opts *RepoCopyOpts) error {
+	loggr := slog.With("component", "repo-copy")
+
+	// A copy into the same location is a re-encoding in place, which
+	// 'repo rekey' does for encryption. The copy would read and delete
+	// the objects it writes.
+	if repoLocation(opts.From) == repoLocation(opts.To) {
+		return fmt.Errorf("source and target are the same repository: %s", repoLocation(opts.From))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	parts := []struct {
+		name    string
+		subPath string
+		last    func(string) bool
+	}{
+		{name: "wal archive", subPath: config.LocalFSStorageSubpath},
+		// a backup is visible once its marker exists, so markers go last
+		{name: "basebackups", subPath: config.BaseBackupSubpath, last: isBackupMarker},
+	}
+
+	for _, part := range parts {
+		src, err := api.SetupStorage(&api.SetupStorageOpts{
+			BaseDir:   filepath.ToSlash(opts.From.Main.Directory),
+			SubPath:   part.subPath,
+			WALLayout: opts.From.Storage.WALLayout,
+			Cfg:       opts.From,
+		})
+		if err != nil {
+			return fmt.Errorf("setup source storage: %w", err)
+		}
+		dst, err := api.SetupStorage(&api.SetupStorageOpts{
+			BaseDir:   filepath.ToSlash(opts.To.Main.Directory),
+			SubPath:   part.subPath,
+			WALLayout: opts.To.Storage.WALLayout,
+			Cfg:       opts.To,
+		})
+		if err != nil {
+			return fmt.Errorf("setup target storage: %w", err)
+		}
+
+		loggr.Info("copying "+part.name, slog.Bool("dry_run", opts.DryRun))
+
+		res, err := st.CopyStorage(ctx, src, dst, st.CopyOpts{
+			Parallel:     opts.Parallel,
+			Last:         part.last,
+			DeleteSource: opts.DeleteSource,
+			DryRun:       opts.DryRun,
+			Log:          loggr,
+		})
+		if err != nil {
+			return fmt.Errorf("copy %s (copied %d files before the failure, safe to re-run): %w", part.name, res.Copied, err)
+		}
+
+		loggr.Info("copied "+part.name,
+			slog.Int("copied", res.Copied),
+			slog.Int("skipped", res.Skipped),
+			slog.Int("deleted", res.Deleted),
+			slog.Int64("bytes", res.Bytes),
+		)
+	}
+	return nil
+}
+
+// repoLocation identifies where the repository of cfg is stored,
+// regardless of its compression and encryption.
+func repoLocation(cfg *config.Config) string {
+	dir := path.Clean(filepath.ToSlash(cfg.Main.Directory))
+	switch {
+	case cfg.IsLocalStor():
+		if abs, err := filepath.Abs(cfg.Main.Directory); err == nil {
+			dir = filepath.ToSlash(abs)
+		}
+		return "localfs://" + dir
+	case strings.EqualFold(cfg.Storage.Name, config.StorageNameSFTP):
+		sftp := cfg.Storage.SFTP
+		return fmt.Sprintf("sftp://%s@%s:%d/%s", sftp.User, strings.ToLower(sftp.Host), sftp.Port,
+			strings.TrimPrefix(path.Join(sftp.BaseDir, dir), "/"))
+	default:
+		s3 := cfg.Storage.S3
+		return fmt.Sprintf("s3://%s/%s/%s", strings.TrimSuffix(strings.ToLower(s3.URL), "/"), s3.Bucket,
+			strings.TrimPrefix(dir, "/"))
+	}
+}
+
+// isBackupMarker matches <id>/<id>.json, written when a basebackup completes.
+func isBackupMarker(p string) bool {
+	dir, file := path.Split(p)
+	dir = strings.TrimSuffix(dir, "/")
+	return dir != "" && !strings.Contains(dir, "/") && file == dir+".json"
+}
+
+type RepoRekeyOpts struct {
+	Directory string
+	Parallel  int
+	DryRun    bool
+}
+
+// RunRepoRekey re-encrypts the WAL archive and the base backups with the
+// active encryption key. It may run next to a live receiver, and may be
+// restarted after a failure.
+func RunRepoRekey(opts *RepoRekeyOpts) error {
+	loggr := slog.With("component", "repo-rekey")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := config.Cfg()
+	if err != nil {
+		return err
+	}
+	if cfg.Storage.Encryption.Algo == "" {
+		return fmt.Errorf("storage.encryption is not configured")
+	}
+
+	parts := []struct {
+		name    string
+		subPath string
+	}{
+		{name: "wal archive", subPath: config.LocalFSStorageSubpath},
+		{name: "basebackups", subPath: config.BaseBackupSubpath},
+	}
+
+	for _, part := range parts {
+		stor, err := api.SetupStorage(&api.SetupStorageOpts{
+			BaseDir: filepath.ToSlash(opts.Directory),
+			SubPath: part.subPath,
+		})
+		if err != nil {
+			return fmt.Errorf("setup storage: %w", err)
+		}
+
+		loggr.Info("rekeying "+part.name,
+			slog.String("active_key", cfg.Storage.Encryption.ActiveKey),
+			slog.Bool("dry_run", opts.DryRun),
+		)
+
+		res, err := stor.Rekey(ctx, st.RekeyOpts{
+			Parallel: opts.Parallel,
+			DryRun:   opts.DryRun,
+			Log:      loggr,
+		})
+		if err != nil {
+			return fmt.Errorf("rekey %s (rekeyed %d files before the failure, safe to re-run): %w", part.name, res.Rekeyed, err)
+		}
+
+		loggr.Info("rekeyed "+part.name,
+			slog.Int("rekeyed", res.Rekeyed),
+			slog.Int("current", res.Current),
+			slog.Int("cleaned", res.Cleaned),
+		)
+	}
+	return nil
+}
+
+type RepoRebuildCatalogOpts struct {
+	Directory string
+}
+
+// RunRepoRebuildCatalog adds the backups missing from the backup catalog,
+// and replaces a catalog that cannot be read. It may run next to a live
+// receiver, a run it records meanwhile may be overwritten.
+func RunRepoRebuildCatalog(opts *RepoRebuildCatalogOpts) error {
+	loggr := slog.With("component", "repo-rebuild-catalog")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	backupStor, err := initBasebackupStorage(opts.Directory)
+	if err != nil {
+		return fmt.Errorf("setup basebackup storage: %w", err)
+	}
+	c, err := initCatalog(opts.Directory, backupStor)
+	if err != nil {
+		return fmt.Errorf("setup catalog storage: %w", err)
+	}
+
+	added, err := c.Rebuild(ctx)
+	if err != nil {
+		return fmt.Errorf("rebuild catalog: %w", err)
+	}
+	loggr.Info("catalog rebuilt", slog.Int("added", added), slog.String("object", catalog.ObjectName))
+	return nil
+}
+
+// RunRepoKeygen writes a new x25519 key pair as a storage.encryption snippet.
+func RunRepoKeygen(w io.Writer) error {
+	pub, priv, err := x25519.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, `# the receiver needs only the public key,
+# restore and serve need the private key
+storage:
+  encryption:
+    algo: %s
+    public_key: %q
+    private_key: %q
+`, config.RepoEncryptorX25519, pub, priv)
+	return err
+}
+
+// RunRepoSignKeygen writes a new ed25519 key pair as a signing snippet.
+func RunRepoSignKeygen(w io.Writer) error {
+	pub, priv, err := signing.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, `# the receiver signs with the private key,
+# restore and serve verify with the public key
+signing:
+  private_key: %q
+  public_keys:
+    - %q
+`, priv, pub)
+	return err
+}
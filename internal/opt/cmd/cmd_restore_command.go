@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 
+	"github.com/pgrwl/pgrwl/internal/opt/api/serveapi"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/cmdx"
 )
 
@@ -49,6 +52,16 @@ func ExecRestoreCommand(walFileName, walFilePath string, opts *RestoreCommandOpt
 	}
 	defer fileDst.Close()
 
-	_, err = io.Copy(fileDst, resp.Body)
-	return err
+	// serve sends the checksum of files verified against a signed manifest,
+	// a file damaged on the way must not be replayed
+	sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(fileDst, sum), resp.Body); err != nil {
+		return err
+	}
+	want := resp.Header.Get(serveapi.ChecksumHeader)
+	if want != "" && want != hex.EncodeToString(sum.Sum(nil)) {
+		_ = os.Remove(walFilePath)
+		return fmt.Errorf("checksum mismatch for %s", walFileName)
+	}
+	return nil
 }
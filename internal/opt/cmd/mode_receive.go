@@ -20,8 +20,11 @@ import (
 	"github.com/pgrwl/pgrwl/internal/core/conv"
 	"github.com/pgrwl/pgrwl/internal/core/xlog"
 	"github.com/pgrwl/pgrwl/internal/opt/api"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
 	"github.com/pgrwl/pgrwl/internal/opt/metrics/backupmetrics"
 	"github.com/pgrwl/pgrwl/internal/opt/metrics/receivemetrics"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/lease"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 	"github.com/pgrwl/pgrwl/internal/opt/supervisors/backupsv"
 	"github.com/pgrwl/pgrwl/internal/opt/supervisors/receivesv"
@@ -34,6 +37,7 @@ type ReceiveModeOpts struct {
 	Slot             string
 	NoLoop           bool
 	ListenPort       int
+	WALLayout        string
 }
 
 func RunReceiveMode(opts *ReceiveModeOpts) error {
@@ -56,6 +60,7 @@ func RunReceiveMode(opts *ReceiveModeOpts) error {
 	// Critical:
 	//   - WAL receiver
 	//   - WAL archive supervisor, when enabled
+	//   - repository lease, when enabled
 	//
 	// Non-critical:
 	//   - HTTP API
@@ -105,12 +110,31 @@ func RunReceiveMode(opts *ReceiveModeOpts) error {
 		return fmt.Errorf("init basebackup storage: %w", err)
 	}
 
+	repoLease, err := initLease(cfg)
+	if err != nil {
+		return fmt.Errorf("init repository lease: %w", err)
+	}
+
+	signer, manifestStor, err := initSigning(cfg)
+	if err != nil {
+		return fmt.Errorf("init signing: %w", err)
+	}
+
+	backupCatalog, err := initCatalog(cfg.Main.Directory, basebackupStor)
+	if err != nil {
+		return fmt.Errorf("init backup catalog: %w", err)
+	}
+
 	basebackupSupervisor, err := backupsv.NewBaseBackupSupervisor(&backupsv.BackupSupervisorOpts{
 		Directory:      opts.ReceiveDirectory,
 		WalSegSz:       pgrw.WalSegSz(),
 		BasebackupStor: basebackupStor,
 		WalStor:        walStor,
+		ManifestStor:   manifestStor,
 		Cfg:            cfg,
+		Lease:          repoLease,
+		Receiver:       pgrw,
+		Catalog:        backupCatalog,
 	})
 	if err != nil {
 		return fmt.Errorf("init basebackup supervisor: %w", err)
@@ -151,37 +175,6 @@ func RunReceiveMode(opts *ReceiveModeOpts) error {
 		loggr.Info("wal-receiver stopped")
 	}()
 
-	//////////////////////////////////////////////////////////////////////
-	// Basebackup supervisor.
-	//
-	// Optional/non-critical component in merged receive mode.
-	//
-	// If it fails, WAL receiving must continue. Errors are logged only.
-	// This starts the cron-based backup daemon only when backup.cron is set.
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		defer func() {
-			if r := recover(); r != nil {
-				loggr.Error("basebackup supervisor panicked",
-					slog.Any("panic", r),
-					slog.String("goroutine", "basebackup-supervisor"),
-				)
-			}
-		}()
-
-		if err := basebackupSupervisor.RunCron(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				return
-			}
-
-			loggr.Error("basebackup supervisor failed", slog.Any("err", err))
-			return
-		}
-	}()
-
 	//////////////////////////////////////////////////////////////////////
 	// HTTP server.
 	//
@@ -210,6 +203,8 @@ func RunReceiveMode(opts *ReceiveModeOpts) error {
 				BaseDir: opts.ReceiveDirectory,
 				Storage: walStor,
 				Cfg:     cfg,
+				Lease:   repoLease,
+				Catalog: backupCatalog,
 			},
 			Backup: &backupapi.Opts{
 				Supervisor: basebackupSupervisor,
@@ -230,32 +225,112 @@ func RunReceiveMode(opts *ReceiveModeOpts) error {
 	}()
 
 	//////////////////////////////////////////////////////////////////////
-	// ArchiveSupervisor.
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		defer func() {
-			if r := recover(); r != nil {
-				sendFatalErr(fmt.Errorf("wal archive supervisor panicked: %v", r))
+	// Repository writers: basebackup supervisor and archive supervisor.
+	//
+	// When the repository lease is enabled, they start only after the lease
+	// is acquired, and the lease is released only after they stopped.
+	// Losing the lease is fatal.
+
+	startWriters := func(wg *sync.WaitGroup) {
+		// Basebackup supervisor.
+		//
+		// Optional/non-critical component in merged receive mode.
+		//
+		// If it fails, WAL receiving must continue. Errors are logged only.
+		// This starts the cron-based backup daemon only when backup.cron is set.
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			defer func() {
+				if r := recover(); r != nil {
+					loggr.Error("basebackup supervisor panicked",
+						slog.Any("panic", r),
+						slog.String("goroutine", "basebackup-supervisor"),
+					)
+				}
+			}()
+
+			if err := basebackupSupervisor.RunCron(ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+
+				loggr.Error("basebackup supervisor failed", slog.Any("err", err))
+				return
 			}
 		}()
 
-		u := receivesv.NewArchiveSupervisor(cfg, walStor, &receivesv.Opts{
-			ReceiveDirectory: opts.ReceiveDirectory,
-			PGRW:             pgrw,
-		})
+		// ArchiveSupervisor.
+		//
+		// Critical component. Any error or panic is fatal.
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			defer func() {
+				if r := recover(); r != nil {
+					sendFatalErr(fmt.Errorf("wal archive supervisor panicked: %v", r))
+				}
+			}()
+
+			u := receivesv.NewArchiveSupervisor(cfg, walStor, &receivesv.Opts{
+				ReceiveDirectory: opts.ReceiveDirectory,
+				PGRW:             pgrw,
+				Signer:           signer,
+				ManifestStor:     manifestStor,
+			})
+
+			if err := u.Run(ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+
+				sendFatalErr(fmt.Errorf("run wal archive supervisor: %w", err))
+				return
+			}
+		}()
+	}
 
-		if err := u.Run(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
+	if repoLease == nil {
+		startWriters(&wg)
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			defer func() {
+				if r := recover(); r != nil {
+					sendFatalErr(fmt.Errorf("repository lease panicked: %v", r))
+				}
+			}()
+
+			if err := repoLease.Acquire(ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				sendFatalErr(fmt.Errorf("acquire repository lease: %w", err))
 				return
 			}
 
-			sendFatalErr(fmt.Errorf("run wal archive supervisor: %w", err))
-			return
-		}
-	}()
+			var writersWg sync.WaitGroup
+			startWriters(&writersWg)
+
+			if err := repoLease.Run(ctx); err != nil {
+				sendFatalErr(fmt.Errorf("repository lease: %w", err))
+			}
+
+			writersWg.Wait()
+
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer releaseCancel()
+			if err := repoLease.Release(releaseCtx); err != nil {
+				loggr.Warn("cannot release repository lease", slog.Any("err", err))
+			}
+		}()
+	}
 
 	//////////////////////////////////////////////////////////////////////
 	// Wait for shutdown reason:
@@ -353,6 +428,7 @@ func initWalStorage(
 		BaseDir:         opts.ReceiveDirectory,
 		SubPath:         config.LocalFSStorageSubpath,
 		S3PartSizeBytes: walSegSz,
+		WALLayout:       opts.WALLayout,
 	})
 	if err != nil {
 		return nil, err
@@ -361,9 +437,58 @@ func initWalStorage(
 	return stor, nil
 }
 
+// initLease returns nil when the repository lease is disabled.
+func initLease(cfg *config.Config) (lease.Lease, error) {
+	if !cfg.Lock.Enable {
+		return nil, nil
+	}
+
+	stor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir: filepath.ToSlash(cfg.Main.Directory),
+		SubPath: config.LockSubpath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the lease object is coordination state, stored without transforms
+	return lease.New(&lease.Opts{
+		Storage: stor.Backend,
+		TTL:     cfg.Lock.TTLParsed,
+	})
+}
+
+// initSigning returns nil values when signing is disabled. The manifest
+// storage is also returned without a signer, retention cleans it up.
+func initSigning(cfg *config.Config) (*signing.Signer, st.Storage, error) {
+	if !cfg.Signing.Enabled() {
+		return nil, nil, nil
+	}
+	signer, err := api.NewSigner(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	stor, err := api.SetupWALManifestStorage(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, stor, nil
+}
+
 func initBasebackupStorage(baseDir string) (st.Storage, error) {
 	return api.SetupStorage(&api.SetupStorageOpts{
 		BaseDir: filepath.ToSlash(baseDir),
 		SubPath: config.BaseBackupSubpath,
 	})
 }
+
+func initCatalog(baseDir string, basebackupStor st.Storage) (*catalog.Catalog, error) {
+	stor, err := api.SetupStorage(&api.SetupStorageOpts{
+		BaseDir: filepath.ToSlash(baseDir),
+		SubPath: config.CatalogSubpath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return catalog.New(stor, basebackupStor), nil
+}
@@ -12,11 +12,31 @@ import (
 	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/opt/api"
 	"github.com/pgrwl/pgrwl/internal/opt/api/serveapi"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 )
 
 type ServeModeOpts struct {
-	Directory  string
-	ListenPort int
+	Directory     string
+	ListenPort    int
+	WALLayout     string
+	AllowUnsigned bool
+}
+
+// initWALIndex returns nil when signing is disabled.
+func initWALIndex() (*signing.WALIndex, error) {
+	cfg, err := config.Cfg()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := api.NewVerifier(cfg)
+	if err != nil || verifier == nil {
+		return nil, err
+	}
+	stor, err := api.SetupWALManifestStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewWALIndex(stor, verifier), nil
 }
 
 func RunServeMode(opts *ServeModeOpts) error {
@@ -30,13 +50,19 @@ func RunServeMode(opts *ServeModeOpts) error {
 	defer signalCancel()
 
 	stor, err := api.SetupStorage(&api.SetupStorageOpts{
-		BaseDir: opts.Directory,
-		SubPath: config.LocalFSStorageSubpath,
+		BaseDir:   opts.Directory,
+		SubPath:   config.LocalFSStorageSubpath,
+		WALLayout: opts.WALLayout,
 	})
 	if err != nil {
 		return fmt.Errorf("setup storage: %w", err)
 	}
 
+	walIndex, err := initWALIndex()
+	if err != nil {
+		return fmt.Errorf("init signing: %w", err)
+	}
+
 	var wg sync.WaitGroup
 
 	errCh := make(chan error, 1)
@@ -67,8 +93,10 @@ func RunServeMode(opts *ServeModeOpts) error {
 		}()
 
 		handlers := serveapi.Init(&serveapi.Opts{
-			BaseDir: opts.Directory,
-			Storage: stor,
+			BaseDir:       opts.Directory,
+			Storage:       stor,
+			WALIndex:      walIndex,
+			AllowUnsigned: opts.AllowUnsigned,
 		})
 
 		srv := api.NewHTTPServer(opts.ListenPort, handlers)
@@ -13,6 +13,9 @@ var M bbMetrics = &bbMetricsNoop{}
 type bbMetrics interface {
 	AddBasebackupBytesReceived(float64)
 	AddBasebackupBytesDeleted(float64)
+	IncBasebackupVerifications(ok bool)
+	SetBasebackupProgress(done, total, bytesPerSecond, etaSeconds float64)
+	AddBasebackupCleanup(kind string, bytes float64)
 }
 
 // noop
@@ -21,8 +24,11 @@ type bbMetricsNoop struct{}
 
 var _ bbMetrics = &bbMetricsNoop{}
 
-func (p bbMetricsNoop) AddBasebackupBytesReceived(_ float64) {}
-func (p bbMetricsNoop) AddBasebackupBytesDeleted(_ float64)  {}
+func (p bbMetricsNoop) AddBasebackupBytesReceived(_ float64)     {}
+func (p bbMetricsNoop) AddBasebackupBytesDeleted(_ float64)      {}
+func (p bbMetricsNoop) IncBasebackupVerifications(_ bool)        {}
+func (p bbMetricsNoop) SetBasebackupProgress(_, _, _, _ float64) {}
+func (p bbMetricsNoop) AddBasebackupCleanup(_ string, _ float64) {}
 
 // prom
 
@@ -30,6 +36,17 @@ type pgrwlMetricsProm struct {
 	// basebackup
 	bbBytesReceived prometheus.Counter
 	bbBytesDeleted  prometheus.Counter
+	bbVerifications *prometheus.CounterVec
+
+	// progress of the running basebackup
+	bbProgressDone       prometheus.Gauge
+	bbProgressTotal      prometheus.Gauge
+	bbProgressThroughput prometheus.Gauge
+	bbProgressETA        prometheus.Gauge
+
+	// cleanup of failed backups
+	bbCleanups     *prometheus.CounterVec
+	bbCleanupBytes *prometheus.CounterVec
 }
 
 var _ bbMetrics = &pgrwlMetricsProm{}
@@ -49,6 +66,34 @@ func InitPromMetrics(_ context.Context) {
 			Name: "pgrwl_basebackup_bytes_deleted_total",
 			Help: "Total number of basebackup bytes deleted.",
 		}),
+		bbVerifications: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "pgrwl_basebackup_verifications_total",
+			Help: "Total number of basebackup verifications, by result.",
+		}, []string{"result"}),
+		bbProgressDone: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "pgrwl_basebackup_progress_bytes_done",
+			Help: "Bytes streamed by the running or last basebackup.",
+		}),
+		bbProgressTotal: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "pgrwl_basebackup_progress_bytes_total",
+			Help: "Estimated size of the running or last basebackup.",
+		}),
+		bbProgressThroughput: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "pgrwl_basebackup_progress_bytes_per_second",
+			Help: "Average throughput of the running or last basebackup.",
+		}),
+		bbProgressETA: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "pgrwl_basebackup_progress_eta_seconds",
+			Help: "Estimated time left of the running basebackup, 0 when unknown.",
+		}),
+		bbCleanups: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "pgrwl_basebackup_cleanup_total",
+			Help: "Total number of orphaned backups deleted and unfinished uploads aborted, by kind.",
+		}, []string{"kind"}),
+		bbCleanupBytes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "pgrwl_basebackup_cleanup_bytes_total",
+			Help: "Total number of bytes reclaimed from failed backups, by kind.",
+		}, []string{"kind"}),
 	}
 }
 
@@ -61,3 +106,23 @@ func (p *pgrwlMetricsProm) AddBasebackupBytesReceived(f float64) {
 func (p *pgrwlMetricsProm) AddBasebackupBytesDeleted(f float64) {
 	p.bbBytesDeleted.Add(f)
 }
+
+func (p *pgrwlMetricsProm) IncBasebackupVerifications(ok bool) {
+	result := "failed"
+	if ok {
+		result = "ok"
+	}
+	p.bbVerifications.WithLabelValues(result).Inc()
+}
+
+func (p *pgrwlMetricsProm) SetBasebackupProgress(done, total, bytesPerSecond, etaSeconds float64) {
+	p.bbProgressDone.Set(done)
+	p.bbProgressTotal.Set(total)
+	p.bbProgressThroughput.Set(bytesPerSecond)
+	p.bbProgressETA.Set(etaSeconds)
+}
+
+func (p *pgrwlMetricsProm) AddBasebackupCleanup(kind string, bytes float64) {
+	p.bbCleanups.WithLabelValues(kind).Inc()
+	p.bbCleanupBytes.WithLabelValues(kind).Add(bytes)
+}
@@ -0,0 +1,238 @@
+// Package hooks runs the commands and webhooks configured around backups and
+// restores.
+//
+// A command is run with "sh -c" and gets the event as PGRWL_* environment
+// variables, a webhook receives it as a JSON POST body. Pre hooks run before
+// the backup or restore starts, post hooks after it finished, successfully
+// or not.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pgrwl/pgrwl/config"
+)
+
+// Phase is when hooks run.
+type Phase string
+
+const (
+	PreBackup   Phase = "pre_backup"
+	PostBackup  Phase = "post_backup"
+	PreRestore  Phase = "pre_restore"
+	PostRestore Phase = "post_restore"
+)
+
+// Status of the backup or restore given to post hooks.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// ErrHookFailed is returned when a hook with the abort policy fails.
+var ErrHookFailed = errors.New("hook failed")
+
+const (
+	// maxOutput limits the output of a failed hook kept in its error.
+	maxOutput = 1024
+
+	// waitDelay is how long a killed command may keep its output open,
+	// e.g. through a child of the shell.
+	waitDelay = time.Second
+)
+
+// Event describes the backup or restore hooks run for. Fields that are not
+// known yet, e.g. the backup ID before a backup, are empty.
+type Event struct {
+	Phase Phase `json:"phase"`
+
+	BackupID   string `json:"backup_id,omitempty"`
+	Label      string `json:"label,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Schedule   string `json:"schedule,omitempty"`
+	StartLSN   string `json:"start_lsn,omitempty"`
+	StopLSN    string `json:"stop_lsn,omitempty"`
+	BytesTotal int64  `json:"bytes_total,omitempty"`
+
+	// Dest is the data directory of a restore.
+	Dest string `json:"dest,omitempty"`
+
+	// Status and Error are set for post hooks.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Env returns the event as environment variables, empty fields are omitted.
+func (e *Event) Env() []string {
+	vars := []struct{ name, value string }{
+		{"PGRWL_HOOK_PHASE", string(e.Phase)},
+		{"PGRWL_BACKUP_ID", e.BackupID},
+		{"PGRWL_BACKUP_LABEL", e.Label},
+		{"PGRWL_BACKUP_SOURCE", e.Source},
+		{"PGRWL_BACKUP_SCHEDULE", e.Schedule},
+		{"PGRWL_BACKUP_START_LSN", e.StartLSN},
+		{"PGRWL_BACKUP_STOP_LSN", e.StopLSN},
+		{"PGRWL_RESTORE_DEST", e.Dest},
+		{"PGRWL_HOOK_STATUS", e.Status},
+		{"PGRWL_HOOK_ERROR", e.Error},
+	}
+	env := make([]string, 0, len(vars)+1)
+	for _, v := range vars {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value)
+		}
+	}
+	if e.BytesTotal > 0 {
+		env = append(env, "PGRWL_BACKUP_BYTES="+strconv.FormatInt(e.BytesTotal, 10))
+	}
+	return env
+}
+
+// Runner runs the hooks of a config. A nil Runner runs no hooks.
+type Runner struct {
+	l      *slog.Logger
+	hooks  map[Phase][]config.Hook
+	client *http.Client
+}
+
+// NewRunner returns a runner of the hooks in cfg, nil when there are none.
+func NewRunner(cfg *config.HooksConfig) *Runner {
+	hooks := map[Phase][]config.Hook{
+		PreBackup:   cfg.PreBackup,
+		PostBackup:  cfg.PostBackup,
+		PreRestore:  cfg.PreRestore,
+		PostRestore: cfg.PostRestore,
+	}
+	n := 0
+	for _, h := range hooks {
+		n += len(h)
+	}
+	if n == 0 {
+		return nil
+	}
+	return &Runner{
+		l:      slog.With(slog.String("component", "hooks")),
+		hooks:  hooks,
+		client: &http.Client{},
+	}
+}
+
+// Run runs the hooks of ev.Phase in order. It stops at the first failed hook
+// with the abort policy and returns an error matching ErrHookFailed, the
+// failures of the other hooks are logged.
+//
+// Post hooks also run when ctx is canceled, e.g. after a cancelled backup.
+func (r *Runner) Run(ctx context.Context, ev *Event) error {
+	if r == nil {
+		return nil
+	}
+	if ev.Phase == PostBackup || ev.Phase == PostRestore {
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	for i := range r.hooks[ev.Phase] {
+		h := &r.hooks[ev.Phase][i]
+		name := h.Name
+		if name == "" {
+			name = fmt.Sprintf("%s[%d]", ev.Phase, i)
+		}
+
+		r.l.Info("running hook", slog.String("phase", string(ev.Phase)), slog.String("hook", name))
+		err := r.runHook(ctx, h, ev)
+		if err == nil {
+			continue
+		}
+		if h.Abort() {
+			return fmt.Errorf("%s hook %s: %w: %w", ev.Phase, name, ErrHookFailed, err)
+		}
+		r.l.Warn("hook failed",
+			slog.String("phase", string(ev.Phase)),
+			slog.String("hook", name),
+			slog.Any("err", err),
+		)
+	}
+	return nil
+}
+
+func (r *Runner) runHook(ctx context.Context, h *config.Hook, ev *Event) error {
+	timeout := h.TimeoutParsed
+	if timeout <= 0 {
+		timeout = config.DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if h.URL != "" {
+		return r.post(ctx, h, ev)
+	}
+	return runCommand(ctx, h.Command, ev)
+}
+
+func runCommand(ctx context.Context, command string, ev *Event) error {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec // the command is configured by the operator
+	cmd.Env = append(os.Environ(), ev.Env()...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = waitDelay
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := truncate(out.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *Runner) post(ctx context.Context, h *config.Hook, ev *Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, truncate(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxOutput {
+		s = s[:maxOutput] + "..."
+	}
+	return s
+}
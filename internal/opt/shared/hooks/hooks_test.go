@@ -0,0 +1,150 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgrwl/pgrwl/config"
+)
+
+func TestNewRunnerWithoutHooks(t *testing.T) {
+	r := NewRunner(&config.HooksConfig{})
+
+	assert.Nil(t, r)
+	assert.NoError(t, r.Run(context.Background(), &Event{Phase: PreBackup}))
+}
+
+func TestEventEnv(t *testing.T) {
+	ev := &Event{
+		Phase:      PostBackup,
+		BackupID:   "20260101000000",
+		StartLSN:   "0/2000028",
+		StopLSN:    "0/2000100",
+		BytesTotal: 4096,
+		Status:     StatusSucceeded,
+	}
+
+	assert.ElementsMatch(t, []string{
+		"PGRWL_HOOK_PHASE=post_backup",
+		"PGRWL_BACKUP_ID=20260101000000",
+		"PGRWL_BACKUP_START_LSN=0/2000028",
+		"PGRWL_BACKUP_STOP_LSN=0/2000100",
+		"PGRWL_BACKUP_BYTES=4096",
+		"PGRWL_HOOK_STATUS=succeeded",
+	}, ev.Env())
+}
+
+func TestRunnerRunsCommandWithEnv(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	r := NewRunner(&config.HooksConfig{
+		PostBackup: []config.Hook{
+			{Name: "record", Command: `echo "$PGRWL_BACKUP_ID $PGRWL_HOOK_STATUS" > ` + out},
+		},
+	})
+
+	err := r.Run(context.Background(), &Event{Phase: PostBackup, BackupID: "20260101000000", Status: StatusFailed})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "20260101000000 failed\n", string(data))
+}
+
+func TestRunnerFailurePolicy(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	r := NewRunner(&config.HooksConfig{
+		PreBackup: []config.Hook{
+			{Name: "warn", Command: "echo not ready >&2; exit 1", OnFailure: config.HookOnFailureWarn},
+			{Name: "abort", Command: "echo paused > " + out + "; echo batch busy >&2; exit 3"},
+			{Name: "skipped", Command: "echo skipped >> " + out},
+		},
+	})
+
+	err := r.Run(context.Background(), &Event{Phase: PreBackup})
+
+	require.ErrorIs(t, err, ErrHookFailed)
+	assert.Contains(t, err.Error(), "pre_backup hook abort")
+	assert.Contains(t, err.Error(), "batch busy")
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "paused\n", string(data))
+}
+
+func TestRunnerCommandTimeout(t *testing.T) {
+	r := NewRunner(&config.HooksConfig{
+		PreRestore: []config.Hook{
+			{Command: "sleep 5", TimeoutParsed: 50 * time.Millisecond},
+		},
+	})
+
+	start := time.Now()
+	err := r.Run(context.Background(), &Event{Phase: PreRestore})
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "pre_restore hook pre_restore[0]")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRunnerPostHooksRunAfterCancel(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	r := NewRunner(&config.HooksConfig{
+		PostBackup: []config.Hook{{Command: "echo $PGRWL_HOOK_STATUS > " + out}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.NoError(t, r.Run(ctx, &Event{Phase: PostBackup, Status: StatusCancelled}))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled\n", string(data))
+}
+
+func TestRunnerPostsWebhook(t *testing.T) {
+	var got Event
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	r := NewRunner(&config.HooksConfig{
+		PostRestore: []config.Hook{
+			{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer t"}},
+		},
+	})
+	ev := &Event{Phase: PostRestore, BackupID: "20260101000000", Dest: "/var/lib/postgresql/data", Status: StatusSucceeded}
+
+	require.NoError(t, r.Run(context.Background(), ev))
+	assert.Equal(t, *ev, got)
+	assert.Equal(t, "Bearer t", token)
+}
+
+func TestRunnerWebhookErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	r := NewRunner(&config.HooksConfig{
+		PreBackup: []config.Hook{{Name: "notify", URL: srv.URL}},
+	})
+
+	err := r.Run(context.Background(), &Event{Phase: PreBackup})
+
+	require.ErrorIs(t, err, ErrHookFailed)
+	assert.True(t, strings.Contains(err.Error(), "503") && strings.Contains(err.Error(), "maintenance"), err.Error())
+}
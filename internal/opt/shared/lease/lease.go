@@ -0,0 +1,427 @@
+// Package lease implements a repository lease: a small object in storage that
+// names the single process allowed to write to the repository.
+//
+// The holder renews the lease periodically. Another process may take it over
+// only after it has expired. Every write is conditional on the version read
+// before it, so two processes cannot both believe they hold the lease.
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+const (
+	DefaultPath = "repo.lease"
+	DefaultTTL  = 60 * time.Second
+)
+
+var (
+	// ErrHeld is returned when the lease is held by another owner.
+	ErrHeld = errors.New("repository lease is held by another owner")
+
+	// ErrLost is returned by Run when the lease could not be renewed before
+	// it expired, or was taken over by another owner.
+	ErrLost = errors.New("repository lease lost")
+)
+
+// HeldError describes the current holder of the lease. It matches ErrHeld.
+type HeldError struct {
+	Holder Record
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("repository lease is held by %q (host %q) until %s",
+		e.Holder.Owner, e.Holder.Hostname, e.Holder.ExpiresAt.Format(time.RFC3339))
+}
+
+func (e *HeldError) Is(target error) bool {
+	return target == ErrHeld
+}
+
+// Record is the content of the lease object.
+type Record struct {
+	Owner      string    `json:"owner"`
+	Hostname   string    `json:"hostname,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (r *Record) expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Status is a snapshot of the lease state as seen by this process.
+type Status struct {
+	Owner     string  `json:"owner"`
+	Held      bool    `json:"held"`
+	Holder    *Record `json:"holder,omitempty"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+type Opts struct {
+	// Storage keeps the lease object. It must implement st.ConditionalStorage,
+	// pass a raw backend (not a VariadicStorage).
+	Storage st.Storage
+
+	// Path of the lease object, DefaultPath when empty.
+	Path string
+
+	// Owner identifies this process, hostname plus a random suffix when empty.
+	Owner string
+
+	// TTL is how long the lease stays valid without renewal, DefaultTTL when zero.
+	TTL time.Duration
+
+	// HeartbeatInterval is the renewal interval, TTL/3 when zero.
+	HeartbeatInterval time.Duration
+
+	// RetryInterval is the wait between acquire attempts, HeartbeatInterval when zero.
+	RetryInterval time.Duration
+}
+
+type Lease interface {
+	// TryAcquire takes the lease if it is free, expired or already ours.
+	// Returns an error matching ErrHeld when another owner holds it.
+	TryAcquire(ctx context.Context) error
+
+	// Acquire blocks until the lease is taken or ctx is canceled.
+	Acquire(ctx context.Context) error
+
+	// Run renews the lease until ctx is canceled. Returns ErrLost when the lease
+	// could not be kept, and nil on cancellation.
+	Run(ctx context.Context) error
+
+	// Release expires the lease, so that another owner can take it immediately.
+	Release(ctx context.Context) error
+
+	// Held reports whether this process holds an unexpired lease.
+	Held() bool
+
+	Status() Status
+}
+
+type lease struct {
+	l        *slog.Logger
+	stor     st.ConditionalStorage
+	path     string
+	owner    string
+	hostname string
+
+	ttl       time.Duration
+	heartbeat time.Duration
+	retry     time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	held    bool
+	version string
+	record  Record  // our record, valid when held
+	holder  *Record // last observed holder
+	lastErr error
+}
+
+var _ Lease = &lease{}
+
+func New(opts *Opts) (Lease, error) {
+	if opts == nil || opts.Storage == nil {
+		return nil, fmt.Errorf("lease: storage is required")
+	}
+	stor, ok := opts.Storage.(st.ConditionalStorage)
+	if !ok {
+		return nil, fmt.Errorf("lease: storage %T does not support conditional writes", opts.Storage)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+
+	l := &lease{
+		l:         slog.With(slog.String("component", "repo-lease")),
+		stor:      stor,
+		path:      opts.Path,
+		owner:     opts.Owner,
+		hostname:  hostname,
+		ttl:       opts.TTL,
+		heartbeat: opts.HeartbeatInterval,
+		retry:     opts.RetryInterval,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+	if l.path == "" {
+		l.path = DefaultPath
+	}
+	if l.owner == "" {
+		l.owner = newOwnerID(hostname)
+	}
+	if l.ttl <= 0 {
+		l.ttl = DefaultTTL
+	}
+	if l.heartbeat <= 0 {
+		l.heartbeat = l.ttl / 3
+	}
+	if l.heartbeat >= l.ttl {
+		return nil, fmt.Errorf("lease: heartbeat interval %s must be less than ttl %s", l.heartbeat, l.ttl)
+	}
+	if l.retry <= 0 {
+		l.retry = l.heartbeat
+	}
+	return l, nil
+}
+
+func newOwnerID(hostname string) string {
+	if hostname == "" {
+		hostname = "pgrwl"
+	}
+	return hostname + "-" + strings.ToLower(rand.Text()[:8])
+}
+
+func (l *lease) TryAcquire(ctx context.Context) error {
+	err := l.tryAcquire(ctx)
+	l.setErr(err)
+	return err
+}
+
+func (l *lease) tryAcquire(ctx context.Context) error {
+	now := l.now()
+
+	data, version, err := l.stor.GetVersioned(ctx, l.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read lease: %w", err)
+	}
+
+	acquiredAt := now
+	if err == nil {
+		var cur Record
+		if err := json.Unmarshal(data, &cur); err != nil {
+			// an unreadable lease cannot be honoured, take it over
+			l.l.Warn("cannot decode lease, taking it over", slog.Any("err", err))
+		} else {
+			l.observe(cur)
+			if cur.Owner != l.owner && !cur.expired(now) {
+				return &HeldError{Holder: cur}
+			}
+			if cur.Owner == l.owner && !cur.expired(now) {
+				acquiredAt = cur.AcquiredAt
+			}
+		}
+	}
+
+	rec := Record{
+		Owner:      l.owner,
+		Hostname:   l.hostname,
+		AcquiredAt: acquiredAt,
+		RenewedAt:  now,
+		ExpiresAt:  now.Add(l.ttl),
+	}
+	newVersion, err := l.put(ctx, rec, version)
+	if err != nil {
+		if errors.Is(err, st.ErrPreconditionFailed) {
+			// somebody else wrote the lease between our read and write
+			return fmt.Errorf("%w: concurrent acquire", ErrHeld)
+		}
+		return fmt.Errorf("write lease: %w", err)
+	}
+
+	l.mu.Lock()
+	l.held = true
+	l.version = newVersion
+	l.record = rec
+	l.holder = &rec
+	l.mu.Unlock()
+
+	l.l.Info("repository lease acquired",
+		slog.String("owner", l.owner),
+		slog.Time("expires_at", rec.ExpiresAt),
+	)
+	return nil
+}
+
+func (l *lease) Acquire(ctx context.Context) error {
+	logged := false
+	for {
+		err := l.TryAcquire(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		var held *HeldError
+		switch {
+		case errors.As(err, &held):
+			if !logged {
+				l.l.Info("waiting for repository lease",
+					slog.String("holder", held.Holder.Owner),
+					slog.String("holder_host", held.Holder.Hostname),
+					slog.Time("expires_at", held.Holder.ExpiresAt),
+				)
+				logged = true
+			}
+		case errors.Is(err, ErrHeld):
+			l.l.Debug("lease acquire lost a race, retrying")
+		default:
+			l.l.Warn("cannot acquire repository lease, retrying", slog.Any("err", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.retry):
+		}
+	}
+}
+
+func (l *lease) Run(ctx context.Context) error {
+	ticker := time.NewTicker(l.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		err := l.renew(ctx)
+		l.setErr(err)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrLost) {
+			return err
+		}
+
+		l.mu.Lock()
+		expiresAt := l.record.ExpiresAt
+		l.mu.Unlock()
+
+		if !l.now().Before(expiresAt) {
+			l.markLost()
+			return fmt.Errorf("%w: renewal failed until expiry: %w", ErrLost, err)
+		}
+		l.l.Warn("cannot renew repository lease", slog.Any("err", err), slog.Time("expires_at", expiresAt))
+	}
+}
+
+func (l *lease) renew(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.held {
+		l.mu.Unlock()
+		return ErrLost
+	}
+	rec := l.record
+	version := l.version
+	l.mu.Unlock()
+
+	now := l.now()
+	rec.RenewedAt = now
+	rec.ExpiresAt = now.Add(l.ttl)
+
+	newVersion, err := l.put(ctx, rec, version)
+	if err != nil {
+		if errors.Is(err, st.ErrPreconditionFailed) {
+			l.markLost()
+			return fmt.Errorf("%w: lease was modified by another owner", ErrLost)
+		}
+		return err
+	}
+
+	l.mu.Lock()
+	l.version = newVersion
+	l.record = rec
+	l.holder = &rec
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.held {
+		l.mu.Unlock()
+		return nil
+	}
+	rec := l.record
+	version := l.version
+	l.held = false
+	l.mu.Unlock()
+
+	rec.ExpiresAt = l.now()
+	_, err := l.put(ctx, rec, version)
+	if err != nil && !errors.Is(err, st.ErrPreconditionFailed) {
+		return fmt.Errorf("release lease: %w", err)
+	}
+
+	l.mu.Lock()
+	l.holder = &rec
+	l.mu.Unlock()
+
+	l.l.Info("repository lease released", slog.String("owner", l.owner))
+	return nil
+}
+
+func (l *lease) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held && l.now().Before(l.record.ExpiresAt)
+}
+
+func (l *lease) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := Status{
+		Owner: l.owner,
+		Held:  l.held && l.now().Before(l.record.ExpiresAt),
+	}
+	if l.holder != nil {
+		h := *l.holder
+		s.Holder = &h
+	}
+	if l.lastErr != nil {
+		s.LastError = l.lastErr.Error()
+	}
+	return s
+}
+
+func (l *lease) put(ctx context.Context, rec Record, version string) (string, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	return l.stor.PutIf(ctx, l.path, data, version)
+}
+
+func (l *lease) observe(rec Record) {
+	l.mu.Lock()
+	l.holder = &rec
+	l.mu.Unlock()
+}
+
+func (l *lease) markLost() {
+	l.mu.Lock()
+	l.held = false
+	l.mu.Unlock()
+}
+
+func (l *lease) setErr(err error) {
+	l.mu.Lock()
+	l.lastErr = err
+	l.mu.Unlock()
+}
@@ -0,0 +1,184 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestLease(t *testing.T, stor st.Storage, owner string, clock *fakeClock) *lease {
+	t.Helper()
+	l, err := New(&Opts{
+		Storage:           stor,
+		Owner:             owner,
+		TTL:               30 * time.Second,
+		HeartbeatInterval: 10 * time.Millisecond,
+		RetryInterval:     10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	impl := l.(*lease)
+	impl.now = clock.Now
+	return impl
+}
+
+func readRecord(t *testing.T, stor *st.InMemoryStorage) Record {
+	t.Helper()
+	data, _, err := stor.GetVersioned(context.Background(), DefaultPath)
+	require.NoError(t, err)
+	var rec Record
+	require.NoError(t, json.Unmarshal(data, &rec))
+	return rec
+}
+
+func TestLeaseAcquireExclusive(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	a := newTestLease(t, stor, "a", clock)
+	b := newTestLease(t, stor, "b", clock)
+
+	require.NoError(t, a.TryAcquire(ctx))
+	assert.True(t, a.Held())
+
+	err := b.TryAcquire(ctx)
+	require.ErrorIs(t, err, ErrHeld)
+	var held *HeldError
+	require.True(t, errors.As(err, &held))
+	assert.Equal(t, "a", held.Holder.Owner)
+	assert.False(t, b.Held())
+	assert.Equal(t, "a", b.Status().Holder.Owner)
+
+	// re-acquiring our own lease keeps the acquisition time
+	clock.Advance(time.Second)
+	require.NoError(t, a.TryAcquire(ctx))
+	rec := readRecord(t, stor)
+	assert.Equal(t, "a", rec.Owner)
+	assert.Equal(t, clock.Now().Add(-time.Second), rec.AcquiredAt)
+	assert.Equal(t, clock.Now().Add(30*time.Second), rec.ExpiresAt)
+}
+
+func TestLeaseTakeoverAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	a := newTestLease(t, stor, "a", clock)
+	b := newTestLease(t, stor, "b", clock)
+
+	require.NoError(t, a.TryAcquire(ctx))
+
+	clock.Advance(31 * time.Second)
+	assert.False(t, a.Held(), "an expired lease is not held")
+
+	require.NoError(t, b.TryAcquire(ctx))
+	assert.True(t, b.Held())
+	assert.Equal(t, "b", readRecord(t, stor).Owner)
+
+	// the old owner notices on its next renewal
+	err := a.renew(ctx)
+	require.ErrorIs(t, err, ErrLost)
+	assert.False(t, a.Held())
+}
+
+func TestLeaseRelease(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	a := newTestLease(t, stor, "a", clock)
+	b := newTestLease(t, stor, "b", clock)
+
+	require.NoError(t, a.TryAcquire(ctx))
+	require.NoError(t, a.Release(ctx))
+	assert.False(t, a.Held())
+
+	require.NoError(t, b.TryAcquire(ctx))
+	assert.Equal(t, "b", readRecord(t, stor).Owner)
+
+	// releasing a lease that is not held is a no-op
+	require.NoError(t, a.Release(ctx))
+	assert.Equal(t, "b", readRecord(t, stor).Owner)
+}
+
+func TestLeaseAcquireWaits(t *testing.T) {
+	stor := st.NewInMemoryStorage()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	a := newTestLease(t, stor, "a", clock)
+	b := newTestLease(t, stor, "b", clock)
+
+	require.NoError(t, a.TryAcquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, b.Acquire(ctx), context.DeadlineExceeded)
+
+	require.NoError(t, a.Release(context.Background()))
+	require.NoError(t, b.Acquire(context.Background()))
+	assert.True(t, b.Held())
+}
+
+func TestLeaseRunRenewsAndDetectsLoss(t *testing.T) {
+	stor := st.NewInMemoryStorage()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	a := newTestLease(t, stor, "a", clock)
+	require.NoError(t, a.TryAcquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- a.Run(ctx) }()
+
+	clock.Advance(20 * time.Second)
+	require.Eventually(t, func() bool {
+		return readRecord(t, stor).ExpiresAt.Equal(clock.Now().Add(30 * time.Second))
+	}, time.Second, 5*time.Millisecond)
+
+	// another owner overwrites the lease
+	require.NoError(t, stor.Put(context.Background(), DefaultPath, strings.NewReader(`{"owner":"b"}`)))
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, ErrLost)
+	case <-time.After(time.Second):
+		t.Fatal("Run did not detect the lost lease")
+	}
+	assert.False(t, a.Held())
+}
+
+func TestLeaseRequiresConditionalStorage(t *testing.T) {
+	vs, err := st.NewVariadicStorage(st.NewInMemoryStorage(), st.Algorithms{}, "")
+	require.NoError(t, err)
+
+	_, err = New(&Opts{Storage: vs})
+	require.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package signing
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"testing"
+	"time"
+
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKeys(t *testing.T) (*Signer, *Verifier) {
+	t.Helper()
+	pub, priv, err := GenerateKeyPair()
+	require.NoError(t, err)
+	signer, err := NewSigner(priv)
+	require.NoError(t, err)
+	assert.Equal(t, pub, signer.PublicKey())
+	verifier, err := NewVerifier(pub)
+	require.NoError(t, err)
+	return signer, verifier
+}
+
+func TestSignVerify(t *testing.T) {
+	signer, verifier := newKeys(t)
+	data := []byte(`{"start_lsn":1}`)
+	sig := signer.Sign(ContextBackupMarker, data)
+
+	require.NoError(t, verifier.Verify(ContextBackupMarker, data, sig))
+
+	// modified data, another context, another key
+	require.ErrorIs(t, verifier.Verify(ContextBackupMarker, []byte(`{"start_lsn":2}`), sig), ErrBadSignature)
+	require.ErrorIs(t, verifier.Verify(ContextWALManifest, data, sig), ErrBadSignature)
+	_, other := newKeys(t)
+	require.ErrorIs(t, other.Verify(ContextBackupMarker, data, sig), ErrBadSignature)
+	require.ErrorIs(t, verifier.Verify(ContextBackupMarker, data, []byte("garbage")), ErrBadSignature)
+}
+
+func TestVerifierAcceptsRotatedKeys(t *testing.T) {
+	oldPub, oldPriv, err := GenerateKeyPair()
+	require.NoError(t, err)
+	newPub, _, err := GenerateKeyPair()
+	require.NoError(t, err)
+
+	old, err := NewSigner(oldPriv)
+	require.NoError(t, err)
+	verifier, err := NewVerifier(newPub, oldPub)
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(ContextWALManifest, []byte("x"), old.Sign(ContextWALManifest, []byte("x"))))
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	require.NoError(t, err)
+	assert.NoError(t, ParsePublicKey(pub))
+	assert.NoError(t, ParsePrivateKey(priv))
+	assert.Error(t, ParsePublicKey(priv))
+	assert.Error(t, ParsePrivateKey(pub))
+	assert.Error(t, ParsePublicKey(PublicKeyPrefix+"AAAA"))
+
+	_, err = NewVerifier()
+	assert.Error(t, err)
+}
+
+func TestPutSignedGetVerified(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	signer, verifier := newKeys(t)
+
+	require.NoError(t, PutSigned(ctx, stor, signer, ContextBackupMarker, "b/b.json", []byte("marker")))
+	data, err := GetVerified(ctx, stor, verifier, ContextBackupMarker, "b/b.json")
+	require.NoError(t, err)
+	assert.Equal(t, "marker", string(data))
+
+	// replaced object
+	require.NoError(t, stor.Put(ctx, "b/b.json", strings.NewReader("forged")))
+	_, err = GetVerified(ctx, stor, verifier, ContextBackupMarker, "b/b.json")
+	require.ErrorIs(t, err, ErrBadSignature)
+
+	// no signature
+	require.NoError(t, PutSigned(ctx, stor, nil, ContextBackupMarker, "c/c.json", []byte("marker")))
+	data, err = GetVerified(ctx, stor, verifier, ContextBackupMarker, "c/c.json")
+	require.ErrorIs(t, err, ErrUnsigned)
+	assert.Equal(t, "marker", string(data))
+}
+
+func TestWALManifestName(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)
+	name := WALManifestName([]WALFile{
+		{Name: "000000010000000000000003"},
+		{Name: "000000010000000000000001"},
+	}, at)
+	assert.Equal(t, "000000010000000000000001_000000010000000000000003_20250102T030405.000000006.json", name)
+
+	last, ok := ParseWALManifestName(name)
+	require.True(t, ok)
+	assert.Equal(t, "000000010000000000000003", last)
+
+	_, ok = ParseWALManifestName(name + SigSuffix)
+	assert.False(t, ok)
+}
+
+// listingStorage counts the manifests listed.
+type listingStorage struct {
+	*st.InMemoryStorage
+	listed int
+}
+
+func (s *listingStorage) Iterate(ctx context.Context, path string, opts st.IterateOpts) iter.Seq2[st.FileInfo, error] {
+	return func(yield func(st.FileInfo, error) bool) {
+		for fi, err := range s.InMemoryStorage.Iterate(ctx, path, opts) {
+			if err == nil && !strings.HasSuffix(fi.Path, SigSuffix) {
+				s.listed++
+			}
+			if !yield(fi, err) {
+				return
+			}
+		}
+	}
+}
+
+func newTestWALIndex(stor st.Storage, verifier *Verifier) (*WALIndex, *time.Time) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	index := NewWALIndex(stor, verifier)
+	index.now = func() time.Time { return now }
+	return index, &now
+}
+
+func TestWALIndex(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	signer, verifier := newKeys(t)
+	index, now := newTestWALIndex(stor, verifier)
+
+	seg1 := WALFile{Name: "000000010000000000000001", Size: 4, SHA256: "aa"}
+	seg2 := WALFile{Name: "000000010000000000000002", Size: 4, SHA256: "bb"}
+	require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{seg1}))
+
+	got, err := index.Lookup(ctx, seg1.Name)
+	require.NoError(t, err)
+	assert.Equal(t, seg1, got)
+
+	*now = now.Add(walIndexRefreshInterval)
+	_, err = index.Lookup(ctx, seg2.Name)
+	require.ErrorIs(t, err, ErrUnsigned)
+
+	// a later batch is picked up on a miss
+	require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{seg2}))
+	*now = now.Add(walIndexRefreshInterval)
+	got, err = index.Lookup(ctx, seg2.Name)
+	require.NoError(t, err)
+	assert.Equal(t, seg2, got)
+
+	// a manifest signed with another key vouches for nothing
+	other, _ := newKeys(t)
+	forged := WALFile{Name: "000000010000000000000003", Size: 4, SHA256: "cc"}
+	require.NoError(t, WriteWALManifest(ctx, stor, other, []WALFile{forged}))
+	*now = now.Add(walIndexRefreshInterval)
+	_, err = index.Lookup(ctx, forged.Name)
+	require.ErrorIs(t, err, ErrUnsigned)
+}
+
+func TestWALIndexListsOnlyNewManifests(t *testing.T) {
+	ctx := context.Background()
+	stor := &listingStorage{InMemoryStorage: st.NewInMemoryStorage()}
+	signer, verifier := newKeys(t)
+	index, now := newTestWALIndex(stor, verifier)
+
+	for _, name := range []string{"000000010000000000000001", "000000010000000000000002"} {
+		require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{{Name: name, Size: 4, SHA256: "aa"}}))
+	}
+	_, err := index.Lookup(ctx, "000000010000000000000001")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stor.listed)
+
+	// misses within the refresh interval do not list
+	for range 3 {
+		_, err = index.Lookup(ctx, "000000010000000000000009")
+		require.ErrorIs(t, err, ErrUnsigned)
+	}
+	assert.Equal(t, 2, stor.listed)
+
+	// a refresh lists the manifests after the last one loaded
+	seg3 := WALFile{Name: "000000010000000000000003", Size: 4, SHA256: "cc"}
+	require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{seg3}))
+	*now = now.Add(walIndexRefreshInterval)
+	got, err := index.Lookup(ctx, seg3.Name)
+	require.NoError(t, err)
+	assert.Equal(t, seg3, got)
+	assert.Equal(t, 3, stor.listed)
+}
+
+func TestWALIndexLoadsOutOfOrderManifests(t *testing.T) {
+	ctx := context.Background()
+	stor := &listingStorage{InMemoryStorage: st.NewInMemoryStorage()}
+	signer, verifier := newKeys(t)
+	index, now := newTestWALIndex(stor, verifier)
+
+	seg1 := WALFile{Name: "000000010000000000000001", Size: 4, SHA256: "aa"}
+	seg2 := WALFile{Name: "000000010000000000000002", Size: 4, SHA256: "bb"}
+	seg3 := WALFile{Name: "000000010000000000000003", Size: 4, SHA256: "cc"}
+	require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{seg2, seg3}))
+	_, err := index.Lookup(ctx, seg2.Name)
+	require.NoError(t, err)
+
+	// seg1 failed in the first batch and was uploaded by a later one, its
+	// manifest sorts before the loaded one
+	require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{seg1}))
+	*now = now.Add(walIndexRefreshInterval)
+	got, err := index.Lookup(ctx, seg1.Name)
+	require.NoError(t, err)
+	assert.Equal(t, seg1, got)
+
+	// a miss after that relists, but loads no manifest twice
+	listed := stor.listed
+	*now = now.Add(walIndexRefreshInterval)
+	_, err = index.Lookup(ctx, "000000010000000000000009")
+	require.ErrorIs(t, err, ErrUnsigned)
+	assert.Equal(t, listed+2, stor.listed)
+	assert.Len(t, index.seen, 2)
+}
+
+func TestWALIndexWaitsForPendingSignature(t *testing.T) {
+	ctx := context.Background()
+	stor := st.NewInMemoryStorage()
+	signer, verifier := newKeys(t)
+	index, now := newTestWALIndex(stor, verifier)
+	// the in-memory storage reports the current time as modification time
+	*now = time.Now()
+
+	seg1 := WALFile{Name: "000000010000000000000001", Size: 4, SHA256: "aa"}
+	require.NoError(t, WriteWALManifest(ctx, stor, signer, []WALFile{seg1}))
+	var sigPath string
+	for p := range stor.Files {
+		if strings.HasSuffix(p, SigSuffix) {
+			sigPath = p
+		}
+	}
+	require.NotEmpty(t, sigPath)
+	sig := stor.Files[sigPath]
+	delete(stor.Files, sigPath)
+
+	_, err := index.Lookup(ctx, seg1.Name)
+	require.ErrorIs(t, err, ErrUnsigned)
+
+	// signed meanwhile
+	stor.Files[sigPath] = sig
+	*now = now.Add(walIndexRefreshInterval)
+	got, err := index.Lookup(ctx, seg1.Name)
+	require.NoError(t, err)
+	assert.Equal(t, seg1, got)
+}
@@ -0,0 +1,60 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// PutSigned writes data to path and its signature to path+SigSuffix. Both are
+// metadata: a receiver with write-only encryption must be able to read them.
+// The signature is written last, so an interrupted write leaves the object
+// unsigned rather than signed with stale data.
+func PutSigned(ctx context.Context, stor st.Storage, signer *Signer, context, path string, data []byte) error {
+	if err := st.PutMeta(ctx, stor, path, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if signer == nil {
+		return nil
+	}
+	return st.PutMeta(ctx, stor, path+SigSuffix, bytes.NewReader(signer.Sign(context, data)))
+}
+
+// GetVerified reads path and checks its signature. When the signature object
+// is missing it returns the data together with ErrUnsigned, so that callers
+// allowing unsigned objects can still use it.
+func GetVerified(ctx context.Context, stor st.Storage, verifier *Verifier, context, path string) ([]byte, error) {
+	data, err := readAll(ctx, stor, path)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readAll(ctx, stor, path+SigSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, fmt.Errorf("%s: %w", path, ErrUnsigned)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.Verify(context, data, sig); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+func readAll(ctx context.Context, stor st.Storage, path string) ([]byte, error) {
+	rc, err := stor.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return data, rc.Close()
+}
@@ -0,0 +1,202 @@
+package signing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// The WAL archive is signed with rolling manifests: every upload batch of
+// the receiver writes a signed manifest with the checksums of the files it
+// uploaded. Manifests are named "<first>_<last>_<time>.json" by the first
+// and last file name of the batch, so retention can drop them by name.
+
+const walManifestVersion = 1
+
+// WALFile is the checksum of one file of the WAL archive, of its content
+// before compression and encryption.
+type WALFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type WALManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []WALFile `json:"files"`
+}
+
+// WALManifestName returns the object name of a manifest of files.
+func WALManifestName(files []WALFile, createdAt time.Time) string {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	return fmt.Sprintf("%s_%s_%s.json", names[0], names[len(names)-1], createdAt.UTC().Format("20060102T150405.000000000"))
+}
+
+// ParseWALManifestName returns the last file name covered by a manifest.
+func ParseWALManifestName(name string) (last string, ok bool) {
+	_, last, ok = ParseWALManifestRange(name)
+	return last, ok
+}
+
+// ParseWALManifestRange returns the first and last file names covered by a
+// manifest.
+func ParseWALManifestRange(name string) (first, last string, ok bool) {
+	if !strings.HasSuffix(name, ".json") {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(name, ".json"), "_")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// WriteWALManifest writes a signed manifest of files.
+func WriteWALManifest(ctx context.Context, stor st.Storage, signer *Signer, files []WALFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	m := WALManifest{
+		Version:   walManifestVersion,
+		CreatedAt: time.Now().UTC(),
+		Files:     files,
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return PutSigned(ctx, stor, signer, ContextWALManifest, WALManifestName(files, m.CreatedAt), data)
+}
+
+// walIndexRefreshInterval bounds how often a lookup miss lists the new
+// manifests. At the end of recovery PostgreSQL asks for segments that do not
+// exist yet, each of them is a miss.
+const walIndexRefreshInterval = 5 * time.Second
+
+// walIndexPendingAge is how long a manifest without signature is taken for
+// one whose signature is being written, and looked at again.
+const walIndexPendingAge = time.Minute
+
+// WALIndex looks up WAL checksums in the signed manifests. Manifests are
+// loaded on the first lookup of a file they cover and kept in memory, new
+// manifests are picked up when a file is not found.
+//
+// Manifests are named by the first file they cover, so those of new batches
+// usually sort after the loaded ones and a refresh lists only the manifests
+// after the last one loaded. A segment retried in a later batch gives a
+// manifest that sorts before it, so a miss left by that listing relists all
+// manifests and loads those not seen yet.
+type WALIndex struct {
+	l        *slog.Logger
+	stor     st.Storage
+	verifier *Verifier
+	now      func() time.Time
+
+	mu          sync.Mutex
+	files       map[string]WALFile
+	seen        map[string]bool // manifests loaded or rejected
+	cursor      string          // every manifest up to it was seen
+	lastRefresh time.Time
+}
+
+func NewWALIndex(stor st.Storage, verifier *Verifier) *WALIndex {
+	return &WALIndex{
+		l:        slog.With(slog.String("component", "wal-index")),
+		stor:     stor,
+		verifier: verifier,
+		now:      time.Now,
+		files:    make(map[string]WALFile),
+		seen:     make(map[string]bool),
+	}
+}
+
+// Lookup returns the checksum of a WAL file. It returns ErrUnsigned when no
+// signed manifest covers the file.
+func (x *WALIndex) Lookup(ctx context.Context, name string) (WALFile, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if f, ok := x.files[name]; ok {
+		return f, nil
+	}
+	if now := x.now(); x.lastRefresh.IsZero() || now.Sub(x.lastRefresh) >= walIndexRefreshInterval {
+		x.lastRefresh = now
+		if err := x.refresh(ctx, x.cursor); err != nil {
+			return WALFile{}, err
+		}
+		if _, ok := x.files[name]; !ok {
+			if err := x.refresh(ctx, ""); err != nil {
+				return WALFile{}, err
+			}
+		}
+	}
+	if f, ok := x.files[name]; ok {
+		return f, nil
+	}
+	return WALFile{}, fmt.Errorf("%s: %w", name, ErrUnsigned)
+}
+
+// refresh loads the manifests after startAfter that were not seen yet. A
+// recent manifest without signature is not marked seen and stops the
+// cursor, so that it is loaded once signed.
+func (x *WALIndex) refresh(ctx context.Context, startAfter string) error {
+	pending := false
+	for info, err := range x.stor.Iterate(ctx, "", st.IterateOpts{StartAfter: startAfter}) {
+		if err != nil {
+			return fmt.Errorf("list wal manifests: %w", err)
+		}
+		name := info.Path
+		if _, ok := ParseWALManifestName(name); !ok {
+			continue
+		}
+		if x.seen[name] {
+			x.advance(name, pending)
+			continue
+		}
+
+		data, err := GetVerified(ctx, x.stor, x.verifier, ContextWALManifest, name)
+		switch {
+		case errors.Is(err, ErrUnsigned) && x.now().Sub(info.ModTime) < walIndexPendingAge:
+			pending = true
+			continue
+		case errors.Is(err, ErrUnsigned) || errors.Is(err, ErrBadSignature):
+			// a manifest without a valid signature does not vouch for anything,
+			// the files it lists stay unsigned
+			x.l.Warn("skipping wal manifest", slog.String("name", name), slog.Any("err", err))
+		case err != nil:
+			return err
+		default:
+			var m WALManifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return fmt.Errorf("decode wal manifest %s: %w", name, err)
+			}
+			for _, f := range m.Files {
+				x.files[f.Name] = f
+			}
+		}
+		x.seen[name] = true
+		x.advance(name, pending)
+	}
+	return nil
+}
+
+// advance moves the cursor to a seen manifest, unless a pending one sorts
+// before it.
+func (x *WALIndex) advance(name string, pending bool) {
+	if !pending && name > x.cursor {
+		x.cursor = name
+	}
+}
@@ -0,0 +1,51 @@
+package storecrypt
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalStorage_PutIf(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range iterateBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			cs, ok := s.(ConditionalStorage)
+			require.True(t, ok)
+
+			_, _, err := cs.GetVersioned(ctx, "locks/repo.lease")
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			// create if absent
+			v1, err := cs.PutIf(ctx, "locks/repo.lease", []byte("one"), "")
+			require.NoError(t, err)
+			_, err = cs.PutIf(ctx, "locks/repo.lease", []byte("other"), "")
+			require.ErrorIs(t, err, ErrPreconditionFailed)
+
+			data, v, err := cs.GetVersioned(ctx, "locks/repo.lease")
+			require.NoError(t, err)
+			assert.Equal(t, "one", string(data))
+			assert.Equal(t, v1, v)
+
+			// replace with the current version only
+			v2, err := cs.PutIf(ctx, "locks/repo.lease", []byte("two"), v1)
+			require.NoError(t, err)
+			assert.NotEqual(t, v1, v2)
+			_, err = cs.PutIf(ctx, "locks/repo.lease", []byte("stale"), v1)
+			require.ErrorIs(t, err, ErrPreconditionFailed)
+
+			data, v, err = cs.GetVersioned(ctx, "locks/repo.lease")
+			require.NoError(t, err)
+			assert.Equal(t, "two", string(data))
+			assert.Equal(t, v2, v)
+
+			// a version never matches a missing object
+			_, err = cs.PutIf(ctx, "locks/missing", []byte("x"), v2)
+			require.ErrorIs(t, err, ErrPreconditionFailed)
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package storecrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"path"
+	"sync"
+	"sync/atomic"
+)
+
+// CopyOpts configures CopyStorage.
+type CopyOpts struct {
+	// Parallel is the number of files copied at once, 1 when zero.
+	Parallel int
+
+	// Last marks files copied after all others, and deleted before all others.
+	// Use it for markers that make a set of files visible, such as backup manifests.
+	Last func(logicalPath string) bool
+
+	// DeleteSource removes the source files after everything was copied and verified.
+	DeleteSource bool
+
+	// DryRun only reports what would be copied.
+	DryRun bool
+
+	Log *slog.Logger
+}
+
+// CopyResult summarizes a copy.
+type CopyResult struct {
+	Copied  int   // files written to the target
+	Skipped int   // files already in the target with the same content
+	Deleted int   // source objects removed
+	Bytes   int64 // plain bytes written to the target
+}
+
+// CopyStorage copies every object of src into dst.
+//
+// Objects are decoded with the transforms of src and encoded with the
+// writeExt of dst while streaming, and WAL files are placed by the layout
+// of dst. Each copy is verified by reading it back and comparing the
+// SHA-256 of the plain content. A file already in dst is skipped when its
+// content matches, so an interrupted copy is resumed by running it again.
+// The source is streamed from its listing, only the Last files are kept
+// in memory. DeleteSource removes only the source objects whose name is
+// held by dst, files written to src meanwhile stay.
+func CopyStorage(ctx context.Context, src, dst *VariadicStorage, opts CopyOpts) (CopyResult, error) {
+	var res CopyResult
+
+	loggr := opts.Log
+	if loggr == nil {
+		loggr = slog.With(slog.String("component", "storage-copy"))
+	}
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	// the stored objects of the Last files, copied after and deleted before
+	// all others
+	var last []string
+	lastStored := map[string][]string{}
+	first := func(yield func(string, error) bool) {
+		prev := ""
+		for fi, err := range src.IterateRaw(ctx, "", IterateOpts{}) {
+			if err != nil {
+				yield("", fmt.Errorf("list source: %w", err))
+				return
+			}
+			name := logicalName(src.decodePath(fi.Path))
+			if opts.Last != nil && opts.Last(name) {
+				if _, ok := lastStored[name]; !ok {
+					last = append(last, name)
+				}
+				lastStored[name] = append(lastStored[name], fi.Path)
+				continue
+			}
+			// the encodings of a name are listed next to each other
+			if name == prev {
+				continue
+			}
+			prev = name
+			if !yield(name, nil) {
+				return
+			}
+		}
+	}
+
+	var copied, skipped atomic.Int64
+	var written atomic.Int64
+	copyOne := func(ctx context.Context, name string) error {
+		if opts.DryRun {
+			loggr.Info("would copy", slog.String("path", name))
+			return nil
+		}
+		n, done, err := copyObject(ctx, src, dst, name)
+		if err != nil {
+			return fmt.Errorf("copy %q: %w", name, err)
+		}
+		if !done {
+			skipped.Add(1)
+			loggr.Debug("already in target", slog.String("path", name))
+			return nil
+		}
+		copied.Add(1)
+		written.Add(n)
+		loggr.Debug("copied", slog.String("path", name), slog.Int64("bytes", n))
+		return nil
+	}
+
+	err := runParallel(ctx, parallel, first, copyOne)
+	if err == nil {
+		err = runParallel(ctx, parallel, sliceSeq(last), copyOne)
+	}
+	res.Copied = int(copied.Load())
+	res.Skipped = int(skipped.Load())
+	res.Bytes = written.Load()
+	if err != nil {
+		return res, err
+	}
+
+	if !opts.DeleteSource || opts.DryRun {
+		return res, nil
+	}
+
+	var deleted atomic.Int64
+	deleteOne := func(ctx context.Context, p string) error {
+		held, err := dst.Backend.Exists(ctx, dst.writeName(logicalName(src.decodePath(p))))
+		if err != nil {
+			return fmt.Errorf("check target of %q: %w", p, err)
+		}
+		if !held {
+			return nil
+		}
+		if err := src.Backend.Delete(ctx, p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("delete source %q: %w", p, err)
+		}
+		deleted.Add(1)
+		return nil
+	}
+	var lastObjects []string
+	for _, name := range last {
+		lastObjects = append(lastObjects, lastStored[name]...)
+	}
+	err = runParallel(ctx, parallel, sliceSeq(lastObjects), deleteOne)
+	if err == nil {
+		err = runParallel(ctx, parallel, func(yield func(string, error) bool) {
+			for fi, err := range src.IterateRaw(ctx, "", IterateOpts{}) {
+				if err != nil {
+					yield("", fmt.Errorf("list source: %w", err))
+					return
+				}
+				if !yield(fi.Path, nil) {
+					return
+				}
+			}
+		}, deleteOne)
+	}
+	res.Deleted = int(deleted.Load())
+	return res, err
+}
+
+// logicalName maps a WAL file at its sharded location to its bare name, so
+// that the layout of the target decides where it goes.
+func logicalName(p string) string {
+	base := path.Base(p)
+	if sharded, ok := shardedWALPath(base); ok && sharded == p {
+		return base
+	}
+	return p
+}
+
+// copyObject copies one object and verifies it. Returns false when the
+// target already held the same content.
+func copyObject(ctx context.Context, src, dst *VariadicStorage, name string) (int64, bool, error) {
+	target := dst.writeName(name)
+
+	exists, err := dst.Backend.Exists(ctx, target)
+	if err != nil {
+		return 0, false, err
+	}
+	if exists {
+		same, err := sameContent(ctx, src, dst, name, target)
+		if err != nil {
+			return 0, false, fmt.Errorf("read source: %w", err)
+		}
+		if same {
+			return 0, false, nil
+		}
+		// a partial or different object, overwrite it
+	}
+
+	rc, err := src.Get(ctx, name)
+	if err != nil {
+		return 0, false, fmt.Errorf("read source: %w", err)
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	cr := &countingReader{r: io.TeeReader(rc, h)}
+	if err := dst.Put(ctx, name, cr); err != nil {
+		return 0, false, fmt.Errorf("write target: %w", err)
+	}
+
+	dstSum, err := contentSum(dst.getStored(ctx, target))
+	if err != nil {
+		return 0, false, fmt.Errorf("verify target: %w", err)
+	}
+	if !bytes.Equal(h.Sum(nil), dstSum) {
+		return 0, false, fmt.Errorf("verify target: checksum mismatch")
+	}
+	return cr.n, true, nil
+}
+
+// sameContent compares the plain content of a source object with the
+// stored target in a single pass over both, and stops at the first
+// difference, so a partial target is not compared to the whole source.
+// A target that cannot be read is not the same.
+func sameContent(ctx context.Context, src, dst *VariadicStorage, name, target string) (bool, error) {
+	dr, err := dst.getStored(ctx, target)
+	if err != nil {
+		return false, nil
+	}
+	defer dr.Close()
+
+	sr, err := src.Get(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	defer sr.Close()
+
+	const chunk = 32 * 1024
+	bufSrc, bufDst := make([]byte, chunk), make([]byte, chunk)
+	for {
+		ns, err := io.ReadFull(sr, bufSrc)
+		srcEOF := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !srcEOF {
+			return false, err
+		}
+		nd, err := io.ReadFull(dr, bufDst)
+		dstEOF := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !dstEOF {
+			return false, nil
+		}
+		if ns != nd || srcEOF != dstEOF || !bytes.Equal(bufSrc[:ns], bufDst[:nd]) {
+			return false, nil
+		}
+		if srcEOF {
+			return true, nil
+		}
+	}
+}
+
+// contentSum is the SHA-256 of the plain (decoded) content of an object.
+func contentSum(rc io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// runParallel runs fn for every item on n workers and stops at the first
+// error, of fn or of the sequence.
+func runParallel(ctx context.Context, n int, items iter.Seq2[string, error], fn func(context.Context, string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	work := make(chan string)
+
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if err := fn(ctx, item); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for item, err := range items {
+		if err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break feed
+		case work <- item:
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// sliceSeq feeds a slice to runParallel.
+func sliceSeq(items []string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for _, item := range items {
+			if !yield(item, nil) {
+				return
+			}
+		}
+	}
+}
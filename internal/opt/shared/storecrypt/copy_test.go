@@ -0,0 +1,151 @@
+package storecrypt
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/aesgcm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCopyStorages(t *testing.T) (src, dst *VariadicStorage, srcMem, dstMem *InMemoryStorage) {
+	t.Helper()
+
+	srcMem = NewInMemoryStorage()
+	src, err := NewVariadicStorage(srcMem, Algorithms{
+		Gzip: &CodecPair{Compressor: codec.GzipCompressor{}, Decompressor: codec.GzipDecompressor{}},
+	}, ".gz")
+	require.NoError(t, err)
+	src.SetWALLayout(WALLayoutSharded)
+
+	dstMem = NewInMemoryStorage()
+	dst, err = NewVariadicStorage(dstMem, Algorithms{
+		Zstd: &CodecPair{Compressor: codec.ZstdCompressor{}, Decompressor: codec.ZstdDecompressor{}},
+		AES:  aesgcm.NewChunkedGCMCrypter("target"),
+	}, ".zst.aes")
+	require.NoError(t, err)
+
+	return src, dst, srcMem, dstMem
+}
+
+func memKeys(m *InMemoryStorage) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.Files))
+	for k := range m.Files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCopyStorage_TranscodesAndPlacesByTargetLayout(t *testing.T) {
+	ctx := context.Background()
+	src, dst, _, dstMem := newCopyStorages(t)
+
+	putAll(t, src,
+		"000000010000000000000001",
+		"00000002.history",
+		"20250101000000/base.tar",
+		"20250101000000/20250101000000.json",
+	)
+
+	var mu sync.Mutex
+	var order []string
+	res, err := CopyStorage(ctx, src, dst, CopyOpts{
+		Parallel: 3,
+		Last: func(p string) bool {
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			return path.Base(p) == path.Dir(p)+".json"
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, res.Copied)
+	assert.Equal(t, 0, res.Skipped)
+	assert.Len(t, order, 4)
+
+	assert.Equal(t, []string{
+		"000000010000000000000001.zst.aes",
+		"00000002.history.zst.aes",
+		"20250101000000/20250101000000.json.zst.aes",
+		"20250101000000/base.tar.zst.aes",
+	}, memKeys(dstMem))
+
+	for _, p := range []string{"000000010000000000000001", "00000002.history", "20250101000000/base.tar"} {
+		assert.Equal(t, p, readAll(t, dst, p))
+	}
+}
+
+func TestCopyStorage_ResumeOverwritesDifferentFiles(t *testing.T) {
+	ctx := context.Background()
+	src, dst, _, _ := newCopyStorages(t)
+
+	putAll(t, src, "000000010000000000000001", "000000010000000000000002")
+	require.NoError(t, dst.Put(ctx, "000000010000000000000001", strings.NewReader("000000010000000000000001")))
+	require.NoError(t, dst.Put(ctx, "000000010000000000000002", strings.NewReader("partial")))
+
+	res, err := CopyStorage(ctx, src, dst, CopyOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Copied)
+	assert.Equal(t, 1, res.Skipped)
+	assert.Equal(t, "000000010000000000000002", readAll(t, dst, "000000010000000000000002"))
+}
+
+func TestCopyStorage_DeleteSource(t *testing.T) {
+	ctx := context.Background()
+	src, dst, srcMem, _ := newCopyStorages(t)
+
+	putAll(t, src, "000000010000000000000001", "20250101000000/base.tar")
+
+	res, err := CopyStorage(ctx, src, dst, CopyOpts{DeleteSource: true, Parallel: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Copied)
+	assert.Equal(t, 2, res.Deleted)
+	assert.Empty(t, memKeys(srcMem))
+	assert.Equal(t, "20250101000000/base.tar", readAll(t, dst, "20250101000000/base.tar"))
+}
+
+func TestCopyStorage_DeleteSourceKeepsFilesNotCopied(t *testing.T) {
+	ctx := context.Background()
+	src, dst, srcMem, dstMem := newCopyStorages(t)
+
+	putAll(t, src, "000000010000000000000001", "000000010000000000000002")
+
+	var once sync.Once
+	res, err := CopyStorage(ctx, src, dst, CopyOpts{
+		DeleteSource: true,
+		Last: func(string) bool {
+			// archived while the copy runs, after the source was listed
+			once.Do(func() { putAll(t, src, "000000010000000000000003") })
+			return false
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Copied)
+	assert.Equal(t, 2, res.Deleted)
+	assert.Equal(t, []string{"wal/00000001/00000000/000000010000000000000003.gz"}, memKeys(srcMem))
+	assert.Equal(t, []string{
+		"000000010000000000000001.zst.aes",
+		"000000010000000000000002.zst.aes",
+	}, memKeys(dstMem))
+}
+
+func TestCopyStorage_DryRun(t *testing.T) {
+	ctx := context.Background()
+	src, dst, srcMem, dstMem := newCopyStorages(t)
+
+	putAll(t, src, "000000010000000000000001")
+
+	_, err := CopyStorage(ctx, src, dst, CopyOpts{DryRun: true, DeleteSource: true})
+	require.NoError(t, err)
+	assert.Empty(t, memKeys(dstMem))
+	assert.Len(t, memKeys(srcMem), 1)
+}
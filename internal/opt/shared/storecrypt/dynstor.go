@@ -3,13 +3,18 @@ package storecrypt
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"iter"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/chunked"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/pipe"
 )
 
@@ -20,12 +25,17 @@ type CodecPair struct {
 }
 
 // Algorithms are where you plug in concrete implementations.
-// The variants (plain, .gz, .zst, .gz.aes, .zst.aes, .aes) are
-// defined statically in this file.
+// The variants (plain, .gz, .zst, .lz4, .xz, each optionally followed
+// by .aes, .chacha, .x25519 or .kek) are defined statically in this file.
 type Algorithms struct {
-	Gzip *CodecPair    // nil if gzip is not configured
-	Zstd *CodecPair    // nil if zstd is not configured
-	AES  crypt.Crypter // nil if AES is not configured
+	Gzip     *CodecPair    // nil if gzip is not configured
+	Zstd     *CodecPair    // nil if zstd is not configured
+	Lz4      *CodecPair    // nil if lz4 is not configured
+	Xz       *CodecPair    // nil if xz is not configured
+	AES      crypt.Crypter // nil if AES is not configured
+	ChaCha   crypt.Crypter // nil if ChaCha20-Poly1305 is not configured
+	X25519   crypt.Crypter // nil if X25519 is not configured, public-key (write-only) encryption
+	Envelope crypt.Crypter // nil if envelope encryption is not configured, data keys wrapped by a KEK
 }
 
 // VariadicStorage is a storage wrapper that:
@@ -40,6 +50,8 @@ type VariadicStorage struct {
 	Backend  Storage
 	alg      Algorithms
 	writeExt string // "", ".gz", ".zst", ".gz.aes", ".zst.aes", ".aes"
+
+	walLayout WALLayout // "" means WALLayoutFlat
 }
 
 var _ Storage = (*VariadicStorage)(nil)
@@ -51,8 +63,13 @@ var _ Storage = (*VariadicStorage)(nil)
 //	""         -> plain
 //	".gz"      -> gzip
 //	".zst"     -> zstd
+//	".lz4"     -> lz4
+//	".xz"      -> xz
 //	".gz.aes"  -> gzip + AES
 //	".zst.aes" -> zstd + AES
+//	".aes"     -> AES
+//
+// and the same with ".chacha", ".x25519" or ".kek" in place of ".aes".
 func NewVariadicStorage(backend Storage, alg Algorithms, writeExt string) (*VariadicStorage, error) {
 	vs := &VariadicStorage{
 		Backend:  backend,
@@ -68,22 +85,36 @@ func NewVariadicStorage(backend Storage, alg Algorithms, writeExt string) (*Vari
 // isSupportedWriteExt validates that the chosen writeExt is compatible
 // with the configured algorithms.
 func (vs *VariadicStorage) isSupportedWriteExt(ext string) bool {
-	switch ext {
-	case "":
-		return true
-	case ".gz":
-		return vs.alg.Gzip != nil
-	case ".zst":
-		return vs.alg.Zstd != nil
-	case ".gz.aes":
-		return vs.alg.Gzip != nil && vs.alg.AES != nil
-	case ".zst.aes":
-		return vs.alg.Zstd != nil && vs.alg.AES != nil
-	case ".aes": // <-- NEW: AES-only is allowed if we have AES
-		return vs.alg.AES != nil
-	default:
-		return false
+	return slices.Contains(vs.supportedExts(), ext)
+}
+
+// codecs returns the configured codecs, in lookup order.
+func (vs *VariadicStorage) codecs() []*CodecPair {
+	var cs []*CodecPair
+	for _, c := range []*CodecPair{vs.alg.Gzip, vs.alg.Zstd, vs.alg.Lz4, vs.alg.Xz} {
+		if c != nil {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// crypters returns the configured crypters, in lookup order.
+func (vs *VariadicStorage) crypters() []crypt.Crypter {
+	var cs []crypt.Crypter
+	if vs.alg.AES != nil {
+		cs = append(cs, vs.alg.AES)
+	}
+	if vs.alg.ChaCha != nil {
+		cs = append(cs, vs.alg.ChaCha)
+	}
+	if vs.alg.X25519 != nil {
+		cs = append(cs, vs.alg.X25519)
 	}
+	if vs.alg.Envelope != nil {
+		cs = append(cs, vs.alg.Envelope)
+	}
+	return cs
 }
 
 // supportedExts returns the list of extensions this storage knows about,
@@ -92,20 +123,18 @@ func (vs *VariadicStorage) supportedExts() []string {
 	var exts []string
 
 	// Prefer more "advanced" variants first.
-	if vs.alg.Gzip != nil && vs.alg.AES != nil {
-		exts = append(exts, ".gz.aes")
-	}
-	if vs.alg.Zstd != nil && vs.alg.AES != nil {
-		exts = append(exts, ".zst.aes")
-	}
-	if vs.alg.Gzip != nil {
-		exts = append(exts, ".gz")
+	crypters := vs.crypters()
+	codecs := vs.codecs()
+	for _, c := range crypters {
+		for _, cp := range codecs {
+			exts = append(exts, cp.Compressor.FileExtension()+c.FileExtension())
+		}
 	}
-	if vs.alg.Zstd != nil {
-		exts = append(exts, ".zst")
+	for _, cp := range codecs {
+		exts = append(exts, cp.Compressor.FileExtension())
 	}
-	if vs.alg.AES != nil {
-		exts = append(exts, ".aes")
+	for _, c := range crypters {
+		exts = append(exts, c.FileExtension())
 	}
 	// plain always last
 	exts = append(exts, "")
@@ -127,33 +156,29 @@ type transforms struct {
 //
 // The logic is:
 //
-//	[".gz" | ".zst"] [".aes"]?
-//
-// Currently ".aes" is only used in combination with compression, but
-// this can be expanded if needed.
+//	[".gz" | ".zst" | ".lz4" | ".xz"] [".aes" | ".chacha" | ".x25519" | ".kek"]?
 func (vs *VariadicStorage) transformsFromName(name string) transforms {
 	t := transforms{}
 
-	// Handle AES as the outermost suffix if configured.
-	if vs.alg.AES != nil && strings.HasSuffix(name, ".aes") {
-		t.crypter = vs.alg.AES
-		name = strings.TrimSuffix(name, ".aes")
+	// Handle encryption as the outermost suffix if configured.
+	for _, c := range vs.crypters() {
+		if strings.HasSuffix(name, c.FileExtension()) {
+			t.crypter = c
+			name = strings.TrimSuffix(name, c.FileExtension())
+			break
+		}
 	}
 
 	// Compression suffix.
-	if vs.alg.Gzip != nil && strings.HasSuffix(name, ".gz") {
-		t.compressor = vs.alg.Gzip.Compressor
-		t.decompressor = vs.alg.Gzip.Decompressor
-		return t
-	}
-
-	if vs.alg.Zstd != nil && strings.HasSuffix(name, ".zst") {
-		t.compressor = vs.alg.Zstd.Compressor
-		t.decompressor = vs.alg.Zstd.Decompressor
-		return t
+	for _, cp := range vs.codecs() {
+		if strings.HasSuffix(name, cp.Compressor.FileExtension()) {
+			t.compressor = cp.Compressor
+			t.decompressor = cp.Decompressor
+			return t
+		}
 	}
 
-	// No known compression suffix: plain (maybe AES only in future).
+	// No known compression suffix: plain, or encrypted only.
 	return t
 }
 
@@ -163,6 +188,60 @@ func (vs *VariadicStorage) encodePath(base string) string {
 	return filepath.ToSlash(base + vs.writeExt)
 }
 
+// writeName is the stored object Put writes a logical name to.
+func (vs *VariadicStorage) writeName(name string) string {
+	return vs.walWritePath(filepath.ToSlash(name)) + vs.writeExt
+}
+
+// getStored reads and decodes the stored object of the exact key stored.
+// Headroom of the transforms for MaxStoredSize.
+const (
+	// maxCryptHeader covers the header of every crypter, the largest is
+	// the envelope header with a wrapped data key of up to 64KiB.
+	maxCryptHeader = 80 * 1024
+	// maxCodecFraming covers the headers and the stored blocks the codecs
+	// write for incompressible content, in addition to 1/255 of it.
+	maxCodecFraming = 4 * 1024
+)
+
+// MaxStoredSize bounds the size of the object stored for plain bytes of
+// content with the write extension.
+func (vs *VariadicStorage) MaxStoredSize(plain int64) int64 {
+	n := plain
+	t := vs.transformsFromName(vs.writeExt)
+	if t.compressor != nil {
+		n += n/255 + maxCodecFraming
+	}
+	if t.crypter != nil {
+		n += chunked.Overhead(n) + maxCryptHeader
+	}
+	return n
+}
+
+// MaxPlainSize is the largest content whose stored object is at most
+// stored bytes with the write extension, 0 when none fits.
+func (vs *VariadicStorage) MaxPlainSize(stored int64) int64 {
+	lo, hi := int64(0), stored
+	for lo < hi {
+		mid := hi - (hi-lo)/2
+		if vs.MaxStoredSize(mid) <= stored {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+func (vs *VariadicStorage) getStored(ctx context.Context, stored string) (io.ReadCloser, error) {
+	rc, err := vs.Backend.Get(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	t := vs.transformsFromName(stored)
+	return pipe.DecryptAndDecompressOptional(rc, t.crypter, t.decompressor)
+}
+
 // decodePath strips any known extension combination from the stored
 // name and returns the logical base name.
 func (vs *VariadicStorage) decodePath(encoded string) string {
@@ -179,17 +258,39 @@ func (vs *VariadicStorage) decodePath(encoded string) string {
 }
 
 // findExistingName tries all known extensions for the given logical base
-// name and returns the first existing stored name, or fs.ErrNotExist.
+// name, in every location of the WAL layouts, and returns the first
+// existing stored name, or fs.ErrNotExist.
 func (vs *VariadicStorage) findExistingName(ctx context.Context, base string) (string, error) {
 	base = filepath.ToSlash(base)
-	for _, ext := range vs.supportedExts() {
-		candidate := base + ext
-		ok, err := vs.Backend.Exists(ctx, candidate)
+	for _, loc := range vs.walLocations(base) {
+		for _, ext := range vs.supportedExts() {
+			candidate := loc + ext
+			ok, err := vs.Backend.Exists(ctx, candidate)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fs.ErrNotExist
+}
+
+// findExistingEncoded returns the location of an encoded name (with its
+// transform extension). Only WAL file names may be in more than one place.
+func (vs *VariadicStorage) findExistingEncoded(ctx context.Context, name string) (string, error) {
+	locs := vs.walLocations(name)
+	if len(locs) == 1 {
+		return name, nil
+	}
+	for _, loc := range locs {
+		ok, err := vs.Backend.Exists(ctx, loc)
 		if err != nil {
 			return "", err
 		}
 		if ok {
-			return candidate, nil
+			return loc, nil
 		}
 	}
 	return "", fs.ErrNotExist
@@ -198,8 +299,53 @@ func (vs *VariadicStorage) findExistingName(ctx context.Context, base string) (s
 // Put writes the given reader using the configured writeExt. Callers
 // pass only the logical name, e.g. "000000010000000000000001".
 func (vs *VariadicStorage) Put(ctx context.Context, path string, r io.Reader) error {
+	return vs.put(ctx, path, r, vs.writeExt)
+}
+
+// PutMeta writes metadata that the writer reads back itself, such as backup
+// markers. With public-key encryption the writer holds no private key, so
+// such objects are compressed but not encrypted. Otherwise it is Put.
+func (vs *VariadicStorage) PutMeta(ctx context.Context, path string, r io.Reader) error {
+	ext := vs.writeExt
+	if vs.alg.X25519 != nil {
+		ext = strings.TrimSuffix(ext, vs.alg.X25519.FileExtension())
+	}
+	return vs.put(ctx, path, r, ext)
+}
+
+// PutCompressed writes data that is already compressed with the codec of
+// codecExt (e.g. ".zst"), such as a basebackup compressed by the server. It
+// is encrypted as Put does but not compressed again, and Get decompresses it
+// based on the extension as usual.
+func (vs *VariadicStorage) PutCompressed(ctx context.Context, path, codecExt string, r io.Reader) error {
+	if !slices.ContainsFunc(vs.codecs(), func(cp *CodecPair) bool {
+		return cp.Compressor.FileExtension() == codecExt
+	}) {
+		return fmt.Errorf("compression %q is not configured", codecExt)
+	}
+
+	ext := codecExt
+	for _, c := range vs.crypters() {
+		if strings.HasSuffix(vs.writeExt, c.FileExtension()) {
+			ext += c.FileExtension()
+			break
+		}
+	}
+
+	stored := vs.walWritePath(filepath.ToSlash(path)) + ext
+	t := vs.transformsFromName(stored)
+
+	// Encrypt only, the data is compressed already.
+	transformed, err := pipe.CompressAndEncryptOptional(r, nil, t.crypter)
+	if err != nil {
+		return err
+	}
+	return vs.Backend.Put(ctx, stored, transformed)
+}
+
+func (vs *VariadicStorage) put(ctx context.Context, path string, r io.Reader, ext string) error {
 	path = filepath.ToSlash(path)
-	stored := vs.encodePath(path)
+	stored := vs.walWritePath(path) + ext
 
 	t := vs.transformsFromName(stored)
 
@@ -225,7 +371,11 @@ func (vs *VariadicStorage) Get(ctx context.Context, path string) (io.ReadCloser,
 		}
 		if strings.HasSuffix(path, ext) {
 			// Treat as a fully encoded path.
-			rc, err := vs.Backend.Get(ctx, path)
+			stored, err := vs.findExistingEncoded(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			rc, err := vs.Backend.Get(ctx, stored)
 			if err != nil {
 				return nil, err
 			}
@@ -252,8 +402,7 @@ func (vs *VariadicStorage) Get(ctx context.Context, path string) (io.ReadCloser,
 // List lists FileInfo entries but rewrites the Path field to the
 // logical name (without extensions).
 func (vs *VariadicStorage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
-	prefix = filepath.ToSlash(prefix)
-	files, err := vs.Backend.List(ctx, prefix)
+	files, err := vs.ListInfoRaw(ctx, prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -263,13 +412,54 @@ func (vs *VariadicStorage) List(ctx context.Context, prefix string) ([]FileInfo,
 	return files, nil
 }
 
+// ListInfoRaw lists FileInfo entries with their stored paths. Temporary
+// objects of a running rekey are left out.
 func (vs *VariadicStorage) ListInfoRaw(ctx context.Context, prefix string) ([]FileInfo, error) {
 	prefix = filepath.ToSlash(prefix)
 	files, err := vs.Backend.List(ctx, prefix)
 	if err != nil {
 		return nil, err
 	}
-	return files, nil
+	return slices.DeleteFunc(files, func(fi FileInfo) bool {
+		return isRekeyTmp(fi.Path)
+	}), nil
+}
+
+// Iterate streams FileInfo entries with the Path field rewritten to the
+// logical name. Prefix and StartAfter apply to logical names as well.
+func (vs *VariadicStorage) Iterate(ctx context.Context, prefix string, opts IterateOpts) iter.Seq2[FileInfo, error] {
+	return func(yield func(FileInfo, error) bool) {
+		// A stored name is never shorter than its logical name, so the backend
+		// gets the same bounds, and logical names are re-checked after decoding.
+		for fi, err := range vs.IterateRaw(ctx, prefix, opts) {
+			if err != nil {
+				yield(FileInfo{}, err)
+				return
+			}
+			fi.Path = vs.decodePath(fi.Path)
+			if opts.StartAfter != "" && fi.Path <= opts.StartAfter {
+				continue
+			}
+			if !yield(fi, nil) {
+				return
+			}
+		}
+	}
+}
+
+// IterateRaw is Iterate without decoding, paths keep their transform
+// extensions, as in ListInfoRaw.
+func (vs *VariadicStorage) IterateRaw(ctx context.Context, prefix string, opts IterateOpts) iter.Seq2[FileInfo, error] {
+	return func(yield func(FileInfo, error) bool) {
+		for fi, err := range vs.Backend.Iterate(ctx, filepath.ToSlash(prefix), opts) {
+			if err == nil && isRekeyTmp(fi.Path) {
+				continue
+			}
+			if !yield(fi, err) {
+				return
+			}
+		}
+	}
 }
 
 // Delete deletes all known variants for the given logical path.
@@ -279,10 +469,12 @@ func (vs *VariadicStorage) Delete(ctx context.Context, path string) error {
 	path = filepath.ToSlash(path)
 
 	var lastErr error
-	for _, ext := range vs.supportedExts() {
-		candidate := path + ext
-		if err := vs.Backend.Delete(ctx, candidate); err != nil && !errors.Is(err, fs.ErrNotExist) {
-			lastErr = err
+	for _, loc := range vs.walLocations(path) {
+		for _, ext := range vs.supportedExts() {
+			candidate := loc + ext
+			if err := vs.Backend.Delete(ctx, candidate); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				lastErr = err
+			}
 		}
 	}
 	return lastErr
@@ -293,6 +485,19 @@ func (vs *VariadicStorage) DeleteDir(ctx context.Context, path string) error {
 	return vs.Backend.DeleteDir(ctx, path)
 }
 
+// AbortUploads delegates to the backend, paths of the aborted uploads are
+// rewritten to logical names.
+func (vs *VariadicStorage) AbortUploads(ctx context.Context, path string, before time.Time) ([]Upload, error) {
+	uploads, err := AbortUploads(ctx, vs.Backend, filepath.ToSlash(path), before)
+	if err != nil {
+		return nil, err
+	}
+	for i := range uploads {
+		uploads[i].Path = vs.decodePath(uploads[i].Path)
+	}
+	return uploads, nil
+}
+
 // Exists returns true if any variant for the logical path exists.
 func (vs *VariadicStorage) Exists(ctx context.Context, path string) (bool, error) {
 	path = filepath.ToSlash(path)
@@ -324,22 +529,25 @@ func (vs *VariadicStorage) Rename(ctx context.Context, oldRemotePath, newRemoteP
 
 	var lastErr error
 
-	for _, ext := range vs.supportedExts() {
-		oldPhys := oldBase + ext
-		newPhys := newBase + ext
+	newLoc := vs.walWritePath(newBase)
+	for _, oldLoc := range vs.walLocations(oldBase) {
+		for _, ext := range vs.supportedExts() {
+			oldPhys := oldLoc + ext
+			newPhys := newLoc + ext
 
-		// Check if this physical variant exists
-		ok, err := vs.Backend.Exists(ctx, oldPhys)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-		if !ok {
-			continue
-		}
+			// Check if this physical variant exists
+			ok, err := vs.Backend.Exists(ctx, oldPhys)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if !ok {
+				continue
+			}
 
-		if err := vs.Backend.Rename(ctx, oldPhys, newPhys); err != nil {
-			lastErr = err
+			if err := vs.Backend.Rename(ctx, oldPhys, newPhys); err != nil {
+				lastErr = err
+			}
 		}
 	}
 
@@ -3,13 +3,19 @@ package storecrypt
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"fmt"
 	"io"
 	"io/fs"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/aesgcm"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/chacha"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/x25519"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,6 +39,15 @@ func TestNewVariadicStorage_ValidationMatrix(t *testing.T) {
 		Decompressor: codec.ZstdDecompressor{},
 	}
 
+	lz4Pair := &CodecPair{
+		Compressor:   codec.Lz4Compressor{},
+		Decompressor: codec.Lz4Decompressor{},
+	}
+	xzPair := &CodecPair{
+		Compressor:   codec.XzCompressor{},
+		Decompressor: codec.XzDecompressor{},
+	}
+
 	tests := []struct {
 		name     string
 		alg      Algorithms
@@ -50,6 +65,9 @@ func TestNewVariadicStorage_ValidationMatrix(t *testing.T) {
 		{"zstd-aes-zst.aes-ok", Algorithms{Zstd: zstdPair, AES: aes}, ".zst.aes", true},
 		{"gzip-zstd-aes-gz-ok", Algorithms{Gzip: gzipPair, Zstd: zstdPair, AES: aes}, ".gz", true},
 		{"gzip-zstd-aes-zst.ok", Algorithms{Gzip: gzipPair, Zstd: zstdPair, AES: aes}, ".zst", true},
+		{"lz4-aes-lz4.aes-ok", Algorithms{Lz4: lz4Pair, AES: aes}, ".lz4.aes", true},
+		{"xz-ok", Algorithms{Xz: xzPair}, ".xz", true},
+		{"xz-zst-fail-no-zstd", Algorithms{Xz: xzPair}, ".zst", false},
 		{"unknown-ext-fail", Algorithms{Gzip: gzipPair, AES: aes}, ".xyz", false},
 	}
 
@@ -123,6 +141,11 @@ func TestSupportedExts_OrderAndContent(t *testing.T) {
 			alg:  Algorithms{Gzip: gzipPair, Zstd: zstdPair, AES: aes},
 			want: []string{".gz.aes", ".zst.aes", ".gz", ".zst", ".aes", ""},
 		},
+		{
+			name: "zstd-aes-x25519",
+			alg:  Algorithms{Zstd: zstdPair, AES: aes, X25519: newTestX25519(t, false)},
+			want: []string{".zst.aes", ".zst.x25519", ".zst", ".aes", ".x25519", ""},
+		},
 	}
 
 	for _, tt := range tests {
@@ -360,6 +383,49 @@ func TestVariadicStorage_PutGet_RoundTrip_AllWriteExts(t *testing.T) {
 	}
 }
 
+func TestVariadicStorage_MaxPlainSize_BoundsStoredSize(t *testing.T) {
+	ctx := context.Background()
+
+	aes := aesgcm.NewChunkedGCMCrypter("password")
+	gzipPair := &CodecPair{Compressor: codec.GzipCompressor{}, Decompressor: codec.GzipDecompressor{}}
+	zstdPair := &CodecPair{Compressor: codec.ZstdCompressor{}, Decompressor: codec.ZstdDecompressor{}}
+	chachaCrypter := chacha.NewChunkedChaChaCrypter("password")
+
+	// random content does not compress
+	content := make([]byte, 2<<20)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	const limit = 1 << 20
+
+	tests := []struct {
+		name     string
+		alg      Algorithms
+		writeExt string
+	}{
+		{"plain", Algorithms{}, ""},
+		{"gzip", Algorithms{Gzip: gzipPair}, ".gz"},
+		{"aes-only", Algorithms{AES: aes}, ".aes"},
+		{"chacha-only", Algorithms{ChaCha: chachaCrypter}, ".chacha"},
+		{"zstd-aes", Algorithms{Zstd: zstdPair, AES: aes}, ".zst.aes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewInMemoryStorage()
+			vs, err := NewVariadicStorage(mem, tt.alg, tt.writeExt)
+			require.NoError(t, err)
+
+			plain := vs.MaxPlainSize(limit)
+			require.Positive(t, plain)
+			if tt.writeExt == "" {
+				assert.EqualValues(t, limit, plain)
+			}
+			require.NoError(t, vs.Put(ctx, "base.tar.part00001", bytes.NewReader(content[:plain])))
+			assert.LessOrEqual(t, len(mem.Files["base.tar.part00001"+tt.writeExt]), limit)
+		})
+	}
+}
+
 // -----------------------------------------------------------------------------
 // Delete / Exists
 // -----------------------------------------------------------------------------
@@ -423,6 +489,46 @@ func TestVariadicStorage_DeleteDir_DelegatesAndClearsAllVariants(t *testing.T) {
 	require.True(t, ok, "other/ should be untouched")
 }
 
+// uploadsBackend keeps unfinished uploads under their stored names.
+type uploadsBackend struct {
+	*InMemoryStorage
+	uploads []Upload
+	prefix  string
+}
+
+func (b *uploadsBackend) AbortUploads(_ context.Context, remotePath string, _ time.Time) ([]Upload, error) {
+	b.prefix = remotePath
+	return b.uploads, nil
+}
+
+func TestVariadicStorage_AbortUploads_DelegatesWithLogicalNames(t *testing.T) {
+	ctx := context.Background()
+
+	gzipPair := &CodecPair{
+		Compressor:   codec.GzipCompressor{},
+		Decompressor: codec.GzipDecompressor{},
+	}
+	backend := &uploadsBackend{
+		InMemoryStorage: NewInMemoryStorage(),
+		uploads:         []Upload{{Path: "20260101000000/base.tar.gz", Size: 10}},
+	}
+	vs, err := NewVariadicStorage(backend, Algorithms{Gzip: gzipPair}, ".gz")
+	require.NoError(t, err)
+
+	uploads, err := AbortUploads(ctx, vs, "20260101000000", time.Now())
+
+	require.NoError(t, err)
+	assert.Equal(t, []Upload{{Path: "20260101000000/base.tar", Size: 10}}, uploads)
+	assert.Equal(t, "20260101000000", backend.prefix)
+
+	// backends without unfinished uploads
+	plain, err := NewVariadicStorage(NewInMemoryStorage(), Algorithms{}, "")
+	require.NoError(t, err)
+	uploads, err = AbortUploads(ctx, plain, "", time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
 func TestVariadicStorage_Exists_AnyVariant(t *testing.T) {
 	ctx := context.Background()
 
@@ -529,3 +635,168 @@ func TestVariadicStorage_ListInfo_RewritesPath(t *testing.T) {
 
 	assert.ElementsMatch(t, []string{"p/a", "p/c"}, paths)
 }
+
+// -----------------------------------------------------------------------------
+// X25519 (write-only) encryption
+// -----------------------------------------------------------------------------
+
+var testX25519Pub, testX25519Priv = func() (string, string) {
+	pub, priv, err := x25519.GenerateKeyPair()
+	if err != nil {
+		panic(err)
+	}
+	return pub, priv
+}()
+
+func newTestX25519(t *testing.T, withPrivate bool) crypt.Crypter {
+	t.Helper()
+	priv := ""
+	if withPrivate {
+		priv = testX25519Priv
+	}
+	c, err := x25519.NewCrypter(testX25519Pub, priv)
+	require.NoError(t, err)
+	return c
+}
+
+func TestVariadicStorage_X25519_WriteOnlyKeepsMetaReadable(t *testing.T) {
+	ctx := context.Background()
+	backend := NewInMemoryStorage()
+	zstdPair := &CodecPair{Compressor: codec.ZstdCompressor{}, Decompressor: codec.ZstdDecompressor{}}
+
+	writer, err := NewVariadicStorage(backend, Algorithms{Zstd: zstdPair, X25519: newTestX25519(t, false)}, ".zst.x25519")
+	require.NoError(t, err)
+
+	require.NoError(t, writer.Put(ctx, "20250101000000/base.tar", strings.NewReader("base")))
+	require.NoError(t, PutMeta(ctx, writer, "20250101000000/20250101000000.json", strings.NewReader(`{"id":1}`)))
+
+	_, ok := backend.Files["20250101000000/base.tar.zst.x25519"]
+	assert.True(t, ok)
+	_, ok = backend.Files["20250101000000/20250101000000.json.zst"]
+	assert.True(t, ok)
+
+	// the writer reads metadata, but not content
+	rc, err := writer.Get(ctx, "20250101000000/20250101000000.json")
+	require.NoError(t, err)
+	meta, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.JSONEq(t, `{"id":1}`, string(meta))
+
+	_, err = writer.Get(ctx, "20250101000000/base.tar")
+	require.ErrorIs(t, err, x25519.ErrNoPrivateKey)
+
+	reader, err := NewVariadicStorage(backend, Algorithms{Zstd: zstdPair, X25519: newTestX25519(t, true)}, ".zst.x25519")
+	require.NoError(t, err)
+	rc, err = reader.Get(ctx, "20250101000000/base.tar")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "base", string(data))
+}
+
+func TestVariadicStorage_ChaCha_KeepsAESReadable(t *testing.T) {
+	ctx := context.Background()
+	backend := NewInMemoryStorage()
+	zstdPair := &CodecPair{Compressor: codec.ZstdCompressor{}, Decompressor: codec.ZstdDecompressor{}}
+	alg := Algorithms{
+		Zstd:   zstdPair,
+		AES:    aesgcm.NewChunkedGCMCrypter("pass"),
+		ChaCha: chacha.NewChunkedChaChaCrypter("pass"),
+	}
+
+	// an archive written with AES, then switched to ChaCha20-Poly1305
+	old, err := NewVariadicStorage(backend, alg, ".zst.aes")
+	require.NoError(t, err)
+	require.NoError(t, old.Put(ctx, "000000010000000000000001", strings.NewReader("one")))
+
+	vs, err := NewVariadicStorage(backend, alg, ".zst.chacha")
+	require.NoError(t, err)
+	require.NoError(t, vs.Put(ctx, "000000010000000000000002", strings.NewReader("two")))
+
+	_, ok := backend.Files["000000010000000000000002.zst.chacha"]
+	assert.True(t, ok)
+
+	for name, want := range map[string]string{
+		"000000010000000000000001": "one",
+		"000000010000000000000002": "two",
+	} {
+		rc, err := vs.Get(ctx, name)
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, want, string(got))
+	}
+}
+
+func TestVariadicStorage_MixedCodecArchive(t *testing.T) {
+	ctx := context.Background()
+	backend := NewInMemoryStorage()
+	alg := Algorithms{
+		Gzip: &CodecPair{Compressor: codec.GzipCompressor{}, Decompressor: codec.GzipDecompressor{}},
+		Zstd: &CodecPair{Compressor: codec.ZstdCompressor{Level: 19}, Decompressor: codec.ZstdDecompressor{}},
+		Lz4:  &CodecPair{Compressor: codec.Lz4Compressor{Level: 1}, Decompressor: codec.Lz4Decompressor{}},
+		Xz:   &CodecPair{Compressor: codec.XzCompressor{Level: 9}, Decompressor: codec.XzDecompressor{}},
+		AES:  aesgcm.NewChunkedGCMCrypter("pass"),
+	}
+
+	// the codec changed over the life of the archive
+	want := map[string]string{}
+	for i, ext := range []string{".gz", ".zst.aes", ".lz4", ".lz4.aes", ".xz", ".xz.aes"} {
+		vs, err := NewVariadicStorage(backend, alg, ext)
+		require.NoError(t, err)
+		name := fmt.Sprintf("00000001000000000000000%d", i+1)
+		require.NoError(t, vs.Put(ctx, name, strings.NewReader(name+ext)))
+		_, ok := backend.Files[name+ext]
+		require.True(t, ok, name+ext)
+		want[name] = name + ext
+	}
+
+	vs, err := NewVariadicStorage(backend, alg, ".zst")
+	require.NoError(t, err)
+	for name, content := range want {
+		rc, err := vs.Get(ctx, name)
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, content, string(got))
+	}
+}
+
+func TestVariadicStorage_PutCompressed(t *testing.T) {
+	ctx := context.Background()
+	backend := NewInMemoryStorage()
+	alg := Algorithms{
+		Gzip: &CodecPair{Compressor: codec.GzipCompressor{}, Decompressor: codec.GzipDecompressor{}},
+		Zstd: &CodecPair{Compressor: codec.ZstdCompressor{}, Decompressor: codec.ZstdDecompressor{}},
+		AES:  aesgcm.NewChunkedGCMCrypter("pass"),
+	}
+	vs, err := NewVariadicStorage(backend, alg, ".gz.aes")
+	require.NoError(t, err)
+
+	// compressed elsewhere, e.g. by the server
+	var buf bytes.Buffer
+	w, err := codec.ZstdCompressor{}.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("base backup"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.NoError(t, vs.PutCompressed(ctx, "20250101000000/base.tar", ".zst", &buf))
+
+	// stored with the codec of the data and the configured encryption
+	_, ok := backend.Files["20250101000000/base.tar.zst.aes"]
+	assert.True(t, ok)
+
+	rc, err := vs.Get(ctx, "20250101000000/base.tar")
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "base backup", string(got))
+
+	assert.Error(t, vs.PutCompressed(ctx, "20250101000000/16384.tar", ".lz4", strings.NewReader("x")))
+}
@@ -0,0 +1,148 @@
+package storecrypt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// IterateOpts narrows down a Storage.Iterate listing.
+type IterateOpts struct {
+	// Prefix keeps only the entries whose name, relative to the listed
+	// directory, starts with it (e.g. "00000002" for a single timeline).
+	Prefix string
+
+	// StartAfter keeps only the entries whose Path sorts after it.
+	// Pass the Path of the last entry seen to resume a listing.
+	StartAfter string
+}
+
+// iterFilter is IterateOpts resolved against the listed directory.
+type iterFilter struct {
+	prefix     string
+	startAfter string
+}
+
+func newIterFilter(remotePath string, opts IterateOpts) iterFilter {
+	return iterFilter{
+		prefix:     storagePrefix(cleanListPath(remotePath)) + opts.Prefix,
+		startAfter: opts.StartAfter,
+	}
+}
+
+func (f iterFilter) match(p string) bool {
+	return strings.HasPrefix(p, f.prefix) && (f.startAfter == "" || p > f.startAfter)
+}
+
+// skipDir reports whether nothing under dir can match, so that the
+// directory does not have to be read at all.
+func (f iterFilter) skipDir(dir string) bool {
+	d := dir + "/"
+	if !strings.HasPrefix(d, f.prefix) && !strings.HasPrefix(f.prefix, d) {
+		return true
+	}
+	// Every path under d sorts before startAfter, unless startAfter is inside d.
+	return f.startAfter != "" && d < f.startAfter && !strings.HasPrefix(f.startAfter, d)
+}
+
+// cleanListPath normalizes a listed directory to the form paths are
+// reported in: slash separated, relative, "" for the root.
+func cleanListPath(remotePath string) string {
+	p := path.Clean("/" + filepath.ToSlash(remotePath))
+	return strings.TrimPrefix(p, "/")
+}
+
+// readDirFunc returns the entries of a directory on a hierarchical backend.
+type readDirFunc func(dir string) ([]os.FileInfo, error)
+
+// iterateTree yields the files under remotePath of a hierarchical backend
+// rooted at baseDir. A missing directory is an empty listing, as on S3.
+func iterateTree(
+	ctx context.Context,
+	baseDir, remotePath string,
+	opts IterateOpts,
+	readDir readDirFunc,
+) iter.Seq2[FileInfo, error] {
+	return func(yield func(FileInfo, error) bool) {
+		rel := cleanListPath(remotePath)
+		abs := filepath.ToSlash(filepath.Join(baseDir, rel))
+		walkTree(ctx, readDir, abs, rel, true, newIterFilter(remotePath, opts), yield)
+	}
+}
+
+// walkTree visits the files under dir in lexical order of their full paths,
+// which is the order S3 lists keys in. Directories are sorted as if their
+// names ended with "/", so that "a-b" comes before "a/b".
+func walkTree(
+	ctx context.Context,
+	readDir readDirFunc,
+	abs, rel string,
+	root bool,
+	f iterFilter,
+	yield func(FileInfo, error) bool,
+) bool {
+	if err := ctx.Err(); err != nil {
+		return yield(FileInfo{}, err)
+	}
+
+	entries, err := readDir(abs)
+	if err != nil {
+		if root && isNotExist(err) {
+			return true
+		}
+		return yield(FileInfo{}, err)
+	}
+
+	sortKey := func(fi os.FileInfo) string {
+		if fi.IsDir() {
+			return fi.Name() + "/"
+		}
+		return fi.Name()
+	}
+	slices.SortFunc(entries, func(a, b os.FileInfo) int {
+		return strings.Compare(sortKey(a), sortKey(b))
+	})
+
+	for _, e := range entries {
+		childRel := path.Join(rel, e.Name())
+		if e.IsDir() {
+			if f.skipDir(childRel) {
+				continue
+			}
+			if !walkTree(ctx, readDir, path.Join(abs, e.Name()), childRel, false, f, yield) {
+				return false
+			}
+			continue
+		}
+		if !f.match(childRel) {
+			continue
+		}
+		if !yield(FileInfo{Path: childRel, ModTime: e.ModTime(), Size: e.Size()}, nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFileInfos drains an Iterate sequence into a slice.
+func collectFileInfos(seq iter.Seq2[FileInfo, error]) ([]FileInfo, error) {
+	var result []FileInfo
+	for fi, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fi)
+	}
+	return result, nil
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || os.IsNotExist(err) ||
+		strings.Contains(err.Error(), "file does not exist")
+}
@@ -0,0 +1,161 @@
+package storecrypt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func iteratePaths(t *testing.T, s Storage, remotePath string, opts IterateOpts) []string {
+	t.Helper()
+	var paths []string
+	for fi, err := range s.Iterate(context.Background(), remotePath, opts) {
+		require.NoError(t, err)
+		paths = append(paths, fi.Path)
+	}
+	return paths
+}
+
+func putAll(t *testing.T, s Storage, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		require.NoError(t, s.Put(context.Background(), p, strings.NewReader(p)))
+	}
+}
+
+func iterateBackends(t *testing.T) map[string]Storage {
+	t.Helper()
+	local, err := NewLocal(&LocalStorageOpts{BaseDir: t.TempDir()})
+	require.NoError(t, err)
+	sftpStor, _ := newPipeSFTPStorage(t)
+	return map[string]Storage{
+		"mem":   NewInMemoryStorage(),
+		"local": local,
+		"sftp":  sftpStor,
+	}
+}
+
+func TestIterate_OrderPrefixStartAfter(t *testing.T) {
+	for name, s := range iterateBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			putAll(t, s,
+				"wal/000000010000000000000002",
+				"wal/000000010000000000000001",
+				"wal/000000020000000000000001",
+				"wal/00000002.history",
+				"wal/a/b",
+				"wal/a-c",
+				"other/x",
+			)
+
+			assert.Equal(t, []string{
+				"wal/000000010000000000000001",
+				"wal/000000010000000000000002",
+				"wal/00000002.history",
+				"wal/000000020000000000000001",
+				"wal/a-c",
+				"wal/a/b",
+			}, iteratePaths(t, s, "wal", IterateOpts{}))
+
+			assert.Equal(t, []string{
+				"wal/000000010000000000000001",
+				"wal/000000010000000000000002",
+			}, iteratePaths(t, s, "wal", IterateOpts{Prefix: "00000001"}))
+
+			assert.Equal(t, []string{
+				"wal/00000002.history",
+				"wal/000000020000000000000001",
+				"wal/a-c",
+				"wal/a/b",
+			}, iteratePaths(t, s, "wal", IterateOpts{StartAfter: "wal/000000010000000000000002"}))
+
+			assert.Equal(t, []string{"wal/a/b"}, iteratePaths(t, s, "wal", IterateOpts{Prefix: "a/"}))
+			assert.Equal(t, []string{"wal/a/b"}, iteratePaths(t, s, "/wal/", IterateOpts{StartAfter: "wal/a-c"}))
+			assert.Empty(t, iteratePaths(t, s, "missing", IterateOpts{}))
+		})
+	}
+}
+
+func TestIterate_PagesCoverListing(t *testing.T) {
+	for name, s := range iterateBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			putAll(t, s, "d/1", "d/2", "d/3/x", "d/3-y", "d/4")
+
+			var all []string
+			startAfter := ""
+			for {
+				var page []string
+				for fi, err := range s.Iterate(context.Background(), "d", IterateOpts{StartAfter: startAfter}) {
+					require.NoError(t, err)
+					page = append(page, fi.Path)
+					if len(page) == 2 {
+						break
+					}
+				}
+				all = append(all, page...)
+				if len(page) < 2 {
+					break
+				}
+				startAfter = page[len(page)-1]
+			}
+
+			assert.Equal(t, []string{"d/1", "d/2", "d/3-y", "d/3/x", "d/4"}, all)
+		})
+	}
+}
+
+func TestIterate_CanceledContext(t *testing.T) {
+	s := NewInMemoryStorage()
+	putAll(t, s, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var gotErr error
+	for _, err := range s.Iterate(ctx, "", IterateOpts{}) {
+		gotErr = err
+	}
+	assert.ErrorIs(t, gotErr, context.Canceled)
+}
+
+func TestInMemoryStorage_DeleteWhileIterating(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStorage()
+	putAll(t, s, "a", "b", "c")
+
+	for fi, err := range s.Iterate(ctx, "", IterateOpts{}) {
+		require.NoError(t, err)
+		require.NoError(t, s.Delete(ctx, fi.Path))
+	}
+	assert.Empty(t, s.Files)
+}
+
+func TestVariadicStorage_Iterate(t *testing.T) {
+	mem := NewInMemoryStorage()
+	mem.Files["p/a.gz"] = []byte("1")
+	mem.Files["p/a0"] = []byte("2")
+	mem.Files["p/b.gz"] = []byte("3")
+	mem.Files["p/c"] = []byte("4")
+
+	vs, err := NewVariadicStorage(mem, Algorithms{
+		Gzip: &CodecPair{Compressor: codec.GzipCompressor{}, Decompressor: codec.GzipDecompressor{}},
+	}, ".gz")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"p/a", "p/a0", "p/b", "p/c"}, iteratePaths(t, vs, "p", IterateOpts{}))
+
+	// start-after is a logical name, its stored variants are skipped too
+	assert.Equal(t, []string{"p/a0", "p/b", "p/c"}, iteratePaths(t, vs, "p", IterateOpts{StartAfter: "p/a"}))
+	assert.Equal(t, []string{"p/b"}, iteratePaths(t, vs, "p", IterateOpts{Prefix: "b"}))
+
+	var raw []string
+	for fi, err := range vs.IterateRaw(context.Background(), "p", IterateOpts{StartAfter: "p/a0"}) {
+		require.NoError(t, err)
+		raw = append(raw, fi.Path)
+	}
+	assert.Equal(t, []string{"p/b.gz", "p/c"}, raw)
+}
@@ -2,9 +2,11 @@ package storecrypt
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"iter"
 	"os"
 	"path/filepath"
 	"strings"
@@ -22,7 +24,10 @@ type localStorage struct {
 	fsyncOnWrite bool
 }
 
-var _ Storage = &localStorage{}
+var (
+	_ Storage            = &localStorage{}
+	_ ConditionalStorage = &localStorage{}
+)
 
 func NewLocal(o *LocalStorageOpts) (Storage, error) {
 	bd := strings.TrimSuffix(o.BaseDir, "/")
@@ -68,33 +73,34 @@ func (l *localStorage) Get(_ context.Context, remotePath string) (io.ReadCloser,
 	return os.Open(l.fullPath(remotePath))
 }
 
-func (l *localStorage) List(_ context.Context, remotePath string) ([]FileInfo, error) {
-	fullPath := l.fullPath(remotePath)
-	var result []FileInfo
+func (l *localStorage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
+	return collectFileInfos(l.Iterate(ctx, remotePath, IterateOpts{}))
+}
 
-	err := filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return fmt.Errorf("error accessing path %q: %w", path, err)
-		}
-		if d.IsDir() {
-			return nil
-		}
-		rel, err := filepath.Rel(l.baseDir, path)
-		if err != nil {
-			return err
+func (l *localStorage) Iterate(ctx context.Context, remotePath string, opts IterateOpts) iter.Seq2[FileInfo, error] {
+	return iterateTree(ctx, l.baseDir, remotePath, opts, readLocalDir)
+}
+
+func readLocalDir(dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing path %q: %w", dir, err)
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		var info os.FileInfo
+		if e.IsDir() {
+			info, err = e.Info()
+		} else {
+			// follow symlinks, as the file content is what gets read
+			info, err = os.Stat(filepath.Join(dir, e.Name()))
 		}
-		stat, err := os.Stat(path)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("error accessing path %q: %w", filepath.Join(dir, e.Name()), err)
 		}
-		result = append(result, FileInfo{
-			Path:    filepath.ToSlash(rel),
-			ModTime: stat.ModTime(),
-			Size:    stat.Size(),
-		})
-		return nil
-	})
-	return result, err
+		infos = append(infos, info)
+	}
+	return infos, nil
 }
 
 func (l *localStorage) Delete(_ context.Context, remotePath string) error {
@@ -162,3 +168,68 @@ func (l *localStorage) Rename(_ context.Context, oldRemotePath, newRemotePath st
 
 	return os.Rename(oldFull, newFull)
 }
+
+func (l *localStorage) GetVersioned(_ context.Context, remotePath string) ([]byte, string, error) {
+	data, err := os.ReadFile(l.fullPath(remotePath))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentVersion(data), nil
+}
+
+func (l *localStorage) PutIf(_ context.Context, remotePath string, data []byte, version string) (string, error) {
+	fullPath := l.fullPath(remotePath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o750); err != nil {
+		return "", err
+	}
+
+	if version == "" {
+		err := l.writeFile(fullPath, os.O_EXCL, data)
+		if errors.Is(err, fs.ErrExist) {
+			return "", ErrPreconditionFailed
+		}
+		if err != nil {
+			return "", err
+		}
+		return contentVersion(data), nil
+	}
+
+	cur, err := os.ReadFile(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrPreconditionFailed
+		}
+		return "", err
+	}
+	if contentVersion(cur) != version {
+		return "", ErrPreconditionFailed
+	}
+
+	// replace atomically, so readers never see a partial object
+	tmp := fullPath + ".tmp"
+	if err := l.writeFile(tmp, os.O_TRUNC, data); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, fullPath); err != nil {
+		return "", err
+	}
+	return contentVersion(data), nil
+}
+
+func (l *localStorage) writeFile(fullPath string, flag int, data []byte) error {
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|flag, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if l.fsyncOnWrite {
+		if err := fsync.Fsync(f); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
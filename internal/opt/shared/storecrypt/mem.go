@@ -6,6 +6,8 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"iter"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -18,7 +20,10 @@ type InMemoryStorage struct {
 	mu    sync.RWMutex
 }
 
-var _ Storage = &InMemoryStorage{}
+var (
+	_ Storage            = &InMemoryStorage{}
+	_ ConditionalStorage = &InMemoryStorage{}
+)
 
 func NewInMemoryStorage() *InMemoryStorage {
 	return &InMemoryStorage{
@@ -68,6 +73,41 @@ func (s *InMemoryStorage) List(_ context.Context, path string) ([]FileInfo, erro
 	return infos, nil
 }
 
+// Iterate yields a snapshot of the matching files, taken under the lock,
+// so callers are free to modify the storage while iterating.
+func (s *InMemoryStorage) Iterate(ctx context.Context, path string, opts IterateOpts) iter.Seq2[FileInfo, error] {
+	return func(yield func(FileInfo, error) bool) {
+		f := newIterFilter(path, opts)
+
+		s.mu.RLock()
+		infos := make([]FileInfo, 0)
+		for name, data := range s.Files {
+			if f.match(name) {
+				infos = append(infos, FileInfo{
+					Path:    name,
+					ModTime: time.Now(),
+					Size:    int64(len(data)),
+				})
+			}
+		}
+		s.mu.RUnlock()
+
+		slices.SortFunc(infos, func(a, b FileInfo) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+
+		for _, fi := range infos {
+			if err := ctx.Err(); err != nil {
+				yield(FileInfo{}, err)
+				return
+			}
+			if !yield(fi, nil) {
+				return
+			}
+		}
+	}
+}
+
 func (s *InMemoryStorage) Delete(_ context.Context, path string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -176,3 +216,29 @@ func (s *InMemoryStorage) Rename(ctx context.Context, oldRemotePath, newRemotePa
 
 	return nil
 }
+
+func (s *InMemoryStorage) GetVersioned(_ context.Context, path string) ([]byte, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.Files[path]
+	if !ok {
+		return nil, "", fs.ErrNotExist
+	}
+	return bytes.Clone(data), contentVersion(data), nil
+}
+
+func (s *InMemoryStorage) PutIf(_ context.Context, path string, data []byte, version string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.Files[path]
+	switch {
+	case version == "" && ok:
+		return "", ErrPreconditionFailed
+	case version != "" && (!ok || contentVersion(cur) != version):
+		return "", ErrPreconditionFailed
+	}
+	s.Files[path] = bytes.Clone(data)
+	return contentVersion(data), nil
+}
@@ -0,0 +1,203 @@
+package storecrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+)
+
+// rekeyTmpSuffix marks the objects Rekey writes before renaming them over
+// the originals. VariadicStorage listings leave them out.
+const rekeyTmpSuffix = ".rekey"
+
+func isRekeyTmp(p string) bool {
+	return strings.HasSuffix(p, rekeyTmpSuffix)
+}
+
+// RekeyOpts configures Rekey.
+type RekeyOpts struct {
+	// Parallel is the number of objects re-encrypted at once, 1 when zero.
+	Parallel int
+
+	// DryRun only reports what would be re-encrypted.
+	DryRun bool
+
+	Log *slog.Logger
+}
+
+// RekeyResult summarizes a rekey run.
+type RekeyResult struct {
+	Rekeyed int // objects re-encrypted with the active key
+	Current int // objects already encrypted with the active key
+	Cleaned int // leftovers of interrupted runs removed
+}
+
+// Rekey re-encrypts every encrypted object that was not written with the
+// active key of the AES crypter.
+//
+// Only the encryption layer is replaced, compressed content is kept as is.
+// The new object is written next to the old one, verified by decrypting it
+// and comparing the SHA-256 of the content, and then renamed over it, so
+// readers always see a complete object. Running it again resumes an
+// interrupted run. Objects are streamed from the listing, not collected.
+func (vs *VariadicStorage) Rekey(ctx context.Context, opts RekeyOpts) (RekeyResult, error) {
+	var res RekeyResult
+
+	if vs.alg.AES == nil {
+		return res, errors.New("rekey: encryption is not configured")
+	}
+	kid, ok := vs.alg.AES.(crypt.KeyIdentifier)
+	if !ok || kid.ActiveKeyID() == "" {
+		return res, errors.New("rekey: no active key id, configure an encryption keyring")
+	}
+
+	loggr := opts.Log
+	if loggr == nil {
+		loggr = slog.With(slog.String("component", "storage-rekey"))
+	}
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	// Leftovers of interrupted runs are removed first, so that no running
+	// rekey of the same object writes them meanwhile.
+	aesExt := vs.alg.AES.FileExtension()
+	if !opts.DryRun {
+		for fi, err := range vs.Backend.Iterate(ctx, "", IterateOpts{}) {
+			if err != nil {
+				return res, fmt.Errorf("list: %w", err)
+			}
+			if !strings.HasSuffix(fi.Path, aesExt+rekeyTmpSuffix) {
+				continue
+			}
+			if err := vs.Backend.Delete(ctx, fi.Path); err != nil {
+				return res, fmt.Errorf("delete leftover %q: %w", fi.Path, err)
+			}
+			res.Cleaned++
+		}
+	}
+
+	// IterateRaw leaves out the temporary objects written below.
+	objects := func(yield func(string, error) bool) {
+		for fi, err := range vs.IterateRaw(ctx, "", IterateOpts{}) {
+			if err != nil {
+				yield("", fmt.Errorf("list: %w", err))
+				return
+			}
+			if strings.HasSuffix(fi.Path, aesExt) && !yield(fi.Path, nil) {
+				return
+			}
+		}
+	}
+
+	var rekeyed, current atomic.Int64
+	err := runParallel(ctx, parallel, objects, func(ctx context.Context, p string) error {
+		keyID, err := vs.readKeyID(ctx, kid, p)
+		if err != nil {
+			return fmt.Errorf("read key id of %q: %w", p, err)
+		}
+		if keyID == kid.ActiveKeyID() {
+			current.Add(1)
+			return nil
+		}
+		if opts.DryRun {
+			loggr.Info("would rekey", slog.String("path", p), slog.String("key_id", keyID))
+			return nil
+		}
+		if err := vs.rekeyObject(ctx, p); err != nil {
+			return fmt.Errorf("rekey %q: %w", p, err)
+		}
+		rekeyed.Add(1)
+		loggr.Debug("rekeyed", slog.String("path", p), slog.String("from_key_id", keyID))
+		return nil
+	})
+	res.Rekeyed = int(rekeyed.Load())
+	res.Current = int(current.Load())
+	return res, err
+}
+
+func (vs *VariadicStorage) readKeyID(ctx context.Context, kid crypt.KeyIdentifier, p string) (string, error) {
+	rc, err := vs.Backend.Get(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return kid.ReadKeyID(rc)
+}
+
+// rekeyObject re-encrypts one stored object with the active key.
+func (vs *VariadicStorage) rekeyObject(ctx context.Context, p string) error {
+	tmp := p + rekeyTmpSuffix
+
+	rc, err := vs.Backend.Get(ctx, p)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	plain, err := vs.alg.AES.Decrypt(rc)
+	if err != nil {
+		return fmt.Errorf("decrypt: %w", err)
+	}
+
+	h := sha256.New()
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := vs.alg.AES.Encrypt(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(w, io.TeeReader(plain, h)); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+
+	if err := vs.Backend.Put(ctx, tmp, pr); err != nil {
+		pr.CloseWithError(err)
+		return fmt.Errorf("write: %w", err)
+	}
+
+	sum, err := vs.decryptedSum(ctx, tmp)
+	if err == nil && !bytes.Equal(sum, h.Sum(nil)) {
+		err = errors.New("checksum mismatch")
+	}
+	if err != nil {
+		if delErr := vs.Backend.Delete(ctx, tmp); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+		return fmt.Errorf("verify: %w", err)
+	}
+
+	return vs.Backend.Rename(ctx, tmp, p)
+}
+
+// decryptedSum is the SHA-256 of the decrypted content of a stored object.
+func (vs *VariadicStorage) decryptedSum(ctx context.Context, p string) ([]byte, error) {
+	rc, err := vs.Backend.Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	plain, err := vs.alg.AES.Decrypt(rc)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, plain); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
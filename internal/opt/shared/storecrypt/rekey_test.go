@@ -0,0 +1,109 @@
+package storecrypt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/aesgcm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKeyringStorage(t *testing.T, backend Storage, pass string, keys map[string]string, active string) *VariadicStorage {
+	t.Helper()
+	var aes crypt.Crypter
+	if len(keys) == 0 {
+		aes = aesgcm.NewChunkedGCMCrypter(pass)
+	} else {
+		var err error
+		aes, err = aesgcm.NewKeyringGCMCrypter(pass, keys, active)
+		require.NoError(t, err)
+	}
+	vs, err := NewVariadicStorage(backend, Algorithms{
+		Zstd: &CodecPair{Compressor: codec.ZstdCompressor{}, Decompressor: codec.ZstdDecompressor{}},
+		AES:  aes,
+	}, ".zst.aes")
+	require.NoError(t, err)
+	return vs
+}
+
+func TestRekey_ReencryptsWithActiveKey(t *testing.T) {
+	ctx := context.Background()
+
+	for name, backend := range iterateBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			// objects written with the legacy pass and with the first key
+			legacy := newKeyringStorage(t, backend, "legacy", nil, "")
+			putAll(t, legacy, "000000010000000000000001")
+			k1 := newKeyringStorage(t, backend, "legacy", map[string]string{"k1": "one"}, "k1")
+			putAll(t, k1, "20250101000000/base.tar")
+
+			keys := map[string]string{"k1": "one", "k2": "two"}
+			k2 := newKeyringStorage(t, backend, "legacy", keys, "k2")
+			putAll(t, k2, "000000010000000000000002")
+			require.NoError(t, backend.Put(ctx, "000000010000000000000003.zst.aes.rekey", strings.NewReader("partial")))
+
+			res, err := k2.Rekey(ctx, RekeyOpts{Parallel: 2})
+			require.NoError(t, err)
+			assert.Equal(t, RekeyResult{Rekeyed: 2, Current: 1, Cleaned: 1}, res)
+
+			// readable without the legacy pass and the retired key
+			onlyK2 := newKeyringStorage(t, backend, "", map[string]string{"k2": "two"}, "k2")
+			for _, p := range []string{"000000010000000000000001", "000000010000000000000002", "20250101000000/base.tar"} {
+				assert.Equal(t, p, readAll(t, onlyK2, p))
+			}
+
+			exists, err := backend.Exists(ctx, "000000010000000000000003.zst.aes.rekey")
+			require.NoError(t, err)
+			assert.False(t, exists)
+
+			// a second run has nothing to do
+			res, err = k2.Rekey(ctx, RekeyOpts{})
+			require.NoError(t, err)
+			assert.Equal(t, RekeyResult{Current: 3}, res)
+		})
+	}
+}
+
+func TestRekey_DryRun(t *testing.T) {
+	ctx := context.Background()
+	mem := NewInMemoryStorage()
+
+	putAll(t, newKeyringStorage(t, mem, "legacy", nil, ""), "000000010000000000000001")
+	before := string(mem.Files["000000010000000000000001.zst.aes"])
+
+	vs := newKeyringStorage(t, mem, "legacy", map[string]string{"k1": "one"}, "k1")
+	res, err := vs.Rekey(ctx, RekeyOpts{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Rekeyed)
+	assert.Equal(t, before, string(mem.Files["000000010000000000000001.zst.aes"]))
+}
+
+func TestRekey_RequiresKeyring(t *testing.T) {
+	vs := newKeyringStorage(t, NewInMemoryStorage(), "legacy", nil, "")
+	_, err := vs.Rekey(context.Background(), RekeyOpts{})
+	require.Error(t, err)
+}
+
+func TestRekey_TempObjectsAreNotListed(t *testing.T) {
+	ctx := context.Background()
+	mem := NewInMemoryStorage()
+	vs := newKeyringStorage(t, mem, "legacy", map[string]string{"k1": "one"}, "k1")
+	putAll(t, vs, "000000010000000000000001")
+	require.NoError(t, mem.Put(ctx, "000000010000000000000001.zst.aes.rekey", strings.NewReader("partial")))
+
+	files, err := vs.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "000000010000000000000001", files[0].Path)
+
+	var raw []string
+	for fi, err := range vs.IterateRaw(ctx, "", IterateOpts{}) {
+		require.NoError(t, err)
+		raw = append(raw, fi.Path)
+	}
+	assert.Equal(t, []string{"000000010000000000000001.zst.aes"}, raw)
+}
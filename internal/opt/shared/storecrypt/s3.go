@@ -1,10 +1,13 @@
 package storecrypt
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"iter"
 	"log/slog"
 	"strings"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 const (
@@ -45,7 +49,10 @@ type s3Storage struct {
 	log            *slog.Logger
 }
 
-var _ Storage = &s3Storage{}
+var (
+	_ Storage            = &s3Storage{}
+	_ ConditionalStorage = &s3Storage{}
+)
 
 func NewS3Storage(client *s3.Client, bucket, prefix string) Storage {
 	return NewS3StorageWithOptions(client, bucket, prefix, S3Options{})
@@ -145,29 +152,45 @@ func (s *s3Storage) Get(ctx context.Context, remotePath string) (io.ReadCloser,
 }
 
 func (s *s3Storage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
-	fullPath := s3DirPrefix(s.fullPath(remotePath))
-	var objects []FileInfo
+	return collectFileInfos(s.Iterate(ctx, remotePath, IterateOpts{}))
+}
 
-	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(fullPath),
-	})
+// Iterate pages through ListObjectsV2, prefix and start-after are applied
+// server side, so only the requested part of the bucket is transferred.
+func (s *s3Storage) Iterate(ctx context.Context, remotePath string, opts IterateOpts) iter.Seq2[FileInfo, error] {
+	return func(yield func(FileInfo, error) bool) {
+		f := newIterFilter(remotePath, opts)
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get page: %w", err)
+		input := &s3.ListObjectsV2Input{
+			Bucket: aws.String(s.bucket),
+			Prefix: aws.String(s3DirPrefix(s.fullPath(remotePath)) + opts.Prefix),
 		}
-		for _, obj := range page.Contents {
-			objects = append(objects, FileInfo{
-				Path:    s.relativeKey(aws.ToString(obj.Key)),
-				ModTime: aws.ToTime(obj.LastModified),
-				Size:    aws.ToInt64(obj.Size),
-			})
+		if opts.StartAfter != "" {
+			input.StartAfter = aws.String(s.fullPath(opts.StartAfter))
 		}
-	}
 
-	return objects, nil
+		paginator := s3.NewListObjectsV2Paginator(s.client, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				yield(FileInfo{}, fmt.Errorf("failed to get page: %w", err))
+				return
+			}
+			for _, obj := range page.Contents {
+				fi := FileInfo{
+					Path:    s.relativeKey(aws.ToString(obj.Key)),
+					ModTime: aws.ToTime(obj.LastModified),
+					Size:    aws.ToInt64(obj.Size),
+				}
+				if !f.match(fi.Path) {
+					continue
+				}
+				if !yield(fi, nil) {
+					return
+				}
+			}
+		}
+	}
 }
 
 func (s *s3Storage) Delete(ctx context.Context, remotePath string) error {
@@ -321,3 +344,57 @@ func (s *s3Storage) Rename(ctx context.Context, oldRemotePath, newRemotePath str
 
 	return nil
 }
+
+// GetVersioned uses the object ETag as the version.
+func (s *s3Storage) GetVersioned(ctx context.Context, remotePath string) ([]byte, string, error) {
+	fullPath := s.fullPath(remotePath)
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(fullPath),
+	})
+	if err != nil {
+		var nsk *s3types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, "", fs.ErrNotExist
+		}
+		return nil, "", fmt.Errorf("failed to read object from S3: %w", err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read object from S3: %w", err)
+	}
+	return data, aws.ToString(out.ETag), nil
+}
+
+// PutIf relies on S3 conditional writes (If-None-Match / If-Match).
+func (s *s3Storage) PutIf(ctx context.Context, remotePath string, data []byte, version string) (string, error) {
+	fullPath := s.fullPath(remotePath)
+
+	in := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(fullPath),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	}
+	if version == "" {
+		in.IfNoneMatch = aws.String("*")
+	} else {
+		in.IfMatch = aws.String(version)
+	}
+
+	out, err := s.client.PutObject(ctx, in)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "PreconditionFailed", "ConditionalRequestConflict", "NoSuchKey":
+				return "", ErrPreconditionFailed
+			}
+		}
+		return "", fmt.Errorf("s3 conditional put %q: %w", fullPath, err)
+	}
+	return aws.ToString(out.ETag), nil
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -164,3 +165,83 @@ func (s *s3Storage) putMultipartStream(ctx context.Context, remotePath string, r
 
 	return nil
 }
+
+var _ UploadStorage = &s3Storage{}
+
+// AbortUploads aborts the multipart uploads under remotePath initiated before
+// the given time. The size of an upload is that of its uploaded parts.
+func (s *s3Storage) AbortUploads(ctx context.Context, remotePath string, before time.Time) ([]Upload, error) {
+	prefix := s.fullPath(remotePath)
+	if prefix != "" && !endsWithSlash(prefix) {
+		prefix += "/"
+	}
+
+	paginator := s3.NewListMultipartUploadsPaginator(s.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var aborted []Upload
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return aborted, fmt.Errorf("list multipart uploads: %w", err)
+		}
+
+		for _, mu := range page.Uploads {
+			initiated := aws.ToTime(mu.Initiated)
+			if !initiated.Before(before) {
+				continue
+			}
+			key := aws.ToString(mu.Key)
+			uploadID := aws.ToString(mu.UploadId)
+
+			size, err := s.uploadedSize(ctx, key, uploadID)
+			if err != nil {
+				return aborted, err
+			}
+			_, err = s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.bucket),
+				Key:      aws.String(key),
+				UploadId: aws.String(uploadID),
+			})
+			if err != nil {
+				return aborted, fmt.Errorf("abort multipart upload %q: %w", key, err)
+			}
+
+			s.logf().Info("multipart upload aborted",
+				slog.String("s3_key", key),
+				slog.String("upload_id", uploadID),
+				slog.Time("initiated", initiated),
+			)
+			aborted = append(aborted, Upload{
+				Path:      s.relativeKey(key),
+				Initiated: initiated,
+				Size:      size,
+			})
+		}
+	}
+
+	return aborted, nil
+}
+
+// uploadedSize returns the size of the parts of a multipart upload.
+func (s *s3Storage) uploadedSize(ctx context.Context, key, uploadID string) (int64, error) {
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	var size int64
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("list parts of %q: %w", key, err)
+		}
+		for _, part := range page.Parts {
+			size += aws.ToInt64(part.Size)
+		}
+	}
+	return size, nil
+}
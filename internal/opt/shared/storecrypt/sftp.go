@@ -2,8 +2,11 @@ package storecrypt
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
@@ -12,16 +15,49 @@ import (
 	"github.com/pkg/sftp"
 )
 
+// sftpConn hands out SFTP sessions to sftpStorage and takes back the ones
+// that turned out to be broken.
+type sftpConn interface {
+	Client(ctx context.Context) (*sftp.Client, error)
+	Invalidate(c *sftp.Client)
+}
+
+// staticSFTPConn wraps a single session that is never replaced.
+type staticSFTPConn struct {
+	client *sftp.Client
+}
+
+func (c staticSFTPConn) Client(_ context.Context) (*sftp.Client, error) {
+	return c.client, nil
+}
+
+func (c staticSFTPConn) Invalidate(_ *sftp.Client) {}
+
 type sftpStorage struct {
-	client  *sftp.Client
+	conn    sftpConn
 	baseDir string
 }
 
-var _ Storage = &sftpStorage{}
+var (
+	_ Storage            = &sftpStorage{}
+	_ ConditionalStorage = &sftpStorage{}
+)
 
+// NewSFTPStorage creates a storage on top of a single SFTP session.
+// Use NewSFTPStorageWithClient to reconnect automatically when the session is lost.
 func NewSFTPStorage(client *sftp.Client, remoteDir string) Storage {
+	return newSFTPStorage(staticSFTPConn{client: client}, remoteDir)
+}
+
+// NewSFTPStorageWithClient creates a storage that takes a fresh session
+// from client after a connection loss.
+func NewSFTPStorageWithClient(client *SFTPClient, remoteDir string) Storage {
+	return newSFTPStorage(client, remoteDir)
+}
+
+func newSFTPStorage(conn sftpConn, remoteDir string) *sftpStorage {
 	return &sftpStorage{
-		client:  client,
+		conn:    conn,
 		baseDir: strings.TrimSuffix(remoteDir, "/"),
 	}
 }
@@ -30,129 +66,348 @@ func (s *sftpStorage) fullPath(p string) string {
 	return filepath.ToSlash(filepath.Join(s.baseDir, filepath.Clean(p)))
 }
 
-func (s *sftpStorage) Put(_ context.Context, remotePath string, r io.Reader) error {
+func (s *sftpStorage) Put(ctx context.Context, remotePath string, r io.Reader) error {
 	fullPath := s.fullPath(remotePath)
 
-	// Ensure directory exists
-	dir := path.Dir(fullPath)
-	if err := s.client.MkdirAll(dir); err != nil {
-		return fmt.Errorf("mkdir: %w", err)
-	}
+	// The reader is consumed by the first attempt, so Put is never retried.
+	// A lost connection is still invalidated, so the next Put reconnects.
+	return sftpExec(ctx, s, false, func(c *sftp.Client) error {
+		// Ensure directory exists
+		dir := path.Dir(fullPath)
+		if err := c.MkdirAll(dir); err != nil {
+			return fmt.Errorf("mkdir: %w", err)
+		}
 
-	// Open file for writing
-	f, err := s.client.Create(fullPath)
-	if err != nil {
-		return fmt.Errorf("sftp create: %w", err)
-	}
-	defer f.Close()
+		// Open file for writing
+		f, err := c.Create(fullPath)
+		if err != nil {
+			return fmt.Errorf("sftp create: %w", err)
+		}
 
-	_, err = io.Copy(f, r)
-	return err
+		// Closing the file unblocks a write that hangs on a dead connection
+		stop := context.AfterFunc(ctx, func() {
+			_ = f.Close()
+		})
+		defer stop()
+
+		if _, err := io.Copy(f, &ctxReader{ctx: ctx, r: r}); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
 }
 
-func (s *sftpStorage) Get(_ context.Context, remotePath string) (io.ReadCloser, error) {
+func (s *sftpStorage) Get(ctx context.Context, remotePath string) (io.ReadCloser, error) {
 	fullPath := s.fullPath(remotePath)
-	f, err := s.client.Open(fullPath)
+	f, err := sftpDo(ctx, s, true, func(c *sftp.Client) (*sftp.File, error) {
+		f, err := c.Open(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("sftp open: %w", err)
+		}
+		return f, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("sftp open: %w", err)
+		return nil, err
 	}
-	return f, nil
+	return newCtxReadCloser(ctx, f), nil
 }
 
-func (s *sftpStorage) List(_ context.Context, remotePath string) ([]FileInfo, error) {
-	fullPath := s.fullPath(remotePath)
-	var result []FileInfo
+func (s *sftpStorage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
+	return collectFileInfos(s.Iterate(ctx, remotePath, IterateOpts{}))
+}
 
-	walker := s.client.Walk(fullPath)
-	for walker.Step() {
-		if err := walker.Err(); err != nil {
-			if os.IsNotExist(err) || strings.Contains(err.Error(), "file does not exist") {
-				return nil, nil
-			}
+// Iterate reads one directory at a time, each read is retried on a fresh
+// session when the connection is lost, so a long listing survives reconnects.
+func (s *sftpStorage) Iterate(ctx context.Context, remotePath string, opts IterateOpts) iter.Seq2[FileInfo, error] {
+	return iterateTree(ctx, s.baseDir, remotePath, opts, func(dir string) ([]os.FileInfo, error) {
+		entries, err := sftpDo(ctx, s, true, func(c *sftp.Client) ([]os.FileInfo, error) {
+			return c.ReadDir(dir)
+		})
+		if err != nil {
 			return nil, fmt.Errorf("error walking directory: %w", err)
 		}
-		stat := walker.Stat()
-		if stat == nil {
-			continue
+		return entries, nil
+	})
+}
+
+func (s *sftpStorage) Delete(ctx context.Context, remotePath string) error {
+	return sftpExec(ctx, s, true, func(c *sftp.Client) error {
+		return c.Remove(s.fullPath(remotePath))
+	})
+}
+
+func (s *sftpStorage) DeleteDir(ctx context.Context, remotePath string) error {
+	return sftpExec(ctx, s, true, func(c *sftp.Client) error {
+		return c.RemoveAll(s.fullPath(remotePath))
+	})
+}
+
+func (s *sftpStorage) Exists(ctx context.Context, remotePath string) (bool, error) {
+	fullPath := s.fullPath(remotePath)
+
+	return sftpDo(ctx, s, true, func(c *sftp.Client) (bool, error) {
+		info, err := c.Stat(fullPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
 		}
-		if stat.IsDir() {
-			continue
+		return info.Mode().IsRegular(), nil
+	})
+}
+
+func (s *sftpStorage) ListTopLevelDirs(ctx context.Context, prefix string) (map[string]bool, error) {
+	fullPath := s.fullPath(prefix)
+
+	return sftpDo(ctx, s, true, func(c *sftp.Client) (map[string]bool, error) {
+		result := make(map[string]bool)
+
+		entries, err := c.ReadDir(fullPath)
+		if err != nil {
+			return nil, err
 		}
-		if walker.Path() != fullPath {
-			rel, err := filepath.Rel(s.baseDir, walker.Path())
-			if err != nil {
-				return nil, err
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirFullPath := filepath.ToSlash(filepath.Join(fullPath, entry.Name()))
+				rel, err := filepath.Rel(s.baseDir, dirFullPath)
+				if err != nil {
+					return nil, err
+				}
+				result[filepath.ToSlash(rel)] = true
 			}
-			result = append(result, FileInfo{
-				Path:    rel,
-				ModTime: stat.ModTime(),
-				Size:    stat.Size(),
-			})
 		}
+		return result, nil
+	})
+}
+
+func (s *sftpStorage) Rename(ctx context.Context, oldRemotePath, newRemotePath string) error {
+	oldFull := s.fullPath(oldRemotePath)
+	newFull := s.fullPath(newRemotePath)
+
+	if oldFull == newFull {
+		return nil
 	}
 
-	return result, nil
-}
+	return sftpExec(ctx, s, true, func(c *sftp.Client) error {
+		// Ensure destination directory exists
+		dir := path.Dir(newFull)
+		if err := c.MkdirAll(dir); err != nil {
+			return fmt.Errorf("mkdir dest dir %q: %w", dir, err)
+		}
 
-func (s *sftpStorage) Delete(_ context.Context, remotePath string) error {
-	return s.client.Remove(s.fullPath(remotePath))
-}
+		// posix-rename replaces an existing target, plain rename does not,
+		// fall back to it for servers without the extension
+		if err := c.PosixRename(oldFull, newFull); err == nil {
+			return nil
+		}
+		if err := c.Rename(oldFull, newFull); err != nil {
+			return fmt.Errorf("sftp rename %q -> %q: %w", oldFull, newFull, err)
+		}
 
-func (s *sftpStorage) DeleteDir(_ context.Context, remotePath string) error {
-	return s.client.RemoveAll(s.fullPath(remotePath))
+		return nil
+	})
 }
 
-func (s *sftpStorage) Exists(_ context.Context, remotePath string) (bool, error) {
+func (s *sftpStorage) GetVersioned(ctx context.Context, remotePath string) ([]byte, string, error) {
 	fullPath := s.fullPath(remotePath)
-	info, err := s.client.Stat(fullPath)
+
+	data, err := sftpDo(ctx, s, true, func(c *sftp.Client) ([]byte, error) {
+		return readSFTPFile(c, fullPath)
+	})
 	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
+		return nil, "", err
 	}
-	return info.Mode().IsRegular(), nil
+	return data, contentVersion(data), nil
 }
 
-func (s *sftpStorage) ListTopLevelDirs(_ context.Context, prefix string) (map[string]bool, error) {
-	fullPath := s.fullPath(prefix)
-	result := make(map[string]bool)
+func (s *sftpStorage) PutIf(ctx context.Context, remotePath string, data []byte, version string) (string, error) {
+	fullPath := s.fullPath(remotePath)
+
+	err := sftpExec(ctx, s, false, func(c *sftp.Client) error {
+		if err := c.MkdirAll(path.Dir(fullPath)); err != nil {
+			return fmt.Errorf("mkdir: %w", err)
+		}
+
+		if version == "" {
+			err := writeSFTPFile(c, fullPath, os.O_EXCL, data)
+			if err != nil && !isSFTPConnLost(err) {
+				// SFTP reports a failed exclusive create as a generic failure
+				if _, statErr := c.Stat(fullPath); statErr == nil {
+					return ErrPreconditionFailed
+				}
+			}
+			return err
+		}
+
+		cur, err := readSFTPFile(c, fullPath)
+		if err != nil {
+			if isNotExist(err) {
+				return ErrPreconditionFailed
+			}
+			return err
+		}
+		if contentVersion(cur) != version {
+			return ErrPreconditionFailed
+		}
+
+		// replace atomically, so readers never see a partial object
+		tmp := fullPath + ".tmp"
+		if err := writeSFTPFile(c, tmp, os.O_TRUNC, data); err != nil {
+			return err
+		}
+		if err := c.PosixRename(tmp, fullPath); err != nil {
+			return fmt.Errorf("sftp rename %q -> %q: %w", tmp, fullPath, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return contentVersion(data), nil
+}
 
-	entries, err := s.client.ReadDir(fullPath)
+func readSFTPFile(c *sftp.Client, fullPath string) ([]byte, error) {
+	f, err := c.Open(fullPath)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			dirFullPath := filepath.ToSlash(filepath.Join(fullPath, entry.Name()))
-			rel, err := filepath.Rel(s.baseDir, dirFullPath)
-			if err != nil {
-				return nil, err
-			}
-			result[filepath.ToSlash(rel)] = true
+func writeSFTPFile(c *sftp.Client, fullPath string, flag int, data []byte) error {
+	f, err := c.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|flag)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sftpDo runs op against the current session.
+//
+// pkg/sftp calls are not bound to a context, so op runs in its own goroutine
+// and sftpDo returns as soon as ctx is done. When op fails because the
+// connection was lost, the session is invalidated and, if retry is set,
+// op runs once more against a fresh session.
+func sftpDo[T any](ctx context.Context, s *sftpStorage, retry bool, op func(c *sftp.Client) (T, error)) (T, error) {
+	var zero T
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+
+		c, err := s.conn.Client(ctx)
+		if err != nil {
+			return zero, err
+		}
+
+		v, err := runWithContext(ctx, func() (T, error) {
+			return op(c)
+		})
+		if err == nil || !isSFTPConnLost(err) {
+			return v, err
+		}
+
+		s.conn.Invalidate(c)
+		if !retry || attempt > 1 {
+			return zero, err
 		}
 	}
-	return result, nil
 }
 
-func (s *sftpStorage) Rename(_ context.Context, oldRemotePath, newRemotePath string) error {
-	oldFull := s.fullPath(oldRemotePath)
-	newFull := s.fullPath(newRemotePath)
+// sftpExec is sftpDo for operations without a result.
+func sftpExec(ctx context.Context, s *sftpStorage, retry bool, op func(c *sftp.Client) error) error {
+	_, err := sftpDo(ctx, s, retry, func(c *sftp.Client) (struct{}, error) {
+		return struct{}{}, op(c)
+	})
+	return err
+}
 
-	if oldFull == newFull {
-		return nil
+// runWithContext returns the result of op, or ctx.Err() if ctx is done first.
+// A result that arrives after cancellation is released if it is an io.Closer.
+func runWithContext[T any](ctx context.Context, op func() (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		v, err := op()
+		ch <- result{v: v, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		go func() {
+			r := <-ch
+			if c, ok := any(r.v).(io.Closer); ok && r.err == nil {
+				_ = c.Close()
+			}
+		}()
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func isSFTPConnLost(err error) bool {
+	if err == nil {
+		return false
 	}
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// ctxReader stops reading from r once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
 
-	// Ensure destination directory exists
-	dir := path.Dir(newFull)
-	if err := s.client.MkdirAll(dir); err != nil {
-		return fmt.Errorf("mkdir dest dir %q: %w", dir, err)
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
 	}
+	return c.r.Read(p)
+}
+
+// ctxReadCloser closes the underlying file when ctx is done, so a read
+// blocked on a dead connection returns.
+type ctxReadCloser struct {
+	ctxReader
+	c    io.Closer
+	stop func() bool
+}
 
-	if err := s.client.Rename(oldFull, newFull); err != nil {
-		return fmt.Errorf("sftp rename %q -> %q: %w", oldFull, newFull, err)
+func newCtxReadCloser(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	return &ctxReadCloser{
+		ctxReader: ctxReader{ctx: ctx, r: rc},
+		c:         rc,
+		stop: context.AfterFunc(ctx, func() {
+			_ = rc.Close()
+		}),
 	}
+}
 
-	return nil
+func (c *ctxReadCloser) Close() error {
+	if !c.stop() {
+		// already closed by the ctx callback
+		return nil
+	}
+	return c.c.Close()
 }
@@ -0,0 +1,204 @@
+package storecrypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeSFTPConn serves each session from an in-process SFTP server over pipes.
+type pipeSFTPConn struct {
+	t *testing.T
+
+	mu          sync.Mutex
+	cur         *sftp.Client
+	srv         *sftp.Server
+	dials       int
+	invalidated int
+}
+
+func (p *pipeSFTPConn) Client(_ context.Context) (*sftp.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cur != nil {
+		return p.cur, nil
+	}
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	srv, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw})
+	require.NoError(p.t, err)
+	go func() {
+		_ = srv.Serve()
+	}()
+
+	c, err := sftp.NewClientPipe(cr, cw)
+	require.NoError(p.t, err)
+
+	// The client waits for its receive loop on Close, so the server goes first.
+	p.t.Cleanup(func() {
+		_ = srv.Close()
+		_ = c.Close()
+	})
+
+	p.cur = c
+	p.srv = srv
+	p.dials++
+	return c, nil
+}
+
+func (p *pipeSFTPConn) Invalidate(c *sftp.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cur != c {
+		return
+	}
+	_ = p.srv.Close()
+	_ = p.cur.Close()
+	p.cur = nil
+	p.invalidated++
+}
+
+// dropServer kills the server side of the current session.
+func (p *pipeSFTPConn) dropServer() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.srv.Close()
+}
+
+func newPipeSFTPStorage(t *testing.T) (*sftpStorage, *pipeSFTPConn) {
+	t.Helper()
+	conn := &pipeSFTPConn{t: t}
+	return newSFTPStorage(conn, filepath.ToSlash(t.TempDir())), conn
+}
+
+func TestSFTPStorage_PutGetListExists(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newPipeSFTPStorage(t)
+
+	require.NoError(t, s.Put(ctx, "dir/a.txt", strings.NewReader("hello")))
+	require.NoError(t, s.Put(ctx, "dir/sub/b.txt", strings.NewReader("world")))
+
+	rc, err := s.Get(ctx, "dir/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "hello", string(data))
+
+	ok, err := s.Exists(ctx, "dir/a.txt")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.Exists(ctx, "dir/missing.txt")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	files, err := s.List(ctx, "dir")
+	require.NoError(t, err)
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, filepath.ToSlash(f.Path))
+	}
+	assert.ElementsMatch(t, []string{"dir/a.txt", "dir/sub/b.txt"}, paths)
+
+	dirs, err := s.ListTopLevelDirs(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"dir/sub": true}, dirs)
+}
+
+func TestSFTPStorage_ReconnectsAfterConnectionLoss(t *testing.T) {
+	ctx := context.Background()
+	s, conn := newPipeSFTPStorage(t)
+
+	require.NoError(t, s.Put(ctx, "a.txt", strings.NewReader("data")))
+	assert.Equal(t, 1, conn.dials)
+
+	conn.dropServer()
+
+	// Idempotent operations are retried once on a fresh session.
+	ok, err := s.Exists(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, conn.dials)
+	assert.Equal(t, 1, conn.invalidated)
+
+	// Put is not retried, but the next one runs on a fresh session.
+	conn.dropServer()
+	err = s.Put(ctx, "b.txt", strings.NewReader("data"))
+	require.Error(t, err)
+	assert.Equal(t, 2, conn.invalidated)
+
+	require.NoError(t, s.Put(ctx, "b.txt", strings.NewReader("data")))
+	assert.Equal(t, 3, conn.dials)
+}
+
+func TestSFTPStorage_CanceledContext(t *testing.T) {
+	s, conn := newPipeSFTPStorage(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.Put(ctx, "a.txt", strings.NewReader("data"))
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.Exists(ctx, "a.txt")
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, conn.dials)
+}
+
+func TestSFTPStorage_CancelUnblocksPut(t *testing.T) {
+	s, _ := newPipeSFTPStorage(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Put(ctx, "a.txt", pr)
+	}()
+
+	_, err := pw.Write(bytes.Repeat([]byte("x"), 1024))
+	require.NoError(t, err)
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put did not return after context cancellation")
+	}
+}
+
+func TestSFTPStorage_GetReaderStopsOnCancel(t *testing.T) {
+	s, _ := newPipeSFTPStorage(t)
+	require.NoError(t, s.Put(context.Background(), "a.txt", strings.NewReader("data")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rc, err := s.Get(ctx, "a.txt")
+	require.NoError(t, err)
+
+	cancel()
+
+	_, err = rc.Read(make([]byte, 4))
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, rc.Close())
+}
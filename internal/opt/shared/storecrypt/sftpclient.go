@@ -1,14 +1,29 @@
 package storecrypt
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+const (
+	DefaultSFTPDialTimeout       = 5 * time.Second
+	DefaultSFTPKeepaliveInterval = 30 * time.Second
+)
+
+var ErrSFTPClientClosed = errors.New("sftp client is closed")
+
 type SFTPConfig struct {
 	// Required
 	Host     string
@@ -18,13 +33,35 @@ type SFTPConfig struct {
 
 	// Optional, it private key is created with a passphrase
 	Passphrase string
+
+	// Optional host key verification. KnownHostsPath is an OpenSSH known_hosts
+	// file, HostKeyFingerprint is a pinned key in 'ssh-keygen -l' format
+	// (SHA256:...). When both are set, both must match. When none is set,
+	// the host key is not verified.
+	KnownHostsPath     string
+	HostKeyFingerprint string
+
+	// Optional, DefaultSFTPKeepaliveInterval is used when zero
+	KeepaliveInterval time.Duration
+
+	// Optional, DefaultSFTPDialTimeout is used when zero
+	DialTimeout time.Duration
 }
 
+// SFTPClient holds an SSH connection with an SFTP session on top of it.
+//
+// The connection is re-established lazily: when it is lost (detected by a
+// failed keepalive, by the SSH transport closing, or reported by a storage
+// operation via Invalidate), the next Client call dials a new one.
 type SFTPClient struct {
+	l         *slog.Logger
+	config    *SFTPConfig
+	sshConfig *ssh.ClientConfig
+
+	mu         sync.Mutex
 	sshClient  *ssh.Client
 	sftpClient *sftp.Client
-
-	config *SFTPConfig
+	closed     bool
 }
 
 // NewSFTPClient creates an SFTP client using passphrase-protected private key authentication
@@ -51,42 +88,99 @@ func NewSFTPClient(sftpConfig *SFTPConfig) (*SFTPClient, error) {
 		}
 	}
 
+	loggr := slog.With(
+		slog.String("component", "sftp-client"),
+		slog.String("host", sftpConfig.Host),
+	)
+
+	hostKeyCallback, err := newHostKeyCallback(sftpConfig)
+	if err != nil {
+		return nil, err
+	}
+	if sftpConfig.KnownHostsPath == "" && sftpConfig.HostKeyFingerprint == "" {
+		loggr.Warn("sftp host key is not verified, set storage.sftp.known_hosts or storage.sftp.host_key_fingerprint")
+	}
+
 	// Setup SSH configuration
 	sshConfig := &ssh.ClientConfig{
 		User: sftpConfig.User,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		//nolint:gosec
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         5 * time.Second,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout(sftpConfig),
 	}
 
-	// Establish the SSH connection
-	addr := fmt.Sprintf("%s:%s", sftpConfig.Host, sftpConfig.Port)
-	conn, err := ssh.Dial("tcp", addr, sshConfig)
-	if err != nil {
-		return nil, fmt.Errorf("unable to connect to SFTP server: %w", err)
+	c := &SFTPClient{
+		l:         loggr,
+		config:    sftpConfig,
+		sshConfig: sshConfig,
 	}
 
-	// Create an SFTP sftpClient over the SSH connection
-	client, err := sftp.NewClient(conn)
+	// Establish the first connection eagerly, so misconfiguration fails at startup
+	if _, err := c.Client(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Client returns the current SFTP session, reconnecting if the previous one was lost.
+func (s *SFTPClient) Client(ctx context.Context) (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrSFTPClientClosed
+	}
+	if s.sftpClient != nil {
+		return s.sftpClient, nil
+	}
+
+	sshClient, sftpClient, err := s.connect(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create SFTP sftpClient: %w", err)
+		return nil, err
 	}
 
-	return &SFTPClient{
-		sshClient:  conn,
-		sftpClient: client,
-		config:     sftpConfig,
-	}, nil
+	s.sshClient = sshClient
+	s.sftpClient = sftpClient
+
+	go s.keepalive(sshClient, sftpClient)
+
+	return sftpClient, nil
+}
+
+// Invalidate drops the given session if it is still the current one,
+// so that the next Client call reconnects.
+func (s *SFTPClient) Invalidate(c *sftp.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c == nil || s.sftpClient != c {
+		return
+	}
+
+	s.l.Warn("sftp connection lost, will reconnect on next operation")
+	_ = s.teardown()
 }
 
+// SFTPClient returns the current SFTP session, it may be nil if the connection was lost.
 func (s *SFTPClient) SFTPClient() *sftp.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.sftpClient
 }
 
 func (s *SFTPClient) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return s.teardown()
+}
+
+// teardown closes the current connection, s.mu must be held.
+func (s *SFTPClient) teardown() error {
 	var err error
 	if s.sftpClient != nil {
 		err = s.sftpClient.Close()
@@ -94,5 +188,153 @@ func (s *SFTPClient) Close() error {
 	if s.sshClient != nil {
 		err = s.sshClient.Close()
 	}
+	s.sftpClient = nil
+	s.sshClient = nil
 	return err
 }
+
+func (s *SFTPClient) connect(ctx context.Context) (*ssh.Client, *sftp.Client, error) {
+	addr := net.JoinHostPort(s.config.Host, s.config.Port)
+	timeout := dialTimeout(s.config)
+
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to SFTP server: %w", err)
+	}
+
+	// ssh.NewClientConn does not know about ctx, bound the handshake with a deadline
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, s.sshConfig)
+	stop()
+	if err != nil {
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("unable to connect to SFTP server: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	sshClient := ssh.NewClient(c, chans, reqs)
+
+	// Create an SFTP sftpClient over the SSH connection
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, nil, fmt.Errorf("unable to create SFTP sftpClient: %w", err)
+	}
+
+	s.l.Debug("sftp connection established", slog.String("addr", addr))
+	return sshClient, sftpClient, nil
+}
+
+// keepalive pings the server until the SSH transport is closed. A ping that
+// fails or does not return within the interval closes the connection.
+func (s *SFTPClient) keepalive(sshClient *ssh.Client, sftpClient *sftp.Client) {
+	interval := s.config.KeepaliveInterval
+	if interval <= 0 {
+		interval = DefaultSFTPKeepaliveInterval
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = sshClient.Wait()
+		close(done)
+		s.Invalidate(sftpClient)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := sshClient.SendRequest("keepalive@openssh.com", true, nil)
+			errCh <- err
+		}()
+
+		var err error
+		select {
+		case <-done:
+			return
+		case err = <-errCh:
+		case <-time.After(interval):
+			err = fmt.Errorf("no keepalive reply within %s", interval)
+		}
+
+		if err != nil {
+			s.l.Warn("sftp keepalive failed, closing connection", slog.Any("err", err))
+			_ = sshClient.Close()
+			return
+		}
+	}
+}
+
+func dialTimeout(cfg *SFTPConfig) time.Duration {
+	if cfg.DialTimeout > 0 {
+		return cfg.DialTimeout
+	}
+	return DefaultSFTPDialTimeout
+}
+
+// newHostKeyCallback builds the host key verification from known_hosts and/or
+// a pinned fingerprint.
+func newHostKeyCallback(cfg *SFTPConfig) (ssh.HostKeyCallback, error) {
+	var callbacks []ssh.HostKeyCallback
+
+	if cfg.KnownHostsPath != "" {
+		cb, err := knownhosts.New(cfg.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read known_hosts: %w", err)
+		}
+		callbacks = append(callbacks, cb)
+	}
+
+	if cfg.HostKeyFingerprint != "" {
+		want, err := normalizeFingerprint(cfg.HostKeyFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		callbacks = append(callbacks, func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			got := ssh.FingerprintSHA256(key)
+			if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+				return fmt.Errorf("host key fingerprint mismatch for %s: got %s, want %s", hostname, got, want)
+			}
+			return nil
+		})
+	}
+
+	if len(callbacks) == 0 {
+		//nolint:gosec
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, cb := range callbacks {
+			if err := cb(hostname, remote, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// normalizeFingerprint accepts the SHA256:<base64> form printed by
+// 'ssh-keygen -l', with or without the base64 padding.
+func normalizeFingerprint(fp string) (string, error) {
+	fp = strings.TrimSpace(fp)
+	if !strings.HasPrefix(fp, "SHA256:") {
+		return "", fmt.Errorf("host key fingerprint must be in SHA256:<base64> format")
+	}
+	return strings.TrimRight(fp, "="), nil
+}
@@ -0,0 +1,121 @@
+package storecrypt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return key
+}
+
+func TestHostKeyCallback_NoneConfiguredAcceptsAnyKey(t *testing.T) {
+	cb, err := newHostKeyCallback(&SFTPConfig{})
+	require.NoError(t, err)
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	assert.NoError(t, cb("127.0.0.1:22", addr, newTestHostKey(t)))
+}
+
+func TestHostKeyCallback_Fingerprint(t *testing.T) {
+	key := newTestHostKey(t)
+	other := newTestHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+	}{
+		{"with-prefix", ssh.FingerprintSHA256(key)},
+		{"with-padding", ssh.FingerprintSHA256(key) + "="},
+		{"with-spaces", " " + ssh.FingerprintSHA256(key) + " "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, err := newHostKeyCallback(&SFTPConfig{HostKeyFingerprint: tt.fingerprint})
+			require.NoError(t, err)
+
+			assert.NoError(t, cb("127.0.0.1:22", addr, key))
+			assert.ErrorContains(t, cb("127.0.0.1:22", addr, other), "host key fingerprint mismatch")
+		})
+	}
+}
+
+func TestHostKeyCallback_FingerprintWithoutPrefix(t *testing.T) {
+	key := newTestHostKey(t)
+
+	_, err := newHostKeyCallback(&SFTPConfig{
+		HostKeyFingerprint: strings.TrimPrefix(ssh.FingerprintSHA256(key), "SHA256:"),
+	})
+	assert.ErrorContains(t, err, "SHA256:<base64>")
+}
+
+func TestHostKeyCallback_KnownHosts(t *testing.T) {
+	key := newTestHostKey(t)
+	other := newTestHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2323}
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("127.0.0.1:2323")}, key)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0o600))
+
+	cb, err := newHostKeyCallback(&SFTPConfig{KnownHostsPath: path})
+	require.NoError(t, err)
+
+	assert.NoError(t, cb("127.0.0.1:2323", addr, key))
+	assert.Error(t, cb("127.0.0.1:2323", addr, other))
+
+	// unknown host
+	unknown := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	assert.Error(t, cb("10.0.0.1:22", unknown, key))
+}
+
+func TestHostKeyCallback_KnownHostsAndFingerprintMustBothMatch(t *testing.T) {
+	key := newTestHostKey(t)
+	other := newTestHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("127.0.0.1:22")}, key)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0o600))
+
+	cb, err := newHostKeyCallback(&SFTPConfig{
+		KnownHostsPath:     path,
+		HostKeyFingerprint: ssh.FingerprintSHA256(other),
+	})
+	require.NoError(t, err)
+
+	assert.Error(t, cb("127.0.0.1:22", addr, key))
+}
+
+func TestHostKeyCallback_MissingKnownHostsFile(t *testing.T) {
+	_, err := newHostKeyCallback(&SFTPConfig{
+		KnownHostsPath: filepath.Join(t.TempDir(), "missing"),
+	})
+	assert.ErrorContains(t, err, "unable to read known_hosts")
+}
+
+func TestIsSFTPConnLost(t *testing.T) {
+	assert.False(t, isSFTPConnLost(nil))
+	assert.False(t, isSFTPConnLost(os.ErrNotExist))
+	assert.True(t, isSFTPConnLost(sftp.ErrSSHFxConnectionLost))
+	assert.True(t, isSFTPConnLost(net.ErrClosed))
+	assert.True(t, isSFTPConnLost(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}))
+}
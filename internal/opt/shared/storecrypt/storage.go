@@ -2,8 +2,14 @@ package storecrypt
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"iter"
 	"time"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/codec"
 )
 
 type FileInfo struct {
@@ -23,6 +29,11 @@ type Storage interface {
 	// List returns all file infos under the given directory.
 	List(ctx context.Context, remotePath string) ([]FileInfo, error)
 
+	// Iterate streams file infos under the given directory in lexical order
+	// of their paths, without loading the whole listing into memory.
+	// The sequence stops after the first error.
+	Iterate(ctx context.Context, remotePath string, opts IterateOpts) iter.Seq2[FileInfo, error]
+
 	// Delete removes the specified file.
 	Delete(ctx context.Context, remotePath string) error
 
@@ -39,3 +50,99 @@ type Storage interface {
 	// For S3 this is implemented as copy+delete (not recursive prefix rename).
 	Rename(ctx context.Context, oldRemotePath, newRemotePath string) error
 }
+
+// ErrPreconditionFailed is returned by a conditional write when the object
+// is not in the expected state.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ConditionalStorage is implemented by backends that can make a write of a
+// small object depend on its current state. It is used for coordination
+// objects such as the repository lease, which are stored without transforms.
+//
+// S3 and the in-memory storage check the condition atomically. Local and
+// SFTP storages create objects atomically, but replace them with a
+// compare-then-write, so concurrent replaces are only narrowed, not excluded.
+type ConditionalStorage interface {
+	// GetVersioned reads an object together with a version token that
+	// changes on every write. Returns fs.ErrNotExist for a missing object.
+	GetVersioned(ctx context.Context, remotePath string) ([]byte, string, error)
+
+	// PutIf writes the object if its current version is version, or if it
+	// does not exist when version is empty, and returns the new version.
+	// Returns ErrPreconditionFailed otherwise.
+	PutIf(ctx context.Context, remotePath string, data []byte, version string) (string, error)
+}
+
+// MetaStorage is implemented by storages that write metadata, which the
+// writer reads back itself, differently from content. See VariadicStorage.PutMeta.
+type MetaStorage interface {
+	PutMeta(ctx context.Context, remotePath string, r io.Reader) error
+}
+
+var _ MetaStorage = (*VariadicStorage)(nil)
+
+// PutMeta writes metadata with s.PutMeta when s is a MetaStorage, and with Put otherwise.
+func PutMeta(ctx context.Context, s Storage, remotePath string, r io.Reader) error {
+	if ms, ok := s.(MetaStorage); ok {
+		return ms.PutMeta(ctx, remotePath, r)
+	}
+	return s.Put(ctx, remotePath, r)
+}
+
+// CompressedStorage is implemented by storages that keep compressed data as
+// is. See VariadicStorage.PutCompressed.
+type CompressedStorage interface {
+	PutCompressed(ctx context.Context, remotePath, codecExt string, r io.Reader) error
+}
+
+var _ CompressedStorage = (*VariadicStorage)(nil)
+
+// PutCompressed writes data compressed with dec's codec. A CompressedStorage
+// stores it as is, other storages get it decompressed with Put.
+func PutCompressed(ctx context.Context, s Storage, remotePath string, dec codec.Decompressor, r io.Reader) error {
+	if cs, ok := s.(CompressedStorage); ok {
+		return cs.PutCompressed(ctx, remotePath, dec.FileExtension(), r)
+	}
+	rc, err := dec.Decompress(r)
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, remotePath, rc); err != nil {
+		_ = rc.Close()
+		return err
+	}
+	return rc.Close()
+}
+
+// Upload is an upload that was started but neither completed nor aborted.
+type Upload struct {
+	Path      string
+	Initiated time.Time
+	// Size is the size of the parts uploaded so far.
+	Size int64
+}
+
+// UploadStorage is implemented by backends that keep the data of an
+// interrupted upload until it is aborted, such as S3 multipart uploads.
+type UploadStorage interface {
+	// AbortUploads aborts the unfinished uploads under remotePath that were
+	// started before the given time, and returns them.
+	AbortUploads(ctx context.Context, remotePath string, before time.Time) ([]Upload, error)
+}
+
+var _ UploadStorage = (*VariadicStorage)(nil)
+
+// AbortUploads aborts the unfinished uploads of s when it is an
+// UploadStorage. Other storages leave nothing behind, nil is returned.
+func AbortUploads(ctx context.Context, s Storage, remotePath string, before time.Time) ([]Upload, error) {
+	if us, ok := s.(UploadStorage); ok {
+		return us.AbortUploads(ctx, remotePath, before)
+	}
+	return nil, nil
+}
+
+// contentVersion is the version token of backends without native versions.
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,204 @@
+package storecrypt
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WALLayout defines where WAL files are placed in the archive.
+type WALLayout string
+
+const (
+	// WALLayoutFlat keeps every WAL file in the archive root.
+	WALLayoutFlat WALLayout = "flat"
+
+	// WALLayoutSharded places WAL files under wal/<timeline>/<logid>/,
+	// and timeline history files under wal/<timeline>/.
+	WALLayoutSharded WALLayout = "sharded"
+
+	walShardRoot = "wal"
+)
+
+// shardedWALPath returns the sharded location of a WAL archive file name
+// (with or without transform extensions). ok is false for names that are
+// neither segments (including .partial and .backup files) nor timeline
+// history files.
+func shardedWALPath(name string) (string, bool) {
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+
+	if len(name) >= 24 && isHex(name[:24]) && (len(name) == 24 || name[24] == '.') {
+		timeline, logID := name[:8], name[8:16]
+		return path.Join(walShardRoot, timeline, logID, name), true
+	}
+
+	if len(name) > 8 && isHex(name[:8]) && strings.HasPrefix(name[8:], ".history") {
+		return path.Join(walShardRoot, name[:8], name), true
+	}
+
+	return "", false
+}
+
+func isHex(s string) bool {
+	for _, ch := range s {
+		isOk := (ch >= '0' && ch <= '9') ||
+			(ch >= 'A' && ch <= 'F') ||
+			(ch >= 'a' && ch <= 'f')
+		if !isOk {
+			return false
+		}
+	}
+	return true
+}
+
+// SetWALLayout sets the layout used for new WAL writes. Reads look into
+// both layouts, so the archive stays readable while it is being migrated.
+func (vs *VariadicStorage) SetWALLayout(layout WALLayout) {
+	vs.walLayout = layout
+}
+
+// WALLayout returns the layout used for new WAL writes.
+func (vs *VariadicStorage) WALLayout() WALLayout {
+	if vs.walLayout == "" {
+		return WALLayoutFlat
+	}
+	return vs.walLayout
+}
+
+// walWritePath maps a logical name to its location in the configured layout.
+func (vs *VariadicStorage) walWritePath(name string) string {
+	if vs.WALLayout() != WALLayoutSharded {
+		return name
+	}
+	if sharded, ok := shardedWALPath(name); ok {
+		return sharded
+	}
+	return name
+}
+
+// walLocations returns every location a name may be stored at.
+//
+// For WAL file names the location of the other layout comes first: a
+// migration copies into the configured layout before removing the source,
+// so a reader that misses the source is guaranteed to find the target.
+func (vs *VariadicStorage) walLocations(name string) []string {
+	sharded, ok := shardedWALPath(name)
+	if !ok {
+		return []string{name}
+	}
+	if vs.WALLayout() == WALLayoutSharded {
+		return []string{name, sharded}
+	}
+	return []string{sharded, name}
+}
+
+// IsWALPath reports whether a raw storage path (as yielded by IterateRaw)
+// is a file placed by either WAL layout: a root-level file, or a WAL file
+// at its sharded location.
+func (vs *VariadicStorage) IsWALPath(p string) bool {
+	p = filepath.ToSlash(strings.TrimSpace(p))
+	p = strings.TrimPrefix(p, "./")
+	if p == "" {
+		return false
+	}
+	if !strings.Contains(p, "/") {
+		return true
+	}
+	sharded, ok := shardedWALPath(path.Base(p))
+	return ok && sharded == p
+}
+
+// MigrateWALLayoutOpts configures VariadicStorage.MigrateWALLayout.
+type MigrateWALLayoutOpts struct {
+	// DryRun only reports what would be moved.
+	DryRun bool
+
+	Log *slog.Logger
+}
+
+// MigrateWALLayoutResult summarizes a layout migration.
+type MigrateWALLayoutResult struct {
+	Moved   int // files moved into the configured layout
+	Cleaned int // sources removed because the target was already in place
+	InPlace int // files already in the configured layout
+}
+
+// MigrateWALLayout moves WAL files stored in the other layout into the
+// configured one.
+//
+// It is safe to run while WAL files are being uploaded and read, and to run
+// again after an interruption: a file is first placed at its target and only
+// then removed from its source, and a source whose target already exists is
+// just removed.
+func (vs *VariadicStorage) MigrateWALLayout(ctx context.Context, opts MigrateWALLayoutOpts) (MigrateWALLayoutResult, error) {
+	var res MigrateWALLayoutResult
+
+	l := opts.Log
+	if l == nil {
+		l = slog.Default()
+	}
+	l = l.With(
+		slog.String("component", "wal-layout-migration"),
+		slog.String("layout", string(vs.WALLayout())),
+	)
+
+	for fi, err := range vs.Backend.Iterate(ctx, "", IterateOpts{}) {
+		if err != nil {
+			return res, fmt.Errorf("list WAL archive: %w", err)
+		}
+		if !vs.IsWALPath(fi.Path) {
+			continue
+		}
+
+		src := filepath.ToSlash(fi.Path)
+		if _, ok := shardedWALPath(path.Base(src)); !ok {
+			// a root-level file that is not a WAL file
+			continue
+		}
+
+		dst := vs.walWritePath(path.Base(src))
+		if dst == src {
+			res.InPlace++
+			continue
+		}
+
+		if opts.DryRun {
+			l.Info("would move WAL file", slog.String("from", src), slog.String("to", dst))
+			res.Moved++
+			continue
+		}
+
+		exists, err := vs.Backend.Exists(ctx, dst)
+		if err != nil {
+			return res, fmt.Errorf("check %s: %w", dst, err)
+		}
+		if exists {
+			// a previous run was interrupted after the copy
+			if err := vs.Backend.Delete(ctx, src); err != nil {
+				return res, fmt.Errorf("delete %s: %w", src, err)
+			}
+			l.Info("removed migrated WAL source", slog.String("from", src), slog.String("to", dst))
+			res.Cleaned++
+			continue
+		}
+
+		if err := vs.Backend.Rename(ctx, src, dst); err != nil {
+			return res, fmt.Errorf("move %s -> %s: %w", src, dst, err)
+		}
+		l.Debug("moved WAL file", slog.String("from", src), slog.String("to", dst))
+		res.Moved++
+	}
+
+	l.Info("WAL layout migration completed",
+		slog.Bool("dry_run", opts.DryRun),
+		slog.Int("moved", res.Moved),
+		slog.Int("cleaned", res.Cleaned),
+		slog.Int("in_place", res.InPlace),
+	)
+	return res, nil
+}
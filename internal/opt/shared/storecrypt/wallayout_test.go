@@ -0,0 +1,140 @@
+package storecrypt
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedWALPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"000000010000003C000000D8", "wal/00000001/0000003C/000000010000003C000000D8", true},
+		{"000000010000003C000000D8.gz.aes", "wal/00000001/0000003C/000000010000003C000000D8.gz.aes", true},
+		{"000000010000003C000000D8.00000028.backup", "wal/00000001/0000003C/000000010000003C000000D8.00000028.backup", true},
+		{"00000002.history", "wal/00000002/00000002.history", true},
+		{"00000002.history.zst", "wal/00000002/00000002.history.zst", true},
+		{"000000010000003C000000D8X", "", false},
+		{"README.txt", "", false},
+		{"dir/000000010000003C000000D8", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := shardedWALPath(tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func newLayoutStorage(t *testing.T, layout WALLayout) (*VariadicStorage, *InMemoryStorage) {
+	t.Helper()
+	mem := NewInMemoryStorage()
+	vs, err := NewVariadicStorage(mem, Algorithms{}, "")
+	require.NoError(t, err)
+	vs.SetWALLayout(layout)
+	return vs, mem
+}
+
+func readAll(t *testing.T, s Storage, name string) string {
+	t.Helper()
+	rc, err := s.Get(context.Background(), name)
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestVariadicStorage_ShardedLayoutWritesAndReadsBoth(t *testing.T) {
+	ctx := context.Background()
+	vs, mem := newLayoutStorage(t, WALLayoutSharded)
+
+	require.NoError(t, vs.Put(ctx, "000000010000003C000000D9", strings.NewReader("new")))
+	require.NoError(t, vs.Put(ctx, "backups.json", strings.NewReader("meta")))
+	mem.Files["000000010000003C000000D8"] = []byte("old")
+
+	assert.Contains(t, mem.Files, "wal/00000001/0000003C/000000010000003C000000D9")
+	assert.Contains(t, mem.Files, "backups.json")
+
+	assert.Equal(t, "new", readAll(t, vs, "000000010000003C000000D9"))
+	assert.Equal(t, "old", readAll(t, vs, "000000010000003C000000D8"))
+
+	ok, err := vs.Exists(ctx, "000000010000003C000000D8")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, vs.Delete(ctx, "000000010000003C000000D9"))
+	assert.NotContains(t, mem.Files, "wal/00000001/0000003C/000000010000003C000000D9")
+
+	// a flat storage reads sharded files as well
+	flat, err := NewVariadicStorage(mem, Algorithms{}, "")
+	require.NoError(t, err)
+	mem.Files["wal/00000001/0000003C/000000010000003C000000DA"] = []byte("sharded")
+	assert.Equal(t, "sharded", readAll(t, flat, "000000010000003C000000DA"))
+}
+
+func TestVariadicStorage_IsWALPath(t *testing.T) {
+	vs, _ := newLayoutStorage(t, WALLayoutFlat)
+
+	assert.True(t, vs.IsWALPath("000000010000003C000000D8.gz"))
+	assert.True(t, vs.IsWALPath("wal/00000001/0000003C/000000010000003C000000D8.gz"))
+	assert.True(t, vs.IsWALPath("wal/00000002/00000002.history"))
+	assert.False(t, vs.IsWALPath("wal/00000001/0000003D/000000010000003C000000D8"))
+	assert.False(t, vs.IsWALPath("archive/000000010000003C000000D8"))
+	assert.False(t, vs.IsWALPath(""))
+}
+
+func TestVariadicStorage_MigrateWALLayout(t *testing.T) {
+	ctx := context.Background()
+	vs, mem := newLayoutStorage(t, WALLayoutSharded)
+
+	mem.Files["000000010000003C000000D8.gz"] = []byte("a")
+	mem.Files["000000010000003C000000D9"] = []byte("b")
+	mem.Files["00000002.history"] = []byte("h")
+	mem.Files["README.txt"] = []byte("r")
+	mem.Files["wal/00000001/0000003C/000000010000003C000000DA"] = []byte("c")
+
+	// an interrupted run left both the source and the target behind
+	mem.Files["000000010000003C000000DB"] = []byte("d")
+	mem.Files["wal/00000001/0000003C/000000010000003C000000DB"] = []byte("d")
+
+	res, err := vs.MigrateWALLayout(ctx, MigrateWALLayoutOpts{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 4, res.Moved)
+	assert.Contains(t, mem.Files, "000000010000003C000000D9")
+
+	res, err = vs.MigrateWALLayout(ctx, MigrateWALLayoutOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateWALLayoutResult{Moved: 3, Cleaned: 1, InPlace: 2}, res)
+
+	want := []string{
+		"README.txt",
+		"wal/00000001/0000003C/000000010000003C000000D8.gz",
+		"wal/00000001/0000003C/000000010000003C000000D9",
+		"wal/00000001/0000003C/000000010000003C000000DA",
+		"wal/00000001/0000003C/000000010000003C000000DB",
+		"wal/00000002/00000002.history",
+	}
+	assert.Equal(t, want, iteratePaths(t, mem, "", IterateOpts{}))
+
+	// re-running is a no-op
+	res, err = vs.MigrateWALLayout(ctx, MigrateWALLayoutOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateWALLayoutResult{InPlace: 5}, res)
+
+	// and back to flat
+	vs.SetWALLayout(WALLayoutFlat)
+	res, err = vs.MigrateWALLayout(ctx, MigrateWALLayoutOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, res.Moved)
+	assert.Contains(t, mem.Files, "000000010000003C000000D8.gz")
+	assert.Contains(t, mem.Files, "00000002.history")
+}
@@ -7,6 +7,10 @@ const (
 	GzipCompName = "gzip"
 	ZstdFileExt  = ".zst"
 	ZstdCompName = "zstd"
+	Lz4FileExt   = ".lz4"
+	Lz4CompName  = "lz4"
+	XzFileExt    = ".xz"
+	XzCompName   = "xz"
 )
 
 type Flusher interface {
@@ -38,6 +42,10 @@ func GetDecompressor(c Compressor) Decompressor {
 		return &GzipDecompressor{}
 	case ZstdFileExt:
 		return &ZstdDecompressor{}
+	case Lz4FileExt:
+		return &Lz4Decompressor{}
+	case XzFileExt:
+		return &XzDecompressor{}
 	default:
 		return nil
 	}
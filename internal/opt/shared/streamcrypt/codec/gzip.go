@@ -7,7 +7,11 @@ import (
 
 // Gzip Compressor
 
-type GzipCompressor struct{}
+// GzipCompressor compresses with gzip. Level is 1 (fastest) to 9 (best),
+// the library default when zero.
+type GzipCompressor struct {
+	Level int
+}
 
 var _ Compressor = &GzipCompressor{}
 
@@ -15,8 +19,15 @@ func (GzipCompressor) FileExtension() string {
 	return GzipFileExt
 }
 
-func (GzipCompressor) NewWriter(w io.Writer) (WriteFlushCloser, error) {
-	gw := gzip.NewWriter(w)
+func (c GzipCompressor) NewWriter(w io.Writer) (WriteFlushCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
 	return &gzipWrapper{Writer: gw}, nil
 }
 
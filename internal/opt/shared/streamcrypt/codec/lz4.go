@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// Lz4 Compressor
+
+// Lz4Compressor compresses with lz4 frames, cheap on CPU. Level is 1-9 for
+// the high-compression mode, the fast mode when zero.
+type Lz4Compressor struct {
+	Level int
+}
+
+var _ Compressor = &Lz4Compressor{}
+
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Fast,
+	lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5,
+	lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+func (Lz4Compressor) FileExtension() string {
+	return Lz4FileExt
+}
+
+func (c Lz4Compressor) NewWriter(w io.Writer) (WriteFlushCloser, error) {
+	if c.Level < 0 || c.Level >= len(lz4Levels) {
+		return nil, fmt.Errorf("lz4: invalid level %d", c.Level)
+	}
+	lw := lz4.NewWriter(w)
+	if err := lw.Apply(lz4.CompressionLevelOption(lz4Levels[c.Level])); err != nil {
+		return nil, err
+	}
+	return lw, nil
+}
+
+func (Lz4Compressor) Name() string {
+	return Lz4CompName
+}
+
+// Lz4 Decompressor
+
+type Lz4Decompressor struct{}
+
+var _ Decompressor = &Lz4Decompressor{}
+
+func (Lz4Decompressor) FileExtension() string {
+	return Lz4FileExt
+}
+
+func (Lz4Decompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
@@ -0,0 +1,49 @@
+//nolint:dupl
+package codec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLz4Compressor_RoundTripLevels(t *testing.T) {
+	original := bytes.Repeat([]byte("this is a test of lz4 compression "), 4096)
+
+	for _, level := range []int{0, 1, 9} {
+		var buf bytes.Buffer
+		comp := Lz4Compressor{Level: level}
+
+		writer, err := comp.NewWriter(&buf)
+		require.NoError(t, err)
+
+		_, err = writer.Write(original)
+		require.NoError(t, err)
+		assert.NoError(t, writer.Flush())
+		assert.NoError(t, writer.Close())
+		assert.Less(t, buf.Len(), len(original))
+
+		reader, err := Lz4Decompressor{}.Decompress(&buf)
+		require.NoError(t, err)
+
+		result, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, original, result, "level %d", level)
+	}
+}
+
+func TestLz4Compressor_InvalidLevel(t *testing.T) {
+	_, err := Lz4Compressor{Level: 10}.NewWriter(io.Discard)
+	require.Error(t, err)
+}
+
+func TestLz4Compressor_Metadata(t *testing.T) {
+	comp := Lz4Compressor{}
+	assert.Equal(t, Lz4FileExt, comp.FileExtension())
+	assert.Equal(t, Lz4CompName, comp.Name())
+	assert.IsType(t, &Lz4Decompressor{}, GetDecompressor(comp))
+}
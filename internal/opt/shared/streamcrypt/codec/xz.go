@@ -0,0 +1,84 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Xz Compressor
+
+// XzCompressor compresses with xz, slow but dense, for cold data such as
+// basebackups. Level 0-9 is a dictionary size: that of the matching xz
+// preset, 6 (8 MiB) when zero. The encoder has no other settings, a level
+// does not change the effort of the match finder as the presets of the xz
+// tool do.
+//
+// An xz stream cannot be flushed midway, Flush of its writer fails. Use it
+// only where everything is written before Close.
+type XzCompressor struct {
+	Level int
+}
+
+var _ Compressor = &XzCompressor{}
+
+// xzDictCaps are the dictionary sizes of the xz presets 0-9.
+var xzDictCaps = []int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+func (XzCompressor) FileExtension() string {
+	return XzFileExt
+}
+
+func (c XzCompressor) NewWriter(w io.Writer) (WriteFlushCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = 6
+	}
+	if level < 0 || level >= len(xzDictCaps) {
+		return nil, fmt.Errorf("xz: invalid level %d", c.Level)
+	}
+	xw, err := xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &xzWrapper{Writer: xw}, nil
+}
+
+func (XzCompressor) Name() string {
+	return XzCompName
+}
+
+// ErrXzFlush is returned by Flush of an xz writer.
+var ErrXzFlush = errors.New("xz: a stream cannot be flushed, only closed")
+
+// xzWrapper fails Flush: everything is written on Close.
+type xzWrapper struct {
+	*xz.Writer
+}
+
+func (x *xzWrapper) Flush() error {
+	return ErrXzFlush
+}
+
+// Xz Decompressor
+
+type XzDecompressor struct{}
+
+var _ Decompressor = &XzDecompressor{}
+
+func (XzDecompressor) FileExtension() string {
+	return XzFileExt
+}
+
+func (XzDecompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xr), nil
+}
@@ -0,0 +1,49 @@
+//nolint:dupl
+package codec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXzCompressor_RoundTripLevels(t *testing.T) {
+	original := bytes.Repeat([]byte("this is a test of xz compression "), 4096)
+
+	for _, level := range []int{0, 1, 9} {
+		var buf bytes.Buffer
+		comp := XzCompressor{Level: level}
+
+		writer, err := comp.NewWriter(&buf)
+		require.NoError(t, err)
+
+		_, err = writer.Write(original)
+		require.NoError(t, err)
+		assert.ErrorIs(t, writer.Flush(), ErrXzFlush)
+		assert.NoError(t, writer.Close())
+		assert.Less(t, buf.Len(), len(original))
+
+		reader, err := XzDecompressor{}.Decompress(&buf)
+		require.NoError(t, err)
+
+		result, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, original, result, "level %d", level)
+	}
+}
+
+func TestXzCompressor_InvalidLevel(t *testing.T) {
+	_, err := XzCompressor{Level: 10}.NewWriter(io.Discard)
+	require.Error(t, err)
+}
+
+func TestXzCompressor_Metadata(t *testing.T) {
+	comp := XzCompressor{}
+	assert.Equal(t, XzFileExt, comp.FileExtension())
+	assert.Equal(t, XzCompName, comp.Name())
+	assert.IsType(t, &XzDecompressor{}, GetDecompressor(comp))
+}
@@ -8,7 +8,13 @@ import (
 
 // Zstd Compressor
 
-type ZstdCompressor struct{}
+// ZstdCompressor compresses with zstd. Level is a zstd level (1-22, mapped
+// to the closest encoder speed), the default speed when zero. Concurrency
+// is the number of encoder goroutines, GOMAXPROCS when zero.
+type ZstdCompressor struct {
+	Level       int
+	Concurrency int
+}
 
 var _ Compressor = &ZstdCompressor{}
 
@@ -16,8 +22,16 @@ func (ZstdCompressor) FileExtension() string {
 	return ZstdFileExt
 }
 
-func (ZstdCompressor) NewWriter(w io.Writer) (WriteFlushCloser, error) {
-	zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedDefault))
+func (c ZstdCompressor) NewWriter(w io.Writer) (WriteFlushCloser, error) {
+	level := zstd.SpeedDefault
+	if c.Level != 0 {
+		level = zstd.EncoderLevelFromZstd(c.Level)
+	}
+	opts := []zstd.EOption{zstd.WithEncoderLevel(level)}
+	if c.Concurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(c.Concurrency))
+	}
+	zw, err := zstd.NewWriter(w, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -43,3 +43,22 @@ func TestZstdCompressor_Metadata(t *testing.T) {
 	decomp := ZstdDecompressor{}
 	assert.Equal(t, ".zst", decomp.FileExtension())
 }
+
+func TestZstdCompressor_LevelAndConcurrency(t *testing.T) {
+	original := bytes.Repeat([]byte("wal record "), 10000)
+
+	for _, comp := range []ZstdCompressor{{Level: 1}, {Level: 19, Concurrency: 2}} {
+		var buf bytes.Buffer
+		writer, err := comp.NewWriter(&buf)
+		require.NoError(t, err)
+		_, err = writer.Write(original)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		reader, err := ZstdDecompressor{}.Decompress(&buf)
+		require.NoError(t, err)
+		result, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, original, result)
+	}
+}
@@ -4,29 +4,42 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
-
-	"golang.org/x/crypto/argon2"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/chunked"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/kdf"
 )
 
 // Constants
 
 const (
-	chunkSize    = 64 * 1024
-	nonceSize    = 12 // AES-GCM requires a 12-byte (96-bit) nonce for optimal performance.
+	chunkSize    = chunked.ChunkSize
 	saltSize     = 16 // A 128-bit salt is standard in key derivation (like Argon2, PBKDF2, scrypt).
 	keySize      = 32 // AES-256 requires a 256-bit key = 32 bytes.
 	headerPrefix = "AEADv1"
+
+	// headerPrefixV2 is followed by a 1-byte key ID length, the key ID and the salt.
+	headerPrefixV2 = "AEADv2"
+	maxKeyIDLen    = 255
+
+	// headerPrefixV3 is followed by a 1-byte key ID length, the key ID (may be
+	// empty), the KDF parameters, the salt and the object salt. The salt is
+	// shared by the objects of one writer, so the Argon2 key is derived once
+	// and cached, and every object is encrypted with its own key derived from
+	// it and the object salt.
+	headerPrefixV3 = "AEADv3"
+	objectKeyInfo  = "pgrwl aes-256-gcm object"
 )
 
 // Key Derivation
 
+// GeneratePBEKey derives a key with the KDF parameters of AEADv1 and AEADv2
+// objects, which do not record them.
 func GeneratePBEKey(password string, salt []byte) []byte {
-	return argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, keySize)
+	return kdf.Key(password, salt, kdf.Default)
 }
 
 func GenerateRandomNBytes(n int) ([]byte, error) {
@@ -37,11 +50,28 @@ func GenerateRandomNBytes(n int) ([]byte, error) {
 
 // Chunked GCM Crypter
 
+// ChunkedGCMCrypter encrypts with Password and an AEADv1 header, or, when
+// KeyID is set, with Keys[KeyID] and an AEADv2 header that names the key.
+// Decryption picks the key from the header: Password for objects without a
+// key ID, and the key with the recorded ID otherwise.
+//
+// New objects get an AEADv3 header with the KDF parameters, older AEADv1 and
+// AEADv2 objects are decrypted with kdf.Default.
 type ChunkedGCMCrypter struct {
 	Password string
+
+	KeyID string            // key for new objects, empty for none
+	Keys  map[string]string // key ID -> passphrase
+
+	KDF kdf.Params // KDF parameters for new objects, kdf.Default when zero
+
+	salt kdf.Salt
 }
 
-var _ crypt.Crypter = &ChunkedGCMCrypter{}
+var (
+	_ crypt.Crypter       = &ChunkedGCMCrypter{}
+	_ crypt.KeyIdentifier = &ChunkedGCMCrypter{}
+)
 
 func NewChunkedGCMCrypter(password string) crypt.Crypter {
 	return &ChunkedGCMCrypter{
@@ -49,6 +79,109 @@ func NewChunkedGCMCrypter(password string) crypt.Crypter {
 	}
 }
 
+// NewKeyringGCMCrypter creates a crypter that encrypts with the key activeID
+// and decrypts objects written with any key of the keyring. The password is
+// used for objects written before key IDs were introduced, it may be empty.
+func NewKeyringGCMCrypter(password string, keys map[string]string, activeID string) (crypt.Crypter, error) {
+	for id := range keys {
+		if id == "" || len(id) > maxKeyIDLen {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", activeID)
+	}
+	return &ChunkedGCMCrypter{
+		Password: password,
+		KeyID:    activeID,
+		Keys:     keys,
+	}, nil
+}
+
+func (c *ChunkedGCMCrypter) ActiveKeyID() string {
+	return c.KeyID
+}
+
+// ReadKeyID reads the header of an encrypted object and returns its key ID,
+// empty for AEADv1 objects.
+func (c *ChunkedGCMCrypter) ReadKeyID(r io.Reader) (string, error) {
+	h, err := readHeader(r)
+	return h.keyID, err
+}
+
+type header struct {
+	keyID      string
+	params     kdf.Params
+	salt       []byte
+	objectSalt []byte // AEADv3 only
+}
+
+func readHeader(r io.Reader) (header, error) {
+	prefix := make([]byte, len(headerPrefix))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return header{}, err
+	}
+
+	h := header{params: kdf.Default}
+	switch string(prefix) {
+	case headerPrefix:
+	case headerPrefixV2, headerPrefixV3:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return header{}, err
+		}
+		id := make([]byte, n[0])
+		if _, err := io.ReadFull(r, id); err != nil {
+			return header{}, err
+		}
+		h.keyID = string(id)
+	default:
+		return header{}, errors.New("invalid file header")
+	}
+
+	if string(prefix) == headerPrefixV3 {
+		params, err := kdf.Read(r)
+		if err != nil {
+			return header{}, err
+		}
+		h.params = params
+	}
+
+	h.salt = make([]byte, saltSize)
+	if _, err := io.ReadFull(r, h.salt); err != nil {
+		return header{}, err
+	}
+	if string(prefix) == headerPrefixV3 {
+		h.objectSalt = make([]byte, saltSize)
+		if _, err := io.ReadFull(r, h.objectSalt); err != nil {
+			return header{}, err
+		}
+	}
+	return h, nil
+}
+
+// key derives the content key of an object.
+func (h header) key(pass string) ([]byte, error) {
+	if h.objectSalt == nil {
+		return GeneratePBEKey(pass, h.salt), nil
+	}
+	return kdf.ObjectKey(kdf.Key(pass, h.salt, h.params), h.objectSalt, objectKeyInfo)
+}
+
+func (c *ChunkedGCMCrypter) password(keyID string) (string, error) {
+	if keyID == "" {
+		if c.Password == "" {
+			return "", errors.New("object has no key id and no legacy password is configured")
+		}
+		return c.Password, nil
+	}
+	pass, ok := c.Keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key id %q", keyID)
+	}
+	return pass, nil
+}
+
 func (c *ChunkedGCMCrypter) FileExtension() string {
 	return ".aes"
 }
@@ -58,147 +191,87 @@ func (c *ChunkedGCMCrypter) Name() string {
 }
 
 func (c *ChunkedGCMCrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
-	salt, err := GenerateRandomNBytes(saltSize)
+	pass, err := c.password(c.KeyID)
 	if err != nil {
 		return nil, err
 	}
-	key := GeneratePBEKey(c.Password, salt)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
+	params := c.KDF
+	if params == (kdf.Params{}) {
+		params = kdf.Default
+	}
+	if err := params.Validate(); err != nil {
 		return nil, err
 	}
-	aead, err := cipher.NewGCM(block)
+	salt, err := c.salt.Get(saltSize)
 	if err != nil {
 		return nil, err
 	}
-
-	if _, err := w.Write([]byte(headerPrefix)); err != nil {
+	objectSalt, err := GenerateRandomNBytes(saltSize)
+	if err != nil {
 		return nil, err
 	}
-	if _, err := w.Write(salt); err != nil {
+	h := header{keyID: c.KeyID, params: params, salt: salt, objectSalt: objectSalt}
+	key, err := h.key(pass)
+	if err != nil {
 		return nil, err
 	}
 
-	return &gcmChunkedWriter{
-		aead:     aead,
-		w:        w,
-		buf:      make([]byte, 0, chunkSize),
-		chunkNum: 0,
-	}, nil
-}
+	buf := append([]byte(headerPrefixV3), byte(len(c.KeyID)))
+	buf = append(buf, c.KeyID...)
+	buf = params.Append(buf)
+	buf = append(buf, salt...)
+	buf = append(buf, objectSalt...)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
 
-type gcmChunkedWriter struct {
-	aead     cipher.AEAD
-	w        io.Writer
-	buf      []byte
-	chunkNum uint64
+	return NewChunkedWriter(key, w)
 }
 
-func (g *gcmChunkedWriter) Write(p []byte) (int, error) {
-	total := 0
-	for len(p) > 0 {
-		space := chunkSize - len(g.buf)
-		if space > len(p) {
-			space = len(p)
-		}
-		g.buf = append(g.buf, p[:space]...)
-		p = p[space:]
-		total += space
-
-		if len(g.buf) == chunkSize {
-			if err := g.flush(); err != nil {
-				return total, err
-			}
-		}
+// NewChunkedWriter encrypts everything written to it in AES-256-GCM chunks
+// with the given 32-byte key. It writes no header, callers that derive the
+// key themselves write their own.
+func NewChunkedWriter(key []byte, w io.Writer) (io.WriteCloser, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
 	}
-	return total, nil
+	return chunked.NewWriter(aead, w)
 }
 
-func (g *gcmChunkedWriter) Close() error {
-	if len(g.buf) > 0 {
-		if err := g.flush(); err != nil {
-			return err
-		}
+// NewChunkedReader decrypts a stream written by NewChunkedWriter.
+func NewChunkedReader(key []byte, r io.Reader) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return chunked.NewReader(aead, r)
 }
 
-func (g *gcmChunkedWriter) flush() error {
-	nonce := make([]byte, nonceSize)
-	binary.BigEndian.PutUint64(nonce[4:], g.chunkNum)
-	ciphertext := g.aead.Seal(nil, nonce, g.buf, nil)
-
-	if _, err := g.w.Write(nonce); err != nil {
-		return err
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid key size %d, want %d", len(key), keySize)
 	}
-	if _, err := g.w.Write(ciphertext); err != nil {
-		return err
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
 	}
-
-	g.chunkNum++
-	g.buf = g.buf[:0]
-	return nil
+	return cipher.NewGCM(block)
 }
 
 func (c *ChunkedGCMCrypter) Decrypt(r io.Reader) (io.Reader, error) {
-	header := make([]byte, len(headerPrefix)+saltSize)
-	if _, err := io.ReadFull(r, header); err != nil {
+	h, err := readHeader(r)
+	if err != nil {
 		return nil, err
 	}
-	if string(header[:len(headerPrefix)]) != headerPrefix {
-		return nil, errors.New("invalid file header")
-	}
-	salt := header[len(headerPrefix):]
-	key := GeneratePBEKey(c.Password, salt)
-
-	block, err := aes.NewCipher(key)
+	pass, err := c.password(h.keyID)
 	if err != nil {
 		return nil, err
 	}
-	aead, err := cipher.NewGCM(block)
+	key, err := h.key(pass)
 	if err != nil {
 		return nil, err
 	}
 
-	return &gcmChunkedReader{
-		aead:     aead,
-		r:        r,
-		chunkNum: 0,
-		buf:      nil,
-	}, nil
-}
-
-type gcmChunkedReader struct {
-	aead     cipher.AEAD
-	r        io.Reader
-	chunkNum uint64
-	buf      []byte
-}
-
-func (g *gcmChunkedReader) Read(p []byte) (int, error) {
-	if len(g.buf) == 0 {
-		nonce := make([]byte, nonceSize)
-		if _, err := io.ReadFull(g.r, nonce); err != nil {
-			return 0, err
-		}
-
-		ciphertext := make([]byte, chunkSize+g.aead.Overhead())
-		n, err := io.ReadFull(g.r, ciphertext)
-		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
-			return 0, err
-		}
-		ciphertext = ciphertext[:n]
-
-		plaintext, err := g.aead.Open(nil, nonce, ciphertext, nil)
-		if err != nil {
-			return 0, errors.New("decryption failed: tampering or corruption detected")
-		}
-		g.buf = plaintext
-		g.chunkNum++
-	}
-
-	n := copy(p, g.buf)
-	g.buf = g.buf[n:]
-	return n, nil
+	return NewChunkedReader(key, r)
 }
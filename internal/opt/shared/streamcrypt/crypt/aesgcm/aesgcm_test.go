@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/kdf"
 	"github.com/stretchr/testify/require"
 
 	"github.com/stretchr/testify/assert"
@@ -39,8 +41,8 @@ func TestChunkedGCMCrypto_EncryptFunction_HeaderAndSalt(t *testing.T) {
 	assert.NoError(t, writer.Close())
 
 	written := out.Bytes()
-	assert.True(t, bytes.HasPrefix(written, []byte("AEADv1")), "header prefix missing")
-	assert.True(t, len(written) > len("AEADv1")+saltSize, "not enough data written")
+	assert.True(t, bytes.HasPrefix(written, []byte("AEADv3\x00")), "header prefix missing")
+	assert.True(t, len(written) > len("AEADv3")+1+kdf.EncodedSize+2*saltSize, "not enough data written")
 }
 
 func TestChunkedGCMCrypto_EncryptWriteFlushCloseBehavior(t *testing.T) {
@@ -338,3 +340,117 @@ func TestChunkedGCMCrypto_EncryptDecryptRoundtripRangeLoop(t *testing.T) {
 		require.Equal(t, data, result, "decrypted output mismatch at size=%d", size)
 	}
 }
+
+// keyring
+
+func encryptBytes(t *testing.T, c crypt.Crypter, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := c.Encrypt(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// encryptLegacy writes an AEADv1 object, or an AEADv2 object when keyID is set.
+func encryptLegacy(t *testing.T, pass, keyID string, data []byte) []byte {
+	t.Helper()
+	salt, err := GenerateRandomNBytes(saltSize)
+	require.NoError(t, err)
+	buf := bytes.NewBufferString(headerPrefix)
+	if keyID != "" {
+		buf = bytes.NewBufferString(headerPrefixV2)
+		buf.WriteByte(byte(len(keyID)))
+		buf.WriteString(keyID)
+	}
+	buf.Write(salt)
+	w, err := NewChunkedWriter(GeneratePBEKey(pass, salt), buf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestKeyringGCMCrypter_DecryptsAllKeyGenerations(t *testing.T) {
+	data := bytes.Repeat([]byte("rotate "), 20000)
+
+	v1 := encryptLegacy(t, "old-pass", "", data)
+	v2k1 := encryptLegacy(t, "pass-1", "k1", data)
+
+	k1, err := NewKeyringGCMCrypter("old-pass", map[string]string{"k1": "pass-1"}, "k1")
+	require.NoError(t, err)
+	v3k1 := encryptBytes(t, k1, data)
+	assert.True(t, bytes.HasPrefix(v3k1, []byte("AEADv3\x02k1")))
+
+	k2, err := NewKeyringGCMCrypter("old-pass", map[string]string{"k1": "pass-1", "k2": "pass-2"}, "k2")
+	require.NoError(t, err)
+
+	for name, enc := range map[string][]byte{"v1": v1, "v2-k1": v2k1, "v3-k1": v3k1, "k2": encryptBytes(t, k2, data)} {
+		r, err := k2.Decrypt(bytes.NewReader(enc))
+		require.NoError(t, err, name)
+		out, err := io.ReadAll(r)
+		require.NoError(t, err, name)
+		assert.Equal(t, data, out, name)
+	}
+
+	keyID, err := k2.(*ChunkedGCMCrypter).ReadKeyID(bytes.NewReader(v2k1))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", keyID)
+	keyID, err = k2.(*ChunkedGCMCrypter).ReadKeyID(bytes.NewReader(v3k1))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", keyID)
+	keyID, err = k2.(*ChunkedGCMCrypter).ReadKeyID(bytes.NewReader(v1))
+	require.NoError(t, err)
+	assert.Empty(t, keyID)
+}
+
+func TestKeyringGCMCrypter_UnknownKeys(t *testing.T) {
+	k1, err := NewKeyringGCMCrypter("", map[string]string{"k1": "pass-1"}, "k1")
+	require.NoError(t, err)
+	enc := encryptBytes(t, k1, []byte("data"))
+
+	other, err := NewKeyringGCMCrypter("", map[string]string{"k2": "pass-2"}, "k2")
+	require.NoError(t, err)
+	_, err = other.Decrypt(bytes.NewReader(enc))
+	require.ErrorContains(t, err, `unknown encryption key id "k1"`)
+
+	v1 := encryptBytes(t, NewChunkedGCMCrypter("old-pass"), []byte("data"))
+	_, err = other.Decrypt(bytes.NewReader(v1))
+	require.ErrorContains(t, err, "no legacy password")
+
+	_, err = NewKeyringGCMCrypter("", map[string]string{"k1": "pass-1"}, "k9")
+	require.Error(t, err)
+}
+
+func TestChunkedGCMCrypto_KDFParamsInHeader(t *testing.T) {
+	data := []byte("wal segment")
+	weak := &ChunkedGCMCrypter{Password: "pass", KDF: kdf.Params{Time: 1, MemoryKiB: 64, Threads: 1}}
+	a := encryptBytes(t, weak, data)
+	b := encryptBytes(t, weak, data)
+
+	// one writer shares the salt, every object has its own object salt
+	saltAt := len(headerPrefixV3) + 1 + kdf.EncodedSize
+	assert.Equal(t, a[saltAt:saltAt+saltSize], b[saltAt:saltAt+saltSize])
+	assert.NotEqual(t, a[saltAt+saltSize:saltAt+2*saltSize], b[saltAt+saltSize:saltAt+2*saltSize])
+
+	// a reader configured with other parameters uses the recorded ones
+	r, err := (&ChunkedGCMCrypter{Password: "pass", KDF: kdf.Params{Time: 3, MemoryKiB: 1024, Threads: 2}}).Decrypt(bytes.NewReader(a))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	_, err = (&ChunkedGCMCrypter{Password: "pass", KDF: kdf.Params{Time: 1}}).Encrypt(io.Discard)
+	require.Error(t, err)
+}
+
+func TestChunkedGCMCrypto_RejectsUnboundedKDFParams(t *testing.T) {
+	hdr := append([]byte(headerPrefixV3), 0)
+	hdr = kdf.Params{Time: 1, MemoryKiB: kdf.MaxMemoryKiB + 1, Threads: 1}.Append(hdr)
+	hdr = append(hdr, make([]byte, 2*saltSize)...)
+	_, err := NewChunkedGCMCrypter("pass").Decrypt(bytes.NewReader(hdr))
+	require.ErrorContains(t, err, "kdf: memory")
+}
@@ -0,0 +1,95 @@
+package chacha
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/chunked"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/kdf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func encrypt(t *testing.T, c *ChunkedChaChaCrypter, data []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := c.Encrypt(&out)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return out.Bytes()
+}
+
+func TestChaCha_RoundTripMultiChunk(t *testing.T) {
+	c := &ChunkedChaChaCrypter{Password: "edge"}
+
+	data := make([]byte, 3*chunked.ChunkSize+123)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	enc := encrypt(t, c, data)
+	assert.True(t, bytes.HasPrefix(enc, []byte(headerPrefixV2)))
+
+	r, err := c.Decrypt(bytes.NewReader(enc))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestChaCha_WrongPasswordAndTampering(t *testing.T) {
+	c := &ChunkedChaChaCrypter{Password: "edge"}
+	enc := encrypt(t, c, []byte("wal"))
+
+	r, err := (&ChunkedChaChaCrypter{Password: "other"}).Decrypt(bytes.NewReader(enc))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.Error(t, err)
+
+	tampered := bytes.Clone(enc)
+	tampered[len(tampered)-1] ^= 0x01
+	r, err = c.Decrypt(bytes.NewReader(tampered))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.Error(t, err)
+}
+
+func TestChaCha_RejectsOtherHeaders(t *testing.T) {
+	c := &ChunkedChaChaCrypter{Password: "edge"}
+	_, err := c.Decrypt(bytes.NewReader([]byte("AEADv1" + "0123456789abcdef0123")))
+	require.Error(t, err)
+}
+
+func TestChaCha_ReadsV1Objects(t *testing.T) {
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	require.NoError(t, err)
+	aead, err := chacha20poly1305.New(kdf.Key("edge", salt, kdf.Default))
+	require.NoError(t, err)
+
+	enc := bytes.NewBufferString(headerPrefix)
+	enc.Write(salt)
+	w, err := chunked.NewWriter(aead, enc)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("v1 wal"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	c := &ChunkedChaChaCrypter{Password: "edge", KDF: kdf.Params{Time: 2, MemoryKiB: 256, Threads: 1}}
+	r, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "v1 wal", string(got))
+
+	// and v2 objects record the configured parameters
+	r, err = NewChunkedChaChaCrypter("edge").Decrypt(bytes.NewReader(encrypt(t, c, []byte("v2 wal"))))
+	require.NoError(t, err)
+	got, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "v2 wal", string(got))
+}
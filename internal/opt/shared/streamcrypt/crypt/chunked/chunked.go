@@ -0,0 +1,141 @@
+// Package chunked frames a stream as a sequence of independently sealed AEAD
+// chunks: every chunk is a 12-byte nonce (the chunk counter) followed by the
+// sealed ChunkSize bytes of plaintext (less for the last chunk).
+//
+// It is shared by the chunked crypters, which differ only in the AEAD and in
+// the header they write before the chunks.
+package chunked
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	ChunkSize = 64 * 1024
+	NonceSize = 12
+	// TagSize is the overhead of AES-GCM and ChaCha20-Poly1305.
+	TagSize = 16
+)
+
+// Overhead is the number of bytes the framing adds to n bytes of plaintext.
+func Overhead(n int64) int64 {
+	return (n + ChunkSize - 1) / ChunkSize * (NonceSize + TagSize)
+}
+
+// NewWriter seals everything written to it in chunks. Close seals the last
+// partial chunk, it does not close w.
+func NewWriter(aead cipher.AEAD, w io.Writer) (io.WriteCloser, error) {
+	if aead.NonceSize() != NonceSize {
+		return nil, fmt.Errorf("chunked: nonce size %d, want %d", aead.NonceSize(), NonceSize)
+	}
+	return &writer{
+		aead:     aead,
+		w:        w,
+		buf:      make([]byte, 0, ChunkSize),
+		chunkNum: 0,
+	}, nil
+}
+
+// NewReader opens a stream written by NewWriter.
+func NewReader(aead cipher.AEAD, r io.Reader) (io.Reader, error) {
+	if aead.NonceSize() != NonceSize {
+		return nil, fmt.Errorf("chunked: nonce size %d, want %d", aead.NonceSize(), NonceSize)
+	}
+	return &reader{
+		aead:     aead,
+		r:        r,
+		chunkNum: 0,
+		buf:      nil,
+	}, nil
+}
+
+type writer struct {
+	aead     cipher.AEAD
+	w        io.Writer
+	buf      []byte
+	chunkNum uint64
+}
+
+func (g *writer) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		space := ChunkSize - len(g.buf)
+		if space > len(p) {
+			space = len(p)
+		}
+		g.buf = append(g.buf, p[:space]...)
+		p = p[space:]
+		total += space
+
+		if len(g.buf) == ChunkSize {
+			if err := g.flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (g *writer) Close() error {
+	if len(g.buf) > 0 {
+		if err := g.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *writer) flush() error {
+	nonce := make([]byte, NonceSize)
+	binary.BigEndian.PutUint64(nonce[4:], g.chunkNum)
+	ciphertext := g.aead.Seal(nil, nonce, g.buf, nil)
+
+	if _, err := g.w.Write(nonce); err != nil {
+		return err
+	}
+	if _, err := g.w.Write(ciphertext); err != nil {
+		return err
+	}
+
+	g.chunkNum++
+	g.buf = g.buf[:0]
+	return nil
+}
+
+type reader struct {
+	aead     cipher.AEAD
+	r        io.Reader
+	chunkNum uint64
+	buf      []byte
+}
+
+func (g *reader) Read(p []byte) (int, error) {
+	if len(g.buf) == 0 {
+		nonce := make([]byte, NonceSize)
+		if _, err := io.ReadFull(g.r, nonce); err != nil {
+			return 0, err
+		}
+
+		ciphertext := make([]byte, ChunkSize+g.aead.Overhead())
+		n, err := io.ReadFull(g.r, ciphertext)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		ciphertext = ciphertext[:n]
+
+		plaintext, err := g.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return 0, errors.New("decryption failed: tampering or corruption detected")
+		}
+		g.buf = plaintext
+		g.chunkNum++
+	}
+
+	n := copy(p, g.buf)
+	g.buf = g.buf[n:]
+	return n, nil
+}
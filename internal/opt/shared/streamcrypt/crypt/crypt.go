@@ -8,3 +8,14 @@ type Crypter interface {
 	FileExtension() string
 	Name() string
 }
+
+// KeyIdentifier is implemented by crypters that record in every object the
+// ID of the key it was encrypted with.
+type KeyIdentifier interface {
+	// ActiveKeyID is the ID of the key new objects are encrypted with,
+	// empty when objects carry no key ID.
+	ActiveKeyID() string
+
+	// ReadKeyID reads the key ID from the header of an encrypted object.
+	ReadKeyID(r io.Reader) (string, error)
+}
@@ -0,0 +1,118 @@
+// Package envelope implements envelope encryption: every object is encrypted
+// with its own random data key (DEK), and the DEK is stored in the object
+// header wrapped by a key-encryption key (KEK) held by a KeyProvider.
+//
+// The header is "ENVv1", the DEK cipher ID (1 byte), the wrapped DEK length
+// (2 bytes, big endian) and the wrapped DEK. The content follows, encrypted
+// by the DEK cipher.
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/aesgcm"
+)
+
+const (
+	headerPrefix = "ENVv1"
+	dekSize      = 32
+)
+
+// DEK ciphers, the IDs are stored in object headers and must not change.
+const (
+	CipherAES256GCM byte = 1
+)
+
+type dekCipher struct {
+	name      string
+	newWriter func(key []byte, w io.Writer) (io.WriteCloser, error)
+	newReader func(key []byte, r io.Reader) (io.Reader, error)
+}
+
+var dekCiphers = map[byte]dekCipher{
+	CipherAES256GCM: {name: "aes-256-gcm", newWriter: aesgcm.NewChunkedWriter, newReader: aesgcm.NewChunkedReader},
+}
+
+type Crypter struct {
+	provider KeyProvider
+	cipherID byte
+}
+
+var _ crypt.Crypter = &Crypter{}
+
+// NewCrypter creates a crypter that encrypts new objects with the given DEK
+// cipher. Objects are decrypted with the cipher named in their header.
+func NewCrypter(provider KeyProvider, cipherID byte) (crypt.Crypter, error) {
+	if provider == nil {
+		return nil, errors.New("envelope: key provider is required")
+	}
+	if _, ok := dekCiphers[cipherID]; !ok {
+		return nil, fmt.Errorf("envelope: unknown dek cipher %d", cipherID)
+	}
+	return &Crypter{provider: provider, cipherID: cipherID}, nil
+}
+
+func (c *Crypter) FileExtension() string {
+	return ".kek"
+}
+
+func (c *Crypter) Name() string {
+	return "envelope"
+}
+
+func (c *Crypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := c.provider.Wrap(dek)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key with %s provider: %w", c.provider.Name(), err)
+	}
+	if len(wrapped) > math.MaxUint16 {
+		return nil, fmt.Errorf("wrapped data key is too large: %d bytes", len(wrapped))
+	}
+
+	header := make([]byte, 0, len(headerPrefix)+3+len(wrapped))
+	header = append(header, headerPrefix...)
+	header = append(header, c.cipherID)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return dekCiphers[c.cipherID].newWriter(dek, w)
+}
+
+func (c *Crypter) Decrypt(r io.Reader) (io.Reader, error) {
+	fixed := make([]byte, len(headerPrefix)+3)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	if string(fixed[:len(headerPrefix)]) != headerPrefix {
+		return nil, errors.New("invalid file header")
+	}
+	dc, ok := dekCiphers[fixed[len(headerPrefix)]]
+	if !ok {
+		return nil, fmt.Errorf("unknown dek cipher %d", fixed[len(headerPrefix)])
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(fixed[len(headerPrefix)+1:]))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, err
+	}
+
+	dek, err := c.provider.Unwrap(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with %s provider: %w", c.provider.Name(), err)
+	}
+	if len(dek) != dekSize {
+		return nil, fmt.Errorf("unwrapped data key has %d bytes, want %d", len(dek), dekSize)
+	}
+	return dc.newReader(dek, r)
+}
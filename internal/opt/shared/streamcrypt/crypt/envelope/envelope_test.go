@@ -0,0 +1,105 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKEK(t *testing.T) string {
+	t.Helper()
+	kek := make([]byte, kekSize)
+	_, err := rand.Read(kek)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "kek")
+	require.NoError(t, os.WriteFile(path, []byte(hex.EncodeToString(kek)+"\n"), 0o600))
+	return path
+}
+
+func roundTrip(t *testing.T, enc, dec crypt.Crypter, data []byte) ([]byte, []byte, error) {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := enc.Encrypt(&out)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := dec.Decrypt(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		return out.Bytes(), nil, err
+	}
+	got, err := io.ReadAll(r)
+	return out.Bytes(), got, err
+}
+
+func TestEnvelope_FileProvider(t *testing.T) {
+	p, err := NewFileProvider(writeKEK(t))
+	require.NoError(t, err)
+	c, err := NewCrypter(p, CipherAES256GCM)
+	require.NoError(t, err)
+
+	data := make([]byte, 150*1024)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	enc, got, err := roundTrip(t, c, c, data)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.True(t, bytes.HasPrefix(enc, []byte(headerPrefix)))
+
+	// another kek cannot unwrap the data key
+	other, err := NewFileProvider(writeKEK(t))
+	require.NoError(t, err)
+	oc, err := NewCrypter(other, CipherAES256GCM)
+	require.NoError(t, err)
+	_, err = oc.Decrypt(bytes.NewReader(enc))
+	require.Error(t, err)
+}
+
+func TestEnvelope_FileProviderRejectsBadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kek")
+	require.NoError(t, os.WriteFile(path, []byte("short"), 0o600))
+	_, err := NewFileProvider(path)
+	require.Error(t, err)
+}
+
+func TestEnvelope_ExecProvider(t *testing.T) {
+	// an identity "kms" that checks the operation it is called for
+	p, err := NewExecProvider(ExecProviderOpts{
+		WrapCmd:   `test "$PGRWL_KEK_OP" = wrap && cat`,
+		UnwrapCmd: `test "$PGRWL_KEK_OP" = unwrap && cat`,
+	})
+	require.NoError(t, err)
+	c, err := NewCrypter(p, CipherAES256GCM)
+	require.NoError(t, err)
+
+	_, got, err := roundTrip(t, c, c, []byte("wal segment"))
+	require.NoError(t, err)
+	assert.Equal(t, "wal segment", string(got))
+}
+
+func TestEnvelope_ExecProviderFailure(t *testing.T) {
+	p, err := NewExecProvider(ExecProviderOpts{
+		WrapCmd:   `cat`,
+		UnwrapCmd: `echo "access denied" >&2; exit 3`,
+	})
+	require.NoError(t, err)
+	c, err := NewCrypter(p, CipherAES256GCM)
+	require.NoError(t, err)
+
+	_, _, err = roundTrip(t, c, c, []byte("x"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "access denied")
+
+	_, err = NewExecProvider(ExecProviderOpts{WrapCmd: "cat"})
+	require.Error(t, err)
+}
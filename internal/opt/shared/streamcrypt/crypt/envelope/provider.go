@@ -0,0 +1,165 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// KeyProvider wraps and unwraps data keys with a key-encryption key (KEK)
+// that pgrwl itself never has to hold.
+type KeyProvider interface {
+	Wrap(dek []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+	Name() string
+}
+
+// File provider
+
+const (
+	kekSize   = 32
+	nonceSize = 12
+)
+
+type fileProvider struct {
+	aead cipher.AEAD
+}
+
+var _ KeyProvider = &fileProvider{}
+
+// NewFileProvider reads a 32-byte KEK from path: raw, hex or base64 encoded.
+// Data keys are wrapped with AES-256-GCM.
+func NewFileProvider(path string) (KeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read kek file: %w", err)
+	}
+	kek, err := decodeKEK(data)
+	if err != nil {
+		return nil, fmt.Errorf("kek file %q: %w", path, err)
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fileProvider{aead: aead}, nil
+}
+
+func decodeKEK(data []byte) ([]byte, error) {
+	if len(data) == kekSize {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if k, err := hex.DecodeString(text); err == nil && len(k) == kekSize {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(text); err == nil && len(k) == kekSize {
+		return k, nil
+	}
+	return nil, fmt.Errorf("expected a %d-byte key (raw, hex or base64)", kekSize)
+}
+
+func (p *fileProvider) Name() string {
+	return "file"
+}
+
+func (p *fileProvider) Wrap(dek []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, dek, nil), nil
+}
+
+func (p *fileProvider) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < nonceSize {
+		return nil, errors.New("wrapped key is too short")
+	}
+	dek, err := p.aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("cannot unwrap data key: wrong kek or corrupted header")
+	}
+	return dek, nil
+}
+
+// Exec provider
+
+const DefaultExecTimeout = 30 * time.Second
+
+type ExecProviderOpts struct {
+	// WrapCmd and UnwrapCmd are run with `sh -c`. Each reads the base64 of its
+	// input on stdin and writes the base64 of its output to stdout.
+	WrapCmd   string
+	UnwrapCmd string
+
+	// Timeout of one command run, DefaultExecTimeout when zero.
+	Timeout time.Duration
+}
+
+type execProvider struct {
+	opts ExecProviderOpts
+}
+
+var _ KeyProvider = &execProvider{}
+
+// NewExecProvider wraps data keys by running external commands, such as an
+// HSM or KMS CLI.
+func NewExecProvider(opts ExecProviderOpts) (KeyProvider, error) {
+	if opts.WrapCmd == "" || opts.UnwrapCmd == "" {
+		return nil, errors.New("exec kek provider: wrap and unwrap commands are required")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultExecTimeout
+	}
+	return &execProvider{opts: opts}, nil
+}
+
+func (p *execProvider) Name() string {
+	return "exec"
+}
+
+func (p *execProvider) Wrap(dek []byte) ([]byte, error) {
+	return p.run("wrap", p.opts.WrapCmd, dek)
+}
+
+func (p *execProvider) Unwrap(wrapped []byte) ([]byte, error) {
+	return p.run("unwrap", p.opts.UnwrapCmd, wrapped)
+}
+
+func (p *execProvider) run(op, command string, in []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec // the command is configured by the operator
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(in) + "\n")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "PGRWL_KEK_OP="+op)
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kek %s command: %w: %s", op, err, strings.TrimSpace(stderr.String()))
+	}
+	out, err := base64.StdEncoding.DecodeString(strings.TrimSpace(stdout.String()))
+	if err != nil {
+		return nil, fmt.Errorf("kek %s command: output is not base64: %w", op, err)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("kek %s command: empty output", op)
+	}
+	return out, nil
+}
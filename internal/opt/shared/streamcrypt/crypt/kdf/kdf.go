@@ -0,0 +1,185 @@
+// Package kdf derives encryption keys from passphrases with Argon2id.
+//
+// The Argon2id parameters are stored in object headers (see Params.Append),
+// so they can be changed without breaking objects written before. Deriving
+// a key is deliberately slow, so master keys are cached per passphrase, salt
+// and parameters, and per-object keys are derived from the master key and a
+// random object salt with HKDF, which is cheap.
+package kdf
+
+import (
+	"container/list"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	KeySize = 32
+
+	// EncodedSize is the size of Params in a header: time (4 bytes),
+	// memory in KiB (4 bytes) and threads (1 byte).
+	EncodedSize = 9
+
+	// Limits of parameters read from headers, so a crafted object cannot
+	// make a reader allocate unbounded memory.
+	MaxTime      = 64
+	MaxMemoryKiB = 4 * 1024 * 1024
+
+	// DefaultCacheSize is the number of master keys kept by the default cache.
+	DefaultCacheSize = 64
+)
+
+// Params are the Argon2id parameters.
+type Params struct {
+	Time      uint32
+	MemoryKiB uint32
+	Threads   uint8
+}
+
+// Default are the parameters used before they were configurable.
+var Default = Params{Time: 1, MemoryKiB: 64 * 1024, Threads: 4}
+
+func (p Params) Validate() error {
+	if p.Time < 1 || p.Time > MaxTime {
+		return fmt.Errorf("kdf: time must be in 1..%d (got: %d)", MaxTime, p.Time)
+	}
+	if p.Threads < 1 {
+		return errors.New("kdf: threads must be >= 1")
+	}
+	if p.MemoryKiB < 8*uint32(p.Threads) || p.MemoryKiB > MaxMemoryKiB {
+		return fmt.Errorf("kdf: memory must be in %d..%d KiB (got: %d)", 8*uint32(p.Threads), MaxMemoryKiB, p.MemoryKiB)
+	}
+	return nil
+}
+
+// Append appends the encoded parameters to b.
+func (p Params) Append(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, p.Time)
+	b = binary.BigEndian.AppendUint32(b, p.MemoryKiB)
+	return append(b, p.Threads)
+}
+
+// Read reads and validates parameters encoded by Append.
+func Read(r io.Reader) (Params, error) {
+	var b [EncodedSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return Params{}, err
+	}
+	p := Params{
+		Time:      binary.BigEndian.Uint32(b[0:4]),
+		MemoryKiB: binary.BigEndian.Uint32(b[4:8]),
+		Threads:   b[8],
+	}
+	if err := p.Validate(); err != nil {
+		return Params{}, err
+	}
+	return p, nil
+}
+
+// IDKey derives a key with Argon2id, without caching.
+func IDKey(password string, salt []byte, p Params) []byte {
+	return argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKiB, p.Threads, KeySize)
+}
+
+// ObjectKey derives the key of one object from a master key and the random
+// salt of the object. info separates the keys of different ciphers.
+func ObjectKey(master, objectSalt []byte, info string) ([]byte, error) {
+	return hkdf.Key(sha256.New, master, objectSalt, info, KeySize)
+}
+
+// Cache is a fixed-size LRU cache of master keys.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+type cacheKey struct {
+	password [sha256.Size]byte
+	salt     string
+	params   Params
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value []byte
+}
+
+// NewCache creates a cache of at most size master keys.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    max(size, 1),
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+var defaultCache = NewCache(DefaultCacheSize)
+
+// Key returns the master key for password, salt and p from the default cache,
+// deriving it on a miss.
+func Key(password string, salt []byte, p Params) []byte {
+	return defaultCache.Key(password, salt, p)
+}
+
+func (c *Cache) Key(password string, salt []byte, p Params) []byte {
+	k := cacheKey{password: sha256.Sum256([]byte(password)), salt: string(salt), params: p}
+
+	c.mu.Lock()
+	if el, ok := c.entries[k]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*cacheEntry).value
+	}
+	c.mu.Unlock()
+
+	// derived outside the lock, a concurrent miss for the same key only costs time
+	value := IDKey(password, salt, p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[k]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*cacheEntry).value
+	}
+	c.entries[k] = c.lru.PushFront(&cacheEntry{key: k, value: value})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return value
+}
+
+// Len returns the number of cached keys.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Salt is a random salt generated on first use. A writer shares it between
+// all objects it encrypts, so their master key is derived once, and readers
+// find it in the cache.
+type Salt struct {
+	once sync.Once
+	b    []byte
+	err  error
+}
+
+func (s *Salt) Get(size int) ([]byte, error) {
+	s.once.Do(func() {
+		s.b = make([]byte, size)
+		_, s.err = rand.Read(s.b)
+	})
+	return s.b, s.err
+}
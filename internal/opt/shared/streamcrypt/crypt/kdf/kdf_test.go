@@ -0,0 +1,74 @@
+package kdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fast = Params{Time: 1, MemoryKiB: 64, Threads: 1}
+
+func TestParams_RoundTrip(t *testing.T) {
+	b := Default.Append([]byte("x"))
+	require.Len(t, b, 1+EncodedSize)
+
+	p, err := Read(bytes.NewReader(b[1:]))
+	require.NoError(t, err)
+	assert.Equal(t, Default, p)
+}
+
+func TestParams_Validate(t *testing.T) {
+	assert.NoError(t, Default.Validate())
+	assert.NoError(t, fast.Validate())
+	assert.Error(t, Params{}.Validate())
+	assert.Error(t, Params{Time: MaxTime + 1, MemoryKiB: 64, Threads: 1}.Validate())
+	assert.Error(t, Params{Time: 1, MemoryKiB: 16, Threads: 4}.Validate())
+	assert.Error(t, Params{Time: 1, MemoryKiB: MaxMemoryKiB + 1, Threads: 1}.Validate())
+
+	_, err := Read(bytes.NewReader(Params{Time: 1, MemoryKiB: 64}.Append(nil)))
+	require.Error(t, err)
+}
+
+func TestCache_HitsAndEvicts(t *testing.T) {
+	c := NewCache(2)
+
+	a := c.Key("pass", []byte("salt-a"), fast)
+	assert.Equal(t, IDKey("pass", []byte("salt-a"), fast), a)
+	assert.Equal(t, a, c.Key("pass", []byte("salt-a"), fast))
+	assert.Equal(t, 1, c.Len())
+
+	// every input is part of the cache key
+	assert.NotEqual(t, a, c.Key("other", []byte("salt-a"), fast))
+	assert.NotEqual(t, a, c.Key("pass", []byte("salt-a"), Params{Time: 2, MemoryKiB: 64, Threads: 1}))
+	assert.Equal(t, 2, c.Len())
+
+	// the least recently used key was evicted, and is derived again
+	assert.Equal(t, a, c.Key("pass", []byte("salt-a"), fast))
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestObjectKey(t *testing.T) {
+	master := IDKey("pass", []byte("salt"), fast)
+	a, err := ObjectKey(master, []byte("object-1"), "info")
+	require.NoError(t, err)
+	b, err := ObjectKey(master, []byte("object-2"), "info")
+	require.NoError(t, err)
+	c, err := ObjectKey(master, []byte("object-1"), "other")
+	require.NoError(t, err)
+
+	assert.Len(t, a, KeySize)
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func TestSalt_GeneratedOnce(t *testing.T) {
+	var s Salt
+	a, err := s.Get(16)
+	require.NoError(t, err)
+	b, err := s.Get(16)
+	require.NoError(t, err)
+	assert.Len(t, a, 16)
+	assert.Equal(t, a, b)
+}
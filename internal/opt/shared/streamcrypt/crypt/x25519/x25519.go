@@ -0,0 +1,186 @@
+// Package x25519 implements public-key (envelope) encryption, similar to age.
+//
+// Every object gets a fresh ephemeral X25519 key. Its shared secret with the
+// recipient public key is expanded with HKDF-SHA256 into an AES-256-GCM key,
+// and the content is encrypted in the same chunks as aesgcm. The header holds
+// the ephemeral public key only, so a writer needs just the recipient public
+// key, and only the holder of the private key can decrypt.
+package x25519
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt/aesgcm"
+)
+
+const (
+	headerPrefix = "X25519v1"
+	keySize      = 32
+	hkdfInfo     = "pgrwl x25519 aes-256-gcm"
+
+	// key encodings, base64 (std) of the raw 32-byte keys
+	publicKeyPrefix  = "pgrwl-pub-"
+	privateKeyPrefix = "pgrwl-priv-"
+)
+
+var ErrNoPrivateKey = errors.New("x25519: private key is required to decrypt")
+
+type Crypter struct {
+	recipient *ecdh.PublicKey
+	identity  *ecdh.PrivateKey // nil for write-only crypters
+}
+
+var _ crypt.Crypter = &Crypter{}
+
+// NewCrypter creates a crypter from encoded keys. With only a public key it
+// can encrypt but not decrypt. With a private key the public key may be
+// empty, it is derived from the private one.
+func NewCrypter(publicKey, privateKey string) (crypt.Crypter, error) {
+	c := &Crypter{}
+	if privateKey != "" {
+		priv, err := ParsePrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		c.identity = priv
+		c.recipient = priv.PublicKey()
+	}
+	if publicKey != "" {
+		pub, err := ParsePublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if c.recipient != nil && !c.recipient.Equal(pub) {
+			return nil, errors.New("x25519: public key does not match private key")
+		}
+		c.recipient = pub
+	}
+	if c.recipient == nil {
+		return nil, errors.New("x25519: public or private key is required")
+	}
+	return c, nil
+}
+
+// GenerateKeyPair returns a new encoded key pair.
+func GenerateKeyPair() (publicKey, privateKey string, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return EncodePublicKey(priv.PublicKey()), EncodePrivateKey(priv), nil
+}
+
+func EncodePublicKey(k *ecdh.PublicKey) string {
+	return publicKeyPrefix + base64.StdEncoding.EncodeToString(k.Bytes())
+}
+
+func EncodePrivateKey(k *ecdh.PrivateKey) string {
+	return privateKeyPrefix + base64.StdEncoding.EncodeToString(k.Bytes())
+}
+
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := decodeKey(s, publicKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("x25519: invalid public key: %w", err)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+func ParsePrivateKey(s string) (*ecdh.PrivateKey, error) {
+	raw, err := decodeKey(s, privateKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("x25519: invalid private key: %w", err)
+	}
+	return ecdh.X25519().NewPrivateKey(raw)
+}
+
+func decodeKey(s, prefix string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, prefix) {
+		return nil, fmt.Errorf("expected %q prefix", prefix)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, prefix))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("expected %d bytes, got %d", keySize, len(raw))
+	}
+	return raw, nil
+}
+
+func (c *Crypter) FileExtension() string {
+	return ".x25519"
+}
+
+func (c *Crypter) Name() string {
+	return "x25519"
+}
+
+// CanDecrypt reports whether the crypter holds a private key.
+func (c *Crypter) CanDecrypt() bool {
+	return c.identity != nil
+}
+
+func (c *Crypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ephemeral.ECDH(c.recipient)
+	if err != nil {
+		return nil, err
+	}
+	key, err := fileKey(secret, ephemeral.PublicKey(), c.recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(headerPrefix), ephemeral.PublicKey().Bytes()...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return aesgcm.NewChunkedWriter(key, w)
+}
+
+func (c *Crypter) Decrypt(r io.Reader) (io.Reader, error) {
+	if c.identity == nil {
+		return nil, ErrNoPrivateKey
+	}
+
+	header := make([]byte, len(headerPrefix)+keySize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(headerPrefix)]) != headerPrefix {
+		return nil, errors.New("invalid file header")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(header[len(headerPrefix):])
+	if err != nil {
+		return nil, err
+	}
+	secret, err := c.identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	key, err := fileKey(secret, ephemeral, c.recipient)
+	if err != nil {
+		return nil, err
+	}
+	return aesgcm.NewChunkedReader(key, r)
+}
+
+// fileKey binds the content key to both public keys, as in age.
+func fileKey(secret []byte, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	return hkdf.Key(sha256.New, secret, salt, hkdfInfo, keySize)
+}
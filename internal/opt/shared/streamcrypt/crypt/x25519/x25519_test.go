@@ -0,0 +1,111 @@
+package x25519
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/streamcrypt/crypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encrypt(t *testing.T, c crypt.Crypter, data []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := c.Encrypt(&out)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return out.Bytes()
+}
+
+func decrypt(t *testing.T, c crypt.Crypter, data []byte) ([]byte, error) {
+	t.Helper()
+	r, err := c.Decrypt(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestX25519_WriteOnlyEncryptPrivateDecrypt(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	require.NoError(t, err)
+
+	writer, err := NewCrypter(pub, "")
+	require.NoError(t, err)
+	reader, err := NewCrypter("", priv)
+	require.NoError(t, err)
+
+	data := make([]byte, 200*1024+7) // several chunks
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	enc := encrypt(t, writer, data)
+	assert.True(t, bytes.HasPrefix(enc, []byte(headerPrefix)))
+
+	// the writer cannot read its own output
+	_, err = decrypt(t, writer, enc)
+	require.ErrorIs(t, err, ErrNoPrivateKey)
+
+	got, err := decrypt(t, reader, enc)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestX25519_EphemeralKeyPerObject(t *testing.T) {
+	pub, _, err := GenerateKeyPair()
+	require.NoError(t, err)
+	c, err := NewCrypter(pub, "")
+	require.NoError(t, err)
+
+	a := encrypt(t, c, []byte("same"))
+	b := encrypt(t, c, []byte("same"))
+	assert.NotEqual(t, a[:len(headerPrefix)+keySize], b[:len(headerPrefix)+keySize])
+}
+
+func TestX25519_WrongKeyAndTampering(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	require.NoError(t, err)
+	_, otherPriv, err := GenerateKeyPair()
+	require.NoError(t, err)
+
+	c, err := NewCrypter(pub, priv)
+	require.NoError(t, err)
+	enc := encrypt(t, c, []byte("secret wal"))
+
+	other, err := NewCrypter("", otherPriv)
+	require.NoError(t, err)
+	_, err = decrypt(t, other, enc)
+	require.Error(t, err)
+
+	tampered := bytes.Clone(enc)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = decrypt(t, c, tampered)
+	require.Error(t, err)
+
+	_, err = decrypt(t, c, []byte("AEADv1-not-x25519-header-at-all-0123456789"))
+	require.Error(t, err)
+}
+
+func TestX25519_KeyParsing(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	require.NoError(t, err)
+	otherPub, _, err := GenerateKeyPair()
+	require.NoError(t, err)
+
+	_, err = NewCrypter("", "")
+	require.Error(t, err)
+	_, err = NewCrypter(priv, "")
+	require.Error(t, err, "a private key is not a public key")
+	_, err = NewCrypter("pgrwl-pub-AAAA", "")
+	require.Error(t, err)
+	_, err = NewCrypter(otherPub, priv)
+	require.Error(t, err)
+
+	_, err = NewCrypter(pub, priv)
+	require.NoError(t, err)
+}
@@ -52,9 +52,9 @@ func CompressAndEncryptOptional(
 			return
 		}
 
-		// Properly close in reverse order
+		// Properly close in reverse order, Close writes what the compressor
+		// holds back
 		if compWriter != nil {
-			_ = compWriter.Flush()
 			_ = compWriter.Close()
 		}
 		if encWriter != nil {
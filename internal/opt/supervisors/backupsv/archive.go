@@ -0,0 +1,50 @@
+package backupsv
+
+import (
+	"context"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pgrwl/pgrwl/internal/core/xlog"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backup"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// walReceiverArchive is the WAL archived by the receiver of this process.
+type walReceiverArchive struct {
+	pgrw xlog.PgReceiveWal
+	stor *st.VariadicStorage
+}
+
+var _ backup.WALArchive = &walReceiverArchive{}
+
+// receiverArchive returns nil without a receiver.
+func receiverArchive(pgrw xlog.PgReceiveWal, stor *st.VariadicStorage) backup.WALArchive {
+	if pgrw == nil {
+		return nil
+	}
+	return &walReceiverArchive{pgrw: pgrw, stor: stor}
+}
+
+func (a *walReceiverArchive) Stream() (string, uint32, bool) {
+	status := a.pgrw.Status()
+	if status == nil || !status.Running {
+		return "", 0, false
+	}
+	return status.SystemID, status.Timeline, true
+}
+
+// Archived looks up the WAL files in the storage, a file is there once it
+// is complete and uploaded.
+func (a *walReceiverArchive) Archived(ctx context.Context, tli uint32, start, stop pglogrepl.LSN) (pglogrepl.LSN, error) {
+	segSz := a.pgrw.WalSegSz()
+	for segNo := xlog.XLByteToSeg(uint64(start), segSz); ; segNo++ {
+		segStart := xlog.XLogSegNoToRecPtr(segNo, segSz)
+		if segStart >= stop {
+			return stop, nil
+		}
+		ok, err := a.stor.Exists(ctx, xlog.XLogFileName(tli, segNo, segSz))
+		if err != nil || !ok {
+			return max(segStart, start), err
+		}
+	}
+}
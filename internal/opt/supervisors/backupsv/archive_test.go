@@ -0,0 +1,53 @@
+package backupsv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pgrwl/pgrwl/internal/core/xlog"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReceiver struct {
+	xlog.PgReceiveWal
+	status *xlog.StreamStatus
+}
+
+func (r *fakeReceiver) Status() *xlog.StreamStatus { return r.status }
+func (r *fakeReceiver) WalSegSz() uint64           { return 16 << 20 }
+
+func TestReceiverArchiveLooksUpUploadedWAL(t *testing.T) {
+	ctx := context.Background()
+	backend := st.NewInMemoryStorage()
+	archive := receiverArchive(&fakeReceiver{status: &xlog.StreamStatus{
+		Running:      true,
+		SystemID:     "7001",
+		Timeline:     1,
+		LastFlushLSN: "0/5000000",
+	}}, newPlainVariadicStorage(t, backend))
+
+	systemID, tli, ok := archive.Stream()
+	assert.True(t, ok)
+	assert.Equal(t, "7001", systemID)
+	assert.Equal(t, uint32(1), tli)
+
+	// flushed by the receiver up to 0/5000000, uploaded up to 0/3000000
+	putRawObject(t, backend, "000000010000000000000001")
+	putRawObject(t, backend, "000000010000000000000002")
+
+	pos, err := archive.Archived(ctx, 1, 0x1000028, 0x4000028)
+	require.NoError(t, err)
+	assert.Equal(t, pglogrepl.LSN(0x3000000), pos)
+
+	pos, err = archive.Archived(ctx, 1, 0x1000028, 0x3000000)
+	require.NoError(t, err)
+	assert.Equal(t, pglogrepl.LSN(0x3000000), pos)
+
+	// nothing of another timeline
+	pos, err = archive.Archived(ctx, 2, 0x1000028, 0x3000000)
+	require.NoError(t, err)
+	assert.Equal(t, pglogrepl.LSN(0x1000028), pos)
+}
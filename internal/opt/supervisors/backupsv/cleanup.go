@@ -0,0 +1,146 @@
+package backupsv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/metrics/backupmetrics"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+// CleanupReport lists what the cleanup before a backup reclaimed.
+type CleanupReport struct {
+	// Backups are the IDs of the deleted orphaned backups.
+	Backups []string `json:"backups,omitempty"`
+	// Uploads are the paths of the aborted unfinished uploads.
+	Uploads []string `json:"uploads,omitempty"`
+	// BytesReclaimed is the size of the deleted backups and of the parts
+	// of the aborted uploads.
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// CleanupService removes what failed backups left in the repository:
+// orphaned backups, i.e. backup directories without a marker, and
+// unfinished multipart uploads.
+type CleanupService interface {
+	// RunBeforeBackup runs in the backup slot, so no backup of this process
+	// is running. On error, the report holds what was reclaimed until then.
+	RunBeforeBackup(ctx context.Context) (*CleanupReport, error)
+}
+
+type NoopCleanup struct{}
+
+func (NoopCleanup) RunBeforeBackup(ctx context.Context) (*CleanupReport, error) {
+	return nil, ctx.Err()
+}
+
+func NewCleanupService(opts *BackupSupervisorOpts) CleanupService {
+	if opts.Cfg == nil || !opts.Cfg.Backup.Cleanup.Enable {
+		return NoopCleanup{}
+	}
+
+	grace := opts.Cfg.Backup.Cleanup.GracePeriodParsed
+	if grace <= 0 {
+		grace = config.DefaultCleanupGracePeriod
+	}
+	return &orphanCleanup{
+		l:     slog.With(slog.String("component", "basebackup-cleanup")),
+		stor:  opts.BasebackupStor,
+		grace: grace,
+		now:   time.Now,
+	}
+}
+
+type orphanCleanup struct {
+	l     *slog.Logger
+	stor  st.Storage
+	grace time.Duration
+	now   func() time.Time
+}
+
+var _ CleanupService = &orphanCleanup{}
+
+func (c *orphanCleanup) RunBeforeBackup(ctx context.Context) (*CleanupReport, error) {
+	before := c.now().UTC().Add(-c.grace)
+	rep := &CleanupReport{}
+
+	dirs, err := c.stor.ListTopLevelDirs(ctx, "")
+	if err != nil {
+		return rep, fmt.Errorf("list backups: %w", err)
+	}
+	for _, dir := range slices.Sorted(maps.Keys(dirs)) {
+		id := backupBaseName(dir)
+
+		orphaned, size, err := c.orphaned(ctx, id, before)
+		if err != nil {
+			return rep, fmt.Errorf("check backup %s: %w", id, err)
+		}
+		if !orphaned {
+			continue
+		}
+		if err := c.stor.DeleteDir(ctx, dir); err != nil {
+			return rep, fmt.Errorf("delete orphaned backup %s: %w", id, err)
+		}
+
+		c.l.Info("orphaned backup deleted",
+			slog.String("backup_id", id),
+			slog.Int64("bytes", size),
+		)
+		backupmetrics.M.AddBasebackupCleanup("orphan", float64(size))
+		rep.Backups = append(rep.Backups, id)
+		rep.BytesReclaimed += size
+	}
+
+	uploads, err := st.AbortUploads(ctx, c.stor, "", before)
+	for _, u := range uploads {
+		backupmetrics.M.AddBasebackupCleanup("upload", float64(u.Size))
+		rep.Uploads = append(rep.Uploads, u.Path)
+		rep.BytesReclaimed += u.Size
+	}
+	if err != nil {
+		return rep, fmt.Errorf("abort unfinished uploads: %w", err)
+	}
+
+	if len(rep.Backups) > 0 || len(rep.Uploads) > 0 {
+		c.l.Info("failed backups cleaned up",
+			slog.Int("backups", len(rep.Backups)),
+			slog.Int("uploads", len(rep.Uploads)),
+			slog.Int64("bytes_reclaimed", rep.BytesReclaimed),
+		)
+	}
+	return rep, nil
+}
+
+// orphaned reports whether the backup id has no marker and none of its files
+// was written since before, with the size of its files. Directories that are
+// not named like a backup are left alone.
+func (c *orphanCleanup) orphaned(ctx context.Context, id string, before time.Time) (bool, int64, error) {
+	started, err := time.Parse(backupdto.IDLayout, id)
+	if err != nil || !started.Before(before) {
+		return false, 0, nil
+	}
+
+	ok, err := c.stor.Exists(ctx, path.Join(id, id+".json"))
+	if err != nil || ok {
+		return false, 0, err
+	}
+
+	var size int64
+	for fi, err := range c.stor.Iterate(ctx, id, st.IterateOpts{}) {
+		if err != nil {
+			return false, 0, err
+		}
+		if !fi.ModTime.Before(before) {
+			return false, 0, nil
+		}
+		size += fi.Size
+	}
+	return true, size, nil
+}
@@ -0,0 +1,169 @@
+package backupsv
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgrwl/pgrwl/config"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
+)
+
+var cleanupNow = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// agedStorage reports the modification times of its files by backup ID,
+// and keeps unfinished uploads.
+type agedStorage struct {
+	*st.InMemoryStorage
+
+	modTimes map[string]time.Time
+	uploads  []st.Upload
+
+	deleteDirErr error
+}
+
+func newAgedStorage() *agedStorage {
+	return &agedStorage{
+		InMemoryStorage: st.NewInMemoryStorage(),
+		modTimes:        map[string]time.Time{},
+	}
+}
+
+// put stores a file of a backup, written at modTime.
+func (s *agedStorage) put(t *testing.T, path string, data string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, s.Put(context.Background(), path, strings.NewReader(data)))
+	s.modTimes[path] = modTime
+}
+
+func (s *agedStorage) Iterate(ctx context.Context, path string, opts st.IterateOpts) iter.Seq2[st.FileInfo, error] {
+	return func(yield func(st.FileInfo, error) bool) {
+		for fi, err := range s.InMemoryStorage.Iterate(ctx, path, opts) {
+			if err == nil {
+				fi.ModTime = s.modTimes[fi.Path]
+			}
+			if !yield(fi, err) {
+				return
+			}
+		}
+	}
+}
+
+func (s *agedStorage) DeleteDir(ctx context.Context, path string) error {
+	if s.deleteDirErr != nil {
+		return s.deleteDirErr
+	}
+	return s.InMemoryStorage.DeleteDir(ctx, path)
+}
+
+func (s *agedStorage) AbortUploads(_ context.Context, _ string, before time.Time) ([]st.Upload, error) {
+	var aborted, kept []st.Upload
+	for _, u := range s.uploads {
+		if u.Initiated.Before(before) {
+			aborted = append(aborted, u)
+		} else {
+			kept = append(kept, u)
+		}
+	}
+	s.uploads = kept
+	return aborted, nil
+}
+
+func newTestCleanup(stor st.Storage) *orphanCleanup {
+	return &orphanCleanup{
+		l:     testLogger(),
+		stor:  stor,
+		grace: 24 * time.Hour,
+		now:   func() time.Time { return cleanupNow },
+	}
+}
+
+func TestOrphanCleanupDeletesOrphanedBackups(t *testing.T) {
+	stor := newAgedStorage()
+	old := cleanupNow.Add(-48 * time.Hour)
+
+	// completed backup
+	stor.put(t, "20260301000000/base.tar", "base", old)
+	stor.put(t, "20260301000000/20260301000000.json", "{}", old)
+	// failed backups
+	stor.put(t, "20260302000000/base.tar", "12345", old)
+	stor.put(t, "20260302000000/16384.tar", "678", old)
+	stor.put(t, "20260303000000/base.tar.part00001", "1", old)
+	// started before the grace period, but still written to
+	stor.put(t, "20260304000000/base.tar.part00001", "1", old)
+	stor.put(t, "20260304000000/base.tar.part00002", "2", cleanupNow.Add(-time.Minute))
+	// started within the grace period
+	stor.put(t, "20260310000000/base.tar", "base", cleanupNow.Add(-time.Hour))
+	// not a backup
+	stor.put(t, "scratch/notes.txt", "notes", old)
+
+	rep, err := newTestCleanup(stor).RunBeforeBackup(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20260302000000", "20260303000000"}, rep.Backups)
+	assert.Empty(t, rep.Uploads)
+	assert.Equal(t, int64(9), rep.BytesReclaimed)
+
+	assert.Contains(t, stor.Files, "20260301000000/base.tar")
+	assert.NotContains(t, stor.Files, "20260302000000/base.tar")
+	assert.NotContains(t, stor.Files, "20260302000000/16384.tar")
+	assert.NotContains(t, stor.Files, "20260303000000/base.tar.part00001")
+	assert.Contains(t, stor.Files, "20260304000000/base.tar.part00001")
+	assert.Contains(t, stor.Files, "20260310000000/base.tar")
+	assert.Contains(t, stor.Files, "scratch/notes.txt")
+}
+
+func TestOrphanCleanupAbortsStaleUploads(t *testing.T) {
+	stor := newAgedStorage()
+	stor.uploads = []st.Upload{
+		{Path: "20260302000000/base.tar", Initiated: cleanupNow.Add(-48 * time.Hour), Size: 100},
+		{Path: "20260310000000/base.tar", Initiated: cleanupNow.Add(-time.Hour), Size: 50},
+	}
+
+	rep, err := newTestCleanup(stor).RunBeforeBackup(context.Background())
+
+	require.NoError(t, err)
+	assert.Empty(t, rep.Backups)
+	assert.Equal(t, []string{"20260302000000/base.tar"}, rep.Uploads)
+	assert.Equal(t, int64(100), rep.BytesReclaimed)
+	require.Len(t, stor.uploads, 1)
+	assert.Equal(t, "20260310000000/base.tar", stor.uploads[0].Path)
+}
+
+func TestOrphanCleanupReturnsReportOnError(t *testing.T) {
+	stor := newAgedStorage()
+	stor.put(t, "20260302000000/base.tar", "12345", cleanupNow.Add(-48*time.Hour))
+	stor.deleteDirErr = errors.New("access denied")
+
+	rep, err := newTestCleanup(stor).RunBeforeBackup(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "delete orphaned backup 20260302000000")
+	require.NotNil(t, rep)
+	assert.Empty(t, rep.Backups)
+	assert.Contains(t, stor.Files, "20260302000000/base.tar")
+}
+
+func TestNewCleanupService(t *testing.T) {
+	stor := newAgedStorage()
+
+	assert.IsType(t, NoopCleanup{}, NewCleanupService(&BackupSupervisorOpts{
+		BasebackupStor: stor,
+		Cfg:            &config.Config{},
+	}))
+
+	svc := NewCleanupService(&BackupSupervisorOpts{
+		BasebackupStor: stor,
+		Cfg: &config.Config{Backup: config.BackupConfig{
+			Cleanup: config.BackupCleanupConfig{Enable: true},
+		}},
+	})
+	require.IsType(t, &orphanCleanup{}, svc)
+	assert.Equal(t, config.DefaultCleanupGracePeriod, svc.(*orphanCleanup).grace)
+}
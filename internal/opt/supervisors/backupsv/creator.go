@@ -2,27 +2,81 @@ package backupsv
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 
+	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backup"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/restore"
+	"github.com/pgrwl/pgrwl/internal/opt/metrics/backupmetrics"
 )
 
+var ErrBackupVerifyFailed = errors.New("basebackup verification failed")
+
 type BaseBackupCreator interface {
-	Create(ctx context.Context) error
+	// Create takes a backup, the result is returned when the backup was
+	// stored, even if its verification failed.
+	Create(ctx context.Context, opts RunOpts) (*backupdto.Result, error)
 }
 
 type basebackupCreator struct {
 	Directory string
+
+	// Verify, when set, verifies every created backup. The ID of the
+	// created backup is set before each run.
+	Verify *restore.VerifyOpts
+
+	// Progress receives the progress of the running backup, may be nil.
+	Progress backup.ProgressFunc
+
+	// Archive is the WAL of the receiver, may be nil.
+	Archive backup.WALArchive
 }
 
 var _ BaseBackupCreator = &basebackupCreator{}
 
-func (c *basebackupCreator) Create(ctx context.Context) error {
+func (c *basebackupCreator) Create(ctx context.Context, runOpts RunOpts) (*backupdto.Result, error) {
 	if err := ctx.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err := backup.CreateBaseBackup(&backup.CreateBaseBackupOpts{
-		Directory: c.Directory,
+	result, err := backup.CreateBaseBackup(ctx, &backup.CreateBaseBackupOpts{
+		Directory:         c.Directory,
+		Incremental:       runOpts.Type == config.BackupTypeIncremental,
+		Full:              runOpts.Type == config.BackupTypeFull,
+		ServerCompression: runOpts.ServerCompression,
+		IncludeWAL:        runOpts.IncludeWAL,
+		Label:             runOpts.Label,
+		Annotations:       runOpts.Annotations,
+		Pinned:            runOpts.Pinned,
+		Schedule:          runOpts.Schedule,
+		RetentionClass:    runOpts.RetentionClass,
+		Progress:          c.Progress,
+		Archive:           c.Archive,
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
+	if c.Verify == nil {
+		return result, nil
+	}
+
+	opts := *c.Verify
+	opts.ID = result.ID
+	rep, err := restore.VerifyBackup(ctx, &opts)
+	if err != nil {
+		return result, err
+	}
+	backupmetrics.M.IncBasebackupVerifications(rep.OK)
+	if !rep.OK {
+		slog.Error("basebackup verification failed",
+			slog.String("component", "basebackup-verify"),
+			slog.String("id", rep.BackupID),
+			slog.Any("problems", rep.Problems),
+			slog.Any("missing_wal", rep.WAL.Missing),
+		)
+		return result, ErrBackupVerifyFailed
+	}
+	return result, nil
 }
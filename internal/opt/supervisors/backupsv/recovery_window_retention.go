@@ -58,19 +58,22 @@ func (r *recoveryWindowRetention) RunBeforeBackup(ctx context.Context) error {
 		minimumBackups = *cfg.Retention.KeepLast
 	}
 
+	now := time.Now().UTC()
 	anchor := chooseRecoveryWindowAnchor(
 		successful,
 		cfg.Retention.KeepDurationParsed,
 		minimumBackups,
-		time.Now().UTC(),
+		now,
 	)
 	if anchor == nil {
 		return nil
 	}
 
 	backupsToDelete := backupsOlderThanAnchor(successful, anchor)
+	backupsToDelete = keepParents(successful, keepHeld(successful, backupsToDelete, now))
+	keepWAL := heldWALRanges(successful, anchor, now)
 
-	r.logPlan(anchor, backupsToDelete, len(successful), minimumBackups)
+	r.logPlan(anchor, backupsToDelete, keepWAL, len(successful), minimumBackups)
 
 	if len(backupsToDelete) > 0 {
 		if err := r.backupStore.DeleteBackups(ctx, backupsToDelete); err != nil {
@@ -78,7 +81,7 @@ func (r *recoveryWindowRetention) RunBeforeBackup(ctx context.Context) error {
 		}
 	}
 
-	if err := r.walCleaner.DeleteBefore(ctx, anchor.beginWAL); err != nil {
+	if err := r.walCleaner.DeleteBefore(ctx, anchor.beginWAL, keepWAL...); err != nil {
 		return fmt.Errorf("purge old WALs before %s: %w", anchor.beginWAL, err)
 	}
 
@@ -125,12 +128,19 @@ func (r *recoveryWindowRetention) loadSuccessfulBackups(ctx context.Context) ([]
 			continue
 		}
 
-		successful = append(successful, recoveryWindowBackup{
+		b := recoveryWindowBackup{
 			name:      backupID,
 			path:      backupPath,
 			startedAt: info.StartedAt,
 			beginWAL:  beginWAL,
-		})
+			endWAL:    r.backupEndWAL(info),
+			chain:     info.Chain,
+			pinned:    info.Pinned,
+		}
+		if class, ok := r.opts.Cfg.Retention.Classes[info.RetentionClass]; ok && class.KeepParsed > 0 {
+			b.keepUntil = info.StartedAt.Add(class.KeepParsed)
+		}
+		successful = append(successful, b)
 	}
 
 	return successful, nil
@@ -179,9 +189,45 @@ func (r *recoveryWindowRetention) backupBeginWAL(info *backupdto.Result) string
 	)
 }
 
+// backupEndWAL returns the last WAL file needed to restore the backup,
+// empty when it cannot be determined.
+func (r *recoveryWindowRetention) backupEndWAL(info *backupdto.Result) string {
+	walSegSz := r.opts.WalSegSz
+	if info == nil || walSegSz == 0 {
+		return ""
+	}
+
+	timelineID := info.TimelineID
+	endLSN := info.StopLSN
+
+	if info.Manifest != nil && len(info.Manifest.WALRanges) > 0 {
+		walRange := info.Manifest.WALRanges[len(info.Manifest.WALRanges)-1]
+		if lsn, err := pglogrepl.ParseLSN(walRange.EndLSN); err == nil && lsn != 0 {
+			endLSN = lsn
+			if walRange.Timeline != 0 {
+				timelineID = walRange.Timeline
+			}
+		}
+	}
+
+	if timelineID == 0 || endLSN == 0 {
+		return ""
+	}
+
+	// the end LSN is exclusive, it may be the first byte of the next segment
+	segNo := xlog.XLByteToSeg(uint64(endLSN)-1, walSegSz)
+
+	return xlog.XLogFileName(
+		conv.ToUint32(timelineID),
+		segNo,
+		walSegSz,
+	)
+}
+
 func (r *recoveryWindowRetention) logPlan(
 	anchor *recoveryWindowBackup,
 	backupsToDelete []string,
+	keepWAL []WALRange,
 	successfulBackups int,
 	minimumBackups int,
 ) {
@@ -192,5 +238,6 @@ func (r *recoveryWindowRetention) logPlan(
 		slog.Int("minimum_backups", minimumBackups),
 		slog.Int("successful_backups", successfulBackups),
 		slog.Int("delete_backups", len(backupsToDelete)),
+		slog.Int("held_wal_ranges", len(keepWAL)),
 	)
 }
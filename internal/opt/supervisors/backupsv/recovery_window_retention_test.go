@@ -69,14 +69,16 @@ func (s *fakeBackupStore) DeleteBackups(_ context.Context, backupsToDelete []str
 type fakeWALCleaner struct {
 	calls       int
 	keepFromWAL string
+	keep        []WALRange
 	err         error
 }
 
 var _ WALCleaner = (*fakeWALCleaner)(nil)
 
-func (c *fakeWALCleaner) DeleteBefore(_ context.Context, keepFromWAL string) error {
+func (c *fakeWALCleaner) DeleteBefore(_ context.Context, keepFromWAL string, keep ...WALRange) error {
 	c.calls++
 	c.keepFromWAL = keepFromWAL
+	c.keep = keep
 	return c.err
 }
 
@@ -293,6 +295,58 @@ func TestRecoveryWindowRetentionRunBeforeBackupDeletesOldBackupsThenCleansWAL(t
 	assert.NotEmpty(t, cleaner.keepFromWAL)
 }
 
+func TestRecoveryWindowRetentionRunBeforeBackupKeepsPinnedBackup(t *testing.T) {
+	store := newFakeBackupStore()
+	store.dirs = map[string]bool{
+		"20260420065500": true,
+		"20260422065500": true,
+		"20260428065500": true,
+		"20260501065500": true,
+	}
+	now := time.Now().UTC()
+	pinned := manifestResultAt(t, now.Add(-12*24*time.Hour), 1, "0/1000000")
+	pinned.StopLSN = pglogrepl.LSN(0x1800000)
+	pinned.Pinned = true
+	store.manifests["20260420065500"] = pinned
+	store.manifests["20260422065500"] = manifestResultAt(t, now.Add(-10*24*time.Hour), 1, "0/1000000")
+	store.manifests["20260428065500"] = manifestResultAt(t, now.Add(-4*24*time.Hour), 1, "0/2000000")
+	store.manifests["20260501065500"] = manifestResultAt(t, now.Add(-24*time.Hour), 1, "0/3000000")
+
+	cleaner := &fakeWALCleaner{}
+	retention := newRetentionForTest(retentionConfigForTest(), store, cleaner)
+
+	err := retention.RunBeforeBackup(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20260422065500"}, store.deleted)
+	assert.Equal(t, "000000010000000000000002", cleaner.keepFromWAL)
+	assert.Equal(t, []WALRange{{
+		From: "000000010000000000000001",
+		To:   "000000010000000000000001",
+	}}, cleaner.keep)
+}
+
+func TestRecoveryWindowRetentionBackupEndWAL(t *testing.T) {
+	retention := newRetentionForTest(retentionConfigForTest(), newFakeBackupStore(), &fakeWALCleaner{})
+
+	info := manifestResult(t, "2026-04-29T12:00:00Z", 1, "0/1000000")
+	info.StopLSN = pglogrepl.LSN(0x2000000)
+	// the stop LSN is the first byte of the next segment
+	assert.Equal(t, "000000010000000000000001", retention.backupEndWAL(info))
+
+	info.Manifest = &backupdto.BackupManifest{
+		WALRanges: []backupdto.ManifestWALRange{
+			{Timeline: 1, StartLSN: "0/1000000", EndLSN: "0/2000028"},
+			{Timeline: 2, StartLSN: "0/2000028", EndLSN: "0/3000028"},
+		},
+	}
+	assert.Equal(t, "000000020000000000000003", retention.backupEndWAL(info))
+
+	info.Manifest = nil
+	info.StopLSN = 0
+	assert.Empty(t, retention.backupEndWAL(info))
+}
+
 func TestRecoveryWindowRetentionRunBeforeBackupDoesNotCleanWALIfBackupDeleteFails(t *testing.T) {
 	store := newFakeBackupStore()
 	store.deleteErr = errors.New("delete backups failed")
@@ -13,6 +13,20 @@ type recoveryWindowBackup struct {
 	path      string
 	startedAt time.Time
 	beginWAL  string
+	// endWAL is the last WAL file the backup needs, empty when unknown.
+	endWAL string
+
+	// chain lists the parents of an incremental backup.
+	chain []string
+	// pinned backups are never deleted by retention.
+	pinned bool
+	// keepUntil is when the retention class of the backup stops keeping it.
+	keepUntil time.Time
+}
+
+// held reports whether the backup is kept regardless of the recovery window.
+func (b *recoveryWindowBackup) held(now time.Time) bool {
+	return b.pinned || now.Before(b.keepUntil)
 }
 
 func chooseRecoveryWindowAnchor(
@@ -89,10 +103,65 @@ func backupsOlderThanAnchor(backups []recoveryWindowBackup, anchor *recoveryWind
 	return toDelete
 }
 
+// keepParents removes from toDelete the parents of the backups that are
+// kept: an incremental backup cannot be restored without them.
+func keepParents(backups []recoveryWindowBackup, toDelete []string) []string {
+	deleted := make(map[string]bool, len(toDelete))
+	for _, name := range toDelete {
+		deleted[name] = true
+	}
+
+	needed := make(map[string]bool)
+	for _, b := range backups {
+		if deleted[b.name] {
+			continue
+		}
+		for _, parent := range b.chain {
+			needed[parent] = true
+		}
+	}
+
+	return slices.DeleteFunc(slices.Clone(toDelete), func(name string) bool {
+		return needed[name]
+	})
+}
+
+// keepHeld removes the pinned backups, and those their retention class
+// still keeps, from toDelete.
+func keepHeld(backups []recoveryWindowBackup, toDelete []string, now time.Time) []string {
+	held := make(map[string]bool)
+	for _, b := range backups {
+		if b.held(now) {
+			held[b.name] = true
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(toDelete), func(name string) bool {
+		return held[name]
+	})
+}
+
+// heldWALRanges returns the WAL of the held backups older than the anchor,
+// it must survive the cleanup of the WAL before the anchor.
+func heldWALRanges(backups []recoveryWindowBackup, anchor *recoveryWindowBackup, now time.Time) []WALRange {
+	var ranges []WALRange
+	for _, b := range backups {
+		if !b.held(now) || !walBefore(b.beginWAL, anchor.beginWAL) {
+			continue
+		}
+		r := WALRange{From: b.beginWAL, To: b.endWAL}
+		// without a known end keep everything up to the anchor
+		if r.To == "" {
+			r.To = anchor.beginWAL
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
 func normalizeWALFilename(path string) (name string, history, ok bool) {
 	base := filepath.Base(path)
 
-	// ListInfoRaw returns backend/raw paths, so compression/encryption suffixes
+	// IterateRaw yields backend/raw paths, so compression/encryption suffixes
 	// may still be present. Strip known transformation suffixes to get the
 	// underlying PostgreSQL WAL filename.
 	for {
@@ -101,7 +170,11 @@ func normalizeWALFilename(path string) (name string, history, ok bool) {
 		base = strings.TrimSuffix(base, ".gz")
 		base = strings.TrimSuffix(base, ".zst")
 		base = strings.TrimSuffix(base, ".lz4")
+		base = strings.TrimSuffix(base, ".xz")
 		base = strings.TrimSuffix(base, ".aes")
+		base = strings.TrimSuffix(base, ".chacha")
+		base = strings.TrimSuffix(base, ".x25519")
+		base = strings.TrimSuffix(base, ".kek")
 
 		if old == base {
 			break
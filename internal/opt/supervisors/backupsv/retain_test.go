@@ -242,6 +242,85 @@ func TestBackupsOlderThanAnchor(t *testing.T) {
 	})
 }
 
+func TestKeepParents(t *testing.T) {
+	full := makeBackup("20260420000000", mustTime(t, "2026-04-20T00:00:00Z"), "000000010000001000000001")
+	incr1 := makeBackup("20260425000000", mustTime(t, "2026-04-25T00:00:00Z"), "000000010000001100000001")
+	incr1.chain = []string{full.name}
+	incr2 := makeBackup("20260428000000", mustTime(t, "2026-04-28T00:00:00Z"), "000000010000001200000001")
+	incr2.chain = []string{full.name, incr1.name}
+	other := makeBackup("20260410000000", mustTime(t, "2026-04-10T00:00:00Z"), "000000010000000F00000001")
+
+	backups := []recoveryWindowBackup{other, full, incr1, incr2}
+
+	t.Run("parents of a kept backup are kept", func(t *testing.T) {
+		got := keepParents(backups, []string{other.name, full.name, incr1.name})
+		assert.Equal(t, []string{other.name}, got)
+	})
+
+	t.Run("a deleted chain is deleted entirely", func(t *testing.T) {
+		toDelete := []string{other.name, full.name, incr1.name, incr2.name}
+		got := keepParents(backups, toDelete)
+		assert.Equal(t, toDelete, got)
+	})
+
+	t.Run("full backups only", func(t *testing.T) {
+		got := keepParents([]recoveryWindowBackup{other, full}, []string{other.name})
+		assert.Equal(t, []string{other.name}, got)
+	})
+}
+
+func TestKeepHeld(t *testing.T) {
+	old := makeBackup("20260410000000", mustTime(t, "2026-04-10T00:00:00Z"), "000000010000000F00000001")
+	pinned := makeBackup("20260415000000", mustTime(t, "2026-04-15T00:00:00Z"), "000000010000000F00000080")
+	pinned.pinned = true
+	incr := makeBackup("20260416000000", mustTime(t, "2026-04-16T00:00:00Z"), "000000010000000F00000090")
+	incr.chain = []string{old.name}
+	incr.pinned = true
+
+	backups := []recoveryWindowBackup{old, pinned, incr}
+
+	now := mustTime(t, "2026-04-30T00:00:00Z")
+	got := keepHeld(backups, []string{old.name, pinned.name, incr.name}, now)
+	assert.Equal(t, []string{old.name}, got)
+
+	// the parents of a pinned incremental backup are kept as well
+	assert.Empty(t, keepParents(backups, got))
+}
+
+func TestKeepHeldByRetentionClass(t *testing.T) {
+	now := mustTime(t, "2026-04-30T00:00:00Z")
+	weekly := makeBackup("20260405000000", mustTime(t, "2026-04-05T00:00:00Z"), "000000010000000E00000001")
+	weekly.keepUntil = weekly.startedAt.Add(30 * 24 * time.Hour)
+	expired := makeBackup("20260329000000", mustTime(t, "2026-03-29T00:00:00Z"), "000000010000000D00000001")
+	expired.keepUntil = expired.startedAt.Add(30 * 24 * time.Hour)
+
+	got := keepHeld([]recoveryWindowBackup{weekly, expired}, []string{expired.name, weekly.name}, now)
+	assert.Equal(t, []string{expired.name}, got)
+
+	anchor := makeBackup("20260428000000", mustTime(t, "2026-04-28T00:00:00Z"), "000000010000001000000001")
+	weekly.endWAL = "000000010000000E00000002"
+	assert.Equal(t, []WALRange{{From: weekly.beginWAL, To: weekly.endWAL}},
+		heldWALRanges([]recoveryWindowBackup{weekly, expired, anchor}, &anchor, now))
+}
+
+func TestHeldWALRanges(t *testing.T) {
+	anchor := makeBackup("20260420000000", mustTime(t, "2026-04-20T00:00:00Z"), "000000010000001000000001")
+	pinned := makeBackup("20260410000000", mustTime(t, "2026-04-10T00:00:00Z"), "000000010000000F00000001")
+	pinned.endWAL = "000000010000000F00000003"
+	pinned.pinned = true
+	noEnd := makeBackup("20260412000000", mustTime(t, "2026-04-12T00:00:00Z"), "000000010000000F00000040")
+	noEnd.pinned = true
+	unpinned := makeBackup("20260411000000", mustTime(t, "2026-04-11T00:00:00Z"), "000000010000000F00000020")
+	newer := makeBackup("20260425000000", mustTime(t, "2026-04-25T00:00:00Z"), "000000010000001100000001")
+	newer.pinned = true
+
+	got := heldWALRanges([]recoveryWindowBackup{pinned, unpinned, noEnd, anchor, newer}, &anchor, anchor.startedAt)
+	assert.Equal(t, []WALRange{
+		{From: "000000010000000F00000001", To: "000000010000000F00000003"},
+		{From: "000000010000000F00000040", To: "000000010000001000000001"},
+	}, got)
+}
+
 func TestNormalizeWALFilename(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -2,20 +2,69 @@ package backupsv
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/hooks"
 )
 
 type BackupRunnerOpts struct {
 	State      BackupState
 	Retention  RetentionService
 	Basebackup BaseBackupCreator
+	Lease      LeaseHolder
+	// Cleanup removes failed backups before each backup, may be nil.
+	Cleanup CleanupService
+	// Hooks run before and after each backup, may be nil.
+	Hooks *hooks.Runner
+	// Catalog records every run, may be nil.
+	Catalog CatalogRecorder
+}
+
+// CatalogRecorder records backup runs in the backup catalog.
+type CatalogRecorder interface {
+	Append(ctx context.Context, e catalog.Entry) error
+}
+
+// catalogTimeout bounds recording a run, which also happens after the run
+// was cancelled.
+const catalogTimeout = time.Minute
+
+// RunOpts are the options of a single backup run, on top of the config.
+type RunOpts struct {
+	// IncludeWAL makes the backup self-contained, as backup.include_wal does.
+	IncludeWAL bool
+
+	// Label replaces the default "pgrwl_<id>" label of the backup.
+	Label string
+	// Annotations are free-form key/value pairs stored with the backup.
+	Annotations map[string]string
+	// Pinned makes retention keep the backup and the WAL it needs.
+	Pinned bool
+
+	// Schedule is the name of the schedule of a scheduled run.
+	Schedule string
+	// Type is config.BackupTypeFull or config.BackupTypeIncremental, as
+	// backup.incremental.enable decides when empty.
+	Type string
+	// ServerCompression replaces backup.server_compression when not nil.
+	ServerCompression *config.CompressionOverride
+	// RetentionClass is recorded with the backup for retention.
+	RetentionClass string
 }
 
 type BackupRunner interface {
-	Run(ctx context.Context, source string) error
-	StartAsync(ctx context.Context, source string) (*BackupRunState, error)
+	Run(ctx context.Context, source string, opts RunOpts) error
+	StartAsync(ctx context.Context, source string, opts RunOpts) (*BackupRunState, error)
+	// Cancel cancels the running backup, ErrNoBackupRunning when there is none.
+	Cancel() error
 }
 
 type backupRunner struct {
@@ -23,6 +72,13 @@ type backupRunner struct {
 	state      BackupState
 	retention  RetentionService
 	basebackup BaseBackupCreator
+	lease      LeaseHolder
+	cleanup    CleanupService
+	hooks      *hooks.Runner
+	catalog    CatalogRecorder
+
+	mu     sync.Mutex
+	cancel context.CancelCauseFunc // of the running backup
 }
 
 var _ BackupRunner = &backupRunner{}
@@ -33,25 +89,30 @@ func NewBackupRunner(opts *BackupRunnerOpts) BackupRunner {
 		state:      opts.State,
 		retention:  opts.Retention,
 		basebackup: opts.Basebackup,
+		lease:      opts.Lease,
+		cleanup:    opts.Cleanup,
+		hooks:      opts.Hooks,
+		catalog:    opts.Catalog,
 	}
 }
 
-func (r *backupRunner) Run(ctx context.Context, source string) error {
-	if _, err := r.reserve(ctx, source); err != nil {
+func (r *backupRunner) Run(ctx context.Context, source string, opts RunOpts) error {
+	ctx, _, err := r.reserve(ctx, source)
+	if err != nil {
 		return err
 	}
 
-	return r.runReserved(ctx, source)
+	return r.runReserved(ctx, source, opts)
 }
 
-func (r *backupRunner) StartAsync(ctx context.Context, source string) (*BackupRunState, error) {
-	state, err := r.reserve(ctx, source)
+func (r *backupRunner) StartAsync(ctx context.Context, source string, opts RunOpts) (*BackupRunState, error) {
+	ctx, state, err := r.reserve(ctx, source)
 	if err != nil {
 		return nil, err
 	}
 
 	go func() {
-		if err := r.runReserved(ctx, source); err != nil {
+		if err := r.runReserved(ctx, source, opts); err != nil && !errors.Is(err, ErrBackupCancelled) {
 			r.l.Error("async basebackup run failed",
 				slog.String("source", source),
 				slog.Any("err", err),
@@ -62,20 +123,60 @@ func (r *backupRunner) StartAsync(ctx context.Context, source string) (*BackupRu
 	return state, nil
 }
 
-func (r *backupRunner) reserve(ctx context.Context, source string) (*BackupRunState, error) {
+// reserve takes the backup slot and returns the context of the run, which
+// Cancel cancels.
+func (r *backupRunner) reserve(ctx context.Context, source string) (context.Context, *BackupRunState, error) {
 	if err := ctx.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if !r.state.Begin(source) {
-		return nil, ErrBackupAlreadyRunning
+		return nil, nil, ErrBackupAlreadyRunning
 	}
+	ctx, r.cancel = context.WithCancelCause(ctx)
 
 	state := r.state.Snapshot()
-	return &state, nil
+	return ctx, &state, nil
+}
+
+func (r *backupRunner) Cancel() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel == nil {
+		return ErrNoBackupRunning
+	}
+	r.l.Info("cancelling basebackup")
+	r.cancel(ErrBackupCancelled)
+	return nil
 }
 
-func (r *backupRunner) runReserved(ctx context.Context, source string) (err error) {
+// release records the end of the run and forgets its context. Both happen
+// at once, so that Cancel fails only once the state is no longer running,
+// and a new run cannot begin before.
+func (r *backupRunner) release(status BackupRunStatus, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.state.Finish(status, err.Error())
+	} else {
+		r.state.Finish(status, "")
+	}
+	r.cancel(nil)
+	r.cancel = nil
+}
+
+func (r *backupRunner) runReserved(ctx context.Context, source string, opts RunOpts) (err error) {
+	startedAt := time.Now().UTC()
+	var (
+		result *backupdto.Result
+		// post hooks run only once the pre hooks passed, as for restores
+		preHooksPassed bool
+	)
 	defer func() {
 		if rec := recover(); rec != nil {
 			err = fmt.Errorf("basebackup panicked: %v", rec)
@@ -87,18 +188,50 @@ func (r *backupRunner) runReserved(ctx context.Context, source string) (err erro
 			)
 		}
 
-		if err != nil {
-			r.state.Finish(BackupRunFailed, err.Error())
-			return
+		cancelled := errors.Is(context.Cause(ctx), ErrBackupCancelled)
+
+		status := BackupRunSucceeded
+		switch {
+		case err != nil && cancelled:
+			r.l.Warn("basebackup cancelled", slog.String("source", source))
+			err = ErrBackupCancelled
+			status = BackupRunCancelled
+		case err != nil:
+			status = BackupRunFailed
+		}
+
+		if preHooksPassed {
+			ev := backupEvent(hooks.PostBackup, source, opts, result)
+			ev.Status = hookStatus(status)
+			if err != nil {
+				ev.Error = err.Error()
+			}
+			if hookErr := r.hooks.Run(ctx, ev); hookErr != nil {
+				err = errors.Join(err, hookErr)
+				if status == BackupRunSucceeded {
+					status = BackupRunFailed
+				}
+			}
+		}
+
+		// the catalog belongs to the lease holder
+		if !errors.Is(err, ErrLeaseNotHeld) {
+			r.record(ctx, runEntry(source, opts, startedAt, result, status, err))
 		}
 
-		r.state.Finish(BackupRunSucceeded, "")
+		r.release(status, err)
 	}()
 
 	r.l.Info("starting basebackup",
 		slog.String("source", source),
 	)
 
+	if err := r.checkLease(); err != nil {
+		return err
+	}
+
+	r.runCleanup(ctx)
+
 	if err := r.retention.RunBeforeBackup(ctx); err != nil {
 		return fmt.Errorf("retention before basebackup: %w", err)
 	}
@@ -107,7 +240,17 @@ func (r *backupRunner) runReserved(ctx context.Context, source string) (err erro
 		return err
 	}
 
-	if err := r.basebackup.Create(ctx); err != nil {
+	if err := r.checkLease(); err != nil {
+		return err
+	}
+
+	if err := r.hooks.Run(ctx, backupEvent(hooks.PreBackup, source, opts, nil)); err != nil {
+		return err
+	}
+	preHooksPassed = true
+
+	result, err = r.basebackup.Create(ctx, opts)
+	if err != nil {
 		return fmt.Errorf("create basebackup: %w", err)
 	}
 
@@ -117,3 +260,97 @@ func (r *backupRunner) runReserved(ctx context.Context, source string) (err erro
 
 	return nil
 }
+
+// runCleanup removes what failed backups left behind. A failed cleanup is
+// logged and does not fail the backup, it is retried before the next one.
+func (r *backupRunner) runCleanup(ctx context.Context) {
+	if r.cleanup == nil {
+		return
+	}
+	rep, err := r.cleanup.RunBeforeBackup(ctx)
+	if rep != nil {
+		r.state.SetCleanup(*rep)
+	}
+	if err != nil && ctx.Err() == nil {
+		r.l.Warn("cleanup of failed backups failed", slog.Any("err", err))
+	}
+}
+
+// record appends a run to the catalog. A failure is logged, the catalog is
+// rebuilt from the backup markers if needed.
+func (r *backupRunner) record(ctx context.Context, e catalog.Entry) {
+	if r.catalog == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), catalogTimeout)
+	defer cancel()
+
+	if err := r.catalog.Append(ctx, e); err != nil {
+		r.l.Warn("cannot record the basebackup run in the catalog", slog.Any("err", err))
+	}
+}
+
+// runEntry describes a run to the catalog, result is nil when the backup was
+// not stored.
+func runEntry(source string, opts RunOpts, startedAt time.Time, result *backupdto.Result, status BackupRunStatus, err error) catalog.Entry {
+	var e catalog.Entry
+	if result != nil {
+		e = catalog.EntryFromResult(result)
+	} else {
+		e = catalog.Entry{
+			Schedule:       opts.Schedule,
+			Type:           opts.Type,
+			Label:          opts.Label,
+			Annotations:    opts.Annotations,
+			Pinned:         opts.Pinned,
+			RetentionClass: opts.RetentionClass,
+			StartedAt:      startedAt,
+			FinishedAt:     time.Now().UTC(),
+		}
+	}
+	e.Source = source
+	e.Status = string(status)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// backupEvent describes a backup run to its hooks, result is nil before the
+// backup was stored.
+func backupEvent(phase hooks.Phase, source string, opts RunOpts, result *backupdto.Result) *hooks.Event {
+	ev := &hooks.Event{
+		Phase:    phase,
+		Label:    opts.Label,
+		Source:   source,
+		Schedule: opts.Schedule,
+	}
+	if result != nil {
+		ev.BackupID = result.ID
+		ev.Label = result.Label
+		ev.StartLSN = result.StartLSN.String()
+		ev.StopLSN = result.StopLSN.String()
+		ev.BytesTotal = result.BytesTotal
+	}
+	return ev
+}
+
+func hookStatus(status BackupRunStatus) string {
+	switch status {
+	case BackupRunSucceeded:
+		return hooks.StatusSucceeded
+	case BackupRunCancelled:
+		return hooks.StatusCancelled
+	default:
+		return hooks.StatusFailed
+	}
+}
+
+// checkLease fails when the repository lease is configured but not held,
+// so that another receiver owns the backups and their retention.
+func (r *backupRunner) checkLease() error {
+	if r.lease != nil && !r.lease.Held() {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
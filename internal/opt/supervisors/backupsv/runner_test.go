@@ -5,12 +5,19 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/catalog"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/hooks"
 )
 
 type fakeRetentionService struct {
@@ -32,20 +39,26 @@ func (f *fakeRetentionService) RunBeforeBackup(ctx context.Context) error {
 }
 
 type fakeBaseBackupCreator struct {
-	calls int
-	err   error
-	panic any
+	calls    int
+	lastOpts RunOpts
+	result   *backupdto.Result
+	err      error
+	panic    any
 }
 
-func (f *fakeBaseBackupCreator) Create(ctx context.Context) error {
+func (f *fakeBaseBackupCreator) Create(ctx context.Context, opts RunOpts) (*backupdto.Result, error) {
 	f.calls++
+	f.lastOpts = opts
 	if f.panic != nil {
 		panic(f.panic)
 	}
 	if err := ctx.Err(); err != nil {
-		return err
+		return nil, err
 	}
-	return f.err
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.result, nil
 }
 
 type blockingBaseBackupCreator struct {
@@ -63,14 +76,14 @@ func newBlockingBaseBackupCreator() *blockingBaseBackupCreator {
 	}
 }
 
-func (c *blockingBaseBackupCreator) Create(ctx context.Context) error {
+func (c *blockingBaseBackupCreator) Create(ctx context.Context, _ RunOpts) (*backupdto.Result, error) {
 	c.once.Do(func() { close(c.started) })
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	case <-c.release:
-		return c.err
+		return nil, c.err
 	}
 }
 
@@ -93,19 +106,27 @@ func TestBackupRunnerRunFailsWhenContextAlreadyCanceled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	err := runner.Run(ctx, "manual")
+	err := runner.Run(ctx, "manual", RunOpts{})
 
 	assert.ErrorIs(t, err, context.Canceled)
 	assert.Equal(t, BackupRunIdle, state.Snapshot().Status)
 }
 
+func TestBackupRunnerRunPassesRunOpts(t *testing.T) {
+	creator := &fakeBaseBackupCreator{}
+	runner := newTestRunner(NewBackupState(), &fakeRetentionService{}, creator)
+
+	require.NoError(t, runner.Run(context.Background(), "manual", RunOpts{IncludeWAL: true}))
+	assert.True(t, creator.lastOpts.IncludeWAL)
+}
+
 func TestBackupRunnerRunSucceedsAndMarksStateSucceeded(t *testing.T) {
 	state := NewBackupState()
 	retention := &fakeRetentionService{}
 	creator := &fakeBaseBackupCreator{}
 	runner := newTestRunner(state, retention, creator)
 
-	err := runner.Run(context.Background(), "manual")
+	err := runner.Run(context.Background(), "manual", RunOpts{})
 
 	require.NoError(t, err)
 	assert.Equal(t, 1, retention.calls)
@@ -125,7 +146,7 @@ func TestBackupRunnerRunRetentionFailureSkipsBasebackupAndMarksFailed(t *testing
 	creator := &fakeBaseBackupCreator{}
 	runner := newTestRunner(state, retention, creator)
 
-	err := runner.Run(context.Background(), "cron")
+	err := runner.Run(context.Background(), "cron", RunOpts{})
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "retention before basebackup")
@@ -144,7 +165,7 @@ func TestBackupRunnerRunBasebackupFailureMarksFailed(t *testing.T) {
 	creator := &fakeBaseBackupCreator{err: errors.New("basebackup failed")}
 	runner := newTestRunner(state, retention, creator)
 
-	err := runner.Run(context.Background(), "cron")
+	err := runner.Run(context.Background(), "cron", RunOpts{})
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "create basebackup")
@@ -157,13 +178,36 @@ func TestBackupRunnerRunBasebackupFailureMarksFailed(t *testing.T) {
 	assert.Contains(t, snap.LastError, "create basebackup")
 }
 
+type fakeLease bool
+
+func (f fakeLease) Held() bool { return bool(f) }
+
+func TestBackupRunnerRunSkipsWorkWithoutLease(t *testing.T) {
+	state := NewBackupState()
+	retention := &fakeRetentionService{}
+	creator := &fakeBaseBackupCreator{}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  retention,
+		Basebackup: creator,
+		Lease:      fakeLease(false),
+	})
+
+	err := runner.Run(context.Background(), "cron", RunOpts{})
+
+	require.ErrorIs(t, err, ErrLeaseNotHeld)
+	assert.Equal(t, 0, retention.calls)
+	assert.Equal(t, 0, creator.calls)
+	assert.Equal(t, BackupRunFailed, state.Snapshot().Status)
+}
+
 func TestBackupRunnerRunRecoversRetentionPanicAndMarksFailed(t *testing.T) {
 	state := NewBackupState()
 	retention := &fakeRetentionService{panic: "retention boom"}
 	creator := &fakeBaseBackupCreator{}
 	runner := newTestRunner(state, retention, creator)
 
-	err := runner.Run(context.Background(), "cron")
+	err := runner.Run(context.Background(), "cron", RunOpts{})
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "basebackup panicked")
@@ -182,7 +226,7 @@ func TestBackupRunnerRunRecoversBasebackupPanicAndMarksFailed(t *testing.T) {
 	creator := &fakeBaseBackupCreator{panic: "creator boom"}
 	runner := newTestRunner(state, retention, creator)
 
-	err := runner.Run(context.Background(), "cron")
+	err := runner.Run(context.Background(), "cron", RunOpts{})
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "basebackup panicked")
@@ -201,7 +245,7 @@ func TestBackupRunnerRunReturnsAlreadyRunning(t *testing.T) {
 
 	runner := newTestRunner(state, &fakeRetentionService{}, &fakeBaseBackupCreator{})
 
-	err := runner.Run(context.Background(), "manual")
+	err := runner.Run(context.Background(), "manual", RunOpts{})
 
 	assert.ErrorIs(t, err, ErrBackupAlreadyRunning)
 	assert.Equal(t, "existing", state.Snapshot().Source)
@@ -212,7 +256,7 @@ func TestBackupRunnerStartAsyncReservesImmediatelyAndEventuallySucceeds(t *testi
 	creator := newBlockingBaseBackupCreator()
 	runner := newTestRunner(state, &fakeRetentionService{}, creator)
 
-	running, err := runner.StartAsync(context.Background(), "manual")
+	running, err := runner.StartAsync(context.Background(), "manual", RunOpts{})
 	require.NoError(t, err)
 	require.NotNil(t, running)
 	assert.True(t, running.Running)
@@ -227,7 +271,7 @@ func TestBackupRunnerStartAsyncReservesImmediatelyAndEventuallySucceeds(t *testi
 		}
 	}, time.Second, 10*time.Millisecond)
 
-	_, err = runner.StartAsync(context.Background(), "manual")
+	_, err = runner.StartAsync(context.Background(), "manual", RunOpts{})
 	assert.ErrorIs(t, err, ErrBackupAlreadyRunning)
 
 	close(creator.release)
@@ -243,7 +287,7 @@ func TestBackupRunnerStartAsyncEventuallyMarksFailure(t *testing.T) {
 	creator.err = errors.New("async failed")
 	runner := newTestRunner(state, &fakeRetentionService{}, creator)
 
-	_, err := runner.StartAsync(context.Background(), "manual")
+	_, err := runner.StartAsync(context.Background(), "manual", RunOpts{})
 	require.NoError(t, err)
 
 	assert.Eventually(t, func() bool {
@@ -268,7 +312,7 @@ func TestBackupRunnerStartAsyncRecoversPanicAndMarksFailure(t *testing.T) {
 	creator := &fakeBaseBackupCreator{panic: "async panic"}
 	runner := newTestRunner(state, &fakeRetentionService{}, creator)
 
-	_, err := runner.StartAsync(context.Background(), "manual")
+	_, err := runner.StartAsync(context.Background(), "manual", RunOpts{})
 	require.NoError(t, err)
 
 	assert.Eventually(t, func() bool {
@@ -276,3 +320,368 @@ func TestBackupRunnerStartAsyncRecoversPanicAndMarksFailure(t *testing.T) {
 		return snap.Status == BackupRunFailed && snap.LastError != ""
 	}, time.Second, 10*time.Millisecond)
 }
+
+func TestBackupRunnerCancelWithoutRunningBackup(t *testing.T) {
+	runner := newTestRunner(NewBackupState(), &fakeRetentionService{}, &fakeBaseBackupCreator{})
+
+	assert.ErrorIs(t, runner.Cancel(), ErrNoBackupRunning)
+}
+
+func TestBackupRunnerCancelMarksStateCancelled(t *testing.T) {
+	state := NewBackupState()
+	creator := newBlockingBaseBackupCreator()
+	runner := newTestRunner(state, &fakeRetentionService{}, creator)
+
+	_, err := runner.StartAsync(context.Background(), "manual", RunOpts{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		select {
+		case <-creator.started:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, runner.Cancel())
+
+	assert.Eventually(t, func() bool {
+		snap := state.Snapshot()
+		return snap.Status == BackupRunCancelled && !snap.Running
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, ErrBackupCancelled.Error(), state.Snapshot().LastError)
+
+	// the slot is free again
+	assert.ErrorIs(t, runner.Cancel(), ErrNoBackupRunning)
+	_, err = runner.StartAsync(context.Background(), "manual", RunOpts{})
+	assert.NoError(t, err)
+	require.NoError(t, runner.Cancel())
+}
+
+func TestBackupRunnerRunCancelledDuringRetention(t *testing.T) {
+	state := NewBackupState()
+	creator := &fakeBaseBackupCreator{}
+	var runner BackupRunner
+	retention := &cancellingRetentionService{cancel: func() { _ = runner.Cancel() }}
+	runner = newTestRunner(state, retention, creator)
+
+	err := runner.Run(context.Background(), "cron", RunOpts{})
+
+	assert.ErrorIs(t, err, ErrBackupCancelled)
+	assert.Equal(t, 0, creator.calls)
+	assert.Equal(t, BackupRunCancelled, state.Snapshot().Status)
+}
+
+func TestBackupRunnerRunsHooksAroundBackup(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hooks")
+	state := NewBackupState()
+	creator := &fakeBaseBackupCreator{result: &backupdto.Result{
+		ID:         "20260101000000",
+		StartLSN:   0x2000028,
+		StopLSN:    0x2000100,
+		BytesTotal: 4096,
+	}}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  &fakeRetentionService{},
+		Basebackup: creator,
+		Hooks: hooks.NewRunner(&config.HooksConfig{
+			PreBackup: []config.Hook{
+				{Command: `echo "pre $PGRWL_BACKUP_SCHEDULE $PGRWL_BACKUP_ID" >> ` + out},
+			},
+			PostBackup: []config.Hook{
+				{Command: `echo "post $PGRWL_HOOK_STATUS $PGRWL_BACKUP_ID $PGRWL_BACKUP_STOP_LSN $PGRWL_BACKUP_BYTES" >> ` + out},
+			},
+		}),
+	})
+
+	require.NoError(t, runner.Run(context.Background(), "cron", RunOpts{Schedule: "nightly"}))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "pre nightly \npost succeeded 20260101000000 0/2000100 4096\n", string(data))
+	assert.Equal(t, BackupRunSucceeded, state.Snapshot().Status)
+}
+
+func TestBackupRunnerRunningDuringPostHooks(t *testing.T) {
+	dir := t.TempDir()
+	started, release := filepath.Join(dir, "started"), filepath.Join(dir, "release")
+	state := NewBackupState()
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  &fakeRetentionService{},
+		Basebackup: &fakeBaseBackupCreator{},
+		Hooks: hooks.NewRunner(&config.HooksConfig{
+			PostBackup: []config.Hook{
+				{Command: "touch " + started + "; while [ ! -f " + release + " ]; do sleep 0.01; done"},
+			},
+		}),
+	})
+
+	_, err := runner.StartAsync(context.Background(), "manual", RunOpts{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// status and cancel agree while the post hooks run
+	assert.True(t, state.Snapshot().Running)
+	assert.NoError(t, runner.Cancel())
+
+	require.NoError(t, os.WriteFile(release, nil, 0o600))
+	assert.Eventually(t, func() bool {
+		return !state.Snapshot().Running
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, BackupRunSucceeded, state.Snapshot().Status)
+	assert.ErrorIs(t, runner.Cancel(), ErrNoBackupRunning)
+}
+
+func TestBackupRunnerPreHookFailureSkipsBackup(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hooks")
+	state := NewBackupState()
+	creator := &fakeBaseBackupCreator{}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  &fakeRetentionService{},
+		Basebackup: creator,
+		Hooks: hooks.NewRunner(&config.HooksConfig{
+			PreBackup:  []config.Hook{{Name: "pause-batch", Command: "exit 1"}},
+			PostBackup: []config.Hook{{Command: `echo "$PGRWL_HOOK_STATUS" > ` + out}},
+		}),
+	})
+
+	err := runner.Run(context.Background(), "manual", RunOpts{})
+
+	require.ErrorIs(t, err, hooks.ErrHookFailed)
+	assert.Equal(t, 0, creator.calls)
+	snap := state.Snapshot()
+	assert.Equal(t, BackupRunFailed, snap.Status)
+	assert.Contains(t, snap.LastError, "pre_backup hook pause-batch")
+	assert.NoFileExists(t, out, "post hooks run only after the pre hooks passed")
+}
+
+func TestBackupRunnerSkipsPostHooksWhenStoppedBeforePreHooks(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		lease     LeaseHolder
+		retention *fakeRetentionService
+		wantErr   string
+	}{
+		{"lease not held", fakeLease(false), &fakeRetentionService{}, ErrLeaseNotHeld.Error()},
+		{"retention failure", nil, &fakeRetentionService{err: errors.New("retention failed")}, "retention before basebackup"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "hooks")
+			creator := &fakeBaseBackupCreator{}
+			runner := NewBackupRunner(&BackupRunnerOpts{
+				State:      NewBackupState(),
+				Retention:  tc.retention,
+				Basebackup: creator,
+				Lease:      tc.lease,
+				Hooks: hooks.NewRunner(&config.HooksConfig{
+					PreBackup:  []config.Hook{{Command: `echo pre >> ` + out}},
+					PostBackup: []config.Hook{{Command: `echo post >> ` + out}},
+				}),
+			})
+
+			err := runner.Run(context.Background(), "cron", RunOpts{})
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+			assert.Equal(t, 0, creator.calls)
+			assert.NoFileExists(t, out)
+		})
+	}
+}
+
+func TestBackupRunnerPostHookFailurePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		onFailure  string
+		wantStatus BackupRunStatus
+	}{
+		{config.HookOnFailureWarn, BackupRunSucceeded},
+		{config.HookOnFailureAbort, BackupRunFailed},
+	} {
+		t.Run(tc.onFailure, func(t *testing.T) {
+			state := NewBackupState()
+			runner := NewBackupRunner(&BackupRunnerOpts{
+				State:      state,
+				Retention:  &fakeRetentionService{},
+				Basebackup: &fakeBaseBackupCreator{},
+				Hooks: hooks.NewRunner(&config.HooksConfig{
+					PostBackup: []config.Hook{{Command: "exit 1", OnFailure: tc.onFailure}},
+				}),
+			})
+
+			err := runner.Run(context.Background(), "manual", RunOpts{})
+
+			if tc.wantStatus == BackupRunSucceeded {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, hooks.ErrHookFailed)
+			}
+			assert.Equal(t, tc.wantStatus, state.Snapshot().Status)
+		})
+	}
+}
+
+// cancellingRetentionService cancels the run from within it.
+type cancellingRetentionService struct {
+	cancel func()
+}
+
+func (f *cancellingRetentionService) RunBeforeBackup(ctx context.Context) error {
+	f.cancel()
+	return ctx.Err()
+}
+
+type fakeCleanupService struct {
+	calls int
+	rep   *CleanupReport
+	err   error
+}
+
+func (f *fakeCleanupService) RunBeforeBackup(_ context.Context) (*CleanupReport, error) {
+	f.calls++
+	return f.rep, f.err
+}
+
+func TestBackupRunnerRunStoresCleanupReport(t *testing.T) {
+	state := NewBackupState()
+	cleanup := &fakeCleanupService{rep: &CleanupReport{
+		Backups:        []string{"20260302000000"},
+		BytesReclaimed: 42,
+	}}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  &fakeRetentionService{},
+		Basebackup: &fakeBaseBackupCreator{},
+		Cleanup:    cleanup,
+	})
+
+	require.NoError(t, runner.Run(context.Background(), "cron", RunOpts{}))
+
+	assert.Equal(t, 1, cleanup.calls)
+	snap := state.Snapshot()
+	require.NotNil(t, snap.LastCleanup)
+	assert.Equal(t, []string{"20260302000000"}, snap.LastCleanup.Backups)
+	assert.Equal(t, int64(42), snap.LastCleanup.BytesReclaimed)
+}
+
+func TestBackupRunnerRunIgnoresFailedCleanup(t *testing.T) {
+	state := NewBackupState()
+	creator := &fakeBaseBackupCreator{}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  &fakeRetentionService{},
+		Basebackup: creator,
+		Cleanup:    &fakeCleanupService{rep: &CleanupReport{}, err: errors.New("access denied")},
+	})
+
+	require.NoError(t, runner.Run(context.Background(), "cron", RunOpts{}))
+
+	assert.Equal(t, 1, creator.calls)
+	assert.Equal(t, BackupRunSucceeded, state.Snapshot().Status)
+}
+
+type fakeCatalog struct {
+	entries []catalog.Entry
+	err     error
+}
+
+func (f *fakeCatalog) Append(ctx context.Context, e catalog.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.entries = append(f.entries, e)
+	return f.err
+}
+
+func TestBackupRunnerRunRecordsSucceededRun(t *testing.T) {
+	cat := &fakeCatalog{}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:     NewBackupState(),
+		Retention: &fakeRetentionService{},
+		Basebackup: &fakeBaseBackupCreator{result: &backupdto.Result{
+			ID:         "20260301020000",
+			Parent:     "20260228020000",
+			Schedule:   "daily",
+			BytesTotal: 42,
+		}},
+		Catalog: cat,
+	})
+
+	require.NoError(t, runner.Run(context.Background(), "cron", RunOpts{Schedule: "daily"}))
+
+	require.Len(t, cat.entries, 1)
+	e := cat.entries[0]
+	assert.Equal(t, "20260301020000", e.BackupID)
+	assert.Equal(t, catalog.StatusSucceeded, e.Status)
+	assert.Equal(t, "cron", e.Source)
+	assert.Equal(t, "daily", e.Schedule)
+	assert.Equal(t, config.BackupTypeIncremental, e.Type)
+	assert.Equal(t, int64(42), e.BytesTotal)
+	assert.Empty(t, e.Error)
+}
+
+func TestBackupRunnerRunRecordsFailedRun(t *testing.T) {
+	cat := &fakeCatalog{err: errors.New("catalog unavailable")}
+	state := NewBackupState()
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      state,
+		Retention:  &fakeRetentionService{},
+		Basebackup: &fakeBaseBackupCreator{err: errors.New("connection refused")},
+		Catalog:    cat,
+	})
+
+	err := runner.Run(context.Background(), "manual", RunOpts{Label: "before-upgrade"})
+	require.Error(t, err)
+
+	require.Len(t, cat.entries, 1)
+	e := cat.entries[0]
+	assert.Empty(t, e.BackupID)
+	assert.Equal(t, catalog.StatusFailed, e.Status)
+	assert.Equal(t, "manual", e.Source)
+	assert.Equal(t, "before-upgrade", e.Label)
+	assert.Contains(t, e.Error, "connection refused")
+	assert.False(t, e.StartedAt.IsZero())
+	assert.False(t, e.FinishedAt.Before(e.StartedAt))
+	// a failed catalog does not change the outcome of the run
+	assert.Equal(t, BackupRunFailed, state.Snapshot().Status)
+}
+
+func TestBackupRunnerCancelledRunIsRecorded(t *testing.T) {
+	cat := &fakeCatalog{}
+	creator := newBlockingBaseBackupCreator()
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      NewBackupState(),
+		Retention:  &fakeRetentionService{},
+		Basebackup: creator,
+		Catalog:    cat,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(context.Background(), "manual", RunOpts{}) }()
+	<-creator.started
+	require.NoError(t, runner.Cancel())
+	assert.ErrorIs(t, <-done, ErrBackupCancelled)
+
+	require.Len(t, cat.entries, 1)
+	assert.Equal(t, catalog.StatusCancelled, cat.entries[0].Status)
+}
+
+func TestBackupRunnerRunWithoutLeaseIsNotRecorded(t *testing.T) {
+	cat := &fakeCatalog{}
+	runner := NewBackupRunner(&BackupRunnerOpts{
+		State:      NewBackupState(),
+		Retention:  &fakeRetentionService{},
+		Basebackup: &fakeBaseBackupCreator{},
+		Lease:      fakeLease(false),
+		Catalog:    cat,
+	})
+
+	require.ErrorIs(t, runner.Run(context.Background(), "cron", RunOpts{}), ErrLeaseNotHeld)
+	assert.Empty(t, cat.entries)
+}
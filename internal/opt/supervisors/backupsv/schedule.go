@@ -0,0 +1,105 @@
+package backupsv
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/pgrwl/pgrwl/config"
+)
+
+// ScheduleStatus is a backup schedule with its next run.
+type ScheduleStatus struct {
+	Name           string     `json:"name"`
+	Cron           string     `json:"cron"`
+	Type           string     `json:"type,omitempty"`
+	RetentionClass string     `json:"retention_class,omitempty"`
+	NextRun        *time.Time `json:"next_run,omitempty"`
+}
+
+type scheduleEntry struct {
+	schedule config.BackupSchedule
+	id       cron.EntryID
+}
+
+// scheduleRunOpts returns the options of a run of sch.
+func scheduleRunOpts(sch *config.BackupSchedule) RunOpts {
+	opts := RunOpts{
+		Schedule:       sch.Name,
+		Type:           sch.Type,
+		RetentionClass: sch.RetentionClass,
+	}
+	if sch.ServerCompression.Algo != "" {
+		sc := sch.ServerCompression
+		opts.ServerCompression = &sc
+	}
+	return opts
+}
+
+// blackoutAt returns the blackout window t is in, nil when there is none.
+func blackoutAt(blackouts []config.BlackoutWindow, t time.Time) *config.BlackoutWindow {
+	for i := range blackouts {
+		if blackouts[i].Contains(t) {
+			return &blackouts[i]
+		}
+	}
+	return nil
+}
+
+// runScheduled runs a backup of sch, unless it falls into a blackout window.
+func (s *baseBackupSupervisor) runScheduled(ctx context.Context, sch *config.BackupSchedule) {
+	backupCfg := &s.opts.Cfg.Backup
+	if w := blackoutAt(backupCfg.Blackouts, time.Now().In(backupCfg.Location())); w != nil {
+		s.log().Info("scheduled basebackup skipped in a blackout window",
+			slog.String("schedule", sch.Name),
+			slog.String("blackout_start", w.Start),
+			slog.String("blackout_end", w.End),
+		)
+		return
+	}
+
+	if sch.TimeoutParsed > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sch.TimeoutParsed)
+		defer cancel()
+	}
+
+	err := s.runner.Run(ctx, "cron", scheduleRunOpts(sch))
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		s.log().Error("scheduled basebackup timed out",
+			slog.String("schedule", sch.Name),
+			slog.Duration("timeout", sch.TimeoutParsed),
+		)
+		return
+	}
+	if err != nil {
+		s.handleRunError("scheduled", err)
+	}
+}
+
+// scheduleStatuses returns the registered schedules with their next run.
+func (s *baseBackupSupervisor) scheduleStatuses() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) == 0 {
+		return nil
+	}
+	out := make([]ScheduleStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		st := ScheduleStatus{
+			Name:           e.schedule.Name,
+			Cron:           e.schedule.Cron,
+			Type:           e.schedule.Type,
+			RetentionClass: e.schedule.RetentionClass,
+		}
+		if next := s.cron.Entry(e.id).Next; !next.IsZero() {
+			st.NextRun = &next
+		}
+		out = append(out, st)
+	}
+	return out
+}
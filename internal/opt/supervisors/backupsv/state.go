@@ -1,8 +1,11 @@
 package backupsv
 
 import (
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
 )
 
 type BackupRunStatus string
@@ -12,6 +15,7 @@ const (
 	BackupRunRunning   BackupRunStatus = "running"
 	BackupRunSucceeded BackupRunStatus = "succeeded"
 	BackupRunFailed    BackupRunStatus = "failed"
+	BackupRunCancelled BackupRunStatus = "cancelled"
 )
 
 type BackupRunState struct {
@@ -21,11 +25,24 @@ type BackupRunState struct {
 	StartedAt  *time.Time      `json:"started_at,omitempty"`
 	FinishedAt *time.Time      `json:"finished_at,omitempty"`
 	LastError  string          `json:"last_error,omitempty"`
+
+	// Progress is the progress of the running backup, or the final one of
+	// the last backup. Nil until the server sent a progress report.
+	Progress *backupdto.Progress `json:"progress,omitempty"`
+
+	// LastCleanup is what the cleanup before the running or last backup
+	// reclaimed. Nil when cleanup is disabled.
+	LastCleanup *CleanupReport `json:"last_cleanup,omitempty"`
+
+	// Schedules are the backup schedules with their next run.
+	Schedules []ScheduleStatus `json:"schedules,omitempty"`
 }
 
 type BackupState interface {
 	Begin(source string) bool
 	Finish(status BackupRunStatus, errMsg string)
+	SetProgress(p backupdto.Progress)
+	SetCleanup(r CleanupReport)
 	Snapshot() BackupRunState
 }
 
@@ -85,6 +102,28 @@ func (s *backupState) Finish(status BackupRunStatus, errMsg string) {
 	s.state.LastError = errMsg
 }
 
+// SetProgress stores the progress of the running backup.
+func (s *backupState) SetProgress(p backupdto.Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.state.Running {
+		return
+	}
+	s.state.Progress = &p
+}
+
+// SetCleanup stores the cleanup report of the running backup.
+func (s *backupState) SetCleanup(r CleanupReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.state.Running {
+		return
+	}
+	s.state.LastCleanup = &r
+}
+
 func (s *backupState) Snapshot() BackupRunState {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -105,5 +144,17 @@ func cloneBackupRunState(in BackupRunState) BackupRunState {
 		out.FinishedAt = &t
 	}
 
+	if in.Progress != nil {
+		p := *in.Progress
+		out.Progress = &p
+	}
+
+	if in.LastCleanup != nil {
+		r := *in.LastCleanup
+		r.Backups = slices.Clone(r.Backups)
+		r.Uploads = slices.Clone(r.Uploads)
+		out.LastCleanup = &r
+	}
+
 	return out
 }
@@ -5,6 +5,7 @@ import (
 	"sync/atomic"
 	"testing"
 
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/backupdto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -103,6 +104,32 @@ func TestBackupStateSnapshotDeepCopiesTimePointers(t *testing.T) {
 	assert.Equal(t, finished, *snap2.FinishedAt)
 }
 
+func TestBackupStateProgress(t *testing.T) {
+	state := NewBackupState()
+
+	// ignored without a running backup
+	state.SetProgress(backupdto.Progress{BytesDone: 1})
+	assert.Nil(t, state.Snapshot().Progress)
+
+	require.True(t, state.Begin("manual"))
+	state.SetProgress(backupdto.Progress{BytesDone: 100, BytesTotal: 400, Percent: 25})
+
+	snap := state.Snapshot()
+	require.NotNil(t, snap.Progress)
+	assert.InDelta(t, 25.0, snap.Progress.Percent, 0.001)
+
+	// the snapshot is a copy
+	snap.Progress.BytesDone = 0
+	assert.Equal(t, int64(100), state.Snapshot().Progress.BytesDone)
+
+	// the last progress is kept after the backup finished
+	state.Finish(BackupRunSucceeded, "")
+	require.NotNil(t, state.Snapshot().Progress)
+
+	require.True(t, state.Begin("cron"))
+	assert.Nil(t, state.Snapshot().Progress)
+}
+
 func TestBackupStateConcurrentBeginAllowsOnlyOneWinner(t *testing.T) {
 	state := NewBackupState()
 
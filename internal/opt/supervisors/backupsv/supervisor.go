@@ -5,27 +5,53 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 
 	"github.com/pgrwl/pgrwl/config"
+	"github.com/pgrwl/pgrwl/internal/core/xlog"
+	"github.com/pgrwl/pgrwl/internal/opt/api"
+	"github.com/pgrwl/pgrwl/internal/opt/basebackup/restore"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/hooks"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 )
 
-var ErrBackupAlreadyRunning = errors.New("basebackup is already running")
+var (
+	ErrBackupAlreadyRunning = errors.New("basebackup is already running")
+	ErrLeaseNotHeld         = errors.New("repository lease is not held")
+	ErrNoBackupRunning      = errors.New("no basebackup is running")
+	ErrBackupCancelled      = errors.New("basebackup cancelled")
+)
+
+// LeaseHolder reports whether this process holds the repository lease.
+type LeaseHolder interface {
+	Held() bool
+}
 
 type BackupSupervisorOpts struct {
 	Directory      string
 	WalSegSz       uint64
 	BasebackupStor st.Storage
 	WalStor        *st.VariadicStorage
-	Cfg            *config.Config
+	// ManifestStor holds the signed WAL manifests, nil when signing is disabled.
+	ManifestStor st.Storage
+	Cfg          *config.Config
+	// Lease, when set, must be held for backups and retention to run.
+	Lease LeaseHolder
+	// Receiver is the WAL receiver of this process, backups taken from a
+	// standby wait for it to archive their WAL.
+	Receiver xlog.PgReceiveWal
+	// Catalog records the backup runs, nil when they are not recorded.
+	Catalog CatalogRecorder
 }
 
 type BaseBackupSupervisor interface {
 	RunCron(ctx context.Context) error
-	Trigger(ctx context.Context, source string) error
-	TriggerAsync(ctx context.Context, source string) (*BackupRunState, error)
+	Trigger(ctx context.Context, source string, opts RunOpts) error
+	TriggerAsync(ctx context.Context, source string, opts RunOpts) (*BackupRunState, error)
+	Cancel() error
 	BackupStatus() BackupRunState
 }
 
@@ -35,6 +61,9 @@ type baseBackupSupervisor struct {
 	state  BackupState
 	runner BackupRunner
 	cron   *cron.Cron
+
+	mu      sync.Mutex
+	entries []scheduleEntry
 }
 
 var _ BaseBackupSupervisor = &baseBackupSupervisor{}
@@ -45,6 +74,11 @@ func NewBaseBackupSupervisor(opts *BackupSupervisorOpts) (BaseBackupSupervisor,
 		return nil, err
 	}
 
+	verify, err := verifyOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	state := NewBackupState()
 
 	runner := NewBackupRunner(&BackupRunnerOpts{
@@ -52,7 +86,14 @@ func NewBaseBackupSupervisor(opts *BackupSupervisorOpts) (BaseBackupSupervisor,
 		Retention: NewRetentionService(opts),
 		Basebackup: &basebackupCreator{
 			Directory: opts.Directory,
+			Verify:    verify,
+			Progress:  state.SetProgress,
+			Archive:   receiverArchive(opts.Receiver, opts.WalStor),
 		},
+		Lease:   opts.Lease,
+		Cleanup: NewCleanupService(opts),
+		Hooks:   hooks.NewRunner(&opts.Cfg.Hooks),
+		Catalog: opts.Catalog,
 	})
 
 	return &baseBackupSupervisor{
@@ -60,7 +101,7 @@ func NewBaseBackupSupervisor(opts *BackupSupervisorOpts) (BaseBackupSupervisor,
 		opts:   opts,
 		state:  state,
 		runner: runner,
-		cron:   newBackupCron(),
+		cron:   newBackupCron(opts.Cfg.Backup.Location()),
 	}, nil
 }
 
@@ -86,6 +127,25 @@ func checkOpts(opts *BackupSupervisorOpts) error {
 	return nil
 }
 
+// verifyOpts returns nil when backups are not verified after creation.
+func verifyOpts(opts *BackupSupervisorOpts) (*restore.VerifyOpts, error) {
+	if !opts.Cfg.Backup.Verify {
+		return nil, nil
+	}
+	verifier, err := api.NewVerifier(opts.Cfg)
+	if err != nil {
+		return nil, fmt.Errorf("backup-supervisor, init verifier: %w", err)
+	}
+	return &restore.VerifyOpts{
+		BackupStor:    opts.BasebackupStor,
+		WalStor:       opts.WalStor,
+		WalSegSz:      opts.WalSegSz,
+		LocalWALDir:   opts.Directory,
+		Verifier:      verifier,
+		AllowUnsigned: opts.Cfg.Signing.AllowUnsigned,
+	}, nil
+}
+
 func (s *baseBackupSupervisor) log() *slog.Logger {
 	if s.l != nil {
 		return s.l
@@ -93,12 +153,15 @@ func (s *baseBackupSupervisor) log() *slog.Logger {
 	return slog.With(slog.String("component", "basebackup-supervisor"))
 }
 
-// RunCron starts the basebackup scheduler and blocks until ctx is canceled.
+// RunCron registers all backup schedules, starts the scheduler and blocks
+// until ctx is canceled.
 //
 // Fatal/setup errors are returned:
 //   - cron expression is invalid
 //
 // Per-backup errors are logged and do not stop the scheduler:
+//   - run in a blackout window (skipped)
+//   - run exceeded the timeout of its schedule
 //   - backup already running
 //   - retention failed
 //   - basebackup failed
@@ -107,19 +170,32 @@ func (s *baseBackupSupervisor) log() *slog.Logger {
 func (s *baseBackupSupervisor) RunCron(ctx context.Context) error {
 	cfg := s.opts.Cfg
 
-	_, err := s.cron.AddFunc(cfg.Backup.Cron, func() {
-		if err := s.runner.Run(ctx, "cron"); err != nil {
-			s.handleRunError("scheduled", err)
+	schedules := cfg.Backup.AllSchedules()
+	for i := range schedules {
+		sch := &schedules[i]
+		id, err := s.cron.AddFunc(sch.Cron, func() {
+			s.runScheduled(ctx, sch)
+		})
+		if err != nil {
+			return fmt.Errorf("add basebackup schedule %s: %w", sch.Name, err)
 		}
-	})
-	if err != nil {
-		return fmt.Errorf("add basebackup cron job: %w", err)
+
+		s.mu.Lock()
+		s.entries = append(s.entries, scheduleEntry{schedule: *sch, id: id})
+		s.mu.Unlock()
+
+		s.log().Info("basebackup schedule registered",
+			slog.String("schedule", sch.Name),
+			slog.String("cron", sch.Cron),
+			slog.String("type", sch.Type),
+		)
 	}
 
 	s.cron.Start()
 
 	s.log().Info("basebackup scheduler started",
-		slog.String("cron", cfg.Backup.Cron),
+		slog.Int("schedules", len(schedules)),
+		slog.String("timezone", cfg.Backup.Location().String()),
 	)
 
 	<-ctx.Done()
@@ -135,12 +211,12 @@ func (s *baseBackupSupervisor) RunCron(ctx context.Context) error {
 }
 
 // Trigger starts a basebackup run synchronously.
-func (s *baseBackupSupervisor) Trigger(ctx context.Context, source string) error {
+func (s *baseBackupSupervisor) Trigger(ctx context.Context, source string, opts RunOpts) error {
 	if source == "" {
 		source = "manual"
 	}
 
-	return s.runner.Run(ctx, source)
+	return s.runner.Run(ctx, source, opts)
 }
 
 // TriggerAsync starts a basebackup run in the background and returns the
@@ -148,36 +224,48 @@ func (s *baseBackupSupervisor) Trigger(ctx context.Context, source string) error
 //
 // Pass the application context here, not the HTTP request context, otherwise
 // the backup may be canceled as soon as the HTTP response is written.
-func (s *baseBackupSupervisor) TriggerAsync(ctx context.Context, source string) (*BackupRunState, error) {
+func (s *baseBackupSupervisor) TriggerAsync(ctx context.Context, source string, opts RunOpts) (*BackupRunState, error) {
 	if source == "" {
 		source = "manual"
 	}
 
-	return s.runner.StartAsync(ctx, source)
+	return s.runner.StartAsync(ctx, source, opts)
+}
+
+// Cancel cancels the running basebackup, started by cron or manually. The
+// backup is aborted on the server and its partial files are deleted.
+func (s *baseBackupSupervisor) Cancel() error {
+	return s.runner.Cancel()
 }
 
 func (s *baseBackupSupervisor) BackupStatus() BackupRunState {
-	return s.state.Snapshot()
+	state := s.state.Snapshot()
+	state.Schedules = s.scheduleStatuses()
+	return state
 }
 
 //nolint:unparam
 func (s *baseBackupSupervisor) handleRunError(kind string, err error) {
 	switch {
-	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrBackupCancelled):
 		s.log().Info(kind+" basebackup stopped", slog.Any("reason", err))
 
 	case errors.Is(err, ErrBackupAlreadyRunning):
 		s.log().Warn("previous basebackup still running, skipping this run")
 
+	case errors.Is(err, ErrLeaseNotHeld):
+		s.log().Warn("repository lease is not held, skipping this run")
+
 	default:
 		s.log().Error(kind+" basebackup run failed", slog.Any("err", err))
 	}
 }
 
-func newBackupCron() *cron.Cron {
+func newBackupCron(loc *time.Location) *cron.Cron {
 	// POSIX-compatible cron syntax: "* * * * *".
 	// No seconds field.
-	return cron.New(cron.WithParser(cron.NewParser(
+	parser := cron.NewParser(
 		cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow,
-	)))
+	)
+	return cron.New(cron.WithLocation(loc), cron.WithParser(parser))
 }
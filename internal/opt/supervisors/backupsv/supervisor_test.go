@@ -6,6 +6,7 @@ import (
 	"io"
 	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/pgrwl/pgrwl/config"
 
@@ -18,20 +19,24 @@ type fakeBackupRunner struct {
 	runCalls        int
 	startAsyncCalls int
 	lastSource      string
+	lastOpts        RunOpts
 	runErr          error
 	startAsyncErr   error
+	cancelCalls     int
+	cancelErr       error
 	state           BackupRunState
 }
 
 var _ BackupRunner = (*fakeBackupRunner)(nil)
 
-func (r *fakeBackupRunner) Run(_ context.Context, source string) error {
+func (r *fakeBackupRunner) Run(_ context.Context, source string, opts RunOpts) error {
 	r.runCalls++
 	r.lastSource = source
+	r.lastOpts = opts
 	return r.runErr
 }
 
-func (r *fakeBackupRunner) StartAsync(_ context.Context, source string) (*BackupRunState, error) {
+func (r *fakeBackupRunner) StartAsync(_ context.Context, source string, _ RunOpts) (*BackupRunState, error) {
 	r.startAsyncCalls++
 	r.lastSource = source
 	if r.startAsyncErr != nil {
@@ -44,6 +49,11 @@ func (r *fakeBackupRunner) StartAsync(_ context.Context, source string) (*Backup
 	return &state, nil
 }
 
+func (r *fakeBackupRunner) Cancel() error {
+	r.cancelCalls++
+	return r.cancelErr
+}
+
 func newSupervisorForTest(state BackupState, runner BackupRunner) *baseBackupSupervisor {
 	return &baseBackupSupervisor{
 		l: slog.New(slog.NewTextHandler(io.Discard, nil)),
@@ -61,7 +71,7 @@ func TestBaseBackupSupervisorTriggerDefaultsSourceToManual(t *testing.T) {
 	runner := &fakeBackupRunner{}
 	s := newSupervisorForTest(state, runner)
 
-	err := s.Trigger(context.Background(), "")
+	err := s.Trigger(context.Background(), "", RunOpts{})
 
 	require.NoError(t, err)
 	assert.Equal(t, 1, runner.runCalls)
@@ -72,7 +82,7 @@ func TestBaseBackupSupervisorTriggerPassesExplicitSource(t *testing.T) {
 	runner := &fakeBackupRunner{}
 	s := newSupervisorForTest(NewBackupState(), runner)
 
-	err := s.Trigger(context.Background(), "cron")
+	err := s.Trigger(context.Background(), "cron", RunOpts{})
 
 	require.NoError(t, err)
 	assert.Equal(t, "cron", runner.lastSource)
@@ -82,7 +92,7 @@ func TestBaseBackupSupervisorTriggerPropagatesRunnerError(t *testing.T) {
 	runner := &fakeBackupRunner{runErr: errors.New("run failed")}
 	s := newSupervisorForTest(NewBackupState(), runner)
 
-	err := s.Trigger(context.Background(), "manual")
+	err := s.Trigger(context.Background(), "manual", RunOpts{})
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "run failed")
@@ -92,7 +102,7 @@ func TestBaseBackupSupervisorTriggerAsyncDefaultsSourceToManual(t *testing.T) {
 	runner := &fakeBackupRunner{}
 	s := newSupervisorForTest(NewBackupState(), runner)
 
-	state, err := s.TriggerAsync(context.Background(), "")
+	state, err := s.TriggerAsync(context.Background(), "", RunOpts{})
 
 	require.NoError(t, err)
 	require.NotNil(t, state)
@@ -105,7 +115,7 @@ func TestBaseBackupSupervisorTriggerAsyncPropagatesRunnerError(t *testing.T) {
 	runner := &fakeBackupRunner{startAsyncErr: ErrBackupAlreadyRunning}
 	s := newSupervisorForTest(NewBackupState(), runner)
 
-	state, err := s.TriggerAsync(context.Background(), "manual")
+	state, err := s.TriggerAsync(context.Background(), "manual", RunOpts{})
 
 	assert.Nil(t, state)
 	assert.ErrorIs(t, err, ErrBackupAlreadyRunning)
@@ -133,3 +143,65 @@ func TestBaseBackupSupervisorHandleRunErrorDoesNotPanic(t *testing.T) {
 		s.handleRunError("scheduled", errors.New("boom"))
 	})
 }
+
+func TestBaseBackupSupervisorCancelDelegatesToRunner(t *testing.T) {
+	runner := &fakeBackupRunner{cancelErr: ErrNoBackupRunning}
+	s := newSupervisorForTest(NewBackupState(), runner)
+
+	err := s.Cancel()
+
+	assert.ErrorIs(t, err, ErrNoBackupRunning)
+	assert.Equal(t, 1, runner.cancelCalls)
+}
+
+func TestBaseBackupSupervisorRunScheduledPassesSchedulePolicy(t *testing.T) {
+	runner := &fakeBackupRunner{}
+	s := newSupervisorForTest(NewBackupState(), runner)
+
+	s.runScheduled(context.Background(), &config.BackupSchedule{
+		Name:              "weekly",
+		Cron:              "0 3 * * 0",
+		Type:              config.BackupTypeFull,
+		ServerCompression: config.CompressionOverride{Algo: "zstd"},
+		RetentionClass:    "monthly",
+	})
+
+	assert.Equal(t, 1, runner.runCalls)
+	assert.Equal(t, "cron", runner.lastSource)
+	assert.Equal(t, "weekly", runner.lastOpts.Schedule)
+	assert.Equal(t, config.BackupTypeFull, runner.lastOpts.Type)
+	assert.Equal(t, "monthly", runner.lastOpts.RetentionClass)
+	require.NotNil(t, runner.lastOpts.ServerCompression)
+	assert.Equal(t, "zstd", runner.lastOpts.ServerCompression.Algo)
+}
+
+func TestBaseBackupSupervisorBackupStatusListsSchedules(t *testing.T) {
+	s := newSupervisorForTest(NewBackupState(), &fakeBackupRunner{})
+	s.opts.Cfg.Backup = config.BackupConfig{
+		Schedules: []config.BackupSchedule{
+			{Name: "nightly", Cron: "0 1 * * *", Type: config.BackupTypeIncremental},
+			{Name: "weekly", Cron: "0 3 * * 0", Type: config.BackupTypeFull, RetentionClass: "monthly"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.RunCron(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return len(s.BackupStatus().Schedules) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	schedules := s.BackupStatus().Schedules
+	assert.Equal(t, "nightly", schedules[0].Name)
+	assert.Equal(t, config.BackupTypeIncremental, schedules[0].Type)
+	assert.Equal(t, "weekly", schedules[1].Name)
+	assert.Equal(t, "monthly", schedules[1].RetentionClass)
+	for _, sch := range schedules {
+		require.NotNil(t, sch.NextRun, sch.Name)
+		assert.True(t, sch.NextRun.After(time.Now()), sch.Name)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -4,12 +4,34 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"path/filepath"
 	"strings"
+
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
+	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 )
 
 type WALCleaner interface {
-	DeleteBefore(ctx context.Context, keepFromWAL string) error
+	// DeleteBefore deletes the WAL before keepFromWAL, except the WAL in keep.
+	DeleteBefore(ctx context.Context, keepFromWAL string, keep ...WALRange) error
+}
+
+// WALRange is an inclusive range of WAL file names.
+type WALRange struct {
+	From string
+	To   string
+}
+
+func (r WALRange) contains(name string) bool {
+	return !walBefore(name, r.From) && !walBefore(r.To, name)
+}
+
+func inWALRanges(name string, ranges []WALRange) bool {
+	for _, r := range ranges {
+		if r.contains(name) {
+			return true
+		}
+	}
+	return false
 }
 
 type walCleaner struct {
@@ -26,23 +48,24 @@ func NewWALCleaner(opts *BackupSupervisorOpts) WALCleaner {
 	}
 }
 
-func (c *walCleaner) DeleteBefore(ctx context.Context, keepFromWAL string) error {
+func (c *walCleaner) DeleteBefore(ctx context.Context, keepFromWAL string, keep ...WALRange) error {
 	if keepFromWAL == "" {
 		return fmt.Errorf("keepFromWAL is empty")
 	}
 
 	stor := c.opts.WalStor
 
-	wals, err := stor.ListInfoRaw(ctx, "")
-	if err != nil {
-		return fmt.Errorf("list WAL archive: %w", err)
-	}
-
 	deleted := 0
 	kept := 0
 
-	for _, wal := range wals {
-		if !isRootStoragePath(wal.Path) {
+	// The archive is streamed, so memory does not grow with its size.
+	for wal, err := range stor.IterateRaw(ctx, "", st.IterateOpts{}) {
+		if err != nil {
+			return fmt.Errorf("list WAL archive: %w", err)
+		}
+
+		// Both WAL layouts are cleaned, the archive may be mid-migration.
+		if !stor.IsWALPath(wal.Path) {
 			kept++
 			continue
 		}
@@ -60,7 +83,7 @@ func (c *walCleaner) DeleteBefore(ctx context.Context, keepFromWAL string) error
 			continue
 		}
 
-		if !walBefore(name, keepFromWAL) {
+		if !walBefore(name, keepFromWAL) || inWALRanges(name, keep) {
 			kept++
 			continue
 		}
@@ -88,12 +111,56 @@ func (c *walCleaner) DeleteBefore(ctx context.Context, keepFromWAL string) error
 		slog.Int("kept_wals", kept),
 	)
 
-	return nil
+	return c.deleteManifestsBefore(ctx, keepFromWAL, keep)
 }
 
-func isRootStoragePath(path string) bool {
-	clean := filepath.ToSlash(strings.TrimSpace(path))
-	clean = strings.TrimPrefix(clean, "./")
+// deleteManifestsBefore deletes the signed WAL manifests that cover only
+// deleted WAL files, they are named by the first and last file they cover.
+// Like the archive, the manifests are streamed.
+func (c *walCleaner) deleteManifestsBefore(ctx context.Context, keepFromWAL string, keep []WALRange) error {
+	stor := c.opts.ManifestStor
+	if stor == nil {
+		return nil
+	}
 
-	return clean != "" && !strings.Contains(clean, "/")
+	deleted := 0
+	for info, err := range stor.Iterate(ctx, "", st.IterateOpts{}) {
+		if err != nil {
+			return fmt.Errorf("list WAL manifests: %w", err)
+		}
+		first, last, ok := signing.ParseWALManifestRange(strings.TrimSuffix(info.Path, signing.SigSuffix))
+		if !ok {
+			continue
+		}
+		// manifests that cover a history file are kept with it
+		name, history, ok := normalizeWALFilename(last)
+		if !ok || history || !walBefore(name, keepFromWAL) || manifestCovers(first, name, keep) {
+			continue
+		}
+
+		if err := stor.Delete(ctx, info.Path); err != nil {
+			return fmt.Errorf("delete WAL manifest %s: %w", info.Path, err)
+		}
+		deleted++
+	}
+
+	c.l.Info("WAL manifest retention completed", slog.Int("deleted_files", deleted))
+	return nil
+}
+
+// manifestCovers reports whether a manifest of the files from first to last
+// covers WAL in ranges. A first file that is not a WAL segment is taken for
+// the start of the archive.
+func manifestCovers(first, last string, ranges []WALRange) bool {
+	if name, history, ok := normalizeWALFilename(first); ok && !history {
+		first = name
+	} else {
+		first = ""
+	}
+	for _, r := range ranges {
+		if !walBefore(last, r.From) && (first == "" || !walBefore(r.To, first)) {
+			return true
+		}
+	}
+	return false
 }
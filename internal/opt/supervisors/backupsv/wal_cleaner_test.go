@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"iter"
 	"strings"
 	"testing"
 
@@ -146,6 +147,12 @@ func (s *listFailStorage) List(_ context.Context, _ string) ([]st.FileInfo, erro
 	return nil, errors.New("list failed")
 }
 
+func (s *listFailStorage) Iterate(_ context.Context, _ string, _ st.IterateOpts) iter.Seq2[st.FileInfo, error] {
+	return func(yield func(st.FileInfo, error) bool) {
+		yield(st.FileInfo{}, errors.New("list failed"))
+	}
+}
+
 func TestWALCleanerDeleteBeforePropagatesListError(t *testing.T) {
 	backend := &listFailStorage{InMemoryStorage: st.NewInMemoryStorage()}
 	cleaner := NewWALCleaner(&BackupSupervisorOpts{WalStor: newPlainVariadicStorage(t, backend)})
@@ -189,7 +196,7 @@ func TestWALCleanerDeleteBeforeWithRawPathStillDeletesRawObject(t *testing.T) {
 	backend := st.NewInMemoryStorage()
 
 	// This test protects the current walCleaner behavior: it receives raw paths
-	// from ListInfoRaw and passes those same raw paths to Delete.
+	// from IterateRaw and passes those same raw paths to Delete.
 	require.NoError(t, backend.Put(ctx, "000000010000003C000000D8.gz.aes", strings.NewReader("x")))
 
 	cleaner := NewWALCleaner(&BackupSupervisorOpts{WalStor: newPlainVariadicStorage(t, backend)})
@@ -245,3 +252,138 @@ func TestPutRawObjectHelperUsesReader(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "x", string(data))
 }
+
+func TestWALCleanerDeleteBeforeCleansBothLayouts(t *testing.T) {
+	ctx := context.Background()
+	backend := st.NewInMemoryStorage()
+
+	putRawObject(t, backend, "000000010000003C000000D8")
+	putRawObject(t, backend, "wal/00000001/0000003C/000000010000003C000000D9.gz")
+	putRawObject(t, backend, "wal/00000001/0000003C/000000010000003C000000DA")
+	putRawObject(t, backend, "wal/00000002/00000002.history")
+	// not a sharded location of its name
+	putRawObject(t, backend, "wal/00000001/0000003D/000000010000003C000000D7")
+
+	vs := newPlainVariadicStorage(t, backend)
+	vs.SetWALLayout(st.WALLayoutSharded)
+
+	cleaner := NewWALCleaner(&BackupSupervisorOpts{WalStor: vs})
+	require.NoError(t, cleaner.DeleteBefore(ctx, "000000010000003C000000DA"))
+
+	assert.ElementsMatch(t, []string{
+		"wal/00000001/0000003C/000000010000003C000000DA",
+		"wal/00000002/00000002.history",
+		"wal/00000001/0000003D/000000010000003C000000D7",
+	}, keys(backend))
+}
+
+func keys(s *st.InMemoryStorage) []string {
+	var r []string
+	for k := range s.Files {
+		r = append(r, k)
+	}
+	return r
+}
+
+func TestWALCleanerDeleteBeforeDeletesOldManifests(t *testing.T) {
+	ctx := context.Background()
+	backend := st.NewInMemoryStorage()
+	manifests := st.NewInMemoryStorage()
+
+	oldManifest := "000000010000003C000000D8_000000010000003C000000D9_20250101T000000.000000000.json"
+	spanning := "000000010000003C000000D9_000000010000003C000000DA_20250101T000000.000000000.json"
+	history := "00000002.history_00000002.history_20250101T000000.000000000.json"
+	for _, name := range []string{oldManifest, spanning, history} {
+		putRawObject(t, manifests, name)
+		putRawObject(t, manifests, name+".sig")
+	}
+
+	cleaner := NewWALCleaner(&BackupSupervisorOpts{
+		WalStor:      newPlainVariadicStorage(t, backend),
+		ManifestStor: manifests,
+	})
+	require.NoError(t, cleaner.DeleteBefore(ctx, "000000010000003C000000DA"))
+
+	for _, deleted := range []string{oldManifest, oldManifest + ".sig"} {
+		exists, err := manifests.Exists(ctx, deleted)
+		require.NoError(t, err)
+		assert.False(t, exists, "expected %s to be deleted", deleted)
+	}
+	for _, kept := range []string{spanning, spanning + ".sig", history, history + ".sig"} {
+		exists, err := manifests.Exists(ctx, kept)
+		require.NoError(t, err)
+		assert.True(t, exists, "expected %s to be kept", kept)
+	}
+}
+
+func TestWALCleanerDeleteBeforeKeepsPinnedRanges(t *testing.T) {
+	ctx := context.Background()
+	backend := st.NewInMemoryStorage()
+	manifests := st.NewInMemoryStorage()
+
+	for _, name := range []string{
+		"000000010000003C000000D6",
+		"000000010000003C000000D7",
+		"000000010000003C000000D8",
+		"000000010000003C000000D9",
+		"000000010000003C000000DA",
+	} {
+		putRawObject(t, backend, name)
+	}
+	before := "000000010000003C000000D5_000000010000003C000000D6_20250101T000000.000000000.json"
+	inRange := "000000010000003C000000D7_000000010000003C000000D7_20250101T000000.000000000.json"
+	tail := "000000010000003C000000D8_000000010000003C000000D9_20250101T000000.000000000.json"
+	for _, name := range []string{before, inRange, tail} {
+		putRawObject(t, manifests, name)
+	}
+
+	cleaner := NewWALCleaner(&BackupSupervisorOpts{
+		WalStor:      newPlainVariadicStorage(t, backend),
+		ManifestStor: manifests,
+	})
+	err := cleaner.DeleteBefore(ctx, "000000010000003C000000DA", WALRange{
+		From: "000000010000003C000000D7",
+		To:   "000000010000003C000000D8",
+	})
+	require.NoError(t, err)
+
+	for _, deleted := range []string{"000000010000003C000000D6", "000000010000003C000000D9"} {
+		exists, err := backend.Exists(ctx, deleted)
+		require.NoError(t, err)
+		assert.False(t, exists, "expected %s to be deleted", deleted)
+	}
+	for _, kept := range []string{"000000010000003C000000D7", "000000010000003C000000D8", "000000010000003C000000DA"} {
+		exists, err := backend.Exists(ctx, kept)
+		require.NoError(t, err)
+		assert.True(t, exists, "expected %s to be kept", kept)
+	}
+
+	exists, err := manifests.Exists(ctx, before)
+	require.NoError(t, err)
+	assert.False(t, exists, "expected %s to be deleted", before)
+	for _, kept := range []string{inRange, tail} {
+		exists, err := manifests.Exists(ctx, kept)
+		require.NoError(t, err)
+		assert.True(t, exists, "expected %s to be kept", kept)
+	}
+}
+
+func TestManifestCovers(t *testing.T) {
+	ranges := []WALRange{{From: "000000010000003C000000D7", To: "000000010000003C000000D8"}}
+
+	tests := []struct {
+		first, last string
+		want        bool
+	}{
+		{"000000010000003C000000D5", "000000010000003C000000D6", false},
+		{"000000010000003C000000D6", "000000010000003C000000D7", true},
+		{"000000010000003C000000D8", "000000010000003C000000D9", true},
+		{"000000010000003C000000D5", "000000010000003C000000DA", true},
+		{"000000010000003C000000D9", "000000010000003C000000D9", false},
+		{"00000002.history", "000000010000003C000000D9", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, manifestCovers(tt.first, tt.last, ranges), "%s_%s", tt.first, tt.last)
+	}
+	assert.False(t, manifestCovers("000000010000003C000000D7", "000000010000003C000000D7", nil))
+}
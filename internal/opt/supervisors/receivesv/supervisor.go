@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/pgrwl/pgrwl/config"
 	"github.com/pgrwl/pgrwl/internal/core/xlog"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	st "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 )
 
@@ -16,6 +18,11 @@ const defaultUploadInterval = 5 * time.Minute
 type Opts struct {
 	ReceiveDirectory string
 	PGRW             xlog.PgReceiveWal
+
+	// Signer, when set, makes every upload batch write a signed WAL manifest
+	// to ManifestStor. Uploaded files are removed once the manifest is written.
+	Signer       *signing.Signer
+	ManifestStor st.Storage
 }
 
 type uploadBundle struct {
@@ -27,6 +34,15 @@ type ArchiveSupervisor struct {
 	cfg  *config.Config
 	stor st.Storage
 	opts *Opts
+
+	// uploaded files of the current batch, waiting for the manifest
+	mu      sync.Mutex
+	pending []pendingFile
+}
+
+type pendingFile struct {
+	path string
+	file signing.WALFile
 }
 
 func NewArchiveSupervisor(cfg *config.Config, stor st.Storage, opts *Opts) *ArchiveSupervisor {
@@ -2,12 +2,16 @@ package receivesv
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"github.com/pgrwl/pgrwl/internal/opt/metrics/receivemetrics"
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 
 	"github.com/pgrwl/pgrwl/internal/opt/shared/x/fsx"
 )
@@ -106,9 +110,44 @@ func (u *ArchiveSupervisor) uploadFiles(ctx context.Context, files []uploadBundl
 		)
 		lastErr = e
 	}
+	if err := u.writeManifest(ctx); err != nil {
+		u.log().Error("wal manifest error", slog.Any("err", err))
+		lastErr = err
+	}
 	return lastErr
 }
 
+// writeManifest signs the files uploaded in this batch and removes them
+// locally. When it fails, the files stay and are uploaded again by the next
+// batch, so no uploaded file is left without a manifest.
+func (u *ArchiveSupervisor) writeManifest(ctx context.Context) error {
+	u.mu.Lock()
+	pending := u.pending
+	u.pending = nil
+	u.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	files := make([]signing.WALFile, 0, len(pending))
+	for _, p := range pending {
+		files = append(files, p.file)
+	}
+	if err := signing.WriteWALManifest(ctx, u.opts.ManifestStor, u.opts.Signer, files); err != nil {
+		return err
+	}
+	for _, p := range pending {
+		if err := os.Remove(p.path); err != nil {
+			return err
+		}
+		u.log().Info("uploaded and deleted",
+			slog.String("wal-path", p.path),
+			slog.String("result-path", p.file.Name),
+		)
+	}
+	return nil
+}
+
 func (u *ArchiveSupervisor) uploadOneFile(ctx context.Context, bundle uploadBundle) error {
 	u.log().Info("starting upload file",
 		slog.String("path", bundle.walFilePath),
@@ -121,7 +160,8 @@ func (u *ArchiveSupervisor) uploadOneFile(ctx context.Context, bundle uploadBund
 
 	resultFileName := filepath.Base(bundle.walFilePath)
 
-	err = u.stor.Put(ctx, resultFileName, file)
+	sum := sha256.New()
+	err = u.stor.Put(ctx, resultFileName, io.TeeReader(file, sum))
 	if err != nil {
 		// upload error: close the file, return err, DO NOT REMOVE SOURCE WHEN UPLOAD IS FAILED
 		_ = file.Close()
@@ -132,6 +172,22 @@ func (u *ArchiveSupervisor) uploadOneFile(ctx context.Context, bundle uploadBund
 	if err := file.Close(); err != nil {
 		return err
 	}
+	receivemetrics.M.IncWALFilesUploaded()
+
+	// with signing, files are removed once the manifest is written
+	if u.opts.Signer != nil {
+		info, err := os.Stat(bundle.walFilePath)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.pending = append(u.pending, pendingFile{
+			path: bundle.walFilePath,
+			file: signing.WALFile{Name: resultFileName, Size: info.Size(), SHA256: hex.EncodeToString(sum.Sum(nil))},
+		})
+		u.mu.Unlock()
+		return nil
+	}
 
 	// remove files when upload is success
 	if err := os.Remove(bundle.walFilePath); err != nil {
@@ -142,7 +198,5 @@ func (u *ArchiveSupervisor) uploadOneFile(ctx context.Context, bundle uploadBund
 		slog.String("wal-path", bundle.walFilePath),
 		slog.String("result-path", resultFileName),
 	)
-
-	receivemetrics.M.IncWALFilesUploaded()
 	return nil
 }
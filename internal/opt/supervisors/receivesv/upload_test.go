@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pgrwl/pgrwl/internal/opt/shared/signing"
 	stormock "github.com/pgrwl/pgrwl/internal/opt/shared/storecrypt"
 
 	"github.com/pgrwl/pgrwl/config"
@@ -121,3 +122,38 @@ func TestArchiveSupervisor_UploadOneFile(t *testing.T) {
 	_, err = os.Stat(walFile)
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestArchiveSupervisor_UploadWritesSignedManifest(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	walFile := filepath.Join(tmpDir, "000000010000000000000004")
+	assert.NoError(t, os.WriteFile(walFile, []byte("testwal"), 0o600))
+
+	pub, priv, err := signing.GenerateKeyPair()
+	assert.NoError(t, err)
+	signer, err := signing.NewSigner(priv)
+	assert.NoError(t, err)
+	verifier, err := signing.NewVerifier(pub)
+	assert.NoError(t, err)
+
+	stor := stormock.NewInMemoryStorage()
+	manifests := stormock.NewInMemoryStorage()
+	sup := NewArchiveSupervisor(&config.Config{}, stor, &Opts{
+		Signer:       signer,
+		ManifestStor: manifests,
+	})
+
+	// the file is kept until the manifest of the batch is written
+	assert.NoError(t, sup.uploadOneFile(ctx, uploadBundle{walFilePath: walFile}))
+	_, err = os.Stat(walFile)
+	assert.NoError(t, err)
+
+	assert.NoError(t, sup.writeManifest(ctx))
+	_, err = os.Stat(walFile)
+	assert.True(t, os.IsNotExist(err))
+
+	got, err := signing.NewWALIndex(manifests, verifier).Lookup(ctx, "000000010000000000000004")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("testwal")), got.Size)
+	assert.Equal(t, "83ac2da20787adccde577c337bb00a669c1c26d560fbf30959c35f0aaeeced45", got.SHA256)
+}
@@ -138,6 +138,57 @@ func TestS3Storage_Put_SmallSeekableFile(t *testing.T) {
 	assert.Equal(t, wantHash, gotHash)
 }
 
+func TestS3Storage_AbortUploads(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	client := createS3Client()
+	prefix := t.Name()
+	st := storage.NewS3Storage(client, "backups", prefix)
+
+	key := "20260101000000/base.tar"
+	remoteKey := withPrefix(prefix, key)
+
+	// an upload interrupted after its first part
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String("backups"),
+		Key:    aws.String(remoteKey),
+	})
+	require.NoError(t, err)
+	const partSize = 5 * 1024 * 1024
+	_, err = client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String("backups"),
+		Key:        aws.String(remoteKey),
+		UploadId:   created.UploadId,
+		PartNumber: aws.Int32(1),
+		Body:       strings.NewReader(strings.Repeat("x", partSize)),
+	})
+	require.NoError(t, err)
+
+	us, ok := st.(storage.UploadStorage)
+	require.True(t, ok)
+
+	// started after the cutoff
+	uploads, err := us.AbortUploads(ctx, "", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+
+	uploads, err = us.AbortUploads(ctx, "", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, key, uploads[0].Path)
+	assert.Equal(t, int64(partSize), uploads[0].Size)
+
+	out, err := client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String("backups"),
+		Prefix: aws.String(prefix + "/"),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, out.Uploads)
+}
+
 func withPrefix(prefix, key string) string {
 	prefix = strings.Trim(prefix, "/")
 	key = strings.Trim(key, "/")
@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 type Client interface {
-	Snapshot(ctx context.Context, receiver Receiver) Snapshot
+	// Snapshot fetches the state of the receiver and the WAL files of page.
+	Snapshot(ctx context.Context, receiver Receiver, page WALPage) Snapshot
 }
 
 type HTTPClient struct {
@@ -24,10 +27,10 @@ func NewHTTPClient() *HTTPClient {
 	}
 }
 
-// Snapshot fetches all four endpoints concurrently and merges results.
+// Snapshot fetches all endpoints concurrently and merges results.
 // If /status fails the Snapshot.Error field is set; other fields are
 // populated independently so a partial view is still rendered.
-func (c *HTTPClient) Snapshot(ctx context.Context, receiver Receiver) Snapshot {
+func (c *HTTPClient) Snapshot(ctx context.Context, receiver Receiver, page WALPage) Snapshot {
 	s := Snapshot{Receiver: receiver}
 
 	var (
@@ -64,10 +67,10 @@ func (c *HTTPClient) Snapshot(ctx context.Context, receiver Receiver) Snapshot {
 	})
 
 	launch(func() {
-		wal, err := getJSON[[]WALFile](ctx, c.http(), receiver.Addr, "/api/v1/wals")
+		wal, err := c.walFiles(ctx, receiver, page)
 		if err == nil {
 			mu.Lock()
-			s.WALFiles = wal
+			s.WALFiles, s.WALTotal, s.WALMatched, s.WALMore = wal.files, wal.total, wal.matched, wal.more
 			mu.Unlock()
 		}
 	})
@@ -81,10 +84,57 @@ func (c *HTTPClient) Snapshot(ctx context.Context, receiver Receiver) Snapshot {
 		}
 	})
 
+	launch(func() {
+		run, err := getJSON[BackupRun](ctx, c.http(), receiver.Addr, "/api/v1/basebackup/status")
+		if err == nil {
+			mu.Lock()
+			s.BackupRun = &run
+			mu.Unlock()
+		}
+	})
+
 	wg.Wait()
 	return s
 }
 
+type walList struct {
+	files          []WALFile
+	total, matched int
+	more           bool
+}
+
+// walFiles fetches a single page of /api/v1/wals, the last files first. One
+// more file than the limit is asked for, to tell whether there is a next
+// page. The receiver reads its listing once and keeps only the page.
+func (c *HTTPClient) walFiles(ctx context.Context, receiver Receiver, page WALPage) (walList, error) {
+	q := url.Values{}
+	q.Set("order", "desc")
+	if page.Limit > 0 {
+		q.Set("limit", strconv.Itoa(page.Limit+1))
+	}
+	if page.EndBefore != "" {
+		q.Set("end_before", page.EndBefore)
+	}
+	if page.Contains != "" {
+		q.Set("contains", page.Contains)
+	}
+	if page.Ext != "" {
+		q.Set("ext", page.Ext)
+	}
+
+	files, header, err := getJSONWithHeader[[]WALFile](ctx, c.http(), receiver.Addr, "/api/v1/wals?"+q.Encode())
+	if err != nil {
+		return walList{}, err
+	}
+	list := walList{files: files}
+	list.total, _ = strconv.Atoi(header.Get("X-Total-Count"))
+	list.matched, _ = strconv.Atoi(header.Get("X-Match-Count"))
+	if page.Limit > 0 && len(files) > page.Limit {
+		list.files, list.more = files[:page.Limit], true
+	}
+	return list, nil
+}
+
 func (c *HTTPClient) http() *http.Client {
 	if c.HTTP != nil {
 		return c.HTTP
@@ -93,26 +143,31 @@ func (c *HTTPClient) http() *http.Client {
 }
 
 func getJSON[T any](ctx context.Context, client *http.Client, baseURL, path string) (T, error) {
+	v, _, err := getJSONWithHeader[T](ctx, client, baseURL, path)
+	return v, err
+}
+
+func getJSONWithHeader[T any](ctx context.Context, client *http.Client, baseURL, path string) (T, http.Header, error) {
 	var zero T
 
 	baseURL = strings.TrimRight(baseURL, "/")
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
 	if err != nil {
-		return zero, err
+		return zero, nil, err
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return zero, err
+		return zero, nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return zero, fmt.Errorf("%s returned %s", path, resp.Status)
+		return zero, nil, fmt.Errorf("%s returned %s", path, resp.Status)
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&zero); err != nil {
-		return zero, err
+		return zero, nil, err
 	}
-	return zero, nil
+	return zero, resp.Header, nil
 }
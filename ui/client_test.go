@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestHTTPClientFetchesOneWALPage(t *testing.T) {
+	var all []WALFile
+	for i := range 25 {
+		name := fmt.Sprintf("%024X", i+1)
+		all = append(all, WALFile{Name: name, Filename: name, Path: name})
+	}
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/wals" {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+
+		q := r.URL.Query()
+		if q.Get("order") != "desc" || q.Get("contains") != "0001" || q.Get("ext") != "zst" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil {
+			t.Errorf("limit is not set: %v", err)
+		}
+		var page []WALFile
+		for i := len(all) - 1; i >= 0 && len(page) < limit; i-- {
+			if end := q.Get("end_before"); end == "" || all[i].Path < end {
+				page = append(page, all[i])
+			}
+		}
+
+		w.Header().Set("X-Total-Count", "30")
+		w.Header().Set("X-Match-Count", strconv.Itoa(len(all)))
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient()
+	receiver := Receiver{Addr: srv.URL}
+	page := WALPage{Limit: 10, Contains: "0001", Ext: "zst"}
+
+	got, err := client.walFiles(context.Background(), receiver, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.files) != 10 || got.files[0].Path != all[24].Path || !got.more {
+		t.Fatalf("got %d files from %q, more = %v", len(got.files), got.files[0].Path, got.more)
+	}
+	if got.total != 30 || got.matched != 25 {
+		t.Fatalf("total = %d, matched = %d", got.total, got.matched)
+	}
+
+	page.EndBefore = all[5].Path
+	got, err = client.walFiles(context.Background(), receiver, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.files) != 5 || got.files[4].Path != all[0].Path || got.more {
+		t.Fatalf("got %d files to %q, more = %v", len(got.files), got.files[len(got.files)-1].Path, got.more)
+	}
+
+	if requests != 2 {
+		t.Fatalf("requests = %d, want 2", requests)
+	}
+}
@@ -15,9 +15,19 @@ type StreamStatus struct {
 	Running      bool   `json:"running"`
 }
 
+type LockStatus struct {
+	Owner      string     `json:"owner"`
+	Held       bool       `json:"held"`
+	Holder     string     `json:"holder"`
+	HolderHost string     `json:"holder_host"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastError  string     `json:"last_error"`
+}
+
 type PgrwlStatus struct {
 	RunningMode  string        `json:"running_mode"`
 	StreamStatus *StreamStatus `json:"stream_status"`
+	Lock         *LockStatus   `json:"lock"`
 }
 
 type BriefConfig struct {
@@ -28,19 +38,56 @@ type WALFile struct {
 	Name       string    `json:"name"`
 	Ext        string    `json:"ext"`
 	Filename   string    `json:"filename"`
+	Path       string    `json:"path"`
 	SizeMB     float64   `json:"size_mb"`
 	UploadedAt time.Time `json:"uploaded_at"`
 	Encrypted  bool      `json:"encrypted"`
 }
 
+// WALPage selects a page of /api/v1/wals, the last files first.
+type WALPage struct {
+	// EndBefore is the path of the last file of the previous page.
+	EndBefore string
+	// Limit is the page size, the rest of the listing when zero.
+	Limit int
+	// Contains and Ext filter the files by file name and compression, see
+	// the ext filter chips.
+	Contains string
+	Ext      string
+}
+
 type Backup struct {
-	Label       string    `json:"label"`
-	Started     time.Time `json:"started"`
-	Finished    time.Time `json:"finished"`
-	SizeGB      float64   `json:"size_gb"`
-	WALStartLSN string    `json:"wal_start_lsn"`
-	WALStopLSN  string    `json:"wal_stop_lsn"`
-	Status      string    `json:"status"`
+	ID          string            `json:"id"`
+	Label       string            `json:"label"`
+	Started     time.Time         `json:"started"`
+	Finished    time.Time         `json:"finished"`
+	SizeGB      float64           `json:"size_gb"`
+	WALStartLSN string            `json:"wal_start_lsn"`
+	WALStopLSN  string            `json:"wal_stop_lsn"`
+	Status      string            `json:"status"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Pinned      bool              `json:"pinned"`
+}
+
+// BackupProgress is the progress of the running basebackup, bytes are of
+// the uncompressed archives.
+type BackupProgress struct {
+	BytesDone      int64   `json:"bytes_done"`
+	BytesTotal     int64   `json:"bytes_total"`
+	Percent        float64 `json:"percent"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ETASeconds     int64   `json:"eta_seconds"`
+	Archive        string  `json:"archive"`
+	Tablespace     string  `json:"tablespace"`
+}
+
+type BackupRun struct {
+	Running   bool            `json:"running"`
+	Status    string          `json:"status"`
+	Source    string          `json:"source"`
+	StartedAt *time.Time      `json:"started_at"`
+	LastError string          `json:"last_error"`
+	Progress  *BackupProgress `json:"progress"`
 }
 
 type Snapshot struct {
@@ -48,6 +95,14 @@ type Snapshot struct {
 	Status   *PgrwlStatus
 	Config   *BriefConfig
 	WALFiles []WALFile
-	Backups  []Backup
-	Error    string
+	// WALTotal is the number of files in the archive, WALMatched of those
+	// passing the filters of the page. WALMore is set when files passing the
+	// filters are left after WALFiles.
+	WALTotal   int
+	WALMatched int
+	WALMore    bool
+	Backups    []Backup
+	// BackupRun is the state of the backup slot, nil when unknown.
+	BackupRun *BackupRun
+	Error     string
 }
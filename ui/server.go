@@ -8,7 +8,8 @@ import (
 	"io/fs"
 	"log/slog"
 	"net/http"
-	"sort"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -16,7 +17,14 @@ import (
 //go:embed static/*
 var staticFS embed.FS
 
-const pageSize = 15
+const (
+	pageSize = 15
+	// maxPageSize bounds the limit query parameter of the WAL table.
+	maxPageSize = 1000
+	// statusWALLimit is the number of the last WAL files the status page
+	// reads, for the restore readiness and the upload activity.
+	statusWALLimit = 5000
+)
 
 type Options struct {
 	Logger    *slog.Logger
@@ -109,30 +117,40 @@ func (s *Server) backupsTableFragment(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) buildView(r *http.Request, active string) View {
 	selected := selectedReceiverIndex(r, len(s.receivers))
-	snap := s.client.Snapshot(r.Context(), s.receivers[selected])
-
-	// Sort WAL files once here, not inside the hot filter path.
-	sort.SliceStable(snap.WALFiles, func(i, j int) bool {
-		return snap.WALFiles[i].UploadedAt.After(snap.WALFiles[j].UploadedAt)
-	})
 
 	walFilter := r.URL.Query().Get("ext")
 	if walFilter == "" {
 		walFilter = "all"
 	}
 	query := strings.TrimSpace(r.URL.Query().Get("q"))
-	page := parseNonNegativeInt(r.URL.Query().Get("page"))
-
-	walRows := filterWAL(snap.WALFiles, query, walFilter)
-	totalPages := max(1, (len(walRows)+pageSize-1)/pageSize)
-	if page >= totalPages {
-		page = totalPages - 1
+	prev := r.URL.Query()["prev"]
+
+	// the receiver filters and pages the WAL listing, other pages only show
+	// the number of files
+	page := WALPage{Limit: 1}
+	switch active {
+	case "status":
+		page = WALPage{Limit: statusWALLimit}
+	case "wal":
+		page = WALPage{
+			EndBefore: r.URL.Query().Get("end_before"),
+			Limit:     min(parseNonNegativeInt(r.URL.Query().Get("limit")), maxPageSize),
+			Contains:  query,
+		}
+		if page.Limit == 0 {
+			page.Limit = pageSize
+		}
+		if walFilter != "all" {
+			page.Ext = walFilter
+		}
 	}
-	from := page * pageSize
-	to := min(from+pageSize, len(walRows))
-	if from > to {
-		from = to
+	snap := s.client.Snapshot(r.Context(), s.receivers[selected], page)
+
+	next := ""
+	if snap.WALMore && len(snap.WALFiles) > 0 {
+		next = snap.WALFiles[len(snap.WALFiles)-1].Path
 	}
+	from := len(prev) * page.Limit
 
 	return View{
 		Active:        active,
@@ -141,14 +159,15 @@ func (s *Server) buildView(r *http.Request, active string) View {
 		Snapshot:      snap,
 		Query:         query,
 		ExtFilter:     walFilter,
-		Page:          page,
-		PageSize:      pageSize,
-		FilteredWAL:   walRows,
-		VisibleWAL:    walRows[from:to],
-		TotalPages:    totalPages,
-		PageNums:      pageNums(page, totalPages),
-		PageFrom:      displayFrom(from, len(walRows)),
-		PageTo:        to,
+		Page:          len(prev),
+		PageSize:      page.Limit,
+		VisibleWAL:    snap.WALFiles,
+		TotalPages:    max(1, (snap.WALMatched+page.Limit-1)/page.Limit),
+		PageFrom:      displayFrom(from, len(snap.WALFiles)),
+		PageTo:        from + len(snap.WALFiles),
+		EndBefore:     page.EndBefore,
+		PrevCursors:   prev,
+		NextCursor:    next,
 	}
 }
 
@@ -182,48 +201,43 @@ func parseNonNegativeInt(s string) int {
 	return v
 }
 
-// filterWAL filters files by filename query and extension.
-// Sorting is done once in buildView; this function only filters.
-func filterWAL(files []WALFile, query, ext string) []WALFile {
-	query = strings.ToLower(query)
-	out := make([]WALFile, 0, len(files))
-	for _, f := range files {
-		if query != "" && !strings.Contains(strings.ToLower(f.Filename), query) {
-			continue
-		}
-		switch ext {
-		case "zst", "gz":
-			if f.Ext != ext {
-				continue
-			}
-		case "plain":
-			if f.Ext != "" {
-				continue
-			}
-		}
-		out = append(out, f)
+func displayFrom(from, total int) int {
+	if total == 0 {
+		return 0
 	}
-	return out
+	return from + 1
 }
 
-func pageNums(page, total int) []int {
-	start := max(0, page-2)
-	end := min(total, start+5)
-	start = max(0, end-5)
-	pages := make([]int, 0, end-start)
-	for i := start; i < end; i++ {
-		pages = append(pages, i)
+// walPageURL returns the WAL table URL of the page ending before endBefore,
+// prev are the cursors of the pages before it.
+func walPageURL(v View, endBefore string, prev []string) string {
+	q := url.Values{}
+	q.Set("receiver", strconv.Itoa(v.SelectedIndex))
+	q.Set("q", v.Query)
+	q.Set("ext", v.ExtFilter)
+	q.Set("limit", strconv.Itoa(v.PageSize))
+	if endBefore != "" {
+		q.Set("end_before", endBefore)
 	}
-	return pages
+	for _, p := range prev {
+		q.Add("prev", p)
+	}
+	return "/ui/fragments/wal-table?" + q.Encode()
 }
 
-func displayFrom(from, total int) int {
-	if total == 0 {
-		return 0
+func firstWALPageURL(v View) string {
+	return walPageURL(v, "", nil)
+}
+
+func prevWALPageURL(v View) string {
+	if len(v.PrevCursors) == 0 {
+		return firstWALPageURL(v)
 	}
-	return from + 1
+	last := len(v.PrevCursors) - 1
+	return walPageURL(v, v.PrevCursors[last], v.PrevCursors[:last])
 }
 
-func queryURL(path string, receiver int, q, ext string, page int) string {
-	return fmt.Sprintf("%s?receiver=%d&q=%s&ext=%s&page=%d", path, receiver, template.URLQueryEscaper(q), template.URLQueryEscaper(ext), page)
+func nextWALPageURL(v View) string {
+	prev := append(slices.Clone(v.PrevCursors), v.EndBefore)
+	return walPageURL(v, v.NextCursor, prev)
 }
@@ -2,38 +2,41 @@ package ui
 
 import (
 	"context"
+	"fmt"
+	"html"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 )
 
-type fakeClient struct{ snap Snapshot }
-
-func (f *fakeClient) Snapshot(context.Context, Receiver) Snapshot { return f.snap }
-
-func TestFilterWALByQueryAndExtension(t *testing.T) {
-	files := []WALFile{
-		{Name: "0001", Filename: "0001.zst", Ext: "zst"},
-		{Name: "0002", Filename: "0002.gz", Ext: "gz"},
-		{Name: "0003", Filename: "0003", Ext: ""},
-	}
+type fakeClient struct {
+	snap Snapshot
+	// pages are the WAL pages asked for
+	pages []WALPage
+}
 
-	got := filterWAL(files, "0002", "all")
-	if len(got) != 1 || got[0].Filename != "0002.gz" {
-		t.Fatalf("query filter mismatch: %#v", got)
-	}
+// Snapshot pages the WAL files of snap as the receiver does, they are
+// listed by path and sent the last first.
+func (f *fakeClient) Snapshot(_ context.Context, _ Receiver, page WALPage) Snapshot {
+	f.pages = append(f.pages, page)
 
-	got = filterWAL(files, "", "plain")
-	if len(got) != 1 || got[0].Filename != "0003" {
-		t.Fatalf("plain filter mismatch: %#v", got)
+	snap := f.snap
+	var files []WALFile
+	for i := len(snap.WALFiles) - 1; i >= 0; i-- {
+		if file := snap.WALFiles[i]; page.EndBefore == "" || file.Path < page.EndBefore {
+			files = append(files, file)
+		}
 	}
-
-	got = filterWAL(files, "", "zst")
-	if len(got) != 1 || got[0].Filename != "0001.zst" {
-		t.Fatalf("zst filter mismatch: %#v", got)
+	snap.WALTotal, snap.WALMatched = len(snap.WALFiles), len(snap.WALFiles)
+	if page.Limit > 0 && len(files) > page.Limit {
+		files, snap.WALMore = files[:page.Limit], true
 	}
+	snap.WALFiles = files
+	return snap
 }
 
 func TestStatusPageRenders(t *testing.T) {
@@ -64,6 +67,36 @@ func TestStatusPageRenders(t *testing.T) {
 	}
 }
 
+func TestStatusPageRendersLock(t *testing.T) {
+	expires := time.Date(2026, 4, 25, 2, 0, 0, 0, time.UTC)
+	server := NewServer(Options{
+		Receivers: []Receiver{{Label: "local", Addr: "http://127.0.0.1:7070"}},
+		Client: &fakeClient{snap: Snapshot{
+			Status: &PgrwlStatus{
+				StreamStatus: &StreamStatus{Running: true},
+				Lock:         &LockStatus{Owner: "pod-b", Holder: "pod-a", HolderHost: "node-1", ExpiresAt: &expires},
+			},
+		}},
+	})
+
+	mux := http.NewServeMux()
+	server.Mount(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/ui/status", nil)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("status code = %d", res.Code)
+	}
+	body := res.Body.String()
+	for _, want := range []string{"repository lease", "WAIT", "pod-a @ node-1"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("response does not contain %q\n%s", want, body)
+		}
+	}
+}
+
 func TestRestoreReadinessDetectsCoveringWALAndSequence(t *testing.T) {
 	started := time.Date(2026, 4, 25, 2, 0, 0, 0, time.UTC)
 	files := []WALFile{
@@ -122,14 +155,151 @@ func TestRestoreReadinessDetectsGapAfterCoveringWAL(t *testing.T) {
 	}
 }
 
-func TestWALTableFragmentRendersFilteredRows(t *testing.T) {
+func TestRestoreReadinessDoesNotCheckOlderWAL(t *testing.T) {
+	started := time.Date(2026, 4, 25, 2, 0, 0, 0, time.UTC)
+	got := restoreReadiness(View{Snapshot: Snapshot{
+		Status: &PgrwlStatus{StreamStatus: &StreamStatus{LastFlushLSN: "0/B0000000"}},
+		// the last files of a larger archive
+		WALFiles: []WALFile{
+			{Name: "0000000100000000000000AF", Filename: "0000000100000000000000AF.gz", Ext: "gz"},
+			{Name: "0000000100000000000000AE", Filename: "0000000100000000000000AE.gz", Ext: "gz"},
+		},
+		WALTotal: 10,
+		Backups: []Backup{{
+			Started:    started,
+			Finished:   started.Add(3 * time.Minute),
+			WALStopLSN: "0/AB000000",
+			Status:     "done",
+		}},
+	}})
+
+	if got.PossibleLabel != "unknown" || got.Summary != "covering WAL not checked" {
+		t.Fatalf("unexpected readiness: %#v", got)
+	}
+}
+
+func TestWALTableFragmentPassesFilters(t *testing.T) {
+	client := &fakeClient{snap: Snapshot{
+		Receiver: Receiver{Label: "local", Addr: "http://127.0.0.1:7070"},
+		WALFiles: []WALFile{
+			{Name: "0001", Filename: "0001.zst", Path: "0001.zst", Ext: "zst", SizeMB: 16.0, Encrypted: true},
+		},
+	}}
+	server := NewServer(Options{
+		Receivers: []Receiver{{Label: "local", Addr: "http://127.0.0.1:7070"}},
+		Client:    client,
+	})
+
+	mux := http.NewServeMux()
+	server.Mount(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/ui/fragments/wal-table?ext=zst&q=+0001+", nil)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+
+	if want := (WALPage{Limit: pageSize, Contains: "0001", Ext: "zst"}); len(client.pages) != 1 || client.pages[0] != want {
+		t.Fatalf("pages = %#v", client.pages)
+	}
+	body := res.Body.String()
+	if !strings.Contains(body, "0001") {
+		t.Fatalf("unexpected table:\n%s", body)
+	}
+}
+
+func TestWALTableFragmentPagesThroughListing(t *testing.T) {
+	var files []WALFile
+	for i := range 5 {
+		name := fmt.Sprintf("%024X", i+1)
+		files = append(files, WALFile{Name: name, Filename: name + ".gz", Path: name + ".gz", Ext: "gz"})
+	}
+	client := &fakeClient{snap: Snapshot{WALFiles: files}}
+	server := NewServer(Options{
+		Receivers: []Receiver{{Label: "local", Addr: "http://127.0.0.1:7070"}},
+		Client:    client,
+	})
+
+	mux := http.NewServeMux()
+	server.Mount(mux)
+
+	get := func(target string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("status code = %d", res.Code)
+		}
+		return res.Body.String()
+	}
+	link := func(body, label string) string {
+		t.Helper()
+		m := regexp.MustCompile(`hx-get="([^"]*)"[^>]*>` + label + `<`).FindStringSubmatch(body)
+		if m == nil {
+			t.Fatalf("no %s link\n%s", label, body)
+		}
+		return html.UnescapeString(m[1])
+	}
+	// rows of the table, the cursors hold the paths too
+	shows := func(body string, f WALFile) bool {
+		return strings.Contains(body, ">"+f.Name+"<span")
+	}
+
+	// the last files first
+	body := get("/ui/fragments/wal-table?limit=2")
+	if !shows(body, files[4]) || !shows(body, files[3]) || shows(body, files[2]) {
+		t.Fatalf("unexpected first page:\n%s", body)
+	}
+	if !strings.Contains(body, "showing 1-2 of 5") {
+		t.Fatalf("unexpected footer:\n%s", body)
+	}
+
+	body = get(link(body, "next"))
+	if !shows(body, files[2]) || !shows(body, files[1]) || shows(body, files[3]) {
+		t.Fatalf("unexpected second page:\n%s", body)
+	}
+
+	body = get(link(body, "next"))
+	if !shows(body, files[0]) || shows(body, files[1]) {
+		t.Fatalf("unexpected last page:\n%s", body)
+	}
+	if !strings.Contains(body, "showing 5-5 of 5") {
+		t.Fatalf("unexpected footer:\n%s", body)
+	}
+
+	body = get(link(body, "prev"))
+	if !shows(body, files[2]) || shows(body, files[0]) {
+		t.Fatalf("unexpected page after prev:\n%s", body)
+	}
+
+	want := []WALPage{
+		{Limit: 2},
+		{EndBefore: files[3].Path, Limit: 2},
+		{EndBefore: files[1].Path, Limit: 2},
+		{EndBefore: files[3].Path, Limit: 2},
+	}
+	if !slices.Equal(client.pages, want) {
+		t.Fatalf("pages = %#v", client.pages)
+	}
+}
+
+func TestBackupsTableFragmentRendersProgress(t *testing.T) {
+	started := time.Date(2026, 4, 25, 2, 0, 0, 0, time.UTC)
 	server := NewServer(Options{
 		Receivers: []Receiver{{Label: "local", Addr: "http://127.0.0.1:7070"}},
 		Client: &fakeClient{snap: Snapshot{
-			Receiver: Receiver{Label: "local", Addr: "http://127.0.0.1:7070"},
-			WALFiles: []WALFile{
-				{Name: "0001", Filename: "0001.zst", Ext: "zst", SizeMB: 16.0, Encrypted: true},
-				{Name: "0002", Filename: "0002.gz", Ext: "gz", SizeMB: 16.0},
+			BackupRun: &BackupRun{
+				Running:   true,
+				Status:    "running",
+				Source:    "cron",
+				StartedAt: &started,
+				Progress: &BackupProgress{
+					BytesDone:      512 << 20,
+					BytesTotal:     2 << 30,
+					Percent:        25,
+					BytesPerSecond: 64 << 20,
+					ETASeconds:     24,
+					Tablespace:     "/mnt/ts1",
+				},
 			},
 		}},
 	})
@@ -137,12 +307,43 @@ func TestWALTableFragmentRendersFilteredRows(t *testing.T) {
 	mux := http.NewServeMux()
 	server.Mount(mux)
 
-	req := httptest.NewRequest(http.MethodGet, "/ui/fragments/wal-table?ext=zst", nil)
+	req := httptest.NewRequest(http.MethodGet, "/ui/fragments/backups-table", nil)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+
+	body := res.Body.String()
+	for _, want := range []string{"25.0%", "width: 25.0%", "512.0 MiB of ~2.0 GiB", "64.0 MiB/s", "eta 24s", "tablespace /mnt/ts1"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("response does not contain %q\n%s", want, body)
+		}
+	}
+}
+
+func TestBackupsTableFragmentRendersLabels(t *testing.T) {
+	server := NewServer(Options{
+		Receivers: []Receiver{{Label: "local", Addr: "http://127.0.0.1:7070"}},
+		Client: &fakeClient{snap: Snapshot{
+			Backups: []Backup{{
+				ID:          "20260425020000",
+				Label:       "before-upgrade",
+				Status:      "completed",
+				Annotations: map[string]string{"ticket": "OPS-1234"},
+				Pinned:      true,
+			}},
+		}},
+	})
+
+	mux := http.NewServeMux()
+	server.Mount(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/ui/fragments/backups-table", nil)
 	res := httptest.NewRecorder()
 	mux.ServeHTTP(res, req)
 
 	body := res.Body.String()
-	if !strings.Contains(body, "0001") || strings.Contains(body, "0002") {
-		t.Fatalf("unexpected filtered table:\n%s", body)
+	for _, want := range []string{"before-upgrade", ">pinned<", "ticket=OPS-1234"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("response does not contain %q\n%s", want, body)
+		}
 	}
 }
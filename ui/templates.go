@@ -21,12 +21,15 @@ type View struct {
 	ExtFilter     string
 	Page          int
 	PageSize      int
-	FilteredWAL   []WALFile
 	VisibleWAL    []WALFile
 	TotalPages    int
-	PageNums      []int
 	PageFrom      int
 	PageTo        int
+	// EndBefore is the cursor of the page, PrevCursors those of the pages
+	// before it, the first one first, NextCursor of the next page.
+	EndBefore   string
+	PrevCursors []string
+	NextCursor  string
 }
 
 func parseTemplates() *template.Template {
@@ -41,13 +44,15 @@ func parseTemplates() *template.Template {
 		"chipLabel":   chipLabel,
 		"statusClass": statusClass,
 		"statusText":  statusText,
+		"lockClass":   lockClass,
+		"lockText":    lockText,
 		"dotColor":    dotColor,
 		"ringColor":   ringColor,
 		"walCount": func(v View) string {
-			if len(v.Snapshot.WALFiles) == 0 {
+			if v.Snapshot.WALTotal == 0 {
 				return ""
 			}
-			return fmt.Sprintf("%d", len(v.Snapshot.WALFiles))
+			return fmt.Sprintf("%d", v.Snapshot.WALTotal)
 		},
 		"backupCount": func(v View) string {
 			if len(v.Snapshot.Backups) == 0 {
@@ -131,7 +136,9 @@ func parseTemplates() *template.Template {
 		"isFilter":      func(got, want string) bool { return got == want },
 		"add":           func(a, b int) int { return a + b },
 		"sub":           func(a, b int) int { return a - b },
-		"url":           queryURL,
+		"firstWALPage":  firstWALPageURL,
+		"prevWALPage":   prevWALPageURL,
+		"nextWALPage":   nextWALPageURL,
 		"throughput": func(v View) []ThroughputBucket {
 			return walThroughputLast24h(time.Now(), v.Snapshot.WALFiles)
 		},
@@ -139,7 +146,17 @@ func parseTemplates() *template.Template {
 		"lastBackup": lastBackup,
 		"duration":   duration,
 		"restore":    restoreReadiness,
-		"showFooter": func(v View) bool { return len(v.FilteredWAL) > 0 },
+		"showFooter": func(v View) bool { return v.Snapshot.WALMatched > 0 },
+		"runningBackup": func(v View) *BackupRun {
+			if v.Snapshot.BackupRun == nil || !v.Snapshot.BackupRun.Running {
+				return nil
+			}
+			return v.Snapshot.BackupRun
+		},
+		"fmtBytes":      fmtBytes,
+		"int64":         func(f float64) int64 { return int64(f) },
+		"fmtETA":        fmtETA,
+		"progressWidth": progressWidth,
 	}
 
 	return template.Must(template.New("ui").Funcs(funcs).Parse(templates))
@@ -188,6 +205,28 @@ func statusText(s *PgrwlStatus) string {
 	return "STOPPED"
 }
 
+func lockClass(s *PgrwlStatus) string {
+	switch {
+	case s == nil || s.Lock == nil:
+		return "warn"
+	case s.Lock.Held:
+		return "ok"
+	default:
+		return "bad"
+	}
+}
+
+func lockText(s *PgrwlStatus) string {
+	switch {
+	case s == nil || s.Lock == nil:
+		return "OFF"
+	case s.Lock.Held:
+		return "HELD"
+	default:
+		return "WAIT"
+	}
+}
+
 func dotColor(s *PgrwlStatus) template.CSS {
 	switch chipVariant(s) {
 	case stateStreaming:
@@ -410,6 +449,13 @@ func restoreReadiness(v View) RestoreReadiness {
 			r.Note = "No WAL files are present in the archive; cannot verify restore chain."
 			return r
 		}
+		if walOlderThanRead(coveringWAL, v.Snapshot) {
+			r.Summary = "covering WAL not checked"
+			r.CoveringWAL = shortWAL(coveringWAL)
+			r.SequenceLabel = "not checked"
+			r.Note = fmt.Sprintf("The WAL file that covers the latest backup end LSN is older than the last %d WAL files, which are the ones checked.", len(v.Snapshot.WALFiles))
+			return r
+		}
 		r.PossibleLabel = "no"
 		r.StatusClass = "bad"
 		r.Summary = "covering WAL not found"
@@ -445,6 +491,20 @@ func restoreReadiness(v View) RestoreReadiness {
 	return r
 }
 
+// walOlderThanRead reports whether name is older than the WAL files of the
+// snapshot, which are the last ones of a larger archive.
+func walOlderThanRead(name string, snap Snapshot) bool {
+	if len(snap.WALFiles) == 0 || len(snap.WALFiles) >= snap.WALTotal {
+		return false
+	}
+	for _, f := range snap.WALFiles {
+		if f.Name <= name {
+			return false
+		}
+	}
+	return true
+}
+
 type walSequenceCheck struct {
 	ok      bool
 	prev    string
@@ -600,6 +660,36 @@ func shortWAL(name string) string {
 	return base[len(base)-4:]
 }
 
+// backup progress
+
+func fmtBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTP"[exp])
+}
+
+func fmtETA(seconds int64) string {
+	if seconds <= 0 {
+		return "-"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func progressWidth(p *BackupProgress) template.CSS {
+	pct := 0.0
+	if p != nil {
+		pct = max(0, min(100, p.Percent))
+	}
+	return template.CSS(fmt.Sprintf("width: %.1f%%", pct))
+}
+
 func fmtTimeLocal(t time.Time) string {
 	if t.IsZero() {
 		return "-"
@@ -709,7 +799,7 @@ const templates = `
   </div>
   <div class="metric">
     <div class="metric-label">WAL Archive</div>
-    <div class="metric-value">{{ len .Snapshot.WALFiles }}</div>
+    <div class="metric-value">{{ .Snapshot.WALTotal }}</div>
     <div class="metric-meta">latest: {{ if $lastWal }}{{ $lastWal.Name }}{{ else }}-{{ end }}</div>
   </div>
   <div class="metric">
@@ -818,6 +908,11 @@ const templates = `
         </div>
       </div>
 
+      <div class="state-card">
+        <div class="state-key">Lock</div>
+        <div class="state-value {{ lockClass .Snapshot.Status }}">{{ lockText .Snapshot.Status }}</div>
+      </div>
+
       <div class="state-card">
         <div class="state-key">Backup</div>
         <div class="state-value {{ if $lastBackup }}{{ backupVariant $lastBackup.Status }}{{ else }}warn{{ end }}">
@@ -840,6 +935,9 @@ const templates = `
         {{ if $lastBackup }}
         <tr><td class="mono">backup completed</td><td class="mono muted">{{ fmtShortTime $lastBackup.Finished }}</td><td><span class="badge badge-{{ backupVariant $lastBackup.Status }}">{{ $lastBackup.Status }}</span></td><td class="mono muted">{{ $lastBackup.Label }} · {{ fmtGB $lastBackup.SizeGB }} · {{ duration $lastBackup.Started $lastBackup.Finished }}</td></tr>
         {{ end }}
+        {{ with .Snapshot.Status }}{{ with .Lock }}
+        <tr><td class="mono">repository lease</td><td class="mono muted">{{ if .ExpiresAt }}{{ fmtShortTime .ExpiresAt }}{{ else }}-{{ end }}</td><td><span class="badge badge-{{ if .Held }}ok{{ else }}bad{{ end }}">{{ if .Held }}held{{ else }}waiting{{ end }}</span></td><td class="mono muted">holder: {{ if .Holder }}{{ .Holder }}{{ if .HolderHost }} @ {{ .HolderHost }}{{ end }}{{ else }}-{{ end }}{{ if .LastError }} · {{ .LastError }}{{ end }}</td></tr>
+        {{ end }}{{ end }}
         <tr><td class="mono">receiver heartbeat</td><td class="mono muted">now</td><td><span class="badge badge-{{ statusClass .Snapshot.Status }}">{{ chipLabel .Snapshot.Status }}</span></td><td class="mono muted">slot: {{ if $ss }}{{ $ss.Slot }}{{ else }}-{{ end }}</td></tr>
       </tbody>
     </table>
@@ -851,6 +949,7 @@ const templates = `
 <div class="filter-bar">
   <form hx-get="/ui/fragments/wal-table" hx-target="#wal-table" hx-swap="outerHTML" class="filter-form">
     <input type="hidden" name="receiver" value="{{ .SelectedIndex }}">
+    <input type="hidden" name="limit" value="{{ .PageSize }}">
     <input class="search" type="text" name="q" value="{{ .Query }}" placeholder="filter by filename" hx-trigger="keyup changed delay:250ms" hx-get="/ui/fragments/wal-table" hx-target="#wal-table" hx-include="closest form">
     <button class="filter-chip {{ if isFilter .ExtFilter "all" }}active{{ end }}" name="ext" value="all">all</button>
     <button class="filter-chip {{ if isFilter .ExtFilter "zst" }}active{{ end }}" name="ext" value="zst">zst</button>
@@ -863,7 +962,7 @@ const templates = `
 
 {{ define "wal-table" }}
 <div class="module" id="wal-table">
-  <div class="module-header"><h2>WAL Archive</h2><span class="module-code">{{ len .FilteredWAL }} files</span></div>
+  <div class="module-header"><h2>WAL Archive</h2><span class="module-code">{{ .Snapshot.WALMatched }} files</span></div>
   <div class="module-body no-pad">
     <table class="table">
       <thead><tr><th>filename</th><th>size</th><th>uploaded</th><th>compression</th><th>encryption</th></tr></thead>
@@ -883,13 +982,12 @@ const templates = `
   </div>
   {{ if showFooter . }}
   <div class="footer">
-    <span class="footer-info">showing {{ .PageFrom }}-{{ .PageTo }} of {{ len .FilteredWAL }}</span>
+    <span class="footer-info">showing {{ .PageFrom }}-{{ .PageTo }} of {{ .Snapshot.WALMatched }}</span>
     <div class="pagination">
-      <a class="pg-btn {{ if eq .Page 0 }}disabled{{ end }}" hx-get="{{ url "/ui/fragments/wal-table" .SelectedIndex .Query .ExtFilter 0 }}" hx-target="#wal-table" hx-swap="outerHTML">first</a>
-      <a class="pg-btn {{ if eq .Page 0 }}disabled{{ end }}" hx-get="{{ url "/ui/fragments/wal-table" .SelectedIndex .Query .ExtFilter (sub .Page 1) }}" hx-target="#wal-table" hx-swap="outerHTML">prev</a>
-      {{ range .PageNums }}<a class="pg-btn {{ if eq $.Page . }}pg-active{{ end }}" hx-get="{{ url "/ui/fragments/wal-table" $.SelectedIndex $.Query $.ExtFilter . }}" hx-target="#wal-table" hx-swap="outerHTML">{{ add . 1 }}</a>{{ end }}
-      <a class="pg-btn {{ if ge .Page (sub .TotalPages 1) }}disabled{{ end }}" hx-get="{{ url "/ui/fragments/wal-table" .SelectedIndex .Query .ExtFilter (add .Page 1) }}" hx-target="#wal-table" hx-swap="outerHTML">next</a>
-      <a class="pg-btn {{ if ge .Page (sub .TotalPages 1) }}disabled{{ end }}" hx-get="{{ url "/ui/fragments/wal-table" .SelectedIndex .Query .ExtFilter (sub .TotalPages 1) }}" hx-target="#wal-table" hx-swap="outerHTML">last</a>
+      <a class="pg-btn {{ if eq .Page 0 }}disabled{{ end }}" hx-get="{{ firstWALPage . }}" hx-target="#wal-table" hx-swap="outerHTML">first</a>
+      <a class="pg-btn {{ if eq .Page 0 }}disabled{{ end }}" hx-get="{{ prevWALPage . }}" hx-target="#wal-table" hx-swap="outerHTML">prev</a>
+      <span class="pg-btn pg-active">{{ add .Page 1 }} / {{ .TotalPages }}</span>
+      <a class="pg-btn {{ if not .NextCursor }}disabled{{ end }}" hx-get="{{ nextWALPage . }}" hx-target="#wal-table" hx-swap="outerHTML">next</a>
     </div>
   </div>
   {{ end }}
@@ -902,6 +1000,23 @@ const templates = `
 
 {{ define "backups-table" }}
 <div class="module" id="backups-table" hx-get="/ui/fragments/backups-table?receiver={{ .SelectedIndex }}" hx-trigger="every 15s" hx-swap="outerHTML">
+  {{ with runningBackup . }}
+  <div class="backup-run">
+    <div class="backup-run-head">
+      <span><span class="badge badge-amber">running</span> {{ .Source }} since {{ if .StartedAt }}{{ fmtShortTime .StartedAt }}{{ else }}-{{ end }}</span>
+      <strong>{{ if and .Progress .Progress.BytesTotal }}{{ printf "%.1f" .Progress.Percent }}%{{ else }}-{{ end }}</strong>
+    </div>
+    <div class="progress-track"><div class="progress-fill" style="{{ progressWidth .Progress }}"></div></div>
+    {{ with .Progress }}
+    <div class="backup-run-meta">
+      <span>{{ fmtBytes .BytesDone }} of {{ if .BytesTotal }}~{{ fmtBytes .BytesTotal }}{{ else }}?{{ end }}</span>
+      <span>{{ fmtBytes (int64 .BytesPerSecond) }}/s</span>
+      <span>eta {{ fmtETA .ETASeconds }}</span>
+      <span>{{ if .Tablespace }}tablespace {{ .Tablespace }}{{ else }}data directory{{ end }}</span>
+    </div>
+    {{ end }}
+  </div>
+  {{ end }}
   <div class="module-header"><h2>Backup Registry</h2><span class="module-code">{{ len .Snapshot.Backups }} backups</span></div>
   <div class="module-body no-pad">
     <table class="table">
@@ -910,7 +1025,9 @@ const templates = `
         {{ if eq (len .Snapshot.Backups) 0 }}<tr><td colspan="7"><div class="empty">no backups found</div></td></tr>{{ end }}
         {{ range .Snapshot.Backups }}
         <tr>
-          <td class="mono">{{ .Label }}</td>
+          <td class="mono">{{ .Label }}{{ if .Pinned }} <span class="badge badge-blue" title="kept by retention">pinned</span>{{ end }}
+            {{ if .Annotations }}<div class="backup-annotations">{{ range $k, $v := .Annotations }}<span class="badge badge-muted">{{ $k }}={{ $v }}</span>{{ end }}</div>{{ end }}
+          </td>
           <td class="mono muted">{{ fmtTime .Started }}</td>
           <td class="mono">{{ duration .Started .Finished }}</td>
           <td class="mono">{{ fmtGB .SizeGB }}</td>
@@ -964,6 +1081,7 @@ const templates = `
       <div class="kv-row"><span>GET /api/v1/brief-config</span><strong><span class="badge badge-green">live</span></strong></div>
       <div class="kv-row"><span>GET /api/v1/wals</span><strong><span class="badge badge-amber">optional</span></strong></div>
       <div class="kv-row"><span>GET /api/v1/backups</span><strong><span class="badge badge-amber">optional</span></strong></div>
+      <div class="kv-row"><span>GET /api/v1/basebackup/status</span><strong><span class="badge badge-amber">optional</span></strong></div>
       <div class="kv-row"><span>GET /healthz</span><strong><span class="badge badge-blue">health</span></strong></div>
     </div>
   </section>